@@ -21,6 +21,7 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -28,12 +29,14 @@ import (
 	"time"
 
 	innerMD "github.com/apache/rocketmq-clients/golang/v5/metadata"
-	"github.com/apache/rocketmq-clients/golang/v5/pkg/ticker"
 	"github.com/apache/rocketmq-clients/golang/v5/pkg/utils"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 	"github.com/google/uuid"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/proto"
 )
@@ -102,7 +105,7 @@ func (cs *defaultClientSession) _execute_server_telemetry_command(command *v2.Te
 
 func (cs *defaultClientSession) startUp() {
 	cs.cli.log.Infof("defaultClientSession is startUp! endpoints=%v", cs.endpoints)
-	go func() {
+	cs.cli.goAsync(func() {
 		for {
 			select {
 			case <-cs.cli.done:
@@ -147,7 +150,7 @@ func (cs *defaultClientSession) startUp() {
 			}
 			cs._execute_server_telemetry_command(response)
 		}
-	}()
+	})
 }
 func (cs *defaultClientSession) handleTelemetryCommand(response *v2.TelemetryCommand) error {
 	command := response.GetCommand()
@@ -220,7 +223,9 @@ type defaultClient struct {
 	initTopics                    []string
 	settings                      ClientSettings
 	accessPoint                   *v2.Endpoints
+	accessPointLock               sync.RWMutex
 	router                        sync.Map
+	heartbeatStatuses             sync.Map
 	clientID                      string
 	clientManager                 ClientManager
 	done                          chan struct{}
@@ -234,56 +239,102 @@ type defaultClient struct {
 	clientImpl                    isClient
 	ReceiveReconnect              bool
 	notifyUnsubscribeLiteFunc     func(*v2.NotifyUnsubscribeLiteCommand)
+	// failFastOnNoRoute skips retrying the route lookup of topics which are not found.
+	failFastOnNoRoute bool
+	// goroutines is the number of goroutines started by goAsync which are still running.
+	goroutines atomic.Int64
+	// sql92Support is the FeatureSupport of SQL92 filter expressions told by brokers, see CompatInfo.
+	sql92Support atomic.Int32
 }
 
 var NewClient = func(config *Config, opts ...ClientOption) (Client, error) {
-	endpoints, err := utils.ParseTarget(config.Endpoint)
-	if err != nil {
-		return nil, err
-	}
 	cli := &defaultClient{
 		config:                        config,
 		opts:                          defaultNSOptions,
 		clientID:                      utils.GenClientID(),
-		accessPoint:                   endpoints,
 		messageInterceptors:           make([]MessageInterceptor, 0),
 		endpointsTelemetryClientTable: make(map[string]*defaultClientSession),
 		on:                            *atomic.NewBool(true),
 		inited:                        *atomic.NewBool(false),
 	}
-	cli.log = sugarBaseLogger.With("client_id", cli.clientID)
+	cli.log = sugarBaseLogger.With(logFieldClientID, cli.clientID)
 	for _, opt := range opts {
 		opt.apply(&cli.opts)
 	}
+	if err := cli.opts.checkConnectionPool(); err != nil {
+		return nil, err
+	}
+	if err := cli.resolveAccessPoint(context.Background()); err != nil {
+		return nil, err
+	}
 	cli.done = make(chan struct{}, 1)
-	cli.clientMeterProvider = NewDefaultClientMeterProvider(cli)
+	cli.clientMeterProvider = NewDefaultClientMeterProvider(cli, cli.opts.meterOptions...)
 	return cli, nil
 }
 
 var NewClientConcrete = func(config *Config, opts ...ClientOption) (*defaultClient, error) {
-	endpoints, err := utils.ParseTarget(config.Endpoint)
-	if err != nil {
-		return nil, err
-	}
 	cli := &defaultClient{
 		config:                        config,
 		opts:                          defaultNSOptions,
 		clientID:                      utils.GenClientID(),
-		accessPoint:                   endpoints,
 		messageInterceptors:           make([]MessageInterceptor, 0),
 		endpointsTelemetryClientTable: make(map[string]*defaultClientSession),
 		on:                            *atomic.NewBool(true),
 		clientManager:                 &MockClientManager{},
 	}
-	cli.log = sugarBaseLogger.With("client_id", cli.clientID)
+	cli.log = sugarBaseLogger.With(logFieldClientID, cli.clientID)
 	for _, opt := range opts {
 		opt.apply(&cli.opts)
 	}
+	if err := cli.opts.checkConnectionPool(); err != nil {
+		return nil, err
+	}
+	if err := cli.resolveAccessPoint(context.Background()); err != nil {
+		return nil, err
+	}
 	cli.done = make(chan struct{}, 1)
-	cli.clientMeterProvider = NewDefaultClientMeterProvider(cli)
+	cli.clientMeterProvider = NewDefaultClientMeterProvider(cli, cli.opts.meterOptions...)
 	return cli, nil
 }
 
+func (cli *defaultClient) getAccessPoint() *v2.Endpoints {
+	cli.accessPointLock.RLock()
+	defer cli.accessPointLock.RUnlock()
+	return cli.accessPoint
+}
+
+// resolveAccessPoint parses Config.Endpoint, or resolves it by the EndpointResolver if there is one.
+func (cli *defaultClient) resolveAccessPoint(ctx context.Context) error {
+	var endpoints *v2.Endpoints
+	var err error
+	if cli.opts.endpointResolver == nil {
+		if problems := utils.ValidateTarget(cli.config.Endpoint); len(problems) > 0 {
+			return &ErrInvalidEndpoint{Endpoint: cli.config.Endpoint, Problems: problems}
+		}
+		endpoints, err = utils.ParseTarget(cli.config.Endpoint)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, cli.opts.timeout)
+		defer cancel()
+		endpoints, err = cli.opts.endpointResolver.Resolve(ctx, cli.config.Endpoint)
+		if err == nil && len(endpoints.GetAddresses()) == 0 {
+			err = fmt.Errorf("no address is resolved")
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to resolve endpoint=%s, err=%w", cli.config.Endpoint, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	cli.accessPointLock.Lock()
+	defer cli.accessPointLock.Unlock()
+	if cli.accessPoint != nil && !utils.CompareEndpoints(cli.accessPoint, endpoints) {
+		cli.log.Infof("access point is changed, old=%v, new=%v", cli.accessPoint, endpoints)
+	}
+	cli.accessPoint = endpoints
+	return nil
+}
+
 func (cli *defaultClient) GetClientID() string {
 	return cli.clientID
 }
@@ -347,7 +398,7 @@ func (cli *defaultClient) getMessageQueues(ctx context.Context, topic string) ([
 			return ret, nil
 		}
 	}
-	route, err := cli.queryRoute(ctx, topic, cli.opts.timeout)
+	route, err := cli.queryRouteWithRetry(ctx, topic)
 	if err != nil {
 		return nil, err
 	}
@@ -371,31 +422,64 @@ func (cli *defaultClient) getMessageQueues(ctx context.Context, topic string) ([
 
 func (cli *defaultClient) queryRoute(ctx context.Context, topic string, duration time.Duration) ([]*v2.MessageQueue, error) {
 	ctx = cli.Sign(ctx)
-	response, err := cli.clientManager.QueryRoute(ctx, cli.accessPoint, cli.getQueryRouteRequest(topic), duration)
+	response, err := cli.clientManager.QueryRoute(ctx, cli.getAccessPoint(), cli.getQueryRouteRequest(topic), duration)
 	if err != nil {
 		return nil, err
 	}
 	if response.GetStatus().GetCode() != v2.Code_OK {
-		return nil, &ErrRpcStatus{
+		err = &ErrRpcStatus{
 			Code:    int32(response.Status.GetCode()),
 			Message: response.GetStatus().GetMessage(),
 		}
+		if response.GetStatus().GetCode() == v2.Code_TOPIC_NOT_FOUND {
+			return nil, &ErrTopicNotFound{Topic: topic, Err: err}
+		}
+		return nil, err
 	}
 
 	if len(response.GetMessageQueues()) == 0 {
 		cli.log.Errorf("queryRoute result has no messageQueue, requestId=%s", utils.GetRequestID(ctx))
-		return nil, errors.New("rocketmq: no available brokers")
+		return nil, &ErrTopicNotFound{Topic: topic, Err: errors.New("rocketmq: no available brokers")}
 	}
 	return response.GetMessageQueues(), nil
 }
 
+// queryRouteWithRetry queries the route of topic at most routeMaxAttempts times, ErrRouteUnavailable is returned
+// if all attempts failed.
+func (cli *defaultClient) queryRouteWithRetry(ctx context.Context, topic string) ([]*v2.MessageQueue, error) {
+	maxAttempts := cli.opts.routeMaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		route, err := cli.queryRoute(ctx, topic, cli.opts.timeout)
+		if err == nil {
+			return route, nil
+		}
+		var notFound *ErrTopicNotFound
+		if cli.failFastOnNoRoute && errors.As(err, &notFound) {
+			return nil, err
+		}
+		if attempt >= maxAttempts {
+			return nil, &ErrRouteUnavailable{Topic: topic, Attempts: attempt, Err: err}
+		}
+		cli.log.Warnw("failed to query route, would retry later", logFieldTopic, topic, "attempt", attempt,
+			"maxAttempts", maxAttempts, logFieldErrorCode, errorCodeOf(err), logFieldError, err)
+		select {
+		case <-ctx.Done():
+			return nil, &ErrRouteUnavailable{Topic: topic, Attempts: attempt, Err: ctx.Err()}
+		case <-time.After(cli.opts.routeRetryBackoff):
+		}
+	}
+}
+
 func (cli *defaultClient) getQueryRouteRequest(topic string) *v2.QueryRouteRequest {
 	return &v2.QueryRouteRequest{
 		Topic: &v2.Resource{
 			Name:              topic,
 			ResourceNamespace: cli.config.NameSpace,
 		},
-		Endpoints: cli.accessPoint,
+		Endpoints: cli.getAccessPoint(),
 	}
 }
 
@@ -432,7 +516,7 @@ func (cli *defaultClient) getSettingsCommand() *v2.TelemetryCommand {
 
 func (cli *defaultClient) queryAssignments(ctx context.Context, topic string, group string, duration time.Duration) (*[]*v2.Assignment, error) {
 	ctx = cli.Sign(ctx)
-	response, err := cli.clientManager.QueryAssignments(ctx, cli.accessPoint, cli.getQueryAssignmentRequest(topic, group), duration)
+	response, err := cli.clientManager.QueryAssignments(ctx, cli.getAccessPoint(), cli.getQueryAssignmentRequest(topic, group), duration)
 	if err != nil {
 		return nil, err
 	}
@@ -456,7 +540,7 @@ func (cli *defaultClient) getQueryAssignmentRequest(topic string, group string)
 			Name:              group,
 			ResourceNamespace: cli.config.NameSpace,
 		},
-		Endpoints: cli.accessPoint,
+		Endpoints: cli.getAccessPoint(),
 	}
 }
 
@@ -466,7 +550,9 @@ func (cli *defaultClient) doHeartbeat(target string, request *v2.HeartbeatReques
 	if err != nil {
 		return fmt.Errorf("failed to send heartbeat, err=%v", err)
 	}
+	startTime := defaultClock.Now()
 	resp, err := cli.clientManager.HeartBeat(ctx, endpoints, request, cli.settings.GetRequestTimeout())
+	cli.recordHeartbeat(target, defaultClock.Since(startTime), err != nil || resp.Status.GetCode() != v2.Code_OK)
 	if err != nil {
 		return fmt.Errorf("failed to send heartbeat, endpoints=%v, err=%v, requestId=%s", endpoints, err, utils.GetRequestID(ctx))
 	}
@@ -490,14 +576,65 @@ func (cli *defaultClient) doHeartbeat(target string, request *v2.HeartbeatReques
 	return nil
 }
 
+// recordHeartbeat records the latency of heartbeat to target, and counts it if failed.
+func (cli *defaultClient) recordHeartbeat(target string, duration time.Duration, failed bool) {
+	if !cli.clientMeterProvider.isEnabled() {
+		return
+	}
+	measurements := []stats.Measurement{HeartbeatMLatencyMs.M(duration.Milliseconds())}
+	if failed {
+		measurements = append(measurements, HeartbeatFailuresM.M(1))
+	}
+	err := stats.RecordWithTags(cli.clientMeterProvider.tagContext(), []tag.Mutator{tag.Insert(clientIdTag, cli.clientID), tag.Insert(endpointTag, target)}, measurements...)
+	if err != nil {
+		cli.log.Errorf("failed to record heartbeat, endpoints=%s, err=%v", target, err)
+	}
+}
+
 func (cli *defaultClient) Heartbeat() {
 	targets := cli.getTotalTargets()
 	request := cli.clientImpl.wrapHeartbeatRequest()
 	for _, target := range targets {
-		if err := cli.doHeartbeat(target, request); err != nil {
+		err := cli.doHeartbeat(target, request)
+		cli.heartbeatStatuses.Store(target, HeartbeatStatus{Timestamp: time.Now(), Err: err})
+		if err != nil {
 			cli.log.Error(err)
 		}
 	}
+	cli.recordGoroutines()
+}
+
+// goAsync runs f in a new goroutine which is counted by the client until f returns, see ClientState.Goroutines.
+func (cli *defaultClient) goAsync(f func()) {
+	cli.goroutines.Inc()
+	go func() {
+		defer cli.goroutines.Dec()
+		f()
+	}()
+}
+
+// tick runs f every d until the client is stopped, it blocks the caller so that it is run by goAsync to be counted.
+func (cli *defaultClient) tick(f func(), d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-cli.done:
+			return
+		case <-t.C:
+			f()
+		}
+	}
+}
+
+func (cli *defaultClient) recordGoroutines() {
+	if !cli.clientMeterProvider.isEnabled() {
+		return
+	}
+	err := stats.RecordWithTags(cli.clientMeterProvider.tagContext(), []tag.Mutator{tag.Insert(clientIdTag, cli.clientID)}, GoroutinesM.M(cli.goroutines.Load()))
+	if err != nil {
+		cli.log.Errorf("failed to record goroutines, err=%v", err)
+	}
 }
 
 func (cli *defaultClient) trySyncSettings() {
@@ -523,70 +660,50 @@ func (cli *defaultClient) telemeter(target string, command *v2.TelemetryCommand)
 	ctx := cli.Sign(context.Background())
 	err = cs.publish(ctx, command)
 	if err != nil {
-		cli.log.Errorf("telemeter to %s failed, err=%v", target, err)
+		cli.log.Errorw("telemeter failed", logFieldEndpoints, target, logFieldErrorCode, errorCodeOf(err), logFieldError, err)
 		return err
 	}
-	cli.log.Infof("telemeter to %s success", target)
+	cli.log.Infow("telemeter success", logFieldEndpoints, target)
 	return nil
 }
 
 func (cli *defaultClient) startUp() error {
 	cli.log.Infof("begin to start the rocketmq client")
-	cm := NewDefaultClientManager()
-	cm.startUp()
+	var cm *defaultClientManager
+	if cli.opts.connectionPool != nil {
+		cm = cli.opts.connectionPool.acquire()
+	} else {
+		cm = NewDefaultClientManager()
+		cm.rpcClientOptions = append(cm.rpcClientOptions, WithRpcClientConnOption(WithDialOptions(grpc.WithUserAgent(cli.getUserAgent()))))
+		cm.rpcClientOptions = append(cm.rpcClientOptions, WithRpcClientConnOption(cli.opts.connOptions...))
+		cm.rpcClientOptions = append(cm.rpcClientOptions, cli.opts.rpcClientOptions...)
+		cm.startUp()
+	}
 	cm.RegisterClient(cli)
 	cli.clientManager = cm
 
 	for _, topic := range cli.initTopics {
 		_, err := cli.getMessageQueues(context.Background(), topic)
 		if err != nil {
-			return fmt.Errorf("failed to get topic route data result from remote during client startup, clientId=%s, topics=%v, err=%v", cli.clientID, cli.initTopics, err)
+			return fmt.Errorf("failed to get topic route data result from remote during client startup, clientId=%s, topics=%v, err=%w", cli.clientID, cli.initTopics, err)
 		}
 	}
 	f := func() {
-		cli.router.Range(func(k, v interface{}) bool {
-			topic := k.(string)
-			newRoute, err := cli.queryRoute(context.TODO(), topic, cli.opts.timeout)
-			if err != nil {
-				cli.log.Errorf("scheduled queryRoute err=%v", err)
-			}
-			if newRoute == nil && v != nil {
-				cli.log.Info("newRoute is nil, but oldRoute is not. do not update")
-				return true
+		if cli.opts.endpointResolver != nil {
+			if err := cli.resolveAccessPoint(context.TODO()); err != nil {
+				cli.log.Errorf("scheduled resolving of access point failed, keep the old one, err=%v", err)
 			}
+		}
+		cli.router.Range(func(k, v interface{}) bool {
 			var oldRoute []*v2.MessageQueue
 			if v != nil {
 				oldRoute = v.([]*v2.MessageQueue)
 			}
-			if !routeEqual(oldRoute, newRoute) {
-				cli.router.Store(k, newRoute)
-				switch impl := cli.clientImpl.(type) {
-				case *defaultProducer:
-					existing, ok := impl.publishingRouteDataResultCache.Load(topic)
-					if !ok {
-						plb, err := NewPublishingLoadBalancer(newRoute)
-						if err == nil {
-							impl.publishingRouteDataResultCache.Store(topic, plb)
-						}
-					} else {
-						impl.publishingRouteDataResultCache.Store(topic, existing.(PublishingLoadBalancer).CopyAndUpdate(newRoute))
-					}
-				case *defaultSimpleConsumer:
-					existing, ok := impl.subTopicRouteDataResultCache.Load(topic)
-					if !ok {
-						slb, err := NewSubscriptionLoadBalancer(newRoute)
-						if err == nil {
-							impl.subTopicRouteDataResultCache.Store(topic, slb)
-						}
-					} else {
-						impl.subTopicRouteDataResultCache.Store(topic, existing.(SubscriptionLoadBalancer).CopyAndUpdate(newRoute))
-					}
-				}
-			}
+			cli.refreshRoute(k.(string), oldRoute)
 			return true
 		})
 	}
-	ticker.Tick(f, time.Second*30, cli.done)
+	cli.goAsync(func() { cli.tick(f, time.Second*30) })
 
 	// wait syncSettings finish
 	for !cli.inited.Load() {
@@ -597,6 +714,46 @@ func (cli *defaultClient) startUp() error {
 	return nil
 }
 
+// refreshRoute queries the route of topic, and updates the route and the load balancers of topic if it has changed,
+// e.g. once queues are added to the topic, so that they are selected without restarting the client.
+func (cli *defaultClient) refreshRoute(topic string, oldRoute []*v2.MessageQueue) {
+	newRoute, err := cli.queryRoute(context.TODO(), topic, cli.opts.timeout)
+	if err != nil {
+		cli.log.Errorw("scheduled queryRoute failed", logFieldTopic, topic, logFieldErrorCode, errorCodeOf(err), logFieldError, err)
+	}
+	if newRoute == nil && oldRoute != nil {
+		cli.log.Info("newRoute is nil, but oldRoute is not. do not update")
+		return
+	}
+	if routeEqual(oldRoute, newRoute) {
+		return
+	}
+	cli.log.Infow("topic route has changed", logFieldTopic, topic, "old_queues", len(oldRoute), "new_queues", len(newRoute))
+	cli.router.Store(topic, newRoute)
+	switch impl := cli.clientImpl.(type) {
+	case *defaultProducer:
+		existing, ok := impl.publishingRouteDataResultCache.Load(topic)
+		if !ok {
+			plb, err := impl.newPublishingLoadBalancer(newRoute)
+			if err == nil {
+				impl.publishingRouteDataResultCache.Store(topic, plb)
+			}
+		} else {
+			impl.publishingRouteDataResultCache.Store(topic, existing.(PublishingLoadBalancer).CopyAndUpdate(newRoute))
+		}
+	case *defaultSimpleConsumer:
+		existing, ok := impl.subTopicRouteDataResultCache.Load(topic)
+		if !ok {
+			slb, err := NewSubscriptionLoadBalancer(newRoute)
+			if err == nil {
+				impl.subTopicRouteDataResultCache.Store(topic, slb)
+			}
+		} else {
+			impl.subTopicRouteDataResultCache.Store(topic, existing.(SubscriptionLoadBalancer).CopyAndUpdate(newRoute))
+		}
+	}
+}
+
 func routeEqual(old, new []*v2.MessageQueue) bool {
 	if len(old) != len(new) {
 		return false
@@ -627,14 +784,29 @@ func (cli *defaultClient) GracefulStop() error {
 	}
 	cli.notifyClientTermination()
 	cli.clientManager.UnRegisterClient(cli)
+	if cli.opts.connectionPool != nil {
+		cli.opts.connectionPool.release()
+	}
 	cli.done <- struct{}{}
 	close(cli.done)
-	cli.clientMeterProvider.Reset(&v2.Metric{
-		On: false,
-	})
+	cli.clientMeterProvider.flushOnStop()
+	cli.clientMeterProvider.shutdown()
 	return nil
 }
 
+func (cli *defaultClient) getUserAgent() string {
+	return globalUserAgent.format(cli.opts.applicationName)
+}
+
+// getTLSConfig returns the tls.Config of connections after applying the conn options of client.
+func (cli *defaultClient) getTLSConfig() *tls.Config {
+	opts := defaultConnOptions
+	for _, opt := range cli.opts.connOptions {
+		opt.apply(&opts)
+	}
+	return opts.TLS
+}
+
 func (cli *defaultClient) isRunning() bool {
 	return cli.on.Load()
 }
@@ -741,7 +913,7 @@ func (cli *defaultClient) onNotifyUnsubscribeLiteCommand(endpoints *v2.Endpoints
 
 func (cli *defaultClient) onPrintThreadStackTraceCommand(endpoints *v2.Endpoints, command *v2.PrintThreadStackTraceCommand) {
 	nonce := command.GetNonce()
-	go func(nonce string) {
+	cli.goAsync(func() {
 		// TODO get stack
 		stackTrace := utils.DumpStacks()
 		status := &v2.Status{
@@ -761,7 +933,7 @@ func (cli *defaultClient) onPrintThreadStackTraceCommand(endpoints *v2.Endpoints
 			target := utils.ParseAddress(address)
 			cli.telemeter(target, req)
 		}
-	}(nonce)
+	})
 }
 func (cli *defaultClient) onReconnectEndpointsCommand(endpoints *v2.Endpoints, command *v2.ReconnectEndpointsCommand) {
 	cli.ReceiveReconnect = true
@@ -26,6 +26,10 @@ import (
 	"github.com/apache/rocketmq-clients/golang/v5/pkg/ticker"
 	"github.com/apache/rocketmq-clients/golang/v5/pkg/utils"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -45,6 +49,9 @@ type ClientManager interface {
 	ChangeInvisibleDuration(ctx context.Context, endpoints *v2.Endpoints, request *v2.ChangeInvisibleDurationRequest, duration time.Duration) (*v2.ChangeInvisibleDurationResponse, error)
 	ForwardMessageToDeadLetterQueue(ctx context.Context, endpoints *v2.Endpoints, request *v2.ForwardMessageToDeadLetterQueueRequest, duration time.Duration) (*v2.ForwardMessageToDeadLetterQueueResponse, error)
 	SyncLiteSubscription(ctx context.Context, endpoints *v2.Endpoints, request *v2.SyncLiteSubscriptionRequest, duration time.Duration) (*v2.SyncLiteSubscriptionResponse, error)
+	QueryOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.QueryOffsetRequest, duration time.Duration) (*v2.QueryOffsetResponse, error)
+	UpdateOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.UpdateOffsetRequest, duration time.Duration) (*v2.UpdateOffsetResponse, error)
+	GetOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.GetOffsetRequest, duration time.Duration) (*v2.GetOffsetResponse, error)
 }
 
 type clientManagerOptions struct {
@@ -80,23 +87,74 @@ var defaultClientManagerOptions = clientManagerOptions{
 }
 
 type defaultClientManager struct {
+	id                 string
 	rpcClientTable     map[string]RpcClient
 	rpcClientTableLock sync.RWMutex
 	clientTable        sync.Map
 	done               chan struct{}
 	opts               clientManagerOptions
+	rpcClientOptions   []RpcClientOption
 }
 
 var _ = ClientManager(&defaultClientManager{})
 
+// clientManagerIndex numbers the client managers of the process.
+var clientManagerIndex = atomic.NewInt64(0)
+
 var NewDefaultClientManager = func() *defaultClientManager {
 	return &defaultClientManager{
+		id:             fmt.Sprintf("client-manager-%d", clientManagerIndex.Inc()),
 		rpcClientTable: make(map[string]RpcClient),
 		done:           make(chan struct{}),
 		opts:           defaultClientManagerOptions,
 	}
 }
 
+// SharedConnectionPool shares the connections to brokers of a client manager among clients of the same process,
+// see WithSharedConnectionPool. Connections are closed once the last client using the pool is stopped, and
+// reopened when a client starts again.
+type SharedConnectionPool struct {
+	rpcClientOptions []RpcClientOption
+
+	lock sync.Mutex
+	cm   *defaultClientManager
+	refs int
+}
+
+// NewSharedConnectionPool creates a SharedConnectionPool whose connections are created with opts, instead of the
+// options of the clients using it.
+func NewSharedConnectionPool(opts ...RpcClientOption) *SharedConnectionPool {
+	return &SharedConnectionPool{
+		rpcClientOptions: opts,
+	}
+}
+
+func (pool *SharedConnectionPool) acquire() *defaultClientManager {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	if pool.refs == 0 {
+		pool.cm = NewDefaultClientManager()
+		pool.cm.rpcClientOptions = append(pool.cm.rpcClientOptions, WithRpcClientConnOption(WithDialOptions(grpc.WithUserAgent(globalUserAgent.format("")))))
+		pool.cm.rpcClientOptions = append(pool.cm.rpcClientOptions, pool.rpcClientOptions...)
+		pool.cm.startUp()
+	}
+	pool.refs++
+	return pool.cm
+}
+
+func (pool *SharedConnectionPool) release() {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	if pool.refs == 0 {
+		return
+	}
+	pool.refs--
+	if pool.refs == 0 {
+		pool.cm.shutdown()
+		pool.cm = nil
+	}
+}
+
 func (cm *defaultClientManager) RegisterClient(client Client) {
 	cm.clientTable.Store(client.GetClientID(), client)
 }
@@ -137,6 +195,17 @@ func (cm *defaultClientManager) startUp() {
 func (cm *defaultClientManager) deleteRpcClient(rpcClient RpcClient) {
 	delete(cm.rpcClientTable, rpcClient.GetTarget())
 	rpcClient.GracefulStop()
+	cm.recordActiveConnections()
+}
+
+// recordActiveConnections must be called with rpcClientTableLock held.
+// It is recorded even if metrics are off, so that the gauge is accurate once they are turned on. Connections are shared
+// by the clients registered, so they are recorded once per client manager rather than per client.
+func (cm *defaultClientManager) recordActiveConnections() {
+	err := stats.RecordWithTags(context.Background(), []tag.Mutator{tag.Insert(clientManagerTag, cm.id)}, ActiveConnectionsM.M(int64(len(cm.rpcClientTable))))
+	if err != nil {
+		sugarBaseLogger.Errorf("failed to record active connections, clientManager=%s, err=%v", cm.id, err)
+	}
 }
 
 func (cm *defaultClientManager) clearIdleRpcClients() {
@@ -171,7 +240,6 @@ func (cm *defaultClientManager) syncSettings() {
 }
 func (cm *defaultClientManager) shutdown() {
 	sugarBaseLogger.Info("begin to shutdown the client manager")
-	cm.done <- struct{}{}
 	close(cm.done)
 	cm.cleanRpcClient()
 	sugarBaseLogger.Info("shutdown the client manager successfully")
@@ -211,11 +279,12 @@ func (cm *defaultClientManager) getRpcClient(endpoints *v2.Endpoints) (RpcClient
 			return ret, nil
 		}
 	}
-	rpcClient, err := NewRpcClient(target)
+	rpcClient, err := NewRpcClient(target, cm.rpcClientOptions...)
 	if err != nil {
 		return nil, err
 	}
 	cm.rpcClientTable[target] = rpcClient
+	cm.recordActiveConnections()
 	return rpcClient, nil
 }
 func (cm *defaultClientManager) handleGrpcError(rpcClient RpcClient, err error) {
@@ -361,3 +430,39 @@ func (cm *defaultClientManager) SyncLiteSubscription(ctx context.Context, endpoi
 	cm.handleGrpcError(rpcClient, err)
 	return ret, err
 }
+func (cm *defaultClientManager) QueryOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.QueryOffsetRequest,
+	duration time.Duration) (*v2.QueryOffsetResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	rpcClient, err := cm.getRpcClient(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := rpcClient.QueryOffset(ctx, request)
+	cm.handleGrpcError(rpcClient, err)
+	return ret, err
+}
+func (cm *defaultClientManager) UpdateOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.UpdateOffsetRequest,
+	duration time.Duration) (*v2.UpdateOffsetResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	rpcClient, err := cm.getRpcClient(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := rpcClient.UpdateOffset(ctx, request)
+	cm.handleGrpcError(rpcClient, err)
+	return ret, err
+}
+func (cm *defaultClientManager) GetOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.GetOffsetRequest,
+	duration time.Duration) (*v2.GetOffsetResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	rpcClient, err := cm.getRpcClient(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := rpcClient.GetOffset(ctx, request)
+	cm.handleGrpcError(rpcClient, err)
+	return ret, err
+}
@@ -154,6 +154,36 @@ func (mr *MockClientManagerMockRecorder) QueryAssignments(ctx, endpoints, reques
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryAssignments", reflect.TypeOf((*MockClientManager)(nil).QueryAssignments), ctx, endpoints, request, duration)
 }
 
+// GetOffset mocks base method.
+func (m *MockClientManager) GetOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.GetOffsetRequest, duration time.Duration) (*v2.GetOffsetResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOffset", ctx, endpoints, request, duration)
+	ret0, _ := ret[0].(*v2.GetOffsetResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOffset indicates an expected call of GetOffset.
+func (mr *MockClientManagerMockRecorder) GetOffset(ctx, endpoints, request, duration interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOffset", reflect.TypeOf((*MockClientManager)(nil).GetOffset), ctx, endpoints, request, duration)
+}
+
+// QueryOffset mocks base method.
+func (m *MockClientManager) QueryOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.QueryOffsetRequest, duration time.Duration) (*v2.QueryOffsetResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryOffset", ctx, endpoints, request, duration)
+	ret0, _ := ret[0].(*v2.QueryOffsetResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryOffset indicates an expected call of QueryOffset.
+func (mr *MockClientManagerMockRecorder) QueryOffset(ctx, endpoints, request, duration interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryOffset", reflect.TypeOf((*MockClientManager)(nil).QueryOffset), ctx, endpoints, request, duration)
+}
+
 // QueryRoute mocks base method.
 func (m *MockClientManager) QueryRoute(ctx context.Context, endpoints *v2.Endpoints, request *v2.QueryRouteRequest, duration time.Duration) (*v2.QueryRouteResponse, error) {
 	m.ctrl.T.Helper()
@@ -247,3 +277,18 @@ func (mr *MockClientManagerMockRecorder) UnRegisterClient(client interface{}) *g
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnRegisterClient", reflect.TypeOf((*MockClientManager)(nil).UnRegisterClient), client)
 }
+
+// UpdateOffset mocks base method.
+func (m *MockClientManager) UpdateOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.UpdateOffsetRequest, duration time.Duration) (*v2.UpdateOffsetResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOffset", ctx, endpoints, request, duration)
+	ret0, _ := ret[0].(*v2.UpdateOffsetResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateOffset indicates an expected call of UpdateOffset.
+func (mr *MockClientManagerMockRecorder) UpdateOffset(ctx, endpoints, request, duration interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOffset", reflect.TypeOf((*MockClientManager)(nil).UpdateOffset), ctx, endpoints, request, duration)
+}
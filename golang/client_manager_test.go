@@ -28,6 +28,7 @@ import (
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 	gomock "github.com/golang/mock/gomock"
 	"github.com/prashantv/gostub"
+	"go.opencensus.io/stats/view"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -153,6 +154,31 @@ func TestCMRegisterClient(t *testing.T) {
 	}
 }
 
+func TestCMSharedConnectionPool(t *testing.T) {
+	pool := NewSharedConnectionPool(WithHeartbeatDuration(time.Minute))
+	cm1 := pool.acquire()
+	cm2 := pool.acquire()
+	if cm1 != cm2 {
+		t.Fatal("expected clients of the pool to share the client manager")
+	}
+	pool.release()
+	select {
+	case <-cm1.done:
+		t.Fatal("expected the client manager to be kept while it is still in use")
+	default:
+	}
+	pool.release()
+	select {
+	case <-cm1.done:
+	default:
+		t.Error("expected the client manager to be shutdown once the last client released it")
+	}
+	if cm3 := pool.acquire(); cm3 == cm1 {
+		t.Error("expected a new client manager to be started after shutdown")
+	}
+	pool.release()
+}
+
 func TestCMUnRegisterClient(t *testing.T) {
 	cm := NewDefaultClientManager()
 	cm.startUp()
@@ -384,3 +410,26 @@ func TestCMSyncLiteSubscription(t *testing.T) {
 		t.Error("expected error, got nil")
 	}
 }
+
+func TestCMActiveConnections(t *testing.T) {
+	cm := NewDefaultClientManager()
+	cm.RegisterClient(MOCK_CLIENT)
+	defer cm.UnRegisterClient(MOCK_CLIENT)
+
+	if _, err := cm.getRpcClient(fakeEndpoints()); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := view.RetrieveData(ActiveConnectionsView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if len(row.Tags) == 1 && row.Tags[0].Value == cm.id {
+			if value := row.Data.(*view.LastValueData).Value; value != 1 {
+				t.Errorf("expected 1 active connection, got %v", value)
+			}
+			return
+		}
+	}
+	t.Errorf("active connections of client manager %s are not recorded", cm.id)
+}
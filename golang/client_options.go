@@ -18,6 +18,7 @@
 package golang
 
 import (
+	"fmt"
 	"time"
 
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
@@ -28,11 +29,20 @@ type clientOptions struct {
 	clientConnFunc   ClientConnFunc
 	connOptions      []ConnOption
 	rpcClientOptions []RpcClientOption
+	meterOptions     []ClientMeterProviderOption
+	applicationName  string
+	connectionPool   *SharedConnectionPool
+	endpointResolver EndpointResolver
+
+	routeMaxAttempts  int
+	routeRetryBackoff time.Duration
 }
 
 var defaultNSOptions = clientOptions{
-	timeout:        time.Millisecond * 3000,
-	clientConnFunc: NewClientConn,
+	timeout:           time.Millisecond * 3000,
+	clientConnFunc:    NewClientConn,
+	routeMaxAttempts:  1,
+	routeRetryBackoff: time.Second,
 }
 
 // A ClientOption sets options such as timeout, etc.
@@ -64,6 +74,22 @@ func WithQueryRouteTimeout(d time.Duration) ClientOption {
 	})
 }
 
+// WithRouteMaxAttempts returns a Option that sets max attempts of route lookup before ErrRouteUnavailable is returned.
+// Default is 1.
+func WithRouteMaxAttempts(n int) ClientOption {
+	return newFuncNSOption(func(o *clientOptions) {
+		o.routeMaxAttempts = n
+	})
+}
+
+// WithRouteRetryBackoff returns a Option that sets the delay between attempts of route lookup.
+// Default is 1s.
+func WithRouteRetryBackoff(d time.Duration) ClientOption {
+	return newFuncNSOption(func(o *clientOptions) {
+		o.routeRetryBackoff = d
+	})
+}
+
 // WithClientConnFunc returns a Option that sets ClientConnFunc for nameserver.
 // Default is NewClientConn.
 func WithClientConnFunc(f ClientConnFunc) ClientOption {
@@ -86,6 +112,50 @@ func WithRpcClientOptions(opts ...RpcClientOption) ClientOption {
 	})
 }
 
+// WithClientMeterProviderOptions returns a Option that sets ClientMeterProviderOption for client meter provider.
+func WithClientMeterProviderOptions(opts ...ClientMeterProviderOption) ClientOption {
+	return newFuncNSOption(func(o *clientOptions) {
+		o.meterOptions = append(o.meterOptions, opts...)
+	})
+}
+
+// WithApplicationName returns a Option that sets the application name appended to the user agent
+// of connections to brokers and the metric exporter.
+func WithApplicationName(name string) ClientOption {
+	return newFuncNSOption(func(o *clientOptions) {
+		o.applicationName = name
+	})
+}
+
+// WithSharedConnectionPool returns a Option that makes the client use the connections of pool, which are shared
+// with other clients using the same pool instead of being opened per client. It can not be used along with the
+// options of connections, which are set by NewSharedConnectionPool instead.
+func WithSharedConnectionPool(pool *SharedConnectionPool) ClientOption {
+	return newFuncNSOption(func(o *clientOptions) {
+		o.connectionPool = pool
+	})
+}
+
+// checkConnectionPool rejects the options of connections along with WithSharedConnectionPool, which would be ignored
+// by the shared connections.
+func (o *clientOptions) checkConnectionPool() error {
+	if o.connectionPool == nil {
+		return nil
+	}
+	if o.applicationName != "" || len(o.connOptions) > 0 || len(o.rpcClientOptions) > 0 {
+		return fmt.Errorf("WithApplicationName, WithConnOptions and WithRpcClientOptions can not be used along with WithSharedConnectionPool, set the options of connections by NewSharedConnectionPool instead")
+	}
+	return nil
+}
+
+// WithEndpointResolver returns a Option that resolves Config.Endpoint by resolver instead of parsing it as
+// addresses, the resolved endpoints are refreshed along with the routes.
+func WithEndpointResolver(resolver EndpointResolver) ClientOption {
+	return newFuncNSOption(func(o *clientOptions) {
+		o.endpointResolver = resolver
+	})
+}
+
 type ClientSettings interface {
 	GetClientID() string
 	GetClientType() v2.ClientType
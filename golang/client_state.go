@@ -0,0 +1,80 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"time"
+
+	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+)
+
+// HeartbeatStatus is the result of the latest heartbeat sent to an endpoint.
+type HeartbeatStatus struct {
+	Timestamp time.Time
+	Err       error
+}
+
+// ClientState is a snapshot of the internal state of a client, intended for troubleshooting.
+type ClientState struct {
+	ClientID      string
+	ClientType    v2.ClientType
+	Running       bool
+	MetricEnabled bool
+	// Endpoints are the endpoints which the client holds a telemetry session with.
+	Endpoints     []string
+	Routes        map[string][]*v2.MessageQueue
+	Subscriptions map[string]*FilterExpression
+	Heartbeats    map[string]HeartbeatStatus
+
+	InflightReceiveRequests int64
+	CachedMessagesCount     int64
+	CachedMessagesBytes     int64
+	// Goroutines is the number of goroutines started by the client which are still running, including requests,
+	// callbacks, transaction checkers, the telemetry session of each endpoint and scheduled tasks. Workers of the
+	// consumption pool, see WithPushConsumptionThreadCount, are not counted.
+	Goroutines int64
+}
+
+func (cli *defaultClient) inspect() ClientState {
+	state := ClientState{
+		ClientID:      cli.clientID,
+		Running:       cli.isRunning(),
+		MetricEnabled: cli.clientMeterProvider.isEnabled(),
+		Endpoints:     make([]string, 0),
+		Routes:        make(map[string][]*v2.MessageQueue),
+		Heartbeats:    make(map[string]HeartbeatStatus),
+		Goroutines:    cli.goroutines.Load(),
+	}
+	if cli.settings != nil {
+		state.ClientType = cli.settings.GetClientType()
+	}
+	cli.endpointsTelemetryClientsLock.RLock()
+	for target := range cli.endpointsTelemetryClientTable {
+		state.Endpoints = append(state.Endpoints, target)
+	}
+	cli.endpointsTelemetryClientsLock.RUnlock()
+	cli.router.Range(func(k, v interface{}) bool {
+		state.Routes[k.(string)] = v.([]*v2.MessageQueue)
+		return true
+	})
+	cli.heartbeatStatuses.Range(func(k, v interface{}) bool {
+		state.Heartbeats[k.(string)] = v.(HeartbeatStatus)
+		return true
+	})
+	return state
+}
@@ -19,18 +19,23 @@ package golang
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/apache/rocketmq-clients/golang/v5/credentials"
+	"github.com/apache/rocketmq-clients/golang/v5/pkg/utils"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 	gomock "github.com/golang/mock/gomock"
 	"github.com/prashantv/gostub"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
 )
 
 func BuildCLient(t *testing.T) *defaultClient {
@@ -344,3 +349,166 @@ func Test_routeEqual(t *testing.T) {
 	assert.Equal(t, false, routeEqual(oldRoute, nil))
 	assert.Equal(t, true, routeEqual(nil, []*v2.MessageQueue{}))
 }
+
+func TestCLIApplicationName(t *testing.T) {
+	cli, err := NewClient(&Config{
+		Endpoint:    fakeAddress,
+		Credentials: &credentials.SessionCredentials{},
+	}, WithApplicationName("order-service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := cli.(*defaultClient)
+	ua := dc.getUserAgent()
+	if !strings.HasPrefix(ua, "rocketmq-client-go/"+globalUserAgent.version) || !strings.HasSuffix(ua, " order-service") {
+		t.Errorf("unexpected user agent %q", ua)
+	}
+	if dc.clientMeterProvider.(*defaultClientMeterProvider).userAgent != ua {
+		t.Error("expected the metric exporter to use the client user agent")
+	}
+
+	stubs := gostub.Stub(&NewRpcClient, func(target string, opts ...RpcClientOption) (RpcClient, error) {
+		rcOpts := defaultRpcClientOptions
+		for _, opt := range opts {
+			opt.apply(&rcOpts)
+		}
+		cOpts := defaultConnOptions
+		for _, opt := range rcOpts.connOptions {
+			opt.apply(&cOpts)
+		}
+		if len(cOpts.DialOptions) == 0 {
+			t.Error("expected the user agent dial option to be passed to the rpc client")
+		}
+		return MOCK_RPC_CLIENT, nil
+	})
+	defer stubs.Reset()
+
+	cm := NewDefaultClientManager()
+	cm.rpcClientOptions = append(cm.rpcClientOptions, WithRpcClientConnOption(WithDialOptions(grpc.WithUserAgent(ua))))
+	if _, err := cm.getRpcClient(fakeEndpoints()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCLITLSConfig(t *testing.T) {
+	cli, err := NewClient(&Config{
+		Endpoint:    fakeAddress,
+		Credentials: &credentials.SessionCredentials{},
+	}, WithConnOptions(WithTLSMinVersion(tls.VersionTLS13), WithTLSMaxVersion(tls.VersionTLS13),
+		WithTLSCipherSuites(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := cli.(*defaultClient)
+	tc := dc.getTLSConfig()
+	if tc.MinVersion != tls.VersionTLS13 || tc.MaxVersion != tls.VersionTLS13 || len(tc.CipherSuites) != 1 {
+		t.Errorf("unexpected tls config, minVersion=%x, maxVersion=%x, cipherSuites=%v", tc.MinVersion, tc.MaxVersion, tc.CipherSuites)
+	}
+	if defaultConnOptions.TLS.MinVersion != 0 {
+		t.Error("expected the default tls config to be left untouched")
+	}
+	if dc.clientMeterProvider.(*defaultClientMeterProvider).tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Error("expected the metric exporter to use the client tls config")
+	}
+}
+
+func TestCLIQueryRouteWithRetry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli, err := NewClientConcrete(&Config{
+		Endpoint:    fakeAddress,
+		Credentials: &credentials.SessionCredentials{},
+	}, WithQueryRouteTimeout(time.Millisecond*500), WithRouteMaxAttempts(3), WithRouteRetryBackoff(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+
+	cm.EXPECT().QueryRoute(gomock.Any(), gomock.Any(), gomock.Any(), time.Millisecond*500).Return(&v2.QueryRouteResponse{
+		Status: &v2.Status{Code: v2.Code_INTERNAL_SERVER_ERROR},
+	}, nil).Times(3)
+	_, err = cli.getMessageQueues(context.TODO(), MOCK_TOPIC)
+	var routeErr *ErrRouteUnavailable
+	if !errors.As(err, &routeErr) || routeErr.Topic != MOCK_TOPIC || routeErr.Attempts != 3 {
+		t.Fatalf("expected ErrRouteUnavailable after 3 attempts, got %v", err)
+	}
+	if rpcErr, ok := AsErrRpcStatus(err); !ok || rpcErr.GetCode() != int32(v2.Code_INTERNAL_SERVER_ERROR) {
+		t.Errorf("expected the last rpc status to be wrapped, got %v", err)
+	}
+
+	cm.EXPECT().QueryRoute(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.QueryRouteResponse{
+		Status: &v2.Status{Code: v2.Code_INTERNAL_SERVER_ERROR},
+	}, nil).Times(1)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if _, err = cli.queryRouteWithRetry(ctx, MOCK_TOPIC); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected retries to stop once context is done, got %v", err)
+	}
+}
+
+func TestCLIEndpointResolver(t *testing.T) {
+	var resolved []*v2.Endpoints
+	resolver := EndpointResolverFunc(func(ctx context.Context, name string) (*v2.Endpoints, error) {
+		if name != "orders-cluster" {
+			return nil, fmt.Errorf("unknown name %s", name)
+		}
+		if len(resolved) == 0 {
+			return nil, nil
+		}
+		endpoints := resolved[0]
+		resolved = resolved[1:]
+		return endpoints, nil
+	})
+	config := &Config{Endpoint: "orders-cluster", Credentials: &credentials.SessionCredentials{}}
+	if _, err := NewClient(config, WithEndpointResolver(resolver)); err == nil {
+		t.Error("expected error when no address is resolved")
+	}
+
+	first, _ := utils.ParseTarget("127.0.0.1:8081")
+	second, _ := utils.ParseTarget("127.0.0.2:8081")
+	resolved = []*v2.Endpoints{first, second}
+	cli, err := NewClient(config, WithEndpointResolver(resolver))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := cli.(*defaultClient)
+	if dc.getAccessPoint() != first || dc.getQueryRouteRequest(MOCK_TOPIC).GetEndpoints() != first {
+		t.Errorf("expected resolved access point, got %v", dc.getAccessPoint())
+	}
+	if err = dc.resolveAccessPoint(context.TODO()); err != nil || dc.getAccessPoint() != second {
+		t.Errorf("expected access point to be refreshed, got %v, err=%v", dc.getAccessPoint(), err)
+	}
+	if err = dc.resolveAccessPoint(context.TODO()); err == nil || dc.getAccessPoint() != second {
+		t.Errorf("expected the old access point to be kept on failure, got %v, err=%v", dc.getAccessPoint(), err)
+	}
+}
+
+func TestCLISharedConnectionPoolOptions(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, Credentials: &credentials.SessionCredentials{}}
+	pool := NewSharedConnectionPool()
+	if _, err := NewClient(config, WithSharedConnectionPool(pool)); err != nil {
+		t.Fatal(err)
+	}
+	for name, opt := range map[string]ClientOption{
+		"application name": WithApplicationName("app"),
+		"conn options":     WithConnOptions(WithTLSConfig(nil)),
+		"rpc options":      WithRpcClientOptions(WithHeartbeatDuration(time.Minute)),
+	} {
+		if _, err := NewClient(config, WithSharedConnectionPool(pool), opt); err == nil {
+			t.Errorf("expected %s to be rejected along with the shared connection pool", name)
+		}
+	}
+}
+
+func TestCLIInvalidEndpoint(t *testing.T) {
+	config := &Config{Endpoint: "127.0.0.1:8081;127.0.0.1;broker name:8081;broker:99999", Credentials: &credentials.SessionCredentials{}}
+	_, err := NewClient(config)
+	var invalid *ErrInvalidEndpoint
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected ErrInvalidEndpoint, got %v", err)
+	}
+	if len(invalid.Problems) != 3 {
+		t.Errorf("expected every bad address to be listed, got %v", invalid.Problems)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProtocolVersion is the version of the gRPC protocol spoken by the client.
+const ProtocolVersion = "v2"
+
+// FeatureSupport tells whether brokers support a feature, see CompatInfo.
+type FeatureSupport int32
+
+const (
+	// FeatureSupport_UNKNOWN means brokers have not told whether the feature is supported.
+	FeatureSupport_UNKNOWN FeatureSupport = iota
+	FeatureSupport_SUPPORTED
+	FeatureSupport_UNSUPPORTED
+)
+
+// CompatInfo is the result of checking the compatibility between the client and brokers.
+// Brokers do not report their versions, so the protocol version of brokers is the one they are found to implement,
+// and features are told by the routes of topics known by the client and the replies of brokers.
+type CompatInfo struct {
+	ClientVersion   string
+	ProtocolVersion string
+	// BrokerProtocolVersion is empty if brokers reject the protocol of the client.
+	BrokerProtocolVersion string
+	// Fifo and Transaction are supported if any topic known by the client accepts the message type, brokers which
+	// do not declare the accepted message types of topics leave them unknown.
+	Fifo        FeatureSupport
+	Transaction FeatureSupport
+	// Sql92 is told by the replies of brokers to receive requests with SQL92 filter expressions, it is unknown until
+	// the client receives messages with them.
+	Sql92 FeatureSupport
+	// TopicMessageTypes are the message types accepted by each topic known by the client.
+	TopicMessageTypes map[string][]v2.MessageType
+	// Mismatches describe the incompatibilities found, which is empty if Compatible.
+	Mismatches []string
+	Compatible bool
+}
+
+// checkCompatibility probes the access point with a heartbeat, and queries the routes of topics known by the client.
+// Errors other than the rejection of the protocol are returned as is.
+func (cli *defaultClient) checkCompatibility(ctx context.Context) (CompatInfo, error) {
+	info := CompatInfo{
+		ClientVersion:     globalUserAgent.version,
+		ProtocolVersion:   ProtocolVersion,
+		Sql92:             FeatureSupport(cli.sql92Support.Load()),
+		TopicMessageTypes: make(map[string][]v2.MessageType),
+	}
+	resp, err := cli.clientManager.HeartBeat(cli.Sign(ctx), cli.getAccessPoint(), cli.clientImpl.wrapHeartbeatRequest(), cli.opts.timeout)
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		info.Mismatches = append(info.Mismatches, fmt.Sprintf("brokers do not implement protocol %s", ProtocolVersion))
+	case err != nil:
+		return info, err
+	case isProtocolRejected(resp.GetStatus().GetCode()):
+		info.Mismatches = append(info.Mismatches, fmt.Sprintf("brokers reject protocol %s, code=%v, message=%s",
+			ProtocolVersion, resp.GetStatus().GetCode(), resp.GetStatus().GetMessage()))
+	case resp.GetStatus().GetCode() != v2.Code_OK:
+		return info, &ErrRpcStatus{
+			Code:    int32(resp.GetStatus().GetCode()),
+			Message: resp.GetStatus().GetMessage(),
+		}
+	default:
+		info.BrokerProtocolVersion = ProtocolVersion
+	}
+
+	topics := make([]string, 0)
+	cli.router.Range(func(k, v interface{}) bool {
+		topics = append(topics, k.(string))
+		return true
+	})
+	for _, topic := range topics {
+		mqs, err := cli.queryRoute(ctx, topic, cli.opts.timeout)
+		var notFound *ErrTopicNotFound
+		if errors.As(err, &notFound) {
+			continue
+		}
+		if err != nil {
+			return info, err
+		}
+		messageTypes := acceptMessageTypesOf(mqs)
+		info.TopicMessageTypes[topic] = messageTypes
+		for _, messageType := range messageTypes {
+			switch messageType {
+			case v2.MessageType_FIFO:
+				info.Fifo = FeatureSupport_SUPPORTED
+			case v2.MessageType_TRANSACTION:
+				info.Transaction = FeatureSupport_SUPPORTED
+			}
+		}
+	}
+	if info.Sql92 == FeatureSupport_UNSUPPORTED {
+		info.Mismatches = append(info.Mismatches, "brokers reject SQL92 filter expressions")
+	}
+	info.Compatible = len(info.Mismatches) == 0
+	return info, nil
+}
+
+func isProtocolRejected(code v2.Code) bool {
+	return code == v2.Code_NOT_IMPLEMENTED || code == v2.Code_VERSION_UNSUPPORTED || code == v2.Code_UNRECOGNIZED_CLIENT_TYPE
+}
+
+// observeReceiveStatus tells the support of SQL92 filter expressions from the reply of brokers to request.
+func (cli *defaultClient) observeReceiveStatus(request *v2.ReceiveMessageRequest, code v2.Code) {
+	if request.GetFilterExpression().GetType() != v2.FilterType_SQL {
+		return
+	}
+	switch code {
+	case v2.Code_OK, v2.Code_MESSAGE_NOT_FOUND:
+		cli.sql92Support.Store(int32(FeatureSupport_SUPPORTED))
+	case v2.Code_NOT_IMPLEMENTED, v2.Code_UNSUPPORTED:
+		cli.sql92Support.Store(int32(FeatureSupport_UNSUPPORTED))
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/apache/rocketmq-clients/golang/v5/pkg/grpc/middleware/zaplog"
 	validator "github.com/go-playground/validator/v10"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 )
 
@@ -98,6 +99,9 @@ var NewClientConn = func(endpoint string, opts ...ConnOption) (ClientConn, error
 		return nil, err
 	}
 	client.conn = conn
+	if client.opts.ConnectivityStateListener != nil {
+		go client.watchConnectivityState(endpoint)
+	}
 
 	return client, nil
 }
@@ -111,6 +115,20 @@ func (c *clientConn) Close() error {
 	return c.conn.Close()
 }
 
+// watchConnectivityState reports the changes of connectivity state to the listener until the connection is closed.
+func (c *clientConn) watchConnectivityState(endpoint string) {
+	state := c.conn.GetState()
+	c.opts.ConnectivityStateListener(endpoint, state)
+	for state != connectivity.Shutdown && c.conn.WaitForStateChange(c.ctx, state) {
+		state = c.conn.GetState()
+		c.opts.ConnectivityStateListener(endpoint, state)
+	}
+	// The context may be canceled before the shutdown is observed.
+	if state != connectivity.Shutdown && c.conn.GetState() == connectivity.Shutdown {
+		c.opts.ConnectivityStateListener(endpoint, connectivity.Shutdown)
+	}
+}
+
 func (c *clientConn) dialSetupOpts(dopts ...grpc.DialOption) (opts []grpc.DialOption, err error) {
 	opts = append(opts, dopts...)
 	if c.creds != nil && EnableSsl {
@@ -122,6 +140,18 @@ func (c *clientConn) dialSetupOpts(dopts ...grpc.DialOption) (opts []grpc.DialOp
 	opts = append(opts, grpc.WithBlock(), grpc.WithChainUnaryInterceptor(
 		zaplog.UnaryClientInterceptor(c.opts.Logger),
 	))
+	if len(c.opts.RpcInterceptors) > 0 {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(rpcInterceptorsUnaryClientInterceptor(c.opts.RpcInterceptors)),
+			grpc.WithChainStreamInterceptor(rpcInterceptorsStreamClientInterceptor(c.opts.RpcInterceptors)),
+		)
+	}
+	if c.opts.RpcTracing {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(traceUnaryClientInterceptor()),
+			grpc.WithChainStreamInterceptor(traceStreamClientInterceptor()),
+		)
+	}
 	return
 }
 
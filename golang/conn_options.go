@@ -27,6 +27,7 @@ import (
 	"github.com/apache/rocketmq-clients/golang/v5/pkg/zaplog"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 type connOptions struct {
@@ -58,6 +59,15 @@ type connOptions struct {
 
 	// Logger is logger
 	Logger *zap.Logger
+
+	// RpcInterceptors are invoked once every RPC completes.
+	RpcInterceptors []RpcInterceptor
+
+	// RpcTracing starts an OpenCensus span around every RPC.
+	RpcTracing bool
+
+	// ConnectivityStateListener is invoked with the endpoint once the connectivity state of connection changes.
+	ConnectivityStateListener func(endpoint string, state connectivity.State)
 }
 
 var defaultConnOptions = connOptions{
@@ -100,6 +110,39 @@ func WithTLSConfig(tc *tls.Config) ConnOption {
 	})
 }
 
+// WithTLSMinVersion returns a ConnOption that sets the minimum TLS version, e.g. tls.VersionTLS13.
+func WithTLSMinVersion(version uint16) ConnOption {
+	return newFuncConnOption(func(o *connOptions) {
+		o.TLS = cloneTLSConfig(o.TLS)
+		o.TLS.MinVersion = version
+	})
+}
+
+// WithTLSMaxVersion returns a ConnOption that sets the maximum TLS version.
+func WithTLSMaxVersion(version uint16) ConnOption {
+	return newFuncConnOption(func(o *connOptions) {
+		o.TLS = cloneTLSConfig(o.TLS)
+		o.TLS.MaxVersion = version
+	})
+}
+
+// WithTLSCipherSuites returns a ConnOption that sets the enabled cipher suites of TLS 1.0-1.2.
+// Note that cipher suites of TLS 1.3 are not configurable in crypto/tls.
+func WithTLSCipherSuites(cipherSuites ...uint16) ConnOption {
+	return newFuncConnOption(func(o *connOptions) {
+		o.TLS = cloneTLSConfig(o.TLS)
+		o.TLS.CipherSuites = cipherSuites
+	})
+}
+
+// cloneTLSConfig avoids modifying the tls.Config shared with the default options.
+func cloneTLSConfig(tc *tls.Config) *tls.Config {
+	if tc == nil {
+		return &tls.Config{}
+	}
+	return tc.Clone()
+}
+
 // WithDialTimeout returns a ConnOption that sets DialTimeout for grpc.DialContext.
 // Default it is 5 second.
 func WithDialTimeout(dur time.Duration) ConnOption {
@@ -150,3 +193,32 @@ func WithZapLogger(logger *zap.Logger) ConnOption {
 		o.Logger = logger
 	})
 }
+
+// WithRpcInterceptor returns a ConnOption that adds interceptor invoked with the method, latency and status of every
+// RPC to brokers, e.g. to find out which type of RPC is slow. Unlike MessageInterceptor, it is not limited to the
+// RPCs of messages.
+func WithRpcInterceptor(interceptor RpcInterceptor) ConnOption {
+	return newFuncConnOption(func(o *connOptions) {
+		o.RpcInterceptors = append(o.RpcInterceptors, interceptor)
+	})
+}
+
+// WithRpcTracing returns a ConnOption that sets whether an OpenCensus span is started around every RPC to brokers,
+// which is a child of the span in the context of RPC if any, and ends once the RPC completes, or once the stream ends
+// for streaming RPCs. Spans are sampled by the sampler of trace.ApplyConfig, and exported by the exporters registered
+// by trace.RegisterExporter, see WithTraceExport to export them to the metric exporter. Default is false.
+func WithRpcTracing(enabled bool) ConnOption {
+	return newFuncConnOption(func(o *connOptions) {
+		o.RpcTracing = enabled
+	})
+}
+
+// OnConnectivityStateChange returns a ConnOption that sets the function invoked with the endpoint and the new state,
+// e.g. TRANSIENT_FAILURE, once the connectivity state of the connection to a broker changes. It is invoked with the
+// current state once connected as well, and with SHUTDOWN once the connection is closed.
+// The function runs on the goroutine watching the connection and must not block.
+func OnConnectivityStateChange(f func(endpoint string, state connectivity.State)) ConnOption {
+	return newFuncConnOption(func(o *connOptions) {
+		o.ConnectivityStateListener = f
+	})
+}
@@ -0,0 +1,77 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestConnectivityStateListener(t *testing.T) {
+	cc, err := grpc.Dial(fakeAddress, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(chan connectivity.State, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &clientConn{
+		opts:   defaultConnOptions,
+		ctx:    ctx,
+		cancel: cancel,
+		conn:   cc,
+	}
+	OnConnectivityStateChange(func(endpoint string, state connectivity.State) {
+		if endpoint != fakeAddress {
+			t.Errorf("unexpected endpoint=%s", endpoint)
+		}
+		states <- state
+	}).apply(&c.opts)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.watchConnectivityState(fakeAddress)
+	}()
+
+	expect := func(expected connectivity.State) {
+		for {
+			select {
+			case state := <-states:
+				if state == expected {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected connectivity state=%v", expected)
+			}
+		}
+	}
+	cc.Connect()
+	expect(connectivity.Connecting)
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expect(connectivity.Shutdown)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected watcher to stop once the connection is closed")
+	}
+}
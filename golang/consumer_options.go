@@ -17,6 +17,12 @@
 
 package golang
 
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
 type FilterExpressionType int32
 
 const (
@@ -32,6 +38,14 @@ type FilterExpression struct {
 
 var SUB_ALL = NewFilterExpression("*")
 
+func (fe *FilterExpression) GetExpression() string {
+	return fe.expression
+}
+
+func (fe *FilterExpression) GetExpressionType() FilterExpressionType {
+	return fe.expressionType
+}
+
 var NewFilterExpression = func(expression string) *FilterExpression {
 	return &FilterExpression{
 		expression:     expression,
@@ -45,3 +59,23 @@ var NewFilterExpressionWithType = func(expression string, expressionType FilterE
 		expressionType: expressionType,
 	}
 }
+
+// NewFilterExpressionWithTags builds a TAG expression matching any of the tags, i.e. "TagA||TagB".
+// Tags must be non-empty and contain neither whitespace nor "||". A "*" tag matches all messages.
+var NewFilterExpressionWithTags = func(tags []string) (*FilterExpression, error) {
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("tags could not be empty")
+	}
+	for _, tag := range tags {
+		if len(tag) == 0 {
+			return nil, fmt.Errorf("tag could not be empty, tags=%v", tags)
+		}
+		if strings.IndexFunc(tag, unicode.IsSpace) >= 0 || strings.Contains(tag, "||") {
+			return nil, fmt.Errorf("tag could not contain whitespace or \"||\", tag=%q", tag)
+		}
+		if tag == "*" {
+			return NewFilterExpression("*"), nil
+		}
+	}
+	return NewFilterExpression(strings.Join(tags, "||")), nil
+}
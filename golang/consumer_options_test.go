@@ -0,0 +1,169 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+	"github.com/golang/mock/gomock"
+)
+
+func TestNewFilterExpressionWithTags(t *testing.T) {
+	filterExpression, err := NewFilterExpressionWithTags([]string{"TagA", "TagB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filterExpression.expression != "TagA||TagB" || filterExpression.expressionType != TAG {
+		t.Errorf("expected TAG expression 'TagA||TagB', got %v %s", filterExpression.expressionType, filterExpression.expression)
+	}
+
+	filterExpression, err = NewFilterExpressionWithTags([]string{"TagA", "*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filterExpression.expression != "*" {
+		t.Errorf("expected expression '*', got %s", filterExpression.expression)
+	}
+
+	for _, tags := range [][]string{nil, {""}, {"TagA", ""}, {"Tag A"}, {"TagA||TagB"}} {
+		if _, err := NewFilterExpressionWithTags(tags); err == nil {
+			t.Errorf("expected error for tags=%q", tags)
+		}
+	}
+}
+
+func TestSimpleConsumerPreferredBrokerRegion(t *testing.T) {
+	sc := &defaultSimpleConsumer{scOpts: defaultSimpleConsumerOptions}
+	WithPreferredBrokerRegion("us-east", func(broker *v2.Broker) string {
+		return strings.SplitN(broker.GetName(), "/", 2)[0]
+	}).apply(&sc.scOpts)
+
+	slb, _ := NewSubscriptionLoadBalancer([]*v2.MessageQueue{
+		{Id: 0, Broker: &v2.Broker{Name: "us-west/broker-a"}},
+		{Id: 1, Broker: &v2.Broker{Name: "us-east/broker-b"}},
+		{Id: 2, Broker: &v2.Broker{Name: "us-west/broker-c"}},
+		{Id: 3, Broker: &v2.Broker{Name: "us-east/broker-d"}},
+	})
+	taken := make(map[int32]int)
+	for i := 0; i < 10; i++ {
+		mq, err := slb.TakeMessageQueueByPreference(sc.isInPreferredBrokerRegion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		taken[mq.GetId()]++
+	}
+	if len(taken) != 2 || taken[1] != 5 || taken[3] != 5 {
+		t.Errorf("expected queues of the preferred region in round-robin, got %v", taken)
+	}
+
+	slb = slb.CopyAndUpdate([]*v2.MessageQueue{{Id: 0, Broker: &v2.Broker{Name: "us-west/broker-a"}}})
+	if mq, err := slb.TakeMessageQueueByPreference(sc.isInPreferredBrokerRegion); err != nil || mq.GetId() != 0 {
+		t.Errorf("expected to fall back to queues of other regions, got %v, err=%v", mq, err)
+	}
+}
+
+func TestSimpleConsumerReceiptStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	store := NewMemoryReceiptStore(2)
+	sc := &defaultSimpleConsumer{
+		cli:        cli,
+		scOpts:     defaultSimpleConsumerOptions,
+		scSettings: &simpleConsumerSettings{groupName: &v2.Resource{Name: "test-group"}},
+	}
+	WithSimpleReceiptStore(store).apply(&sc.scOpts)
+	sc.receiptStore = sc.scOpts.receiptStore
+
+	now := time.Now()
+	sc.saveReceipts(context.TODO(), []*MessageView{
+		{messageId: "msg-expired", topic: "topic", ReceiptHandle: "handle-expired", endpoints: fakeEndpoints()},
+	}, now.Add(-time.Second))
+	sc.saveReceipts(context.TODO(), []*MessageView{
+		{messageId: "msg-a", topic: "topic", ReceiptHandle: "handle-a", endpoints: fakeEndpoints()},
+	}, now.Add(time.Minute))
+	sc.saveReceipts(context.TODO(), []*MessageView{
+		{messageId: "msg-b", topic: "topic", ReceiptHandle: "handle-b", endpoints: fakeEndpoints()},
+	}, now.Add(2*time.Minute))
+	receipts, err := sc.RecoverReceipts(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 2 || receipts[0].ReceiptHandle == "handle-expired" || receipts[1].ReceiptHandle == "handle-expired" {
+		t.Fatalf("expected the expired receipt to be forgotten beyond capacity, got %v", receipts)
+	}
+
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *v2.Endpoints, request *v2.AckMessageRequest, _ time.Duration) (*v2.AckMessageResponse, error) {
+			if request.GetEntries()[0].GetReceiptHandle() != "handle-a" {
+				t.Errorf("expected to ack with the receipt handle recovered, got %v", request.GetEntries())
+			}
+			return &v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil
+		})
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_INVALID_RECEIPT_HANDLE}}, nil)
+	if err := sc.AckReceipt(context.TODO(), receipts[0]); err != nil {
+		t.Error(err)
+	}
+	var errRpcStatus *ErrRpcStatus
+	if err := sc.AckReceipt(context.TODO(), receipts[1]); !errors.As(err, &errRpcStatus) || errRpcStatus.GetCode() != int32(v2.Code_INVALID_RECEIPT_HANDLE) {
+		t.Errorf("expected the receipt handle to be rejected as invalid, got %v", err)
+	}
+	if receipts, _ := store.Load(context.TODO()); len(receipts) != 0 {
+		t.Errorf("expected receipts acked or rejected to be removed, got %v", receipts)
+	}
+
+	// Ack keeps ignoring the status rejected.
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_INVALID_RECEIPT_HANDLE}}, nil)
+	if err := sc.Ack(context.TODO(), &MessageView{messageId: "msg-c", topic: "topic", ReceiptHandle: "handle-c", endpoints: fakeEndpoints()}); err != nil {
+		t.Errorf("expected Ack to return nil for the status rejected, got %v", err)
+	}
+}
+
+func TestMemoryReceiptStoreEviction(t *testing.T) {
+	store := NewMemoryReceiptStore(2)
+	now := time.Now()
+	save := func(messageId string, invisibleUntil time.Time) {
+		if err := store.Save(context.TODO(), &Receipt{MessageId: messageId, InvisibleUntil: invisibleUntil}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("msg-a", now.Add(time.Minute))
+	save("msg-b", now.Add(2*time.Minute))
+	// Replacing the receipt of msg-a makes msg-b the one expiring soonest.
+	save("msg-a", now.Add(3*time.Minute))
+	save("msg-c", now.Add(4*time.Minute))
+	receipts, _ := store.Load(context.TODO())
+	if len(receipts) != 2 || receipts[0].MessageId != "msg-a" || receipts[1].MessageId != "msg-c" {
+		t.Errorf("expected the receipt expiring soonest to be forgotten, got %v", receipts)
+	}
+	_ = store.Remove(context.TODO(), "msg-a")
+	save("msg-d", now.Add(time.Minute))
+	receipts, _ = store.Load(context.TODO())
+	if len(receipts) != 2 || receipts[0].MessageId != "msg-d" || receipts[1].MessageId != "msg-c" {
+		t.Errorf("expected receipts in the order of expiry, got %v", receipts)
+	}
+}
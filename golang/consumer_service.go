@@ -18,6 +18,8 @@
 package golang
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -33,10 +35,26 @@ type baseConsumeService struct {
 	messageListener     MessageListener
 	consumptionExecutor *simpleThreadPool
 	messageInterceptor  MessageInterceptor
+	// ctx is done once the consumer is shutting down, which stops waiting for the consumption.
+	ctx context.Context
+	// consumeRateLimiter paces the dispatch of messages to the listener, nil means unlimited.
+	consumeRateLimiter *tokenBucket
+	// consumeTimeout bounds the consumption of a message, see WithConsumeTimeout.
+	consumeTimeout time.Duration
+	// onConsumeTimeout is invoked once the consumption of a message times out, if it is not nil.
+	onConsumeTimeout func(*MessageView)
+	// onAwaitingChange is invoked with delta once a message of topic enters or leaves the queue of the consumption
+	// executor, if it is not nil.
+	onAwaitingChange func(topic string, delta int64)
+	// goAsync runs the function in a new goroutine accounted by the client, if it is not nil.
+	goAsync func(func())
+	// onDrain takes over the message instead of consuming it if it returns true, if it is not nil.
+	onDrain func(*MessageView) bool
 }
 
 func NewBaseConsumeService(clientId string, messageListener MessageListener, consumptionExecutor *simpleThreadPool, messageInterceptor MessageInterceptor) *baseConsumeService {
 	return &baseConsumeService{
+		ctx:                 context.Background(),
 		clientId:            clientId,
 		messageListener:     messageListener,
 		consumptionExecutor: consumptionExecutor,
@@ -49,11 +67,24 @@ func (bcs *baseConsumeService) consumeImmediately(messageView *MessageView, call
 }
 func (bcs *baseConsumeService) consumeWithDuration(messageView *MessageView, duration time.Duration, callback func(ConsumerResult, error)) {
 	task := bcs.newConsumeTask(bcs.clientId, bcs.messageListener, messageView, bcs.messageInterceptor, callback)
+	submit := func() { bcs.consumptionExecutor.Submit(task) }
+	if onAwaitingChange := bcs.onAwaitingChange; onAwaitingChange != nil {
+		topic := messageView.GetTopic()
+		consume := task
+		task = func() {
+			onAwaitingChange(topic, -1)
+			consume()
+		}
+		submit = func() {
+			onAwaitingChange(topic, 1)
+			bcs.consumptionExecutor.Submit(task)
+		}
+	}
 	if duration <= 0 {
-		bcs.consumptionExecutor.Submit(task)
+		submit()
 		return
 	}
-	time.AfterFunc(duration, func() { bcs.consumptionExecutor.Submit(task) })
+	time.AfterFunc(duration, submit)
 }
 
 func (bcs *baseConsumeService) Shutdown() error {
@@ -76,8 +107,18 @@ func (bcs *baseConsumeService) newConsumeTask(clientId string, messageListener M
 				callback(consumeResult, nil)
 			}
 		}()
+		if bcs.onDrain != nil && bcs.onDrain(messageView) {
+			// The message is evicted by the callback without being acked, see PushConsumer.DrainAndClose.
+			messageView.drained = true
+			return
+		}
+		if bcs.consumeRateLimiter != nil {
+			// Waiting for the token is counted in the await time of message, its error is ignored since the
+			// consumer is shutting down.
+			_, _ = bcs.consumeRateLimiter.acquire(bcs.ctx)
+		}
 		messageInterceptor.doBefore(MessageHookPoints_CONSUME, []*MessageCommon{messageView.GetMessageCommon()})
-		startTime := time.Now()
+		startTime := defaultClock.Now()
 		func() {
 			defer func() {
 				if e := recover(); e != nil {
@@ -86,12 +127,20 @@ func (bcs *baseConsumeService) newConsumeTask(clientId string, messageListener M
 					if !ok {
 						err = fmt.Errorf("panic cause [%v]", e)
 					}
+					messageView.consumeErr = err
 					sugarBaseLogger.Errorf("Message listener raised an exception while consuming messages, clientId=%s, mq=%s, messageId=%s, err=%w", clientId, messageView.messageQueue.String(), messageView.messageId, err)
 				}
 			}()
-			consumeResult = messageListener.consume(messageView)
+			consumeReport{}.applyTo(messageView)
+			if bcs.consumeTimeout > 0 {
+				consumeResult = bcs.consumeWithTimeout(clientId, messageListener, messageView)
+				return
+			}
+			ctx, cancel := context.WithCancel(bcs.ctx)
+			defer cancel()
+			consumeResult = messageListener.consume(ctx, messageView)
 		}()
-		duration := time.Since(startTime)
+		duration := defaultClock.Since(startTime)
 		status := MessageHookPointsStatus_ERROR
 		if consumeResult == SUCCESS {
 			status = MessageHookPointsStatus_OK
@@ -100,6 +149,67 @@ func (bcs *baseConsumeService) newConsumeTask(clientId string, messageListener M
 	}
 }
 
+// consumeWithTimeout runs the listener in another goroutine and stops waiting for it once the consume timeout is
+// exceeded, so that the worker is freed even if the listener hangs. The context of listener is cancelled then, and
+// the message is failed to be redelivered, the result of listener returned later is discarded. The goroutine keeps
+// running until the listener returns, so listeners should return promptly once the context is done. A timeout longer
+// than the invisible duration lets brokers redeliver the message before it fires. Panics of the listener are
+// re-raised in the worker, which is the only one writing the message.
+func (bcs *baseConsumeService) consumeWithTimeout(clientId string, messageListener MessageListener, messageView *MessageView) ConsumerResult {
+	ctx, cancel := context.WithTimeout(bcs.ctx, bcs.consumeTimeout)
+	defer cancel()
+	type outcome struct {
+		result ConsumerResult
+		report consumeReport
+		panic  interface{}
+	}
+	done := make(chan outcome, 1)
+	finished := make(chan struct{})
+	consume := func() {
+		o := outcome{result: FAILURE}
+		defer func() {
+			o.panic = recover()
+			done <- o
+			close(finished)
+		}()
+		// The message is only written by the worker, since the listener may be abandoned and still running.
+		if reporting, ok := messageListener.(reportingMessageListener); ok {
+			o.result, o.report = reporting.consumeAndReport(ctx, messageView)
+			return
+		}
+		o.result = messageListener.consume(ctx, messageView)
+	}
+	if bcs.goAsync != nil {
+		bcs.goAsync(consume)
+	} else {
+		go consume()
+	}
+	returned := func(o outcome) ConsumerResult {
+		if o.panic != nil {
+			panic(o.panic)
+		}
+		o.report.applyTo(messageView)
+		return o.result
+	}
+	select {
+	case o := <-done:
+		return returned(o)
+	case <-ctx.Done():
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// The consumer is shutting down, wait for the listener to return as usual.
+		return returned(<-done)
+	}
+	err := &ErrConsumeTimeout{MessageID: messageView.GetMessageId(), Timeout: bcs.consumeTimeout}
+	consumeReport{err: err}.applyTo(messageView)
+	messageView.abandonedConsumption = finished
+	sugarBaseLogger.Warnf("Message listener timed out while consuming messages, clientId=%s, mq=%s, messageId=%s, err=%v", clientId, messageView.messageQueue.String(), messageView.messageId, err)
+	if bcs.onConsumeTimeout != nil {
+		bcs.onConsumeTimeout(messageView)
+	}
+	return FAILURE
+}
+
 var _ = ConsumeService(&standardConsumeService{})
 
 type standardConsumeService struct {
@@ -108,6 +218,8 @@ type standardConsumeService struct {
 type fifoConsumeService struct {
 	baseConsumeService
 	enableFifoConsumeAccelerator bool
+	// orderedRetry holds the following messages until the failed one is not redelivered any more, see WithOrderedRetry.
+	orderedRetry bool
 }
 
 func (scs *standardConsumeService) consume(pq ProcessQueue, messageViews []*MessageView) {
@@ -185,7 +297,11 @@ func (fcs *fifoConsumeService) consumeIteratively(pq ProcessQueue, messageViewsP
 			sugarBaseLogger.Errorf("[Bug] Exception raised in consumption callback, clientId=%s", fcs.clientId)
 			return
 		}
-		pq.eraseFifoMessage(mv, result)
+		if fcs.orderedRetry {
+			pq.eraseFifoMessage(mv, result, func() { fcs.consumeIteratively(pq, messageViewsPtr, ptr+1) })
+			return
+		}
+		pq.eraseFifoMessage(mv, result, nil)
 		fcs.consumeIteratively(pq, messageViewsPtr, ptr+1)
 	})
 }
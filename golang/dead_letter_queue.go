@@ -0,0 +1,65 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"fmt"
+)
+
+const deadLetterQueueTopicPrefix = "%DLQ%"
+
+// DeadLetterQueueTopic returns the topic of dead letter queue of the consumer group.
+func DeadLetterQueueTopic(consumerGroup string) string {
+	return deadLetterQueueTopicPrefix + consumerGroup
+}
+
+// NewDeadLetterQueueConsumer returns a simple consumer which receives messages from the dead letter queue of
+// config.ConsumerGroup. The original topic of each message is available by MessageView.GetOriginalTopic, and the
+// delivery attempts before it was forwarded by MessageView.GetDeliveryAttempt.
+var NewDeadLetterQueueConsumer = func(config *Config, opts ...SimpleConsumerOption) (SimpleConsumer, error) {
+	if len(config.ConsumerGroup) == 0 {
+		return nil, fmt.Errorf("consumerGroup could not be nil")
+	}
+	opts = append(opts, WithSimpleSubscriptionExpressions(map[string]*FilterExpression{
+		DeadLetterQueueTopic(config.ConsumerGroup): SUB_ALL,
+	}))
+	return NewSimpleConsumer(config, opts...)
+}
+
+// ResendDeadLetterMessage sends the message received from dead letter queue to its original topic, the body, tag,
+// keys, properties and message group are retained.
+func ResendDeadLetterMessage(ctx context.Context, producer Producer, mv *MessageView) ([]*SendReceipt, error) {
+	msg, err := restoreDeadLetterMessage(mv)
+	if err != nil {
+		return nil, err
+	}
+	return producer.Send(ctx, msg)
+}
+
+func restoreDeadLetterMessage(mv *MessageView) (*Message, error) {
+	if len(mv.GetOriginalTopic()) == 0 {
+		return nil, fmt.Errorf("message is not from dead letter queue, topic=%s, messageId=%s", mv.GetTopic(), mv.GetMessageId())
+	}
+	msg := NewMessageFromView(mv)
+	msg.Topic = mv.GetOriginalTopic()
+	if mv.GetMessageGroup() != nil {
+		msg.SetMessageGroup(*mv.GetMessageGroup())
+	}
+	return msg, nil
+}
@@ -0,0 +1,73 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"testing"
+
+	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+)
+
+func TestNewDeadLetterQueueConsumer(t *testing.T) {
+	sc, err := NewDeadLetterQueueConsumer(&Config{Endpoint: fakeAddress, ConsumerGroup: "test-group"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriptions := *sc.(*defaultSimpleConsumer).subscriptionExpressions
+	if _, ok := subscriptions["%DLQ%test-group"]; !ok || len(subscriptions) != 1 {
+		t.Errorf("expected to subscribe the dead letter queue only, got %v", subscriptions)
+	}
+	if _, err := NewDeadLetterQueueConsumer(&Config{Endpoint: fakeAddress}); err == nil {
+		t.Error("expected error for empty consumer group")
+	}
+}
+
+func TestRestoreDeadLetterMessage(t *testing.T) {
+	tag := "tag-a"
+	messageGroup := "group-a"
+	mv := fromProtobuf_MessageView0(&v2.Message{
+		Topic: &v2.Resource{Name: DeadLetterQueueTopic("test-group")},
+		SystemProperties: &v2.SystemProperties{
+			MessageId:       "dlq-msg",
+			Tag:             &tag,
+			Keys:            []string{"key-a"},
+			MessageGroup:    &messageGroup,
+			DeadLetterQueue: &v2.DeadLetterQueue{Topic: "origin-topic", MessageId: "origin-msg"},
+		},
+		UserProperties: map[string]string{"k": "v"},
+		Body:           []byte("body"),
+	})
+	if mv.GetOriginalTopic() != "origin-topic" || mv.GetOriginalMessageId() != "origin-msg" {
+		t.Fatalf("unexpected dead letter queue metadata, topic=%s, messageId=%s", mv.GetOriginalTopic(), mv.GetOriginalMessageId())
+	}
+	msg, err := restoreDeadLetterMessage(mv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Topic != "origin-topic" || string(msg.Body) != "body" || *msg.GetTag() != tag ||
+		*msg.GetMessageGroup() != messageGroup || msg.GetKeys()[0] != "key-a" || msg.GetProperties()["k"] != "v" {
+		t.Errorf("unexpected restored message %+v", msg)
+	}
+
+	if _, err := restoreDeadLetterMessage(fromProtobuf_MessageView0(&v2.Message{
+		Topic:            &v2.Resource{Name: "topic"},
+		SystemProperties: &v2.SystemProperties{MessageId: "msg"},
+	})); err == nil {
+		t.Error("expected error for message not from dead letter queue")
+	}
+}
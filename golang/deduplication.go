@@ -0,0 +1,149 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// sendDeduplicator remembers the deduplication keys of messages accepted by brokers within a window in LRU order,
+// brokers do not deduplicate messages by themselves.
+type sendDeduplicator struct {
+	window   time.Duration
+	capacity int
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type deduplicationEntry struct {
+	key        string
+	messageId  string
+	acceptedAt time.Time
+	// pending is true while the message of key is being sent, see reserve.
+	pending bool
+}
+
+func newSendDeduplicator(window time.Duration, capacity int) *sendDeduplicator {
+	return &sendDeduplicator{
+		window:   window,
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// reserve reserves key for the message to be sent, unless a message has been accepted with key within the window or
+// is being sent with it, whose id is returned then, empty for the one being sent. The reservation is settled by
+// record once the message is accepted, or by release otherwise.
+func (sd *sendDeduplicator) reserve(key string) (string, bool) {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	if elem, ok := sd.entries[key]; ok {
+		entry := elem.Value.(*deduplicationEntry)
+		if entry.pending || time.Since(entry.acceptedAt) <= sd.window {
+			return entry.messageId, true
+		}
+		sd.order.Remove(elem)
+	}
+	sd.put(&deduplicationEntry{key: key, acceptedAt: time.Now(), pending: true})
+	return "", false
+}
+
+func (sd *sendDeduplicator) record(key, messageId string) {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	if elem, ok := sd.entries[key]; ok {
+		sd.order.Remove(elem)
+	}
+	sd.put(&deduplicationEntry{key: key, messageId: messageId, acceptedAt: time.Now()})
+}
+
+// release drops the reservation of key, so that the message could be sent again.
+func (sd *sendDeduplicator) release(key string) {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	if elem, ok := sd.entries[key]; ok && elem.Value.(*deduplicationEntry).pending {
+		sd.order.Remove(elem)
+		delete(sd.entries, key)
+	}
+}
+
+func (sd *sendDeduplicator) put(entry *deduplicationEntry) {
+	sd.entries[entry.key] = sd.order.PushFront(entry)
+	for sd.order.Len() > sd.capacity {
+		oldest := sd.order.Back()
+		sd.order.Remove(oldest)
+		delete(sd.entries, oldest.Value.(*deduplicationEntry).key)
+	}
+}
+
+// ackedReceiptHandles remembers the receipt handles acknowledged recently in LRU order, to short-circuit acks of the
+// same delivery, which are rejected by brokers. A nil one remembers nothing.
+type ackedReceiptHandles struct {
+	capacity int
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newAckedReceiptHandles(capacity int) *ackedReceiptHandles {
+	if capacity <= 0 {
+		return nil
+	}
+	return &ackedReceiptHandles{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (arh *ackedReceiptHandles) contains(receiptHandle string) bool {
+	if arh == nil {
+		return false
+	}
+	arh.lock.Lock()
+	defer arh.lock.Unlock()
+	elem, ok := arh.entries[receiptHandle]
+	if ok {
+		arh.order.MoveToFront(elem)
+	}
+	return ok
+}
+
+func (arh *ackedReceiptHandles) add(receiptHandle string) {
+	if arh == nil {
+		return
+	}
+	arh.lock.Lock()
+	defer arh.lock.Unlock()
+	if elem, ok := arh.entries[receiptHandle]; ok {
+		arh.order.MoveToFront(elem)
+		return
+	}
+	arh.entries[receiptHandle] = arh.order.PushFront(receiptHandle)
+	for arh.order.Len() > arh.capacity {
+		oldest := arh.order.Back()
+		arh.order.Remove(oldest)
+		delete(arh.entries, oldest.Value.(string))
+	}
+}
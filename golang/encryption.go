@@ -0,0 +1,56 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+// EncryptionKeyIdProperty is the message property which holds the key id returned by the Encryptor, for the
+// Decryptor of consumers to select the key.
+const EncryptionKeyIdProperty = "__ENCRYPTION_KEY_ID"
+
+// Encryptor encrypts the body of message before sending, see WithEncryptor. keyId is sent along with the message
+// as EncryptionKeyIdProperty, which should not be empty.
+type Encryptor func(body []byte) (keyId string, encrypted []byte, err error)
+
+// Decryptor decrypts the body of message encrypted by the Encryptor with the key of keyId, see WithDecryptor.
+type Decryptor func(keyId string, body []byte) ([]byte, error)
+
+// decryptMessageView decrypts the body of message if it is encrypted, messages failed to be decrypted are marked
+// as corrupted like those failed to be decompressed.
+func decryptMessageView(mv *MessageView, decryptor Decryptor) {
+	if decryptor == nil || mv.corrupted {
+		return
+	}
+	keyId, ok := mv.properties[EncryptionKeyIdProperty]
+	if !ok {
+		return
+	}
+	body, err := decryptor(keyId, mv.body)
+	if err != nil {
+		sugarBaseLogger.Errorf("failed to decrypt message body, topic=%s, messageId=%s, keyId=%s, err=%v", mv.topic, mv.messageId, keyId, err)
+		mv.corrupted = true
+		return
+	}
+	mv.body = body
+	// The message looks like the one before encryption, e.g. to be resent by ResendDeadLetterMessage.
+	properties := make(map[string]string, len(mv.properties)-1)
+	for k, v := range mv.properties {
+		if k != EncryptionKeyIdProperty {
+			properties[k] = v
+		}
+	}
+	mv.properties = properties
+}
@@ -0,0 +1,37 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+
+	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+)
+
+// EndpointResolver turns the logical name set as Config.Endpoint into the endpoints of the access point, e.g. for
+// service discovery other than DNS. It is called when the client is created and every time the routes are refreshed.
+type EndpointResolver interface {
+	Resolve(ctx context.Context, name string) (*v2.Endpoints, error)
+}
+
+// EndpointResolverFunc is an adapter to use an ordinary function as an EndpointResolver.
+type EndpointResolverFunc func(ctx context.Context, name string) (*v2.Endpoints, error)
+
+func (f EndpointResolverFunc) Resolve(ctx context.Context, name string) (*v2.Endpoints, error) {
+	return f(ctx, name)
+}
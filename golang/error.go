@@ -20,8 +20,11 @@ package golang
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+	"google.golang.org/grpc/status"
 )
 
 type ErrRpcStatus struct {
@@ -47,6 +50,233 @@ func (err *ErrRpcStatus) Error() string {
 
 var _ = error(&ErrRpcStatus{})
 
+// ErrRouteUnavailable is returned if the route of topic could not be resolved in the configured attempts.
+type ErrRouteUnavailable struct {
+	Topic    string
+	Attempts int
+	Err      error
+}
+
+func (err *ErrRouteUnavailable) Error() string {
+	return fmt.Sprintf("route of topic=%s is unavailable after %d attempt(s), err=%v", err.Topic, err.Attempts, err.Err)
+}
+
+func (err *ErrRouteUnavailable) Unwrap() error {
+	return err.Err
+}
+
+var _ = error(&ErrRouteUnavailable{})
+
+// ErrInvalidEndpoint is returned on creating clients if any address of Config.Endpoint is invalid, Problems lists
+// the bad addresses with the reasons.
+type ErrInvalidEndpoint struct {
+	Endpoint string
+	Problems []string
+}
+
+func (err *ErrInvalidEndpoint) Error() string {
+	return fmt.Sprintf("invalid endpoint=%q, %s", err.Endpoint, strings.Join(err.Problems, "; "))
+}
+
+var _ = error(&ErrInvalidEndpoint{})
+
+// ErrTopicNotFound is returned if the topic is not found by brokers, or has no message queue.
+type ErrTopicNotFound struct {
+	Topic string
+	Err   error
+}
+
+func (err *ErrTopicNotFound) Error() string {
+	return fmt.Sprintf("topic=%s is not found, err=%v", err.Topic, err.Err)
+}
+
+func (err *ErrTopicNotFound) Unwrap() error {
+	return err.Err
+}
+
+var _ = error(&ErrTopicNotFound{})
+
+// MessageSizeLimit names the limit exceeded by ErrMessageTooLarge.
+type MessageSizeLimit string
+
+const (
+	// MessageSizeLimit_BODY is the max body size of a message synced from brokers.
+	MessageSizeLimit_BODY MessageSizeLimit = "max body size"
+	// MessageSizeLimit_SINGLE is the max body size of a message sent alone, see WithMaxSingleMessageSize.
+	MessageSizeLimit_SINGLE MessageSizeLimit = "max single message size"
+	// MessageSizeLimit_BATCH is the max total body size of messages sent in batch, see WithMaxBatchSize.
+	MessageSizeLimit_BATCH MessageSizeLimit = "max batch size"
+)
+
+// ErrMessageTooLarge is returned before the request is sent if the body size of messages exceeds Limit. Size is the
+// size of encrypted bodies if the producer has an Encryptor.
+type ErrMessageTooLarge struct {
+	Limit   MessageSizeLimit
+	Size    int
+	MaxSize int
+}
+
+func (err *ErrMessageTooLarge) Error() string {
+	return fmt.Sprintf("message body size=%d bytes exceeds the %s=%d bytes", err.Size, err.Limit, err.MaxSize)
+}
+
+var _ = error(&ErrMessageTooLarge{})
+
+// SendError is returned once sending message(s) fails in every attempt, carrying the error of each attempt.
+type SendError struct {
+	causes []error
+}
+
+// Attempts returns how many attempts were made.
+func (err *SendError) Attempts() int {
+	return len(err.causes)
+}
+
+// Causes returns the errors of attempts in order.
+func (err *SendError) Causes() []error {
+	return err.causes
+}
+
+func (err *SendError) Error() string {
+	return fmt.Sprintf("failed to send message(s) after %d attempt(s), err=%v", len(err.causes), err.Unwrap())
+}
+
+// Unwrap returns the error of the last attempt.
+func (err *SendError) Unwrap() error {
+	if len(err.causes) == 0 {
+		return nil
+	}
+	return err.causes[len(err.causes)-1]
+}
+
+var _ = error(&SendError{})
+
+// ErrSendUncertain is returned with SendCancellation_UNCERTAIN if the context of send is done while a request is in
+// flight, the messages could have been stored by brokers or not. Attempt is the attempt of the request, and Err is
+// the error of the request.
+type ErrSendUncertain struct {
+	Topic      string
+	MessageIDs []string
+	Attempt    int
+	Endpoints  *v2.Endpoints
+	Err        error
+}
+
+func (err *ErrSendUncertain) Error() string {
+	return fmt.Sprintf("outcome of sending message(s) is uncertain, topic=%s, messageIds=%v, attempt=%d, err=%v",
+		err.Topic, err.MessageIDs, err.Attempt, err.Err)
+}
+
+func (err *ErrSendUncertain) Unwrap() error {
+	return err.Err
+}
+
+var _ = error(&ErrSendUncertain{})
+
+// ErrDuplicate is returned if a message with the same deduplication key has been accepted within the deduplication
+// window of producer, the message is not sent again so callers could treat it as a success. MessageID is empty if
+// the message with the same key is still being sent, which may fail.
+type ErrDuplicate struct {
+	Key       string
+	MessageID string
+}
+
+func (err *ErrDuplicate) Error() string {
+	return fmt.Sprintf("message with deduplication key=%s has been sent, messageId=%s", err.Key, err.MessageID)
+}
+
+var _ = error(&ErrDuplicate{})
+
+// ErrDuplicateAck is returned if the message has been acknowledged by the same receipt handle recently,
+// the ack is not sent to brokers again.
+type ErrDuplicateAck struct {
+	MessageID string
+}
+
+func (err *ErrDuplicateAck) Error() string {
+	return fmt.Sprintf("message has been acknowledged, messageId=%s", err.MessageID)
+}
+
+var _ = error(&ErrDuplicateAck{})
+
+// ErrMissingProperty is returned if a message to send lacks a property required by WithRequiredProperties.
+type ErrMissingProperty struct {
+	Topic string
+	Key   string
+}
+
+func (err *ErrMissingProperty) Error() string {
+	return fmt.Sprintf("message of topic=%s lacks the required property=%s", err.Topic, err.Key)
+}
+
+var _ = error(&ErrMissingProperty{})
+
+// ErrConsumeTimeout is the consumption error of a message whose listener does not return within the consume timeout,
+// see WithConsumeTimeout.
+type ErrConsumeTimeout struct {
+	MessageID string
+	Timeout   time.Duration
+}
+
+func (err *ErrConsumeTimeout) Error() string {
+	return fmt.Sprintf("consumption of message timed out after %v, messageId=%s", err.Timeout, err.MessageID)
+}
+
+var _ = error(&ErrConsumeTimeout{})
+
+// ErrMessageTypeMismatch is returned if a message is sent to a topic not accepting its type, which is told by the
+// message group, delivery timestamp, lite topic and transaction of the message, see Message.
+type ErrMessageTypeMismatch struct {
+	Topic              string
+	MessageType        v2.MessageType
+	AcceptMessageTypes []v2.MessageType
+}
+
+// messageTypeHints tells how to send messages of the type.
+var messageTypeHints = map[v2.MessageType]string{
+	v2.MessageType_NORMAL:      "send without message group, delivery timestamp or transaction",
+	v2.MessageType_FIFO:        "set the message group",
+	v2.MessageType_DELAY:       "set the delivery timestamp",
+	v2.MessageType_TRANSACTION: "send in a transaction",
+	v2.MessageType_LITE:        "set the lite topic",
+}
+
+func (err *ErrMessageTypeMismatch) Error() string {
+	hints := make([]string, 0, len(err.AcceptMessageTypes))
+	for _, messageType := range err.AcceptMessageTypes {
+		if hint, ok := messageTypeHints[messageType]; ok {
+			hints = append(hints, fmt.Sprintf("%v: %s", messageType, hint))
+		}
+	}
+	return fmt.Sprintf("topic=%s does not accept %v messages, accepted types are %v (%s)", err.Topic, err.MessageType,
+		err.AcceptMessageTypes, strings.Join(hints, "; "))
+}
+
+var _ = error(&ErrMessageTypeMismatch{})
+
+// ErrSerialization is returned if a message fails to be serialized into the send request, e.g. by the property
+// transformer or for strings which are not valid UTF-8. It is returned before the request is sent, and is not
+// retried since sending the message again fails the same way.
+type ErrSerialization struct {
+	Topic string
+	Keys  []string
+	Err   error
+}
+
+func newErrSerialization(msg *Message, err error) *ErrSerialization {
+	return &ErrSerialization{Topic: msg.Topic, Keys: msg.GetKeys(), Err: err}
+}
+
+func (err *ErrSerialization) Error() string {
+	return fmt.Sprintf("failed to serialize message of topic=%s, keys=%v, err=%v", err.Topic, err.Keys, err.Err)
+}
+
+func (err *ErrSerialization) Unwrap() error {
+	return err.Err
+}
+
+var _ = error(&ErrSerialization{})
+
 func AsErrRpcStatus(err error) (*ErrRpcStatus, bool) {
 	if err == nil {
 		return nil, false
@@ -58,3 +288,14 @@ func AsErrRpcStatus(err error) (*ErrRpcStatus, bool) {
 	err = errors.Unwrap(err)
 	return AsErrRpcStatus(err)
 }
+
+// errorCodeOf returns the name of the status code carried by err, which is empty if err carries no code.
+func errorCodeOf(err error) string {
+	if target, ok := AsErrRpcStatus(err); ok {
+		return v2.Code(target.GetCode()).String()
+	}
+	if s, ok := status.FromError(err); ok && err != nil {
+		return s.Code().String()
+	}
+	return ""
+}
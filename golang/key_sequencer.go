@@ -0,0 +1,76 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"sync"
+)
+
+// keySequencer serializes the work of the same key in the order of turns, see WithShardingKeyOrder.
+type keySequencer struct {
+	lock  sync.Mutex
+	tails map[string]chan struct{}
+	// goAsync runs the function in a new goroutine accounted by the client, if it is not nil.
+	goAsync func(func())
+}
+
+func newKeySequencer() *keySequencer {
+	return &keySequencer{tails: make(map[string]chan struct{})}
+}
+
+// enter takes a turn of key, the turn starts once prev is closed, or at once if prev is nil. done must be called
+// after the turn, so that the next turn of key starts.
+func (ks *keySequencer) enter(key string) (prev <-chan struct{}, done func()) {
+	cur := make(chan struct{})
+	ks.lock.Lock()
+	prev = ks.tails[key]
+	ks.tails[key] = cur
+	ks.lock.Unlock()
+	return prev, func() {
+		close(cur)
+		ks.lock.Lock()
+		if ks.tails[key] == cur {
+			delete(ks.tails, key)
+		}
+		ks.lock.Unlock()
+	}
+}
+
+// wait blocks until the turn starts or ctx is done. If ctx is done first, the turn is ended once it starts, so that
+// later turns never overtake the earlier ones.
+func (ks *keySequencer) wait(ctx context.Context, prev <-chan struct{}, done func()) error {
+	if prev == nil {
+		return nil
+	}
+	select {
+	case <-prev:
+		return nil
+	case <-ctx.Done():
+		endTurn := func() {
+			<-prev
+			done()
+		}
+		if ks.goAsync != nil {
+			ks.goAsync(endTurn)
+		} else {
+			go endTurn()
+		}
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySequencer_Order(t *testing.T) {
+	ks := newKeySequencer()
+	ctx := context.Background()
+	var lock sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		prev, done := ks.enter("key")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, ks.wait(ctx, prev, done))
+			lock.Lock()
+			order = append(order, i)
+			lock.Unlock()
+			done()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, order)
+	assert.Empty(t, ks.tails, "finished keys should be released")
+}
+
+func TestKeySequencer_ContextCanceled(t *testing.T) {
+	ks := newKeySequencer()
+	_, done0 := ks.enter("key")
+	prev1, done1 := ks.enter("key")
+	prev2, done2 := ks.enter("key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, ks.wait(ctx, prev1, done1), context.DeadlineExceeded)
+
+	// The canceled turn must not let the next turn overtake the first one.
+	select {
+	case <-prev2:
+		t.Fatal("turn started before the earlier turn is done")
+	case <-time.After(10 * time.Millisecond):
+	}
+	done0()
+	assert.NoError(t, ks.wait(context.Background(), prev2, done2))
+	done2()
+	assert.Empty(t, ks.tails)
+}
@@ -22,7 +22,6 @@ import (
 	"errors"
 	"time"
 
-	"github.com/apache/rocketmq-clients/golang/v5/pkg/ticker"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 	"github.com/google/uuid"
 	"google.golang.org/protobuf/types/known/durationpb"
@@ -90,7 +89,7 @@ func (lpc *defaultLitePushConsumer) Start() error {
 	lpc.defaultPushConsumer.cli.notifyUnsubscribeLiteFunc = lpc.notifyUnsubscribeLite
 	//todo
 	lpc.syncAllLiteSubscription()
-	ticker.Tick(lpc.syncAllLiteSubscription, time.Second*30, lpc.defaultPushConsumer.cli.done)
+	lpc.defaultPushConsumer.cli.goAsync(func() { lpc.defaultPushConsumer.cli.tick(lpc.syncAllLiteSubscription, time.Second*30) })
 	return nil
 }
 
@@ -156,7 +155,7 @@ func (lpc *defaultLitePushConsumer) syncAllLiteSubscription() {
 }
 
 func (lpc *defaultLitePushConsumer) syncLiteSubscription(context context.Context, action v2.LiteSubscriptionAction, diff []string) error {
-	endpoints := lpc.cli.accessPoint
+	endpoints := lpc.cli.getAccessPoint()
 	request := v2.SyncLiteSubscriptionRequest{
 		Action: action,
 		Topic: &v2.Resource{
@@ -171,6 +171,15 @@ func (m *mockedClientManager) ChangeInvisibleDuration(ctx context.Context, endpo
 func (m *mockedClientManager) ForwardMessageToDeadLetterQueue(ctx context.Context, endpoints *v2.Endpoints, request *v2.ForwardMessageToDeadLetterQueueRequest, duration time.Duration) (*v2.ForwardMessageToDeadLetterQueueResponse, error) {
 	return nil, nil
 }
+func (m *mockedClientManager) QueryOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.QueryOffsetRequest, duration time.Duration) (*v2.QueryOffsetResponse, error) {
+	return nil, nil
+}
+func (m *mockedClientManager) UpdateOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.UpdateOffsetRequest, duration time.Duration) (*v2.UpdateOffsetResponse, error) {
+	return nil, nil
+}
+func (m *mockedClientManager) GetOffset(ctx context.Context, endpoints *v2.Endpoints, request *v2.GetOffsetRequest, duration time.Duration) (*v2.GetOffsetResponse, error) {
+	return nil, nil
+}
 
 func (m *mockedClientManager) SyncLiteSubscription(ctx context.Context, endpoints *v2.Endpoints, request *v2.SyncLiteSubscriptionRequest, duration time.Duration) (*v2.SyncLiteSubscriptionResponse, error) {
 	fmt.Printf("DEBUG: mockedClientManager.SyncLiteSubscription called with request: %+v\n", request)
@@ -19,6 +19,7 @@ package golang
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"go.uber.org/atomic"
@@ -31,12 +32,18 @@ import (
 
 type PublishingLoadBalancer interface {
 	TakeMessageQueueByMessageGroup(messageGroup *string) ([]*v2.MessageQueue, error)
+	TakeMessageQueueByShardingKey(shardingKey string) ([]*v2.MessageQueue, error)
+	TakeMessageQueueByBroker(brokerName string, queueId int32) ([]*v2.MessageQueue, error)
 	TakeMessageQueues(excluded *sync.Map, count int) ([]*v2.MessageQueue, error)
+	TakeMessageQueuesByScore(excluded *sync.Map, count int, scorer func(*v2.MessageQueue) float64) ([]*v2.MessageQueue, error)
 	CopyAndUpdate([]*v2.MessageQueue) PublishingLoadBalancer
+	AcceptMessageTypes() []v2.MessageType
 }
 
 type publishingLoadBalancer struct {
 	messageQueues []*v2.MessageQueue
+	// acceptMessageTypes is the union of the message types accepted by message queues.
+	acceptMessageTypes []v2.MessageType
 
 	index atomic.Int32
 }
@@ -45,11 +52,31 @@ var _ = PublishingLoadBalancer(&publishingLoadBalancer{})
 
 var NewPublishingLoadBalancer = func(messageQueues []*v2.MessageQueue) (PublishingLoadBalancer, error) {
 	plb := &publishingLoadBalancer{
-		messageQueues: messageQueues,
+		messageQueues:      messageQueues,
+		acceptMessageTypes: acceptMessageTypesOf(messageQueues),
 	}
 	return plb, nil
 }
 
+func acceptMessageTypesOf(messageQueues []*v2.MessageQueue) []v2.MessageType {
+	var acceptMessageTypes []v2.MessageType
+	seen := make(map[v2.MessageType]bool)
+	for _, mq := range messageQueues {
+		for _, messageType := range mq.GetAcceptMessageTypes() {
+			if !seen[messageType] {
+				seen[messageType] = true
+				acceptMessageTypes = append(acceptMessageTypes, messageType)
+			}
+		}
+	}
+	return acceptMessageTypes
+}
+
+// AcceptMessageTypes returns the message types accepted by the topic, which is empty if brokers do not declare them.
+func (plb *publishingLoadBalancer) AcceptMessageTypes() []v2.MessageType {
+	return plb.acceptMessageTypes
+}
+
 func (plb *publishingLoadBalancer) TakeMessageQueueByMessageGroup(messageGroup *string) ([]*v2.MessageQueue, error) {
 	if len(plb.messageQueues) == 0 {
 		return nil, fmt.Errorf("messageQueues is empty")
@@ -57,11 +84,31 @@ func (plb *publishingLoadBalancer) TakeMessageQueueByMessageGroup(messageGroup *
 	if messageGroup == nil {
 		return nil, fmt.Errorf("messageGroup is nil")
 	}
-	h := int64(siphash.Hash(506097522914230528, 1084818905618843912, []byte(*messageGroup)))
+	return plb.takeMessageQueueByHash(*messageGroup), nil
+}
+
+func (plb *publishingLoadBalancer) TakeMessageQueueByShardingKey(shardingKey string) ([]*v2.MessageQueue, error) {
+	if len(plb.messageQueues) == 0 {
+		return nil, fmt.Errorf("messageQueues is empty")
+	}
+	return plb.takeMessageQueueByHash(shardingKey), nil
+}
+
+func (plb *publishingLoadBalancer) TakeMessageQueueByBroker(brokerName string, queueId int32) ([]*v2.MessageQueue, error) {
+	for _, mq := range plb.messageQueues {
+		if mq.GetBroker().GetName() == brokerName && mq.GetId() == queueId {
+			return []*v2.MessageQueue{mq}, nil
+		}
+	}
+	return nil, fmt.Errorf("messageQueue is not found, brokerName=%s, queueId=%d", brokerName, queueId)
+}
+
+func (plb *publishingLoadBalancer) takeMessageQueueByHash(key string) []*v2.MessageQueue {
+	h := int64(siphash.Hash(506097522914230528, 1084818905618843912, []byte(key)))
 	i := utils.Mod64(h, len(plb.messageQueues))
 	return []*v2.MessageQueue{
 		plb.messageQueues[i],
-	}, nil
+	}
 }
 
 func (plb *publishingLoadBalancer) TakeMessageQueues(excluded *sync.Map, count int) ([]*v2.MessageQueue, error) {
@@ -73,7 +120,7 @@ func (plb *publishingLoadBalancer) TakeMessageQueues(excluded *sync.Map, count i
 	candidateBrokerNames := make(map[string]bool, 32)
 
 	for i := 0; i < len(plb.messageQueues); i++ {
-		idx := utils.Mod(next+1, len(plb.messageQueues))
+		idx := utils.Mod(next+int32(i), len(plb.messageQueues))
 		selectMessageQueue := plb.messageQueues[idx]
 		broker := selectMessageQueue.Broker
 		brokerName := broker.GetName()
@@ -102,7 +149,7 @@ func (plb *publishingLoadBalancer) TakeMessageQueues(excluded *sync.Map, count i
 	}
 	if len(candidates) == 0 {
 		for i := 0; i < len(plb.messageQueues); i++ {
-			idx := utils.Mod(next+1, len(plb.messageQueues))
+			idx := utils.Mod(next+int32(i), len(plb.messageQueues))
 			selectMessageQueue := plb.messageQueues[idx]
 			broker := selectMessageQueue.Broker
 			brokerName := broker.GetName()
@@ -121,15 +168,75 @@ func (plb *publishingLoadBalancer) TakeMessageQueues(excluded *sync.Map, count i
 	return candidates, nil
 }
 
+type scoredMessageQueue struct {
+	mq    *v2.MessageQueue
+	score float64
+}
+
+// TakeMessageQueuesByScore takes at most count message queues on different brokers, preferring queues with
+// higher scores. Queues with equal scores are taken in round-robin.
+func (plb *publishingLoadBalancer) TakeMessageQueuesByScore(excluded *sync.Map, count int, scorer func(*v2.MessageQueue) float64) ([]*v2.MessageQueue, error) {
+	if len(plb.messageQueues) == 0 {
+		return nil, fmt.Errorf("messageQueues is empty")
+	}
+	next := plb.index.Inc()
+	scored := make([]scoredMessageQueue, len(plb.messageQueues))
+	for i := range scored {
+		mq := plb.messageQueues[utils.Mod(next+int32(i), len(plb.messageQueues))]
+		scored[i] = scoredMessageQueue{mq: mq, score: scorer(mq)}
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	candidates := takeScoredCandidates(scored, excluded, count)
+	if len(candidates) == 0 {
+		candidates = takeScoredCandidates(scored, nil, count)
+	}
+	return candidates, nil
+}
+
+func takeScoredCandidates(scored []scoredMessageQueue, excluded *sync.Map, count int) []*v2.MessageQueue {
+	var candidates []*v2.MessageQueue
+	candidateBrokerNames := make(map[string]bool, 32)
+	for _, item := range scored {
+		broker := item.mq.Broker
+		brokerName := broker.GetName()
+		if _, ok := candidateBrokerNames[brokerName]; ok {
+			continue
+		}
+		if excluded != nil {
+			pass := false
+			for _, address := range broker.GetEndpoints().GetAddresses() {
+				if _, ok := excluded.Load(utils.ParseAddress(address)); ok {
+					pass = true
+					break
+				}
+			}
+			if pass {
+				continue
+			}
+		}
+		candidates = append(candidates, item.mq)
+		candidateBrokerNames[brokerName] = true
+		if len(candidates) >= count {
+			break
+		}
+	}
+	return candidates
+}
+
 func (plb *publishingLoadBalancer) CopyAndUpdate(messageQueues []*v2.MessageQueue) PublishingLoadBalancer {
 	return &publishingLoadBalancer{
-		messageQueues: messageQueues,
-		index:         plb.index,
+		messageQueues:      messageQueues,
+		acceptMessageTypes: acceptMessageTypesOf(messageQueues),
+		index:              plb.index,
 	}
 }
 
 type SubscriptionLoadBalancer interface {
 	TakeMessageQueue() (*v2.MessageQueue, error)
+	TakeMessageQueueByPreference(preferred func(*v2.MessageQueue) bool) (*v2.MessageQueue, error)
 	CopyAndUpdate([]*v2.MessageQueue) SubscriptionLoadBalancer
 }
 
@@ -158,6 +265,25 @@ func (slb *subscriptionLoadBalancer) TakeMessageQueue() (*v2.MessageQueue, error
 	return selectMessageQueue, nil
 }
 
+// TakeMessageQueueByPreference takes the preferred message queues in round-robin, or any message queue
+// if none of them is preferred.
+func (slb *subscriptionLoadBalancer) TakeMessageQueueByPreference(preferred func(*v2.MessageQueue) bool) (*v2.MessageQueue, error) {
+	if len(slb.messageQueues) == 0 {
+		return nil, fmt.Errorf("messageQueues is empty")
+	}
+	next := slb.index.Inc()
+	var candidates []*v2.MessageQueue
+	for _, mq := range slb.messageQueues {
+		if preferred(mq) {
+			candidates = append(candidates, mq)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = slb.messageQueues
+	}
+	return candidates[utils.Mod(next+1, len(candidates))], nil
+}
+
 func (slb *subscriptionLoadBalancer) CopyAndUpdate(messageQueues []*v2.MessageQueue) SubscriptionLoadBalancer {
 	return &subscriptionLoadBalancer{
 		messageQueues: messageQueues,
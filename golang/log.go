@@ -40,6 +40,17 @@ const (
 	ENABLE_CONSOLE_APPENDER = "mq.consoleAppender.enabled"
 )
 
+// Keys of the structured fields attached to the logs of client lifecycle events, such as connecting,
+// route refreshing, sending failure and rebalance.
+const (
+	logFieldClientID  = "client_id"
+	logFieldTopic     = "topic"
+	logFieldBroker    = "broker"
+	logFieldEndpoints = "endpoints"
+	logFieldErrorCode = "error_code"
+	logFieldError     = "error"
+)
+
 var sugarBaseLogger *zap.SugaredLogger
 
 func ResetLogger() {
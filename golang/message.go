@@ -34,6 +34,14 @@ import (
 type UnifiedMessage struct {
 	msg    *Message
 	pubMsg *PublishingMessage
+	// intercepted tells whether msg has been passed to the send interceptors.
+	intercepted bool
+	// session pins the message queue of sends, see Producer.SendWithSession.
+	session *SendSession
+	// asyncSince is the time of SendAsync, zero for synchronous sends.
+	asyncSince time.Time
+	// batched tells whether the message is sent by Producer.SendBatch.
+	batched bool
 }
 
 func (uMsg *UnifiedMessage) GetMessage() *Message {
@@ -64,6 +72,25 @@ const (
 	MessageHookPoints_FORWARD_TO_DLQ
 )
 
+const (
+	// BodyCharsetProperty is the user property declaring the charset of message body, bodies are always
+	// delivered as raw bytes regardless of the charset.
+	BodyCharsetProperty = "__BODY_CHARSET"
+	// BodyCharsetBinary declares the message body is binary rather than text.
+	BodyCharsetBinary = "binary"
+)
+
+// MessagePriority is a best-effort hint of the producer to route messages, which is not enforced by brokers.
+type MessagePriority int32
+
+const (
+	// MessagePriority_LOW messages tolerate degraded brokers, they are routed like normal ones.
+	MessagePriority_LOW MessagePriority = iota - 1
+	MessagePriority_NORMAL
+	// MessagePriority_HIGH messages prefer brokers with lower recent send latency.
+	MessagePriority_HIGH
+)
+
 type MessageInterceptor interface {
 	doBefore(messageHookPoints MessageHookPoints, messageCommons []*MessageCommon) error
 	doAfter(messageHookPoints MessageHookPoints, messageCommons []*MessageCommon, duration time.Duration, status MessageHookPointsStatus) error
@@ -74,11 +101,16 @@ type Message struct {
 	Body         []byte
 	Tag          *string
 	messageGroup *string
+	shardingKey  *string
+	priority     MessagePriority
+	dedupKey     *string
+	delayLevel   int
 	keys         []string
 	properties   map[string]string
 	LiteTopic    *string
 
 	deliveryTimestamp  *time.Time
+	bornTimestamp      *time.Time
 	parentTraceContext *string
 }
 
@@ -87,6 +119,19 @@ type SendReceipt struct {
 	TransactionId string
 	Offset        int64
 	Endpoints     *v2.Endpoints
+
+	// err is the failure of the message reported by its result entry, while the request succeeds.
+	err error
+	// rawResponse is the response of the send request carrying the message, see RawResponse.
+	rawResponse *v2.SendMessageResponse
+}
+
+// RawResponse returns the raw response of the send request carrying the message, which is shared by the receipts of
+// messages sent in a batch, e.g. for diagnostics or fields of brokers not surfaced by the receipt yet.
+//
+// Experimental: it exposes the protocol as is, which may change without notice, prefer the fields of the receipt.
+func (receipt *SendReceipt) RawResponse() *v2.SendMessageResponse {
+	return receipt.rawResponse
 }
 
 func (msg *Message) SetTag(tag string) {
@@ -128,6 +173,25 @@ func (msg *Message) AddProperty(key, value string) {
 	msg.getOrNewProperties()[key] = value
 }
 
+// AddIntProperty adds a property of integer value, which is encoded in decimal without leading zeros or plus sign,
+// e.g. "-42", so that SQL92 filters compare it as a number, e.g. "a > 10".
+func (msg *Message) AddIntProperty(key string, value int64) {
+	msg.AddProperty(key, strconv.FormatInt(value, 10))
+}
+
+// AddBoolProperty adds a property of boolean value, which is encoded as "true" or "false", so that SQL92 filters
+// match it by "a = TRUE" or "a IS TRUE".
+func (msg *Message) AddBoolProperty(key string, value bool) {
+	msg.AddProperty(key, strconv.FormatBool(value))
+}
+
+// AddFloatProperty adds a property of floating-point value, which is encoded in decimal without exponent by the
+// fewest digits representing value exactly, e.g. "0.1" or "1500000", so that SQL92 filters compare it as a number.
+// NaN and infinities have no numeric encoding in SQL92, and are encoded as "NaN", "+Inf" and "-Inf".
+func (msg *Message) AddFloatProperty(key string, value float64) {
+	msg.AddProperty(key, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
 func (msg *Message) SetDelayTimestamp(deliveryTimestamp time.Time) {
 	msg.deliveryTimestamp = &deliveryTimestamp
 }
@@ -136,6 +200,28 @@ func (msg *Message) GetDeliveryTimestamp() *time.Time {
 	return msg.deliveryTimestamp
 }
 
+// SetBornTimestamp overrides the born timestamp of message, which is the time of sending by default, e.g. to keep
+// the time of original events when backfilling them. The delivery latency of consumers is measured from the delivery
+// timestamp instead, so it is not affected.
+func (msg *Message) SetBornTimestamp(bornTimestamp time.Time) {
+	msg.bornTimestamp = &bornTimestamp
+}
+
+func (msg *Message) GetBornTimestamp() *time.Time {
+	return msg.bornTimestamp
+}
+
+// SetDelayLevel sets the classic delay level of message, which is carried by the DELAY property for brokers
+// supporting delay levels only, e.g. level 3 is 10s with the default levels of brokers.
+// It is mutually exclusive with SetDelayTimestamp, and is validated by the producer against WithMaxDelayLevel.
+func (msg *Message) SetDelayLevel(level int) {
+	msg.delayLevel = level
+}
+
+func (msg *Message) GetDelayLevel() int {
+	return msg.delayLevel
+}
+
 func (msg *Message) SetMessageGroup(messageGroup string) {
 	msg.messageGroup = &messageGroup
 }
@@ -144,6 +230,46 @@ func (msg *Message) GetMessageGroup() *string {
 	return msg.messageGroup
 }
 
+// SetShardingKey makes messages with the same sharding key land on the same message queue,
+// without the ordering semantics of message group. The key is hashed in the same way across
+// client instances, so they agree on the queue as long as the route of topic is the same.
+func (msg *Message) SetShardingKey(shardingKey string) {
+	msg.shardingKey = &shardingKey
+}
+
+func (msg *Message) GetShardingKey() *string {
+	return msg.shardingKey
+}
+
+// SetBodyCharset declares the charset of message body by BodyCharsetProperty, e.g. "GBK" or BodyCharsetBinary.
+func (msg *Message) SetBodyCharset(charset string) {
+	msg.AddProperty(BodyCharsetProperty, charset)
+}
+
+// SetDeduplicationKey makes the producer skip sending the message with ErrDuplicate, if a message with the same key
+// has been accepted by brokers through the producer within its deduplication window, see WithDeduplicationWindow.
+// Deduplication is best-effort on the client side: keys are not shared across producers or restarts, a message sent
+// while another one of the same key is being sent is skipped as well, and a message which failed to send could be
+// sent again.
+func (msg *Message) SetDeduplicationKey(key string) {
+	msg.dedupKey = &key
+}
+
+func (msg *Message) GetDeduplicationKey() *string {
+	return msg.dedupKey
+}
+
+// SetPriority sets the priority hint of the message, see MessagePriority. It only affects the selection of
+// message queues, the order of messages still depends on message groups, and messages with a message group
+// or sharding key are routed by the key regardless of the priority.
+func (msg *Message) SetPriority(priority MessagePriority) {
+	msg.priority = priority
+}
+
+func (msg *Message) GetPriority() MessagePriority {
+	return msg.priority
+}
+
 func (msg *Message) GetMessageCommon() *MessageCommon {
 	return &MessageCommon{
 		topic:              msg.Topic,
@@ -157,6 +283,27 @@ func (msg *Message) GetMessageCommon() *MessageCommon {
 	}
 }
 
+// NewMessageFromView returns a message to send which copies the topic, body, tag, keys and user properties of the
+// consumed message, e.g. to forward it to another topic by changing its Topic. The message group, lite topic and
+// delivery timestamp are not carried over, neither are the fields assigned by brokers such as the message id,
+// receipt handle, born and store information, delivery attempt and the dead letter queue origin.
+func NewMessageFromView(mv *MessageView) *Message {
+	msg := &Message{
+		Topic: mv.GetTopic(),
+		Body:  append([]byte(nil), mv.GetBody()...),
+	}
+	if tag := mv.GetTag(); tag != nil {
+		msg.SetTag(*tag)
+	}
+	if keys := mv.GetKeys(); len(keys) != 0 {
+		msg.SetKeys(keys...)
+	}
+	for k, v := range mv.GetProperties() {
+		msg.AddProperty(k, v)
+	}
+	return msg
+}
+
 type MessageCommon struct {
 	messageId                   *string
 	topic                       string
@@ -187,16 +334,32 @@ type MessageView struct {
 	bornHost                    *string
 	traceContext                *string
 	bornTimestamp               *time.Time
+	storeTimestamp              *time.Time
 	messageQueue                *v2.MessageQueue
 	endpoints                   *v2.Endpoints
 	deliveryAttempt             int32
 	decodeStopwatch             *time.Time
 	deliveryTimestampFromRemote *timestamppb.Timestamp
 	liteTopic                   string
+	originalTopic               string
+	originalMessageId           string
+	transactionId               string
+	storeHost                   string
 
 	offset        int64
 	ReceiptHandle string
 	corrupted     bool
+	expired       bool
+
+	manualAckToken *ManualAckToken
+	// retryAfter is the delay before redelivery requested by FuncRetryAfterMessageListener.
+	retryAfter time.Duration
+	// drained tells whether the message is handed over by PushConsumer.DrainAndClose instead of being consumed.
+	drained bool
+	// consumeErr is the error of the last consumption, see WithDeadLetterPredicate.
+	consumeErr error
+	// abandonedConsumption is closed once the listener which timed out on the message returns, see WithConsumeTimeout.
+	abandonedConsumption chan struct{}
 }
 
 func fromProtobuf_MessageView0(message *v2.Message) *MessageView {
@@ -259,6 +422,7 @@ func fromProtobuf_MessageView2(message *v2.Message, messageQueue *v2.MessageQueu
 
 	mv.keys = systemProperties.GetKeys()
 	mv.bornHost = &systemProperties.BornHost
+	mv.storeHost = systemProperties.GetStoreHost()
 	mv.deliveryAttempt = systemProperties.GetDeliveryAttempt()
 	mv.messageQueue = messageQueue
 	if messageQueue != nil {
@@ -277,11 +441,19 @@ func fromProtobuf_MessageView2(message *v2.Message, messageQueue *v2.MessageQueu
 		bornTimestamp := systemProperties.GetBornTimestamp().AsTime()
 		mv.bornTimestamp = &bornTimestamp
 	}
+	if systemProperties.GetStoreTimestamp() != nil {
+		storeTimestamp := systemProperties.GetStoreTimestamp().AsTime()
+		mv.storeTimestamp = &storeTimestamp
+	}
 	if systemProperties.GetLiteTopic() != "" {
 		mv.liteTopic = systemProperties.GetLiteTopic()
 	}
+	if dlq := systemProperties.GetDeadLetterQueue(); dlq != nil {
+		mv.originalTopic = dlq.GetTopic()
+		mv.originalMessageId = dlq.GetMessageId()
+	}
 	mv.deliveryTimestampFromRemote = deliveryTimestampFromRemote
-	decodeStopwatch := time.Now()
+	decodeStopwatch := defaultClock.Now()
 	mv.decodeStopwatch = &decodeStopwatch
 	return mv
 }
@@ -321,6 +493,24 @@ func (msg *MessageView) GetLiteTopic() string {
 	return msg.liteTopic
 }
 
+// GetOriginalTopic returns the topic which the message was sent to before it was forwarded to
+// the dead letter queue, it is empty if the message is not from dead letter queue.
+func (msg *MessageView) GetOriginalTopic() string {
+	return msg.originalTopic
+}
+
+// GetOriginalMessageId returns the message id before the message was forwarded to
+// the dead letter queue, it is empty if the message is not from dead letter queue.
+func (msg *MessageView) GetOriginalMessageId() string {
+	return msg.originalMessageId
+}
+
+// GetTransactionId returns the transaction id of the half message being checked by TransactionChecker,
+// it is empty otherwise.
+func (msg *MessageView) GetTransactionId() string {
+	return msg.transactionId
+}
+
 func (msg *MessageView) GetBody() []byte {
 	return msg.body
 }
@@ -353,10 +543,20 @@ func (msg *MessageView) GetBornHost() *string {
 	return msg.bornHost
 }
 
+// GetStoreHost returns the host of broker which stored the message, which is empty if not provided by the broker.
+func (msg *MessageView) GetStoreHost() string {
+	return msg.storeHost
+}
+
 func (msg *MessageView) GetBornTimestamp() *time.Time {
 	return msg.bornTimestamp
 }
 
+// GetStoreTimestamp returns the time when the message was stored by broker, which is nil if not provided by the broker.
+func (msg *MessageView) GetStoreTimestamp() *time.Time {
+	return msg.storeTimestamp
+}
+
 func (msg *MessageView) GetDeliveryAttempt() int32 {
 	return msg.deliveryAttempt
 }
@@ -369,6 +569,45 @@ func (msg *MessageView) GetReceiptHandle() string {
 	return msg.ReceiptHandle
 }
 
+// GetBodyCharset returns the declared charset of the body, which is empty if not declared.
+// The body returned by GetBody is always the raw bytes sent by the producer.
+func (msg *MessageView) GetBodyCharset() string {
+	return msg.properties[BodyCharsetProperty]
+}
+
+// GetIntProperty returns the property of key decoded as an integer, see Message.AddIntProperty.
+// ok is false if the property is absent or is not an integer.
+func (msg *MessageView) GetIntProperty(key string) (value int64, ok bool) {
+	value, err := strconv.ParseInt(msg.properties[key], 10, 64)
+	return value, err == nil
+}
+
+// GetBoolProperty returns the property of key decoded as a boolean, see Message.AddBoolProperty.
+// ok is false if the property is absent or is not a boolean.
+func (msg *MessageView) GetBoolProperty(key string) (value bool, ok bool) {
+	value, err := strconv.ParseBool(msg.properties[key])
+	return value, err == nil
+}
+
+// GetFloatProperty returns the property of key decoded as a floating-point number, see Message.AddFloatProperty.
+// ok is false if the property is absent or is not a number.
+func (msg *MessageView) GetFloatProperty(key string) (value float64, ok bool) {
+	value, err := strconv.ParseFloat(msg.properties[key], 64)
+	return value, err == nil
+}
+
+// GetManualAckToken returns the token to acknowledge the message by PushConsumer.AckManually,
+// which is nil unless the push consumer is in manual-ack mode.
+func (msg *MessageView) GetManualAckToken() *ManualAckToken {
+	return msg.manualAckToken
+}
+
+// IsExpired reports whether the message is expired according to the expiry property of the push consumer,
+// which is only visible to the listener if expired messages are delivered.
+func (msg *MessageView) IsExpired() bool {
+	return msg.expired
+}
+
 func (msg *MessageView) GetOffset() int64 {
 	return msg.offset
 }
@@ -19,6 +19,13 @@ package golang
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"os/signal"
+	"reflect"
 	"sync"
 	"time"
 
@@ -30,8 +37,10 @@ import (
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type InvocationStatus string
@@ -41,16 +50,41 @@ const (
 	InvocationStatus_FAILURE InvocationStatus = "failure"
 )
 
+// MetricTagValueOverflow is the tag value recorded instead once the distinct values of a tag exceed the limit,
+// see WithMaxDistinctMetricTagValues.
+const MetricTagValueOverflow = "other"
+
 var (
 	topicTag, _            = tag.NewKey("topic")
 	clientIdTag, _         = tag.NewKey("client_id")
 	invocationStatusTag, _ = tag.NewKey("invocation_status")
 	consumerGroupTag, _    = tag.NewKey("consumer_group")
+	endpointTag, _         = tag.NewKey("endpoint")
+	brokerNameTag, _       = tag.NewKey("broker_name")
+	queueIdTag, _          = tag.NewKey("queue_id")
+	clientManagerTag, _    = tag.NewKey("client_manager")
 
 	PublishMLatencyMs         = stats.Int64("publish_latency", "Publish latency in milliseconds", "ms")
+	PublishTotalM             = stats.Int64("publish_total", "Messages published, tagged by invocation status", stats.UnitDimensionless)
 	ConsumeDeliveryMLatencyMs = stats.Int64("delivery_latency", "Time spent delivering messages from servers to clients", "ms")
 	ConsumeAwaitMLatencyMs    = stats.Int64("await_time", "Client side queuing time of messages before getting processed", "ms")
 	ConsumeProcessMLatencyMs  = stats.Int64("process_time", "Process message time", "ms")
+	ConsumeExpiredMessagesM   = stats.Int64("expired_messages", "Messages skipped because of expiry", stats.UnitDimensionless)
+	ConsumeSkippedMessagesM   = stats.Int64("skipped_messages", "Messages acked without consumption because of being stale", stats.UnitDimensionless)
+	ConsumeDroppedMessagesM   = stats.Int64("dropped_messages", "Messages acked because the dead letter queue is missing", stats.UnitDimensionless)
+	ConsumeNackedMessagesM    = stats.Int64("nacked_messages", "Messages nacked to be redelivered later", stats.UnitDimensionless)
+	ConsumeTimeoutsM          = stats.Int64("consume_timeouts", "Consumptions exceeding the consume timeout", stats.UnitDimensionless)
+	ConsumeRebalanceChurnM    = stats.Int64("rebalance_churn", "Message queues taken or dropped by rebalances", stats.UnitDimensionless)
+	ConsumeAwaitingMessagesM  = stats.Int64("awaiting_messages", "Messages received and waiting for a free consumption thread", stats.UnitDimensionless)
+	ActiveConnectionsM        = stats.Int64("active_connections", "Number of gRPC connections held by the client", stats.UnitDimensionless)
+	GoroutinesM               = stats.Int64("goroutines", "Goroutines started by the client for requests and callbacks", stats.UnitDimensionless)
+	ClockSkewMs               = stats.Int64("clock_skew", "Estimated clock skew of the client ahead of brokers", "ms")
+	HeartbeatMLatencyMs       = stats.Int64("heartbeat_latency", "Heartbeat latency in milliseconds", "ms")
+	HeartbeatFailuresM        = stats.Int64("heartbeat_failures", "Heartbeats failed", stats.UnitDimensionless)
+	PublishThrottledM         = stats.Int64("publish_throttled", "Sends delayed or rejected by the send rate limit", stats.UnitDimensionless)
+	PublishQueueSelectionsM   = stats.Int64("publish_queue_selections", "Send attempts by the message queue selected", stats.UnitDimensionless)
+	PublishBrokerThrottledM   = stats.Int64("publish_broker_throttled", "Sends throttled by brokers", stats.UnitDimensionless)
+	PublishAsyncWaitMs        = stats.Int64("publish_async_wait", "Time from SendAsync to the send request of message", "ms")
 
 	PublishLatencyView = view.View{
 		Name:        "rocketmq_send_cost_time",
@@ -60,6 +94,16 @@ var (
 		TagKeys:     []tag.Key{topicTag, clientIdTag, invocationStatusTag},
 	}
 
+	// PublishTotalView counts messages published by invocation status, so that
+	// the success rate of a topic is the ratio of its success count to the total.
+	PublishTotalView = view.View{
+		Name:        "rocketmq_publish_total",
+		Description: "Published messages",
+		Measure:     PublishTotalM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag, invocationStatusTag},
+	}
+
 	ConsumeDeliveryLatencyView = view.View{
 		Name:        "rocketmq_delivery_latency",
 		Description: "Message delivery latency",
@@ -83,29 +127,323 @@ var (
 		Aggregation: view.Distribution(1, 5, 10, 100, 1000, 10000, 60000),
 		TagKeys:     []tag.Key{topicTag, clientIdTag, consumerGroupTag, invocationStatusTag},
 	}
+
+	ConsumeExpiredMessagesView = view.View{
+		Name:        "rocketmq_expired_messages",
+		Description: "Expired messages",
+		Measure:     ConsumeExpiredMessagesM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag, consumerGroupTag},
+	}
+
+	ConsumeSkippedMessagesView = view.View{
+		Name:        "rocketmq_skipped_messages",
+		Description: "Stale messages skipped",
+		Measure:     ConsumeSkippedMessagesM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag, consumerGroupTag},
+	}
+
+	ConsumeDroppedMessagesView = view.View{
+		Name:        "rocketmq_dropped_messages",
+		Description: "Messages dropped without dead letter queue",
+		Measure:     ConsumeDroppedMessagesM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag, consumerGroupTag},
+	}
+
+	ConsumeNackedMessagesView = view.View{
+		Name:        "rocketmq_nacked_messages",
+		Description: "Nacked messages",
+		Measure:     ConsumeNackedMessagesM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag, consumerGroupTag},
+	}
+
+	ConsumeTimeoutsView = view.View{
+		Name:        "rocketmq_consume_timeouts",
+		Description: "Consumptions timed out",
+		Measure:     ConsumeTimeoutsM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag, consumerGroupTag},
+	}
+
+	ConsumeRebalanceChurnView = view.View{
+		Name:        "rocketmq_rebalance_churn",
+		Description: "Message queues moved by rebalances",
+		Measure:     ConsumeRebalanceChurnM,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag, consumerGroupTag},
+	}
+
+	ConsumeAwaitingMessagesView = view.View{
+		Name:        "rocketmq_awaiting_messages",
+		Description: "Messages waiting for a free consumption thread",
+		Measure:     ConsumeAwaitingMessagesM,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag, consumerGroupTag},
+	}
+
+	ActiveConnectionsView = view.View{
+		Name:        "rocketmq_active_connections",
+		Description: "Active gRPC connections of each client manager, which clients of a SharedConnectionPool share",
+		Measure:     ActiveConnectionsM,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{clientManagerTag},
+	}
+
+	GoroutinesView = view.View{
+		Name:        "rocketmq_goroutines",
+		Description: "Running goroutines of the client",
+		Measure:     GoroutinesM,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{clientIdTag},
+	}
+
+	ClockSkewView = view.View{
+		Name:        "rocketmq_clock_skew",
+		Description: "Estimated clock skew",
+		Measure:     ClockSkewMs,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{clientIdTag},
+	}
+
+	HeartbeatLatencyView = view.View{
+		Name:        "rocketmq_heartbeat_latency",
+		Description: "Heartbeat latency",
+		Measure:     HeartbeatMLatencyMs,
+		Aggregation: view.Distribution(1, 5, 10, 20, 50, 200, 500),
+		TagKeys:     []tag.Key{clientIdTag, endpointTag},
+	}
+
+	HeartbeatFailuresView = view.View{
+		Name:        "rocketmq_heartbeat_failures",
+		Description: "Failed heartbeats",
+		Measure:     HeartbeatFailuresM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{clientIdTag, endpointTag},
+	}
+
+	PublishThrottledView = view.View{
+		Name:        "rocketmq_publish_throttled",
+		Description: "Throttled sends",
+		Measure:     PublishThrottledM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag},
+	}
+
+	// PublishQueueSelectionsView counts send attempts by the message queue selected, to tell whether sends are spread
+	// evenly across the queues of topic.
+	PublishQueueSelectionsView = view.View{
+		Name:        "rocketmq_publish_queue_selections",
+		Description: "Message queues selected by sends",
+		Measure:     PublishQueueSelectionsM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag, brokerNameTag, queueIdTag},
+	}
+
+	PublishBrokerThrottledView = view.View{
+		Name:        "rocketmq_publish_broker_throttled",
+		Description: "Sends throttled by brokers",
+		Measure:     PublishBrokerThrottledM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{topicTag, clientIdTag},
+	}
+
+	// PublishAsyncWaitView covers the wait for the turn of sharding key, the send rate limit and the route of topic.
+	PublishAsyncWaitView = view.View{
+		Name:        "rocketmq_publish_async_wait",
+		Description: "Async send wait time",
+		Measure:     PublishAsyncWaitMs,
+		Aggregation: view.Distribution(1, 5, 10, 20, 50, 200, 500),
+		TagKeys:     []tag.Key{topicTag, clientIdTag},
+	}
 )
 
 func init() {
-	if err := view.Register(&PublishLatencyView, &ConsumeDeliveryLatencyView, &ConsumeAwaitTimeView, &ConsumeProcessTimeView); err != nil {
+	if err := view.Register(&PublishLatencyView, &PublishTotalView, &ConsumeDeliveryLatencyView, &ConsumeAwaitTimeView, &ConsumeProcessTimeView, &ConsumeExpiredMessagesView, &ConsumeSkippedMessagesView, &ConsumeDroppedMessagesView, &ConsumeNackedMessagesView, &ConsumeTimeoutsView, &ConsumeRebalanceChurnView, &ConsumeAwaitingMessagesView, &ActiveConnectionsView, &GoroutinesView, &ClockSkewView, &HeartbeatLatencyView, &HeartbeatFailuresView, &PublishThrottledView, &PublishQueueSelectionsView, &PublishBrokerThrottledView, &PublishAsyncWaitView); err != nil {
 		sugarBaseLogger.Fatalf("failed to register views: %v", err)
 	}
 	view.SetReportingPeriod(time.Minute)
 }
 
+var (
+	measureViews = map[string]*view.View{
+		PublishMLatencyMs.Name():         &PublishLatencyView,
+		PublishTotalM.Name():             &PublishTotalView,
+		ConsumeDeliveryMLatencyMs.Name(): &ConsumeDeliveryLatencyView,
+		ConsumeAwaitMLatencyMs.Name():    &ConsumeAwaitTimeView,
+		ConsumeProcessMLatencyMs.Name():  &ConsumeProcessTimeView,
+		ConsumeExpiredMessagesM.Name():   &ConsumeExpiredMessagesView,
+		ConsumeSkippedMessagesM.Name():   &ConsumeSkippedMessagesView,
+		ConsumeDroppedMessagesM.Name():   &ConsumeDroppedMessagesView,
+		ConsumeNackedMessagesM.Name():    &ConsumeNackedMessagesView,
+		ConsumeTimeoutsM.Name():          &ConsumeTimeoutsView,
+		ConsumeRebalanceChurnM.Name():    &ConsumeRebalanceChurnView,
+		ConsumeAwaitingMessagesM.Name():  &ConsumeAwaitingMessagesView,
+		ActiveConnectionsM.Name():        &ActiveConnectionsView,
+		GoroutinesM.Name():               &GoroutinesView,
+		ClockSkewMs.Name():               &ClockSkewView,
+		HeartbeatMLatencyMs.Name():       &HeartbeatLatencyView,
+		HeartbeatFailuresM.Name():        &HeartbeatFailuresView,
+		PublishThrottledM.Name():         &PublishThrottledView,
+		PublishQueueSelectionsM.Name():   &PublishQueueSelectionsView,
+		PublishBrokerThrottledM.Name():   &PublishBrokerThrottledView,
+		PublishAsyncWaitMs.Name():        &PublishAsyncWaitView,
+	}
+	measureViewsLock sync.Mutex
+	// constantTagKeys are the keys of WithConstantTags registered with the views, see registerConstantTagKeys.
+	constantTagKeys []tag.Key
+	// metricStartTime is the start time of the data exported by flushes, views are registered around it.
+	metricStartTime = time.Now()
+)
+
+func measureViewName(base string, aggregation *view.Aggregation) string {
+	switch aggregation.Type {
+	case view.AggTypeCount:
+		return base + "_count"
+	case view.AggTypeSum:
+		return base + "_sum"
+	case view.AggTypeLastValue:
+		return base + "_last_value"
+	default:
+		return base
+	}
+}
+
+// registerMeasureViews replaces the default view of the measure with one view per aggregation.
+// Views which are already registered with the same aggregation keep their collected data.
+func registerMeasureViews(measureName string, aggregations []*view.Aggregation) error {
+	measureViewsLock.Lock()
+	defer measureViewsLock.Unlock()
+	base, ok := measureViews[measureName]
+	if !ok {
+		return fmt.Errorf("no view is defined for measure=%s", measureName)
+	}
+	if len(aggregations) == 0 {
+		return nil
+	}
+	views := make([]*view.View, 0, len(aggregations))
+	keepBase := false
+	for _, aggregation := range aggregations {
+		name := measureViewName(base.Name, aggregation)
+		if name == base.Name {
+			keepBase = true
+		}
+		views = append(views, &view.View{
+			Name:        name,
+			Description: base.Description,
+			Measure:     base.Measure,
+			Aggregation: aggregation,
+			TagKeys:     base.TagKeys,
+		})
+	}
+	if !keepBase {
+		if registered := view.Find(base.Name); registered != nil {
+			view.Unregister(registered)
+		}
+	}
+	for _, v := range views {
+		registered := view.Find(v.Name)
+		if registered != nil && (registered.Aggregation.Type != v.Aggregation.Type || !reflect.DeepEqual(registered.Aggregation.Buckets, v.Aggregation.Buckets)) {
+			view.Unregister(registered)
+		}
+	}
+	return view.Register(views...)
+}
+
+// registerConstantTagKeys adds keys to the tag keys of the views of every measure, including those of
+// WithMetricAggregations. The keys are registered once per process, so that views are replaced only once, keys of
+// later calls must be among the registered ones.
+func registerConstantTagKeys(keys []tag.Key) error {
+	measureViewsLock.Lock()
+	defer measureViewsLock.Unlock()
+	if len(keys) == 0 {
+		return nil
+	}
+	if constantTagKeys != nil {
+		for _, key := range keys {
+			if !containsTagKey(constantTagKeys, key) {
+				return fmt.Errorf("constant tag key=%s is not among the keys registered by another client, keys=%v", key.Name(), constantTagKeys)
+			}
+		}
+		return nil
+	}
+	constantTagKeys = append([]tag.Key{}, keys...)
+	for measureName, base := range measureViews {
+		tagKeys := append([]tag.Key{}, base.TagKeys...)
+		for _, key := range keys {
+			if !containsTagKey(tagKeys, key) {
+				tagKeys = append(tagKeys, key)
+			}
+		}
+		registered := findMeasureViews(base)
+		replaced := *base
+		replaced.TagKeys = tagKeys
+		measureViews[measureName] = &replaced
+		for _, r := range registered {
+			v := *r
+			v.TagKeys = tagKeys
+			view.Unregister(r)
+			if err := view.Register(&v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findMeasureViews returns the registered views of the measure of base, including those of WithMeasureAggregations.
+func findMeasureViews(base *view.View) []*view.View {
+	aggregations := []*view.Aggregation{view.Distribution(), view.Count(), view.Sum(), view.LastValue()}
+	views := make([]*view.View, 0, len(aggregations))
+	for _, aggregation := range aggregations {
+		if v := view.Find(measureViewName(base.Name, aggregation)); v != nil {
+			views = append(views, v)
+		}
+	}
+	return views
+}
+
+// registeredMeasureViews returns the registered views of all measures, including those of WithMeasureAggregations.
+func registeredMeasureViews() []*view.View {
+	measureViewsLock.Lock()
+	defer measureViewsLock.Unlock()
+	views := make([]*view.View, 0, len(measureViews))
+	for _, base := range measureViews {
+		views = append(views, findMeasureViews(base)...)
+	}
+	return views
+}
+
+func containsTagKey(keys []tag.Key, key tag.Key) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
 type defaultClientMeter struct {
 	enabled     atomic.Bool
 	endpoints   *v2.Endpoints
 	ocaExporter view.Exporter
-	mutex       sync.Mutex
+	// traceExporter exports spans, which is nil unless WithTraceExport is enabled.
+	traceExporter trace.Exporter
+	mutex         sync.Mutex
 }
 
 func (dcm *defaultClientMeter) shutdown() {
-	if !dcm.enabled.Load() {
+	if !dcm.enabled.Load() && dcm.ocaExporter == nil {
 		return
 	}
 	dcm.mutex.Lock()
 	defer dcm.mutex.Unlock()
 	view.UnregisterExporter(dcm.ocaExporter)
+	if dcm.traceExporter != nil {
+		trace.UnregisterExporter(dcm.traceExporter)
+	}
 	if dcm.ocaExporter != nil {
 		exporter, ok := dcm.ocaExporter.(*ocagent.Exporter)
 		if ok {
@@ -117,11 +455,63 @@ func (dcm *defaultClientMeter) shutdown() {
 	}
 }
 
+// flush exports the data collected so far of all views, without waiting for the reporting period.
+// It does not hold the mutex, so that shutdown is not blocked by a slow export.
+func (dcm *defaultClientMeter) flush() {
+	if !dcm.enabled.Load() || dcm.ocaExporter == nil {
+		return
+	}
+	now := time.Now()
+	for _, v := range registeredMeasureViews() {
+		rows, err := view.RetrieveData(v.Name)
+		if err != nil || len(rows) == 0 {
+			continue
+		}
+		dcm.ocaExporter.ExportView(&view.Data{
+			View:  v,
+			Start: metricStartTime,
+			End:   now,
+			Rows:  rows,
+		})
+	}
+	if exporter, ok := dcm.ocaExporter.(*ocagent.Exporter); ok {
+		exporter.Flush()
+	}
+}
+
 func (dcm *defaultClientMeter) start() {
 	if !dcm.enabled.Load() {
 		return
 	}
 	view.RegisterExporter(dcm.ocaExporter)
+	if dcm.traceExporter != nil {
+		trace.RegisterExporter(dcm.traceExporter)
+	}
+}
+
+// pause stops exporting while keeping the exporter, so that resume does not need to recreate it.
+func (dcm *defaultClientMeter) pause() {
+	dcm.mutex.Lock()
+	defer dcm.mutex.Unlock()
+	if !dcm.enabled.CAS(true, false) {
+		return
+	}
+	view.UnregisterExporter(dcm.ocaExporter)
+	if dcm.traceExporter != nil {
+		trace.UnregisterExporter(dcm.traceExporter)
+	}
+}
+
+func (dcm *defaultClientMeter) resume() {
+	dcm.mutex.Lock()
+	defer dcm.mutex.Unlock()
+	if !dcm.enabled.CAS(false, true) {
+		return
+	}
+	view.RegisterExporter(dcm.ocaExporter)
+	if dcm.traceExporter != nil {
+		trace.RegisterExporter(dcm.traceExporter)
+	}
 }
 
 var NewDefaultClientMeter = func(exporter view.Exporter, on bool, endpoints *v2.Endpoints, clientID string) *defaultClientMeter {
@@ -138,6 +528,12 @@ type MessageMeterInterceptor interface {
 
 type defaultMessageMeterInterceptor struct {
 	clientMeterProvider ClientMeterProvider
+	sampleCounter       atomic.Int64
+
+	// clockSkew is the moving average of the estimated clock skew in nanoseconds.
+	clockSkew         atomic.Int64
+	clockSkewObserved atomic.Bool
+	clockSkewExceeded atomic.Bool
 }
 
 type ClientMeterProvider interface {
@@ -145,14 +541,85 @@ type ClientMeterProvider interface {
 	isEnabled() bool
 	getClientID() string
 	getClientImpl() isClient
+	onDeliveryLatencyExceeded(topic string, threshold time.Duration, f func(actual time.Duration))
+	getDeliveryLatencyThreshold(topic string) (*deliveryLatencyThreshold, bool)
+	getSampleRate() int64
+	getClockSkewThreshold() time.Duration
+	isClockSkewCorrected() bool
+	getClockSkewCorrection() time.Duration
+	sanitizeTagValue(key tag.Key, value string) string
+	tagContext() context.Context
+	flushOnStop()
+	shutdown()
+	goAsync(f func())
+}
+
+type deliveryLatencyThreshold struct {
+	threshold time.Duration
+	f         func(actual time.Duration)
+}
+
+// goAsync runs f in a goroutine accounted by the client, if the client is a defaultClient.
+func (dcmp *defaultClientMeterProvider) goAsync(f func()) {
+	if dc, ok := dcmp.client.(*defaultClient); ok {
+		dc.goAsync(f)
+		return
+	}
+	go f()
+}
+
+// shutdown stops exporting and closes the exporter for good, unlike Reset which only pauses an existing exporter for
+// settings to turn metrics on again.
+func (dcmp *defaultClientMeterProvider) shutdown() {
+	dcmp.globalMutex.Lock()
+	defer dcmp.globalMutex.Unlock()
+	dcmp.clientMeter.shutdown()
+	dcmp.clientMeter = NewDefaultClientMeter(nil, false, nil, dcmp.client.GetClientID())
 }
 
 var _ = ClientMeterProvider(&defaultClientMeterProvider{})
 
 type defaultClientMeterProvider struct {
+	opts        clientMeterProviderOptions
 	client      Client
+	userAgent   string
+	tlsConfig   *tls.Config
 	clientMeter *defaultClientMeter
 	globalMutex sync.Mutex
+
+	deliveryLatencyThresholds sync.Map
+	exportFailures            atomic.Int64
+
+	tagValuesLock sync.Mutex
+	tagValues     map[tag.Key]map[string]struct{}
+	// tagCtx carries the tags of WithConstantTags, measurements are recorded with it.
+	tagCtx context.Context
+
+	finalFlushed     atomic.Bool
+	flushSignalsDone chan struct{}
+	flushSignalsOnce sync.Once
+
+	// messageMeterInterceptor estimates the clock skew between the client and brokers.
+	messageMeterInterceptor *defaultMessageMeterInterceptor
+}
+
+func (dcmp *defaultClientMeterProvider) onDeliveryLatencyExceeded(topic string, threshold time.Duration, f func(actual time.Duration)) {
+	if f == nil {
+		dcmp.deliveryLatencyThresholds.Delete(topic)
+		return
+	}
+	dcmp.deliveryLatencyThresholds.Store(topic, &deliveryLatencyThreshold{
+		threshold: threshold,
+		f:         f,
+	})
+}
+
+func (dcmp *defaultClientMeterProvider) getDeliveryLatencyThreshold(topic string) (*deliveryLatencyThreshold, bool) {
+	v, ok := dcmp.deliveryLatencyThresholds.Load(topic)
+	if !ok {
+		return nil, false
+	}
+	return v.(*deliveryLatencyThreshold), true
 }
 
 func (dcmp *defaultClientMeterProvider) getClientImpl() isClient {
@@ -194,8 +661,8 @@ func (dmmi *defaultMessageMeterInterceptor) doBeforeConsumeMessage(messageCommon
 		if messageCommon.decodeStopwatch == nil {
 			continue
 		}
-		duration := time.Since(*messageCommon.decodeStopwatch)
-		err := stats.RecordWithTags(context.Background(), []tag.Mutator{tag.Insert(topicTag, messageCommon.topic), tag.Insert(clientIdTag, dmmi.clientMeterProvider.getClientID()), tag.Insert(consumerGroupTag, consumerGroup)}, ConsumeAwaitMLatencyMs.M(duration.Milliseconds()))
+		duration := defaultClock.Since(*messageCommon.decodeStopwatch)
+		err := stats.RecordWithTags(dmmi.clientMeterProvider.tagContext(), []tag.Mutator{tag.Insert(topicTag, dmmi.clientMeterProvider.sanitizeTagValue(topicTag, messageCommon.topic)), tag.Insert(clientIdTag, dmmi.clientMeterProvider.getClientID()), tag.Insert(consumerGroupTag, dmmi.clientMeterProvider.sanitizeTagValue(consumerGroupTag, consumerGroup))}, ConsumeAwaitMLatencyMs.M(duration.Milliseconds()))
 		if err != nil {
 			return err
 		}
@@ -230,7 +697,7 @@ func (dmmi *defaultMessageMeterInterceptor) doAfterConsumeMessage(messageCommons
 		invocationStatus = InvocationStatus_SUCCESS
 	}
 	for _, messageCommon := range messageCommons {
-		err := stats.RecordWithTags(context.Background(), []tag.Mutator{tag.Insert(topicTag, messageCommon.topic), tag.Insert(clientIdTag, dmmi.clientMeterProvider.getClientID()), tag.Insert(consumerGroupTag, consumerGroup), tag.Insert(invocationStatusTag, string(invocationStatus))}, ConsumeProcessMLatencyMs.M(duration.Milliseconds()))
+		err := stats.RecordWithTags(dmmi.clientMeterProvider.tagContext(), []tag.Mutator{tag.Insert(topicTag, dmmi.clientMeterProvider.sanitizeTagValue(topicTag, messageCommon.topic)), tag.Insert(clientIdTag, dmmi.clientMeterProvider.getClientID()), tag.Insert(consumerGroupTag, dmmi.clientMeterProvider.sanitizeTagValue(consumerGroupTag, consumerGroup)), tag.Insert(invocationStatusTag, string(invocationStatus))}, ConsumeProcessMLatencyMs.M(duration.Milliseconds()))
 		if err != nil {
 			return err
 		}
@@ -239,11 +706,103 @@ func (dmmi *defaultMessageMeterInterceptor) doAfterConsumeMessage(messageCommons
 	return nil
 }
 
+// checkDeliveryLatency invokes the registered callback asynchronously with the largest latency exceeding
+// the threshold of each topic, so that the receive path is never blocked by user code.
+func (dmmi *defaultMessageMeterInterceptor) checkDeliveryLatency(messageCommons []*MessageCommon) {
+	var exceeded map[string]time.Duration
+	for _, messageCommon := range messageCommons {
+		if messageCommon.deliveryTimestamp == nil {
+			continue
+		}
+		threshold, ok := dmmi.clientMeterProvider.getDeliveryLatencyThreshold(messageCommon.topic)
+		if !ok {
+			continue
+		}
+		latency := dmmi.deliveryLatency(messageCommon)
+		if latency <= threshold.threshold {
+			continue
+		}
+		if exceeded == nil {
+			exceeded = make(map[string]time.Duration)
+		}
+		if latency > exceeded[messageCommon.topic] {
+			exceeded[messageCommon.topic] = latency
+		}
+	}
+	for topic, latency := range exceeded {
+		if threshold, ok := dmmi.clientMeterProvider.getDeliveryLatencyThreshold(topic); ok {
+			f := threshold.f
+			dmmi.clientMeterProvider.goAsync(func() { f(latency) })
+		}
+	}
+}
+
+// observeClockSkew estimates the clock skew of the client ahead of brokers by the delivery timestamp of the receive
+// response, and warns once it exceeds the threshold.
+func (dmmi *defaultMessageMeterInterceptor) observeClockSkew(messageCommons []*MessageCommon) {
+	var remote *timestamppb.Timestamp
+	for _, messageCommon := range messageCommons {
+		if messageCommon.deliveryTimestampFromRemote != nil {
+			remote = messageCommon.deliveryTimestampFromRemote
+			break
+		}
+	}
+	if remote == nil {
+		return
+	}
+	sample := int64(defaultClock.Since(remote.AsTime()))
+	if dmmi.clockSkewObserved.CompareAndSwap(false, true) {
+		dmmi.clockSkew.Store(sample)
+	} else {
+		old := dmmi.clockSkew.Load()
+		dmmi.clockSkew.Store(old + (sample-old)/8)
+	}
+	skew := time.Duration(dmmi.clockSkew.Load())
+	threshold := dmmi.clientMeterProvider.getClockSkewThreshold()
+	if threshold <= 0 {
+		return
+	}
+	if skew > threshold || skew < -threshold {
+		if dmmi.clockSkewExceeded.CompareAndSwap(false, true) {
+			sugarBaseLogger.Warnf("clock skew between client and brokers exceeds the threshold, skew=%v, threshold=%v, clientId=%s",
+				skew, threshold, dmmi.clientMeterProvider.getClientID())
+		}
+		return
+	}
+	dmmi.clockSkewExceeded.Store(false)
+}
+
+// clockSkewCorrection returns the estimated clock skew of the client ahead of brokers if WithClockSkewCorrection is
+// enabled, or 0 otherwise.
+func (dmmi *defaultMessageMeterInterceptor) clockSkewCorrection() time.Duration {
+	if !dmmi.clientMeterProvider.isClockSkewCorrected() {
+		return 0
+	}
+	return time.Duration(dmmi.clockSkew.Load())
+}
+
+// deliveryLatency returns the latency since the delivery timestamp of message, corrected by the clock skew if enabled.
+func (dmmi *defaultMessageMeterInterceptor) deliveryLatency(messageCommon *MessageCommon) time.Duration {
+	latency := defaultClock.Since(*messageCommon.deliveryTimestamp) - dmmi.clockSkewCorrection()
+	if latency < 0 {
+		return 0
+	}
+	return latency
+}
+
 func (dmmi *defaultMessageMeterInterceptor) doAfterReceiveMessage(messageCommons []*MessageCommon, duration time.Duration, status MessageHookPointsStatus) error {
 	if len(messageCommons) == 0 {
 		// Should never reach here.
 		return nil
 	}
+	dmmi.observeClockSkew(messageCommons)
+	dmmi.checkDeliveryLatency(messageCommons)
+	if !dmmi.clientMeterProvider.isEnabled() {
+		return nil
+	}
+	if messageCommons = dmmi.sample(messageCommons); len(messageCommons) == 0 {
+		return nil
+	}
 	clientImpl := dmmi.clientMeterProvider.getClientImpl()
 	if clientImpl == nil {
 		return nil
@@ -259,13 +818,19 @@ func (dmmi *defaultMessageMeterInterceptor) doAfterReceiveMessage(messageCommons
 		sugarBaseLogger.Errorf("[Bug] consumerGroup is not recognized, clientId=%s", clientId)
 		return nil
 	}
+	if dmmi.clockSkewObserved.Load() {
+		skew := time.Duration(dmmi.clockSkew.Load())
+		if err := stats.RecordWithTags(dmmi.clientMeterProvider.tagContext(), []tag.Mutator{tag.Insert(clientIdTag, clientId)}, ClockSkewMs.M(skew.Milliseconds())); err != nil {
+			return err
+		}
+	}
 
 	for _, messageCommon := range messageCommons {
 		if messageCommon.deliveryTimestamp == nil {
 			continue
 		}
-		latency := time.Since(*messageCommon.deliveryTimestamp)
-		err := stats.RecordWithTags(context.Background(), []tag.Mutator{tag.Insert(topicTag, messageCommon.topic), tag.Insert(clientIdTag, dmmi.clientMeterProvider.getClientID()), tag.Insert(consumerGroupTag, consumerGroup)}, ConsumeDeliveryMLatencyMs.M(latency.Milliseconds()))
+		latency := dmmi.deliveryLatency(messageCommon)
+		err := stats.RecordWithTags(dmmi.clientMeterProvider.tagContext(), []tag.Mutator{tag.Insert(topicTag, dmmi.clientMeterProvider.sanitizeTagValue(topicTag, messageCommon.topic)), tag.Insert(clientIdTag, dmmi.clientMeterProvider.getClientID()), tag.Insert(consumerGroupTag, dmmi.clientMeterProvider.sanitizeTagValue(consumerGroupTag, consumerGroup))}, ConsumeDeliveryMLatencyMs.M(latency.Milliseconds()))
 		if err != nil {
 			return err
 		}
@@ -274,10 +839,41 @@ func (dmmi *defaultMessageMeterInterceptor) doAfterReceiveMessage(messageCommons
 	return nil
 }
 
+// sample returns the messages to record metrics of, which are 1 in every sample rate messages. Messages with ids are
+// sampled by their ids, so that every hook point of a message makes the same decision.
+func (dmmi *defaultMessageMeterInterceptor) sample(messageCommons []*MessageCommon) []*MessageCommon {
+	if dmmi.clientMeterProvider.getSampleRate() <= 1 {
+		return messageCommons
+	}
+	var sampled []*MessageCommon
+	for _, messageCommon := range messageCommons {
+		if dmmi.isSampled(messageCommon) {
+			sampled = append(sampled, messageCommon)
+		}
+	}
+	return sampled
+}
+
+func (dmmi *defaultMessageMeterInterceptor) isSampled(messageCommon *MessageCommon) bool {
+	rate := dmmi.clientMeterProvider.getSampleRate()
+	if rate <= 1 {
+		return true
+	}
+	if messageCommon.messageId == nil || len(*messageCommon.messageId) == 0 {
+		return dmmi.sampleCounter.Inc()%rate == 0
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(*messageCommon.messageId))
+	return h.Sum64()%uint64(rate) == 0
+}
+
 func (dmmi *defaultMessageMeterInterceptor) doBefore(messageHookPoints MessageHookPoints, messageCommons []*MessageCommon) error {
 	if !dmmi.clientMeterProvider.isEnabled() {
 		return nil
 	}
+	if messageCommons = dmmi.sample(messageCommons); len(messageCommons) == 0 {
+		return nil
+	}
 	switch messageHookPoints {
 	case MessageHookPoints_CONSUME:
 		return dmmi.doBeforeConsumeMessage(messageCommons)
@@ -293,7 +889,12 @@ func (dmmi *defaultMessageMeterInterceptor) doAfterSendMessage(messageCommons []
 		invocationStatus = InvocationStatus_SUCCESS
 	}
 	for _, messageCommon := range messageCommons {
-		err := stats.RecordWithTags(context.Background(), []tag.Mutator{tag.Insert(topicTag, messageCommon.topic), tag.Insert(clientIdTag, dmmi.clientMeterProvider.getClientID()), tag.Insert(invocationStatusTag, string(invocationStatus))}, PublishMLatencyMs.M(duration.Milliseconds()))
+		// The total is recorded for every message, only the latency is sampled.
+		measurements := []stats.Measurement{PublishTotalM.M(1)}
+		if dmmi.isSampled(messageCommon) {
+			measurements = append(measurements, PublishMLatencyMs.M(duration.Milliseconds()))
+		}
+		err := stats.RecordWithTags(dmmi.clientMeterProvider.tagContext(), []tag.Mutator{tag.Insert(topicTag, dmmi.clientMeterProvider.sanitizeTagValue(topicTag, messageCommon.topic)), tag.Insert(clientIdTag, dmmi.clientMeterProvider.getClientID()), tag.Insert(invocationStatusTag, string(invocationStatus))}, measurements...)
 		if err != nil {
 			return err
 		}
@@ -302,6 +903,10 @@ func (dmmi *defaultMessageMeterInterceptor) doAfterSendMessage(messageCommons []
 }
 
 func (dmmi *defaultMessageMeterInterceptor) doAfter(messageHookPoints MessageHookPoints, messageCommons []*MessageCommon, duration time.Duration, status MessageHookPointsStatus) error {
+	// Delivery latency thresholds are evaluated even if metrics are off.
+	if messageHookPoints == MessageHookPoints_RECEIVE {
+		return dmmi.doAfterReceiveMessage(messageCommons, duration, status)
+	}
 	if !dmmi.clientMeterProvider.isEnabled() {
 		return nil
 	}
@@ -309,9 +914,10 @@ func (dmmi *defaultMessageMeterInterceptor) doAfter(messageHookPoints MessageHoo
 	case MessageHookPoints_SEND:
 		return dmmi.doAfterSendMessage(messageCommons, duration, status)
 	case MessageHookPoints_CONSUME:
+		if messageCommons = dmmi.sample(messageCommons); len(messageCommons) == 0 {
+			return nil
+		}
 		return dmmi.doAfterConsumeMessage(messageCommons, duration, status)
-	case MessageHookPoints_RECEIVE:
-		return dmmi.doAfterReceiveMessage(messageCommons, duration, status)
 	default:
 		break
 	}
@@ -320,6 +926,53 @@ func (dmmi *defaultMessageMeterInterceptor) doAfter(messageHookPoints MessageHoo
 func (dcmp *defaultClientMeterProvider) isEnabled() bool {
 	return dcmp.clientMeter.enabled.Load()
 }
+func (dcmp *defaultClientMeterProvider) getSampleRate() int64 {
+	return dcmp.opts.sampleRate
+}
+func (dcmp *defaultClientMeterProvider) getClockSkewThreshold() time.Duration {
+	return dcmp.opts.clockSkewThreshold
+}
+func (dcmp *defaultClientMeterProvider) isClockSkewCorrected() bool {
+	return dcmp.opts.clockSkewCorrected
+}
+func (dcmp *defaultClientMeterProvider) getClockSkewCorrection() time.Duration {
+	if dcmp.messageMeterInterceptor == nil {
+		return 0
+	}
+	return dcmp.messageMeterInterceptor.clockSkewCorrection()
+}
+func (dcmp *defaultClientMeterProvider) sanitizeTagValue(key tag.Key, value string) string {
+	if dcmp.opts.tagValueSanitizer != nil {
+		value = dcmp.opts.tagValueSanitizer(key, value)
+	}
+	if dcmp.opts.maxDistinctTagValues <= 0 {
+		return value
+	}
+	dcmp.tagValuesLock.Lock()
+	defer dcmp.tagValuesLock.Unlock()
+	if dcmp.tagValues == nil {
+		dcmp.tagValues = make(map[tag.Key]map[string]struct{})
+	}
+	values, ok := dcmp.tagValues[key]
+	if !ok {
+		values = make(map[string]struct{})
+		dcmp.tagValues[key] = values
+	}
+	if _, ok = values[value]; ok {
+		return value
+	}
+	if len(values) >= dcmp.opts.maxDistinctTagValues {
+		return MetricTagValueOverflow
+	}
+	values[value] = struct{}{}
+	return value
+}
+func (dcmp *defaultClientMeterProvider) tagContext() context.Context {
+	if dcmp.tagCtx == nil {
+		return context.Background()
+	}
+	return dcmp.tagCtx
+}
 func (dcmp *defaultClientMeterProvider) getClientID() string {
 	return dcmp.client.GetClientID()
 }
@@ -331,6 +984,20 @@ func (dcmp *defaultClientMeterProvider) Reset(metric *v2.Metric) {
 		sugarBaseLogger.Infof("metric settings is satisfied by the current message meter, clientId=%s", dcmp.client.GetClientID())
 		return
 	}
+	// Only flip the switch if the exporter is still valid, recreating it would leave a gap of metrics.
+	if dcmp.clientMeter.ocaExporter != nil {
+		if !metric.GetOn() {
+			dcmp.clientMeter.pause()
+			sugarBaseLogger.Infof("metric is paused, clientId=%s", dcmp.client.GetClientID())
+			return
+		}
+		if utils.CompareEndpoints(dcmp.clientMeter.endpoints, endpoints) {
+			dcmp.exportFailures.Store(0)
+			dcmp.clientMeter.resume()
+			sugarBaseLogger.Infof("metric is resumed, endpoints=%v, clientId=%s", endpoints, dcmp.client.GetClientID())
+			return
+		}
+	}
 
 	if !metric.GetOn() {
 		dcmp.clientMeter.shutdown()
@@ -338,38 +1005,206 @@ func (dcmp *defaultClientMeterProvider) Reset(metric *v2.Metric) {
 		dcmp.clientMeter = NewDefaultClientMeter(nil, false, nil, dcmp.client.GetClientID())
 		return
 	}
-	agentAddr := utils.ParseAddress(utils.SelectAnAddress(endpoints))
-	exporter, err := ocagent.NewExporter(
-		ocagent.WithInsecure(),
-		ocagent.WithTLSCredentials(credentials.NewTLS(defaultConnOptions.TLS)),
-		ocagent.WithAddress(agentAddr),
-		ocagent.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(dcmp.invokeWithSign())),
-	)
+	agentAddr := dcmp.opts.exporterAddress
+	if len(agentAddr) == 0 {
+		agentAddr = utils.ParseAddress(utils.SelectAnAddress(endpoints))
+	}
+	exporter, err := ocagent.NewExporter(dcmp.exporterOptions(agentAddr)...)
 	if err != nil {
 		sugarBaseLogger.Errorf("exception raised when resetting message meter, clientId=%s", dcmp.client.GetClientID())
 		return
 	}
 	// Reset message meter.
+	dcmp.exportFailures.Store(0)
 	dcmp.clientMeter.shutdown()
 	dcmp.clientMeter = NewDefaultClientMeter(exporter, true, endpoints, dcmp.client.GetClientID())
+	if dcmp.opts.traceExport {
+		dcmp.clientMeter.traceExporter = exporter
+	}
 	dcmp.clientMeter.start()
-	sugarBaseLogger.Infof("metrics is on, endpoints=%v, clientId=%s", endpoints, dcmp.client.GetClientID())
+	sugarBaseLogger.Infof("metrics is on, endpoints=%v, agentAddr=%s, clientId=%s", endpoints, agentAddr, dcmp.client.GetClientID())
 }
 
-var NewDefaultClientMeterProvider = func(client *defaultClient) ClientMeterProvider {
+var NewDefaultClientMeterProvider = func(client *defaultClient, opts ...ClientMeterProviderOption) ClientMeterProvider {
 	cmp := &defaultClientMeterProvider{
+		opts:        defaultClientMeterProviderOptions,
 		client:      client,
+		userAgent:   client.getUserAgent(),
+		tlsConfig:   client.getTLSConfig(),
 		clientMeter: NewDefaultClientMeter(nil, false, nil, "nil"),
 	}
-	client.registerMessageInterceptor(NewDefaultMessageMeterInterceptor(cmp))
+	for _, opt := range opts {
+		opt.apply(&cmp.opts)
+	}
+	if len(cmp.opts.constantTags) > 0 {
+		keys := make([]tag.Key, 0, len(cmp.opts.constantTags))
+		mutators := make([]tag.Mutator, 0, len(cmp.opts.constantTags))
+		for name, value := range cmp.opts.constantTags {
+			key, err := tag.NewKey(name)
+			if err != nil {
+				sugarBaseLogger.Errorf("ignore invalid constant tag=%s, clientId=%s, err=%v", name, client.GetClientID(), err)
+				continue
+			}
+			keys = append(keys, key)
+			mutators = append(mutators, tag.Upsert(key, value))
+		}
+		ctx, err := tag.New(context.Background(), mutators...)
+		if err == nil {
+			err = registerConstantTagKeys(keys)
+		}
+		if err != nil {
+			sugarBaseLogger.Errorf("failed to register constant tags, ignore them, clientId=%s, err=%v", client.GetClientID(), err)
+		} else {
+			cmp.tagCtx = ctx
+		}
+	}
+	for measureName, aggregations := range cmp.opts.aggregations {
+		if err := registerMeasureViews(measureName, aggregations); err != nil {
+			sugarBaseLogger.Errorf("failed to register views of measure=%s, clientId=%s, err=%v", measureName, client.GetClientID(), err)
+		}
+	}
+	if cmp.opts.finalFlushTimeout > 0 && len(cmp.opts.finalFlushSignals) > 0 {
+		cmp.watchFlushSignals()
+	}
+	cmp.messageMeterInterceptor = NewDefaultMessageMeterInterceptor(cmp)
+	client.registerMessageInterceptor(cmp.messageMeterInterceptor)
 	return cmp
 }
 
+// finalFlush flushes the metrics once, see WithFinalMetricFlush. It returns after the flush or its timeout.
+func (dcmp *defaultClientMeterProvider) finalFlush() {
+	if dcmp.opts.finalFlushTimeout <= 0 || !dcmp.finalFlushed.CAS(false, true) {
+		return
+	}
+	dcmp.globalMutex.Lock()
+	clientMeter := dcmp.clientMeter
+	dcmp.globalMutex.Unlock()
+	done := make(chan struct{})
+	dcmp.goAsync(func() {
+		defer close(done)
+		clientMeter.flush()
+	})
+	select {
+	case <-done:
+	case <-time.After(dcmp.opts.finalFlushTimeout):
+		sugarBaseLogger.Warnf("final flush of metrics timed out, timeout=%v, clientId=%s", dcmp.opts.finalFlushTimeout, dcmp.client.GetClientID())
+	}
+}
+
+// watchFlushSignals flushes the metrics once any of the signals of WithFinalMetricFlush is received, and raises the
+// signal again after flushing.
+func (dcmp *defaultClientMeterProvider) watchFlushSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, dcmp.opts.finalFlushSignals...)
+	dcmp.flushSignalsDone = make(chan struct{})
+	dcmp.goAsync(func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			sugarBaseLogger.Infof("flush metrics on signal=%v, clientId=%s", sig, dcmp.client.GetClientID())
+			dcmp.finalFlush()
+			signal.Stop(signals)
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				if err = p.Signal(sig); err != nil {
+					sugarBaseLogger.Errorf("failed to raise signal=%v again, clientId=%s, err=%v", sig, dcmp.client.GetClientID(), err)
+				}
+			}
+		case <-dcmp.flushSignalsDone:
+		}
+	})
+}
+
+func (dcmp *defaultClientMeterProvider) flushOnStop() {
+	dcmp.finalFlush()
+	dcmp.flushSignalsOnce.Do(func() {
+		if dcmp.flushSignalsDone != nil {
+			close(dcmp.flushSignalsDone)
+		}
+	})
+}
+
 var _ = ClientMeterProvider(&defaultClientMeterProvider{})
 
+func (dcmp *defaultClientMeterProvider) exporterOptions(agentAddr string) []ocagent.ExporterOption {
+	opts := []ocagent.ExporterOption{
+		ocagent.WithInsecure(),
+		ocagent.WithTLSCredentials(credentials.NewTLS(dcmp.tlsConfig)),
+		ocagent.WithGRPCDialOption(grpc.WithUserAgent(dcmp.userAgent)),
+		ocagent.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(dcmp.invokeWithSign())),
+		ocagent.WithGRPCDialOption(grpc.WithChainStreamInterceptor(dcmp.streamWithExportErrorDetection())),
+	}
+	// The agent listening on a Unix domain socket is dialed by its socket path.
+	if path, ok := utils.ParseUnixSocketPath(agentAddr); ok {
+		opts = append(opts, ocagent.WithAddress(path), ocagent.WithGRPCDialOption(grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", addr)
+		})))
+	} else {
+		opts = append(opts, ocagent.WithAddress(agentAddr))
+	}
+	if dcmp.opts.exporterReconnectionPeriod > 0 {
+		opts = append(opts, ocagent.WithReconnectionPeriod(dcmp.opts.exporterReconnectionPeriod))
+	}
+	return append(opts, dcmp.opts.exporterOptions...)
+}
+
 func (dcmp *defaultClientMeterProvider) invokeWithSign() grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 		newCtx := dcmp.client.Sign(ctx)
 		return invoker(newCtx, method, req, reply, cc, opts...)
 	}
 }
+
+// meterClientStream reports the result of every message sent to the metric agent.
+type meterClientStream struct {
+	grpc.ClientStream
+	dcmp *defaultClientMeterProvider
+}
+
+func (mcs *meterClientStream) SendMsg(m interface{}) error {
+	err := mcs.ClientStream.SendMsg(m)
+	if err != nil {
+		mcs.dcmp.onExportError(err)
+		return err
+	}
+	mcs.dcmp.exportFailures.Store(0)
+	return nil
+}
+
+// streamWithExportErrorDetection detects export failures, which are swallowed by the ocagent exporter.
+func (dcmp *defaultClientMeterProvider) streamWithExportErrorDetection() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			dcmp.onExportError(err)
+			return nil, err
+		}
+		return &meterClientStream{ClientStream: stream, dcmp: dcmp}, nil
+	}
+}
+
+func (dcmp *defaultClientMeterProvider) onExportError(err error) {
+	failures := dcmp.exportFailures.Inc()
+	// Log with exponential backoff, i.e. on the 1st, 2nd, 4th, 8th... consecutive failure.
+	if failures&(failures-1) == 0 {
+		sugarBaseLogger.Warnf("failed to export metrics, consecutiveFailures=%d, clientId=%s, err=%v", failures, dcmp.client.GetClientID(), err)
+	}
+	if dcmp.opts.exportErrorHandler != nil {
+		dcmp.opts.exportErrorHandler(err)
+	}
+	if dcmp.opts.maxExportFailures > 0 && failures == dcmp.opts.maxExportFailures {
+		// Stopping the exporter waits for its goroutines, which may be the caller.
+		dcmp.goAsync(func() { dcmp.disable(failures) })
+	}
+}
+
+func (dcmp *defaultClientMeterProvider) disable(failures int64) {
+	dcmp.globalMutex.Lock()
+	defer dcmp.globalMutex.Unlock()
+	if !dcmp.clientMeter.enabled.Load() {
+		return
+	}
+	dcmp.clientMeter.shutdown()
+	dcmp.clientMeter = NewDefaultClientMeter(nil, false, nil, dcmp.client.GetClientID())
+	sugarBaseLogger.Warnf("metrics is disabled after consecutive export failures, consecutiveFailures=%d, clientId=%s", failures, dcmp.client.GetClientID())
+}
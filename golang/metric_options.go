@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"os"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+type clientMeterProviderOptions struct {
+	aggregations       map[string][]*view.Aggregation
+	exportErrorHandler func(err error)
+	maxExportFailures  int64
+	exporterAddress    string
+	sampleRate         int64
+	clockSkewThreshold time.Duration
+	clockSkewCorrected bool
+
+	exporterReconnectionPeriod time.Duration
+	exporterOptions            []ocagent.ExporterOption
+
+	tagValueSanitizer    func(key tag.Key, value string) string
+	maxDistinctTagValues int
+	constantTags         map[string]string
+
+	finalFlushTimeout time.Duration
+	finalFlushSignals []os.Signal
+
+	traceExport bool
+}
+
+var defaultClientMeterProviderOptions = clientMeterProviderOptions{
+	maxExportFailures:  0,
+	sampleRate:         1,
+	clockSkewThreshold: time.Second,
+}
+
+// A ClientMeterProviderOption sets options such as view aggregations, etc.
+type ClientMeterProviderOption interface {
+	apply(*clientMeterProviderOptions)
+}
+
+// funcClientMeterProviderOption wraps a function that modifies options into an implementation of
+// the ClientMeterProviderOption interface.
+type funcClientMeterProviderOption struct {
+	f func(options *clientMeterProviderOptions)
+}
+
+func (fmpo *funcClientMeterProviderOption) apply(mpo *clientMeterProviderOptions) {
+	fmpo.f(mpo)
+}
+
+func newFuncClientMeterProviderOption(f func(options *clientMeterProviderOptions)) *funcClientMeterProviderOption {
+	return &funcClientMeterProviderOption{
+		f: f,
+	}
+}
+
+// WithMeasureAggregations returns a ClientMeterProviderOption that replaces the view of measure
+// with one view per aggregation, e.g. a Distribution and a Sum of PublishMLatencyMs.
+// Views are registered process-wide, so every client should use the same aggregations.
+// Default is a single Distribution per measure.
+func WithMeasureAggregations(measure stats.Measure, aggregations ...*view.Aggregation) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		if o.aggregations == nil {
+			o.aggregations = make(map[string][]*view.Aggregation)
+		}
+		o.aggregations[measure.Name()] = aggregations
+	})
+}
+
+// OnMetricExportError returns a ClientMeterProviderOption that sets the handler invoked on every failure
+// of exporting metrics to the agent. The handler runs on the exporting goroutine and must not block.
+func OnMetricExportError(f func(err error)) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.exportErrorHandler = f
+	})
+}
+
+// WithMaxMetricExportFailures returns a ClientMeterProviderOption that disables metrics after n consecutive
+// export failures, until the server issues the metric settings again.
+// Default is 0, which means metrics are never disabled because of export failures.
+func WithMaxMetricExportFailures(n int64) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.maxExportFailures = n
+	})
+}
+
+// WithMetricExporterAddress returns a ClientMeterProviderOption that sets the address, e.g. "127.0.0.1:55678",
+// of the metric collector to export to, instead of the endpoints advertised by the server.
+func WithMetricExporterAddress(address string) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.exporterAddress = address
+	})
+}
+
+// WithMetricSampleRate returns a ClientMeterProviderOption that records latency distributions of 1 in every n
+// messages, to reduce the overhead of recording at very high rates. Messages are sampled by their ids, so the latencies
+// of a message are recorded at every hook point or none. Distributions keep their shape while their counts are about
+// 1/n of the actual ones, message counts such as rocketmq_publish_total are recorded for every message.
+// Default is 1, which records every message.
+func WithMetricSampleRate(n int64) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.sampleRate = n
+	})
+}
+
+// WithClockSkewThreshold returns a ClientMeterProviderOption that sets the estimated clock skew between the client
+// and brokers beyond which a warning is logged. Default is 1s, and 0 disables the warning.
+func WithClockSkewThreshold(d time.Duration) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.clockSkewThreshold = d
+	})
+}
+
+// WithClockSkewCorrection returns a ClientMeterProviderOption that sets whether the delivery latency is corrected by
+// the estimated clock skew between the client and brokers. The skew is estimated from the delivery timestamps of
+// receive responses, which includes the network transit time. Default is false.
+func WithClockSkewCorrection(corrected bool) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.clockSkewCorrected = corrected
+	})
+}
+
+// WithMetricExporterReconnectionPeriod returns a ClientMeterProviderOption that sets how often the metric exporter
+// tries to reconnect to the collector after the connection is lost.
+// Default is the period of the ocagent exporter.
+func WithMetricExporterReconnectionPeriod(d time.Duration) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.exporterReconnectionPeriod = d
+	})
+}
+
+// WithMetricExporterOptions returns a ClientMeterProviderOption that appends options of the ocagent exporter, e.g.
+// grpc.WithWriteBufferSize through ocagent.WithGRPCDialOption to enlarge the buffer of the exporting stream.
+// They are applied after the options set by client and take precedence.
+func WithMetricExporterOptions(opts ...ocagent.ExporterOption) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.exporterOptions = append(o.exporterOptions, opts...)
+	})
+}
+
+// WithMetricTagValueSanitizer returns a ClientMeterProviderOption that sets the function applied to the values of
+// topic and consumer group tags before recording, e.g. a regexp replacing the dynamic IDs embedded in topic names.
+func WithMetricTagValueSanitizer(f func(key tag.Key, value string) string) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.tagValueSanitizer = f
+	})
+}
+
+// WithConstantTags returns a ClientMeterProviderOption that adds the tags, e.g. environment or region, to every
+// measurement recorded by the client. The tag keys are added to all views once per process by the first client with
+// the option, clients with other keys ignore their tags, and tags which are not valid keys of opencensus are ignored.
+func WithConstantTags(tags map[string]string) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.constantTags = tags
+	})
+}
+
+// WithMaxDistinctMetricTagValues returns a ClientMeterProviderOption that limits the number of distinct values of
+// topic and consumer group tags, values beyond the limit are recorded as MetricTagValueOverflow.
+// Default is 0, which means no limit.
+func WithMaxDistinctMetricTagValues(n int) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.maxDistinctTagValues = n
+	})
+}
+
+// WithFinalMetricFlush returns a ClientMeterProviderOption that exports the metrics collected so far once the client
+// is stopped, instead of losing those of the last reporting period, which lasts a minute. Short-lived processes
+// should enable it. If signals, e.g. syscall.SIGTERM, are given, metrics are flushed once any of them is received as
+// well, and then the signal is raised again for its default action or the handlers of application.
+// Metrics are flushed at most once, and the client waits no longer than timeout for it. Default is 0, which means
+// metrics are not flushed.
+func WithFinalMetricFlush(timeout time.Duration, signals ...os.Signal) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.finalFlushTimeout = timeout
+		o.finalFlushSignals = signals
+	})
+}
+
+// WithTraceExport sets whether the OpenCensus spans are exported to the agent along with metrics, through the same
+// connection signed by the credentials of client, e.g. the spans of RPCs started by WithRpcTracing. The exporter is
+// registered globally by trace.RegisterExporter while metrics are on, so spans of other libraries in the process are
+// exported as well. Default is false.
+func WithTraceExport(enabled bool) ClientMeterProviderOption {
+	return newFuncClientMeterProviderOption(func(o *clientMeterProviderOptions) {
+		o.traceExport = enabled
+	})
+}
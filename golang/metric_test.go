@@ -18,9 +18,23 @@
 package golang
 
 import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+	"unicode"
 
+	"contrib.go.opencensus.io/exporter/ocagent"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/prashantv/gostub"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // This test is designed to verify there is no data race in dcmp.Reset
@@ -34,3 +48,547 @@ func TestDefaultClientMeterProviderResetNoDataRace(t *testing.T) {
 		}()
 	}
 }
+
+func TestRegisterMeasureViews(t *testing.T) {
+	defer func() {
+		view.Unregister(&PublishLatencyView, &view.View{Name: PublishLatencyView.Name + "_sum"})
+		if err := view.Register(&PublishLatencyView); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	err := registerMeasureViews(PublishMLatencyMs.Name(), []*view.Aggregation{view.Distribution(1, 10, 100), view.Sum()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	distribution := view.Find(PublishLatencyView.Name)
+	if distribution == nil || distribution.Aggregation.Type != view.AggTypeDistribution || len(distribution.Aggregation.Buckets) != 3 {
+		t.Errorf("expected distribution view with 3 buckets, got %v", distribution)
+	}
+	sum := view.Find(PublishLatencyView.Name + "_sum")
+	if sum == nil || sum.Aggregation.Type != view.AggTypeSum {
+		t.Errorf("expected sum view, got %v", sum)
+	}
+
+	// Swap the distribution out entirely.
+	err = registerMeasureViews(PublishMLatencyMs.Name(), []*view.Aggregation{view.Count()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view.Find(PublishLatencyView.Name) != nil {
+		t.Error("expected distribution view to be unregistered")
+	}
+	count := view.Find(PublishLatencyView.Name + "_count")
+	if count == nil || count.Aggregation.Type != view.AggTypeCount {
+		t.Errorf("expected count view, got %v", count)
+	}
+	view.Unregister(count)
+
+	if err := registerMeasureViews("unknown", []*view.Aggregation{view.Sum()}); err == nil {
+		t.Error("expected error for unknown measure")
+	}
+}
+
+func TestDeliveryLatencyExceeded(t *testing.T) {
+	cli := BuildCLient(t)
+	dmmi := NewDefaultMessageMeterInterceptor(cli.clientMeterProvider)
+	actual := make(chan time.Duration, 1)
+	cli.clientMeterProvider.onDeliveryLatencyExceeded(MOCK_TOPIC, time.Second, func(latency time.Duration) {
+		actual <- latency
+	})
+
+	fresh := time.Now()
+	stale := time.Now().Add(-time.Minute)
+	err := dmmi.doAfter(MessageHookPoints_RECEIVE, []*MessageCommon{
+		{topic: MOCK_TOPIC, deliveryTimestamp: &fresh},
+		{topic: MOCK_TOPIC, deliveryTimestamp: &stale},
+		{topic: "other_topic", deliveryTimestamp: &stale},
+	}, 0, MessageHookPointsStatus_OK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case latency := <-actual:
+		if latency < time.Minute {
+			t.Errorf("expected latency of at least 1m, got %v", latency)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected delivery latency callback to be invoked")
+	}
+	select {
+	case latency := <-actual:
+		t.Errorf("expected a single callback per topic, got another with %v", latency)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMetricExportErrorDisablesMetrics(t *testing.T) {
+	cli := BuildCLient(t)
+	handled := make(chan error, 3)
+	dcmp := NewDefaultClientMeterProvider(cli, OnMetricExportError(func(err error) {
+		handled <- err
+	}), WithMaxMetricExportFailures(2)).(*defaultClientMeterProvider)
+	dcmp.clientMeter = NewDefaultClientMeter(nil, true, cli.accessPoint, cli.GetClientID())
+
+	dcmp.onExportError(errors.New("agent unavailable"))
+	if !dcmp.isEnabled() {
+		t.Error("expected metrics to stay enabled below the failure threshold")
+	}
+	dcmp.onExportError(errors.New("agent unavailable"))
+	if len(handled) != 2 {
+		t.Errorf("expected export error handler to be invoked twice, got %d", len(handled))
+	}
+	enabled := func() bool {
+		dcmp.globalMutex.Lock()
+		defer dcmp.globalMutex.Unlock()
+		return dcmp.isEnabled()
+	}
+	deadline := time.Now().Add(time.Second)
+	for enabled() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if enabled() {
+		t.Error("expected metrics to be disabled after reaching the failure threshold")
+	}
+}
+
+func TestMetricSampleRate(t *testing.T) {
+	dcmp := &defaultClientMeterProvider{opts: defaultClientMeterProviderOptions}
+	dmmi := &defaultMessageMeterInterceptor{clientMeterProvider: dcmp}
+	messageCommons := make([]*MessageCommon, 10)
+	for i := range messageCommons {
+		messageCommons[i] = &MessageCommon{topic: MOCK_TOPIC}
+	}
+	if sampled := dmmi.sample(messageCommons); len(sampled) != 10 {
+		t.Errorf("expected every message to be recorded by default, got %d", len(sampled))
+	}
+
+	WithMetricSampleRate(3).apply(&dcmp.opts)
+	sampled := len(dmmi.sample(messageCommons[:5]))
+	sampled += len(dmmi.sample(messageCommons[5:]))
+	if sampled != 3 {
+		t.Errorf("expected 1 in 3 messages without ids to be recorded, got %d of 10", sampled)
+	}
+
+	// Messages with ids are sampled by their ids, every hook point makes the same decision.
+	messageCommons = make([]*MessageCommon, 3000)
+	for i := range messageCommons {
+		messageId := GetMessageIdCodecInstance().NextMessageId().String()
+		messageCommons[i] = &MessageCommon{topic: MOCK_TOPIC, messageId: &messageId}
+	}
+	before := dmmi.sample(messageCommons)
+	after := dmmi.sample(messageCommons)
+	if !reflect.DeepEqual(before, after) {
+		t.Error("expected the same messages to be sampled at every hook point")
+	}
+	if len(before) < 800 || len(before) > 1200 {
+		t.Errorf("expected about 1 in 3 messages to be recorded, got %d of 3000", len(before))
+	}
+}
+
+func TestMetricExporterOptions(t *testing.T) {
+	dcmp := &defaultClientMeterProvider{opts: defaultClientMeterProviderOptions}
+	defaults := len(dcmp.exporterOptions(fakeAddress))
+
+	WithMetricExporterReconnectionPeriod(time.Second).apply(&dcmp.opts)
+	WithMetricExporterOptions(ocagent.WithServiceName("test")).apply(&dcmp.opts)
+	opts := dcmp.exporterOptions(fakeAddress)
+	if len(opts) != defaults+2 {
+		t.Errorf("expected reconnection period and custom option to be appended, got %d options", len(opts))
+	}
+}
+
+func TestMetricClockSkew(t *testing.T) {
+	cli := BuildCLient(t)
+	dcmp := &defaultClientMeterProvider{opts: defaultClientMeterProviderOptions, client: cli}
+	dmmi := &defaultMessageMeterInterceptor{clientMeterProvider: dcmp}
+
+	now := time.Now()
+	deliveryTimestamp := now.Add(-3 * time.Second)
+	messageCommons := []*MessageCommon{{
+		topic:                       MOCK_TOPIC,
+		deliveryTimestamp:           &deliveryTimestamp,
+		deliveryTimestampFromRemote: timestamppb.New(now.Add(-2 * time.Second)),
+	}}
+	dmmi.observeClockSkew(messageCommons)
+	if skew := time.Duration(dmmi.clockSkew.Load()); skew < 2*time.Second || skew > 3*time.Second {
+		t.Errorf("unexpected estimated clock skew %v", skew)
+	}
+	if !dmmi.clockSkewExceeded.Load() {
+		t.Error("expected clock skew to exceed the default threshold")
+	}
+	if latency := dmmi.deliveryLatency(messageCommons[0]); latency < 3*time.Second {
+		t.Errorf("expected uncorrected delivery latency by default, got %v", latency)
+	}
+
+	WithClockSkewCorrection(true).apply(&dcmp.opts)
+	if latency := dmmi.deliveryLatency(messageCommons[0]); latency < 900*time.Millisecond || latency > 2*time.Second {
+		t.Errorf("expected delivery latency corrected by clock skew, got %v", latency)
+	}
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func (fc *fakeClock) Since(t time.Time) time.Duration {
+	return fc.now.Sub(t)
+}
+
+func TestMetricFakeClock(t *testing.T) {
+	fc := &fakeClock{now: time.Unix(1700000000, 0)}
+	stubs := gostub.Stub(&defaultClock, clock(fc))
+	defer stubs.Reset()
+
+	deliveryTimestamp := fc.now.Add(-time.Second)
+	mv := fromProtobuf_MessageView0(&v2.Message{
+		Topic:            &v2.Resource{Name: MOCK_TOPIC},
+		SystemProperties: &v2.SystemProperties{DeliveryTimestamp: timestamppb.New(deliveryTimestamp)},
+	})
+	if !mv.GetMessageCommon().decodeStopwatch.Equal(fc.now) {
+		t.Errorf("expected decode stopwatch to be captured from the clock, got %v", mv.GetMessageCommon().decodeStopwatch)
+	}
+
+	fc.now = fc.now.Add(150 * time.Millisecond)
+	dmmi := &defaultMessageMeterInterceptor{clientMeterProvider: &defaultClientMeterProvider{opts: defaultClientMeterProviderOptions}}
+	if latency := dmmi.deliveryLatency(mv.GetMessageCommon()); latency != 1150*time.Millisecond {
+		t.Errorf("expected delivery latency of 1.15s, got %v", latency)
+	}
+}
+
+func TestMetricPublishTotal(t *testing.T) {
+	cli := BuildCLient(t)
+	dcmp := &defaultClientMeterProvider{opts: defaultClientMeterProviderOptions, client: cli, clientMeter: NewDefaultClientMeter(nil, true, nil, cli.GetClientID())}
+	dmmi := &defaultMessageMeterInterceptor{clientMeterProvider: dcmp}
+	messageCommons := []*MessageCommon{{topic: MOCK_TOPIC}}
+	for _, status := range []MessageHookPointsStatus{MessageHookPointsStatus_OK, MessageHookPointsStatus_OK, MessageHookPointsStatus_ERROR} {
+		if err := dmmi.doAfterSendMessage(messageCommons, time.Millisecond, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The total is not sampled.
+	WithMetricSampleRate(1000).apply(&dcmp.opts)
+	for _, status := range []MessageHookPointsStatus{MessageHookPointsStatus_OK, MessageHookPointsStatus_ERROR} {
+		if err := dmmi.doAfter(MessageHookPoints_SEND, messageCommons, time.Millisecond, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := view.RetrieveData(PublishTotalView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		var clientId, invocationStatus string
+		for _, tag := range row.Tags {
+			switch tag.Key {
+			case clientIdTag:
+				clientId = tag.Value
+			case invocationStatusTag:
+				invocationStatus = tag.Value
+			}
+		}
+		if clientId == cli.GetClientID() {
+			counts[invocationStatus] += row.Data.(*view.CountData).Value
+		}
+	}
+	if counts[string(InvocationStatus_SUCCESS)] != 3 || counts[string(InvocationStatus_FAILURE)] != 2 {
+		t.Errorf("unexpected publish counts %v", counts)
+	}
+}
+
+func TestMetricTagValueSanitization(t *testing.T) {
+	opts := defaultClientMeterProviderOptions
+	WithMetricTagValueSanitizer(func(key tag.Key, value string) string {
+		if key == topicTag {
+			return strings.TrimRightFunc(value, unicode.IsDigit)
+		}
+		return value
+	}).apply(&opts)
+	WithMaxDistinctMetricTagValues(2).apply(&opts)
+	dcmp := &defaultClientMeterProvider{opts: opts}
+
+	for _, topic := range []string{"order-1", "order-2", "payment-3"} {
+		if v := dcmp.sanitizeTagValue(topicTag, topic); v != strings.TrimRightFunc(topic, unicode.IsDigit) {
+			t.Errorf("unexpected sanitized topic %s of %s", v, topic)
+		}
+	}
+	if v := dcmp.sanitizeTagValue(topicTag, "refund-4"); v != MetricTagValueOverflow {
+		t.Errorf("expected overflowed topic to be collapsed, got %s", v)
+	}
+	if v := dcmp.sanitizeTagValue(topicTag, "order-5"); v != "order-" {
+		t.Errorf("expected known topic to be kept, got %s", v)
+	}
+	if v := dcmp.sanitizeTagValue(consumerGroupTag, "group-1"); v != "group-1" {
+		t.Errorf("expected distinct values to be limited by tag, got %s", v)
+	}
+}
+
+func TestMetricHeartbeat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	cli.settings = &producerSettings{requestTimeout: time.Second}
+	cli.clientImpl = &defaultProducer{cli: cli}
+	cli.clientMeterProvider.(*defaultClientMeterProvider).clientMeter.enabled.Store(true)
+
+	gomock.InOrder(
+		cm.EXPECT().HeartBeat(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+			&v2.HeartbeatResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil),
+		cm.EXPECT().HeartBeat(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+			&v2.HeartbeatResponse{Status: &v2.Status{Code: v2.Code_INTERNAL_SERVER_ERROR}}, nil),
+		cm.EXPECT().HeartBeat(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("unavailable")),
+	)
+	for i := 0; i < 3; i++ {
+		_ = cli.doHeartbeat(fakeAddress, &v2.HeartbeatRequest{})
+	}
+
+	count := func(viewName string) int64 {
+		rows, err := view.RetrieveData(viewName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int64
+		for _, row := range rows {
+			var clientId, endpoint string
+			for _, tag := range row.Tags {
+				switch tag.Key {
+				case clientIdTag:
+					clientId = tag.Value
+				case endpointTag:
+					endpoint = tag.Value
+				}
+			}
+			if clientId != cli.GetClientID() || endpoint != fakeAddress {
+				continue
+			}
+			switch data := row.Data.(type) {
+			case *view.CountData:
+				count += data.Value
+			case *view.DistributionData:
+				count += data.Count
+			}
+		}
+		return count
+	}
+	if latencies := count(HeartbeatLatencyView.Name); latencies != 3 {
+		t.Errorf("expected latency of every heartbeat to be recorded, got %d", latencies)
+	}
+	if failures := count(HeartbeatFailuresView.Name); failures != 2 {
+		t.Errorf("expected 2 failed heartbeats, got %d", failures)
+	}
+}
+
+func TestMetricExporterUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan struct{})
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			close(accepted)
+			conn.Close()
+		}
+	}()
+
+	dcmp := &defaultClientMeterProvider{opts: defaultClientMeterProviderOptions, client: BuildCLient(t), tlsConfig: &tls.Config{}}
+	exporter, err := ocagent.NewExporter(dcmp.exporterOptions("unix://" + path)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Stop()
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Error("expected exporter to dial the agent over the Unix domain socket")
+	}
+}
+
+func TestMetricExporterAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan struct{})
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			close(accepted)
+			conn.Close()
+		}
+	}()
+
+	cli := BuildCLient(t)
+	dcmp := NewDefaultClientMeterProvider(cli, WithMetricExporterAddress(listener.Addr().String())).(*defaultClientMeterProvider)
+	dcmp.Reset(&v2.Metric{On: true, Endpoints: cli.accessPoint})
+	defer dcmp.clientMeter.shutdown()
+	if !dcmp.isEnabled() {
+		t.Fatal("expected metrics to be on")
+	}
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Error("expected exporter to dial the overridden address instead of the access point")
+	}
+}
+
+func TestMetricShutdown(t *testing.T) {
+	// Nothing listens on the address, so that the exporter does not wait for the handshake on shutdown.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+
+	cli := BuildCLient(t)
+	dcmp := NewDefaultClientMeterProvider(cli, WithMetricExporterAddress(listener.Addr().String())).(*defaultClientMeterProvider)
+	dcmp.Reset(&v2.Metric{On: true, Endpoints: cli.accessPoint})
+	// Turning metrics off by settings keeps the exporter.
+	dcmp.Reset(&v2.Metric{On: false})
+	exporter, ok := dcmp.clientMeter.ocaExporter.(*ocagent.Exporter)
+	if !ok {
+		t.Fatal("expected exporter to be kept while metrics are paused")
+	}
+	dcmp.shutdown()
+	if dcmp.isEnabled() || dcmp.clientMeter.ocaExporter != nil {
+		t.Error("expected exporter to be dropped on shutdown")
+	}
+	// Stopping an exporter which is not running fails.
+	if err := exporter.Stop(); err == nil {
+		t.Error("expected exporter to be stopped on shutdown")
+	}
+}
+
+func TestMetricConstantTags(t *testing.T) {
+	// Views of aggregations registered before carry the keys as well.
+	if err := registerMeasureViews(HeartbeatMLatencyMs.Name(), []*view.Aggregation{HeartbeatLatencyView.Aggregation, view.Sum()}); err != nil {
+		t.Fatal(err)
+	}
+	cli := BuildCLient(t)
+	dcmp := NewDefaultClientMeterProvider(cli, WithConstantTags(map[string]string{"env": "staging", "region": "eu-1", "": "invalid"})).(*defaultClientMeterProvider)
+	dcmp.clientMeter.enabled.Store(true)
+	cli.clientMeterProvider = dcmp
+	envTag, _ := tag.NewKey("env")
+	regionTag, _ := tag.NewKey("region")
+	for _, name := range []string{HeartbeatFailuresView.Name, HeartbeatLatencyView.Name + "_sum"} {
+		if registered := view.Find(name); registered == nil || !containsTagKey(registered.TagKeys, envTag) || !containsTagKey(registered.TagKeys, regionTag) {
+			t.Fatalf("expected constant tag keys to be registered with views, got %v", registered)
+		}
+	}
+	// Registering the same keys again keeps the views, while other keys are rejected.
+	registered := view.Find(HeartbeatFailuresView.Name)
+	if err := registerConstantTagKeys([]tag.Key{envTag}); err != nil {
+		t.Fatal(err)
+	}
+	zoneTag, _ := tag.NewKey("zone")
+	if err := registerConstantTagKeys([]tag.Key{zoneTag}); err == nil {
+		t.Error("expected error for the constant tag key not registered")
+	}
+	if other := NewDefaultClientMeterProvider(BuildCLient(t), WithConstantTags(map[string]string{"zone": "a"})).(*defaultClientMeterProvider); other.tagCtx != nil {
+		t.Error("expected the constant tags of other keys to be ignored")
+	}
+	if view.Find(HeartbeatFailuresView.Name) != registered {
+		t.Error("expected views not to be replaced again")
+	}
+
+	cli.recordHeartbeat(fakeAddress, time.Millisecond, true)
+	rows, err := view.RetrieveData(HeartbeatFailuresView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, row := range rows {
+		tags := make(map[tag.Key]string)
+		for _, tag := range row.Tags {
+			tags[tag.Key] = tag.Value
+		}
+		if tags[clientIdTag] == cli.GetClientID() {
+			found = tags[envTag] == "staging" && tags[regionTag] == "eu-1"
+		}
+	}
+	if !found {
+		t.Errorf("expected measurement to carry constant tags, got %v", rows)
+	}
+}
+
+type fakeViewExporter struct {
+	exported chan *view.Data
+	block    chan struct{}
+}
+
+func (e *fakeViewExporter) ExportView(vd *view.Data) {
+	if e.block != nil {
+		<-e.block
+	}
+	e.exported <- vd
+}
+
+func TestMetricFinalFlush(t *testing.T) {
+	cli := BuildCLient(t)
+	dcmp := NewDefaultClientMeterProvider(cli, WithFinalMetricFlush(time.Second)).(*defaultClientMeterProvider)
+	exporter := &fakeViewExporter{exported: make(chan *view.Data, 64)}
+	dcmp.clientMeter = NewDefaultClientMeter(exporter, true, cli.accessPoint, cli.GetClientID())
+	cli.clientMeterProvider = dcmp
+
+	cli.recordHeartbeat(fakeAddress, time.Millisecond, true)
+	dcmp.flushOnStop()
+	found := false
+	for len(exporter.exported) > 0 {
+		if vd := <-exporter.exported; vd.View.Name == HeartbeatFailuresView.Name {
+			found = len(vd.Rows) > 0
+		}
+	}
+	if !found {
+		t.Error("expected heartbeat failures to be flushed")
+	}
+	// The flush is done at most once.
+	dcmp.flushOnStop()
+	if len(exporter.exported) != 0 {
+		t.Errorf("expected no more flushes, got %d views exported", len(exporter.exported))
+	}
+}
+
+func TestMetricFinalFlushTimeout(t *testing.T) {
+	cli := BuildCLient(t)
+	dcmp := NewDefaultClientMeterProvider(cli, WithFinalMetricFlush(50*time.Millisecond)).(*defaultClientMeterProvider)
+	exporter := &fakeViewExporter{exported: make(chan *view.Data, 64), block: make(chan struct{})}
+	defer close(exporter.block)
+	dcmp.clientMeter = NewDefaultClientMeter(exporter, true, cli.accessPoint, cli.GetClientID())
+	cli.clientMeterProvider = dcmp
+
+	cli.recordHeartbeat(fakeAddress, time.Millisecond, true)
+	start := time.Now()
+	dcmp.flushOnStop()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected flush to be bounded by its timeout, took %v", elapsed)
+	}
+}
+
+func TestMetricResetToggleKeepsExporter(t *testing.T) {
+	cli := BuildCLient(t)
+	dcmp := NewDefaultClientMeterProvider(cli).(*defaultClientMeterProvider)
+	exporter := &fakeViewExporter{exported: make(chan *view.Data, 64)}
+	meter := NewDefaultClientMeter(exporter, true, cli.accessPoint, cli.GetClientID())
+	dcmp.clientMeter = meter
+	meter.start()
+	defer meter.shutdown()
+
+	dcmp.Reset(&v2.Metric{On: false, Endpoints: cli.accessPoint})
+	if dcmp.clientMeter != meter || dcmp.isEnabled() {
+		t.Error("expected metrics to be paused without recreating the meter")
+	}
+	dcmp.Reset(&v2.Metric{On: true, Endpoints: cli.accessPoint})
+	if dcmp.clientMeter != meter || !dcmp.isEnabled() {
+		t.Error("expected metrics to be resumed without recreating the meter")
+	}
+}
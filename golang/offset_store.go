@@ -0,0 +1,250 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apache/rocketmq-clients/golang/v5/pkg/utils"
+	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// OffsetStore keeps the consume offsets of the consumer group on message queues, which Seek, SeekToTimestamp and
+// CommittedOffsets of push consumer go through. The default one keeps offsets on the server, use WithOffsetStore to
+// inject another, e.g. NewMemoryOffsetStore for tests without a broker.
+type OffsetStore interface {
+	// UpdateOffset commits offset as the consume offset of messageQueue.
+	UpdateOffset(ctx context.Context, messageQueue *MessageQueue, offset int64) error
+	// GetOffset returns the committed consume offset of messageQueue.
+	GetOffset(ctx context.Context, messageQueue *MessageQueue) (int64, error)
+	// QueryOffset returns the offset of the first message stored at or after timestamp in messageQueue.
+	QueryOffset(ctx context.Context, messageQueue *MessageQueue, timestamp time.Time) (int64, error)
+}
+
+// brokerOffsetStore keeps offsets on the brokers serving the message queues.
+type brokerOffsetStore struct {
+	cli   *defaultClient
+	group *v2.Resource
+	// resolve returns the message queue of the route, which carries the endpoints of the broker.
+	resolve func(ctx context.Context, messageQueue *MessageQueue) (*v2.MessageQueue, error)
+}
+
+var _ = OffsetStore(&brokerOffsetStore{})
+
+func (bos *brokerOffsetStore) UpdateOffset(ctx context.Context, mq *MessageQueue, offset int64) error {
+	messageQueue, err := bos.resolve(ctx, mq)
+	if err != nil {
+		return err
+	}
+	request := &v2.UpdateOffsetRequest{
+		Group:        bos.group,
+		MessageQueue: messageQueue,
+		Offset:       offset,
+	}
+	ctx = bos.cli.Sign(ctx)
+	endpoints := messageQueue.GetBroker().GetEndpoints()
+	resp, err := bos.cli.clientManager.UpdateOffset(ctx, endpoints, request, bos.cli.opts.timeout)
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus().GetCode() != v2.Code_OK {
+		bos.cli.log.Errorf("failed to update offset, mq=%s, offset=%d, code=%v, status message=[%s], requestId=%s", utils.ParseMessageQueue2Str(messageQueue), offset, resp.GetStatus().GetCode(), resp.GetStatus().GetMessage(), utils.GetRequestID(ctx))
+		return &ErrRpcStatus{
+			Code:    int32(resp.GetStatus().GetCode()),
+			Message: resp.GetStatus().GetMessage(),
+		}
+	}
+	return nil
+}
+
+func (bos *brokerOffsetStore) GetOffset(ctx context.Context, mq *MessageQueue) (int64, error) {
+	messageQueue, err := bos.resolve(ctx, mq)
+	if err != nil {
+		return 0, err
+	}
+	request := &v2.GetOffsetRequest{
+		Group:        bos.group,
+		MessageQueue: messageQueue,
+	}
+	ctx = bos.cli.Sign(ctx)
+	endpoints := messageQueue.GetBroker().GetEndpoints()
+	resp, err := bos.cli.clientManager.GetOffset(ctx, endpoints, request, bos.cli.opts.timeout)
+	if err != nil {
+		return 0, err
+	}
+	if resp.GetStatus().GetCode() != v2.Code_OK {
+		bos.cli.log.Errorf("failed to get offset, mq=%s, code=%v, status message=[%s], requestId=%s", utils.ParseMessageQueue2Str(messageQueue), resp.GetStatus().GetCode(), resp.GetStatus().GetMessage(), utils.GetRequestID(ctx))
+		return 0, &ErrRpcStatus{
+			Code:    int32(resp.GetStatus().GetCode()),
+			Message: resp.GetStatus().GetMessage(),
+		}
+	}
+	return resp.GetOffset(), nil
+}
+
+func (bos *brokerOffsetStore) QueryOffset(ctx context.Context, mq *MessageQueue, timestamp time.Time) (int64, error) {
+	messageQueue, err := bos.resolve(ctx, mq)
+	if err != nil {
+		return 0, err
+	}
+	request := &v2.QueryOffsetRequest{
+		MessageQueue:      messageQueue,
+		QueryOffsetPolicy: v2.QueryOffsetPolicy_TIMESTAMP,
+		Timestamp:         timestamppb.New(timestamp),
+	}
+	ctx = bos.cli.Sign(ctx)
+	endpoints := messageQueue.GetBroker().GetEndpoints()
+	resp, err := bos.cli.clientManager.QueryOffset(ctx, endpoints, request, bos.cli.opts.timeout)
+	if err != nil {
+		return 0, err
+	}
+	if resp.GetStatus().GetCode() != v2.Code_OK {
+		bos.cli.log.Errorf("failed to query offset, mq=%s, timestamp=%v, code=%v, status message=[%s], requestId=%s", utils.ParseMessageQueue2Str(messageQueue), timestamp, resp.GetStatus().GetCode(), resp.GetStatus().GetMessage(), utils.GetRequestID(ctx))
+		return 0, &ErrRpcStatus{
+			Code:    int32(resp.GetStatus().GetCode()),
+			Message: resp.GetStatus().GetMessage(),
+		}
+	}
+	return resp.GetOffset(), nil
+}
+
+// MemoryOffsetStore keeps offsets in memory, for tests of seek and commit behaviors without a broker. It remembers
+// up to capacity message queues in LRU order, the least recently updated ones are forgotten beyond that.
+type MemoryOffsetStore struct {
+	capacity int
+
+	lock    sync.Mutex
+	entries map[MessageQueue]*list.Element
+	order   *list.List
+}
+
+type memoryOffsetEntry struct {
+	messageQueue MessageQueue
+	offset       int64
+	committed    bool
+	// index is sorted by timestamp, see IndexTimestamp.
+	index []timestampedOffset
+}
+
+type timestampedOffset struct {
+	timestamp time.Time
+	offset    int64
+}
+
+var _ = OffsetStore(&MemoryOffsetStore{})
+
+// NewMemoryOffsetStore returns a MemoryOffsetStore remembering up to capacity message queues, 1024 if capacity is not
+// positive.
+func NewMemoryOffsetStore(capacity int) *MemoryOffsetStore {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	return &MemoryOffsetStore{
+		capacity: capacity,
+		entries:  make(map[MessageQueue]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func toMessageQueue(messageQueue *v2.MessageQueue) MessageQueue {
+	return MessageQueue{
+		Topic:      messageQueue.GetTopic().GetName(),
+		BrokerName: messageQueue.GetBroker().GetName(),
+		QueueId:    messageQueue.GetId(),
+	}
+}
+
+// entry returns the entry of messageQueue, creating it if absent, and marks it as the most recently used one.
+func (mos *MemoryOffsetStore) entry(messageQueue *MessageQueue) *memoryOffsetEntry {
+	key := *messageQueue
+	if elem, ok := mos.entries[key]; ok {
+		mos.order.MoveToFront(elem)
+		return elem.Value.(*memoryOffsetEntry)
+	}
+	entry := &memoryOffsetEntry{messageQueue: key}
+	mos.entries[key] = mos.order.PushFront(entry)
+	for mos.order.Len() > mos.capacity {
+		oldest := mos.order.Back()
+		mos.order.Remove(oldest)
+		delete(mos.entries, oldest.Value.(*memoryOffsetEntry).messageQueue)
+	}
+	return entry
+}
+
+func (mos *MemoryOffsetStore) UpdateOffset(_ context.Context, messageQueue *MessageQueue, offset int64) error {
+	if offset < 0 {
+		return fmt.Errorf("illegal offset %d, mq=%+v", offset, *messageQueue)
+	}
+	mos.lock.Lock()
+	defer mos.lock.Unlock()
+	entry := mos.entry(messageQueue)
+	entry.offset = offset
+	entry.committed = true
+	return nil
+}
+
+func (mos *MemoryOffsetStore) GetOffset(_ context.Context, messageQueue *MessageQueue) (int64, error) {
+	mos.lock.Lock()
+	defer mos.lock.Unlock()
+	elem, ok := mos.entries[*messageQueue]
+	if !ok || !elem.Value.(*memoryOffsetEntry).committed {
+		return 0, fmt.Errorf("offset not found, mq=%+v", *messageQueue)
+	}
+	return elem.Value.(*memoryOffsetEntry).offset, nil
+}
+
+// QueryOffset returns the offset of the first message indexed at or after timestamp by IndexTimestamp, or the offset
+// next to the last indexed message if there is none, like brokers do.
+func (mos *MemoryOffsetStore) QueryOffset(_ context.Context, messageQueue *MessageQueue, timestamp time.Time) (int64, error) {
+	mos.lock.Lock()
+	defer mos.lock.Unlock()
+	elem, ok := mos.entries[*messageQueue]
+	if !ok {
+		return 0, nil
+	}
+	index := elem.Value.(*memoryOffsetEntry).index
+	i := sort.Search(len(index), func(i int) bool {
+		return !index[i].timestamp.Before(timestamp)
+	})
+	if i < len(index) {
+		return index[i].offset, nil
+	}
+	if len(index) == 0 {
+		return 0, nil
+	}
+	return index[len(index)-1].offset + 1, nil
+}
+
+// IndexTimestamp records that the message at offset of messageQueue was stored at timestamp, for QueryOffset.
+func (mos *MemoryOffsetStore) IndexTimestamp(messageQueue *MessageQueue, offset int64, timestamp time.Time) {
+	mos.lock.Lock()
+	defer mos.lock.Unlock()
+	entry := mos.entry(messageQueue)
+	i := sort.Search(len(entry.index), func(i int) bool {
+		return entry.index[i].timestamp.After(timestamp)
+	})
+	entry.index = append(entry.index, timestampedOffset{})
+	copy(entry.index[i+1:], entry.index[i:])
+	entry.index[i] = timestampedOffset{timestamp: timestamp, offset: offset}
+}
@@ -80,14 +80,50 @@ func Mod64(n int64, m int) int {
 	return int(i)
 }
 
+// ParseAddress returns the dial target of address, the host of a Unix domain socket address, e.g.
+// "unix:///var/run/agent.sock", is returned as is since it has no port.
 func ParseAddress(address *v2.Address) string {
 	if address == nil {
 		return ""
 	}
+	if _, ok := ParseUnixSocketPath(address.Host); ok {
+		return address.Host
+	}
 	return fmt.Sprintf("%s:%d", address.Host, address.Port)
 }
 
+// ParseUnixSocketPath returns the socket path of a Unix domain socket address, which is either "unix:path" or
+// "unix://absolute_path", ok is false if address is not of the unix scheme.
+func ParseUnixSocketPath(address string) (path string, ok bool) {
+	if strings.HasPrefix(address, "unix://") {
+		return strings.TrimPrefix(address, "unix://"), true
+	}
+	if strings.HasPrefix(address, "unix:") {
+		return strings.TrimPrefix(address, "unix:"), true
+	}
+	return "", false
+}
+
 func ParseTarget(target string) (*v2.Endpoints, error) {
+	ret, errs := parseTarget(target)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return ret, nil
+}
+
+// ValidateTarget parses target like ParseTarget, but returns the problems of all bad addresses rather than the first
+// one. It returns nil if target is valid.
+func ValidateTarget(target string) []string {
+	_, errs := parseTarget(target)
+	var problems []string
+	for _, err := range errs {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+func parseTarget(target string) (*v2.Endpoints, []error) {
 	if strings.HasPrefix(target, "ip:///") {
 		target = strings.TrimPrefix(target, "ip:///")
 	}
@@ -95,6 +131,7 @@ func ParseTarget(target string) (*v2.Endpoints, error) {
 	ret := &v2.Endpoints{
 		Scheme: v2.AddressScheme_DOMAIN_NAME,
 	}
+	var errs []error
 
 	addressRawList := strings.Split(target, ";")
 	for _, item := range addressRawList {
@@ -108,10 +145,12 @@ func ParseTarget(target string) (*v2.Endpoints, error) {
 		if idx := strings.Index(item, "://"); idx != -1 {
 			u, err := url.Parse(item)
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse URL %q: %w", item, err)
+				errs = append(errs, fmt.Errorf("failed to parse URL %q: %w", item, err))
+				continue
 			}
 			if u.Host == "" {
-				return nil, fmt.Errorf("URL missing host: %q", item)
+				errs = append(errs, fmt.Errorf("URL missing host: %q", item))
+				continue
 			}
 			hostPort = u.Host
 		} else {
@@ -120,12 +159,18 @@ func ParseTarget(target string) (*v2.Endpoints, error) {
 
 		host, portStr, err := net.SplitHostPort(hostPort)
 		if err != nil {
-			return nil, fmt.Errorf("invalid host:port in %q (from %q): %w", hostPort, item, err)
+			errs = append(errs, fmt.Errorf("invalid host:port in %q (from %q): %w", hostPort, item, err))
+			continue
 		}
 
 		port, err := strconv.ParseInt(portStr, 10, 32)
 		if err != nil {
-			return nil, fmt.Errorf("invalid port in %q: %w", portStr, err)
+			errs = append(errs, fmt.Errorf("invalid port in %q: %w", portStr, err))
+			continue
+		}
+		if port <= 0 || port > 65535 {
+			errs = append(errs, fmt.Errorf("invalid port in %q: expect 1-65535", portStr))
+			continue
 		}
 
 		ip := net.ParseIP(host)
@@ -136,8 +181,11 @@ func ParseTarget(target string) (*v2.Endpoints, error) {
 			} else {
 				addrScheme = v2.AddressScheme_IPv6
 			}
-		} else {
+		} else if isHostName(host) {
 			addrScheme = v2.AddressScheme_DOMAIN_NAME
+		} else {
+			errs = append(errs, fmt.Errorf("invalid host %q in %q", host, item))
+			continue
 		}
 
 		address := &v2.Address{
@@ -153,11 +201,30 @@ func ParseTarget(target string) (*v2.Endpoints, error) {
 		}
 	}
 
-	if len(ret.Addresses) == 0 {
-		return nil, fmt.Errorf("no valid addresses found in target: %q", target)
+	if len(ret.Addresses) == 0 && len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("no valid addresses found in target: %q", target))
 	}
 
-	return ret, nil
+	return ret, errs
+}
+
+// isHostName reports whether host is a domain name, which may be fully qualified with a trailing dot.
+func isHostName(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 func GetOsDescription() string {
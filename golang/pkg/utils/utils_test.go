@@ -59,6 +59,46 @@ func TestParseAddress(t *testing.T) {
 	if r != "127.0.0.1:80" {
 		t.Error()
 	}
+	r = ParseAddress(&v2.Address{
+		Host: "unix:///var/run/agent.sock",
+	})
+	if r != "unix:///var/run/agent.sock" {
+		t.Error(r)
+	}
+}
+
+func TestParseUnixSocketPath(t *testing.T) {
+	for address, expected := range map[string]string{
+		"unix:///var/run/agent.sock": "/var/run/agent.sock",
+		"unix:agent.sock":            "agent.sock",
+	} {
+		if path, ok := ParseUnixSocketPath(address); !ok || path != expected {
+			t.Errorf("unexpected path of address=%s, path=%s", address, path)
+		}
+	}
+	if _, ok := ParseUnixSocketPath("127.0.0.1:55678"); ok {
+		t.Error("expected tcp address not to be recognized")
+	}
+}
+
+func TestValidateTarget(t *testing.T) {
+	for _, target := range []string{"127.0.0.1:80", "ip:///127.0.0.1:80;127.0.0.2:80", "http://[fe80::1]:80", "rocketmq-xxx.rocketmq.com:8081",
+		"dns://rocketmq-xxx.rocketmq.com.:8081"} {
+		if problems := ValidateTarget(target); len(problems) != 0 {
+			t.Errorf("expected target=%s to be valid, got %v", target, problems)
+		}
+	}
+	for target, expected := range map[string]int{
+		"":                            1,
+		"127.0.0.1":                   1,
+		"127.0.0.1:0;127.0.0.1:65536": 2,
+		"http://:80":                  1,
+		"broker name:80;:80":          2,
+	} {
+		if problems := ValidateTarget(target); len(problems) != expected {
+			t.Errorf("expected %d problem(s) of target=%q, got %v", expected, target, problems)
+		}
+	}
 }
 
 func TestParseTarget(t *testing.T) {
@@ -19,12 +19,16 @@ package golang
 
 import (
 	"context"
+	"errors"
 	"math"
+	"strconv"
 	"time"
 
 	"github.com/apache/rocketmq-clients/golang/v5/pkg/utils"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 	"github.com/google/uuid"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.uber.org/atomic"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -38,7 +42,7 @@ type ProcessQueue interface {
 	discardMessage(*MessageView)
 	eraseMessage(*MessageView, ConsumerResult)
 	discardFifoMessage(*MessageView)
-	eraseFifoMessage(*MessageView, ConsumerResult)
+	eraseFifoMessage(*MessageView, ConsumerResult, func())
 }
 
 const (
@@ -50,6 +54,17 @@ const (
 	RECEIVING_BACKOFF_DELAY_WHEN_CACHE_IS_FULL        time.Duration = time.Second
 )
 
+// FORWARD_MESSAGE_TO_DLQ_MAX_ATTEMPTS bounds the attempts of forwarding a message to the dead letter queue, the message
+// is left to be redelivered by brokers once they run out.
+const FORWARD_MESSAGE_TO_DLQ_MAX_ATTEMPTS = 16
+
+// ACK_MESSAGE_MAX_ATTEMPTS and CHANGE_INVISIBLE_DURATION_MAX_ATTEMPTS bound the attempts of acking and nacking a
+// message, the message is left to be redelivered by brokers once they run out.
+const (
+	ACK_MESSAGE_MAX_ATTEMPTS               = 16
+	CHANGE_INVISIBLE_DURATION_MAX_ATTEMPTS = 16
+)
+
 type defaultProcessQueue struct {
 	consumer         *defaultPushConsumer
 	dropped          atomic.Bool
@@ -63,6 +78,8 @@ type defaultProcessQueue struct {
 	receivedMessagesQuantity atomic.Int64
 	activityNanoTime         atomic.Int64
 	cacheFullNanoTime        atomic.Int64
+	// receptionBatchSizeLimit is the batch size reduced because of oversized receive responses, 0 means no limit.
+	receptionBatchSizeLimit atomic.Int32
 }
 
 func (dpq *defaultProcessQueue) discardFifoMessage(mv *MessageView) {
@@ -70,28 +87,44 @@ func (dpq *defaultProcessQueue) discardFifoMessage(mv *MessageView) {
 	dpq.forwardToDeadLetterQueue(mv, func(error) { dpq.evictCacheMessage(mv) })
 }
 
-func (dpq *defaultProcessQueue) eraseFifoMessage(mv *MessageView, result ConsumerResult) {
+// eraseFifoMessage redelivers the failed message until its attempts run out, and then acks it or forwards it to the
+// dead letter queue. done is invoked once the message is not redelivered any more, if it is not nil.
+func (dpq *defaultProcessQueue) eraseFifoMessage(mv *MessageView, result ConsumerResult, done func()) {
+	if mv.drained {
+		dpq.evictCacheMessage(mv)
+		if done != nil {
+			done()
+		}
+		return
+	}
+	if result == FAILURE && dpq.shouldDeadLetter(mv) {
+		result = TERMINATE
+	}
 	retryPolicy := dpq.consumer.pcSettings.GetRetryPolicy()
 	maxAttempts := retryPolicy.MaxAttempts
 	attempt := mv.GetMessageCommon().deliveryAttempt
 	messageId := mv.GetMessageId()
-	service := dpq.consumer.consumerService
 	clientId := dpq.consumer.cli.clientID
 
 	if result == FAILURE && attempt < maxAttempts {
-		nextAttemptDelay := utils.GetNextAttemptDelay(retryPolicy, int(attempt))
-		mv.deliveryAttempt += 1
-		attempt = mv.deliveryAttempt
-		dpq.consumer.cli.log.Debugf("Prepare to redeliver the fifo message because of the consumption failure, maxAttempt={},"+
-			" attempt=%d, mq=%s, messageId=%s, nextAttemptDelay=%v, clientId=%s", maxAttempts, attempt, dpq.mqstr,
-			messageId, nextAttemptDelay, clientId)
-		service.consumeWithDuration(mv, nextAttemptDelay, func(result0 ConsumerResult, err0 error) {
-			dpq.eraseFifoMessage(mv, result0)
-		})
+		if abandoned := mv.abandonedConsumption; abandoned != nil {
+			// Redeliver once the listener which timed out returns, so that the message is never consumed by two
+			// invocations at the same time, see WithConsumeTimeout.
+			mv.abandonedConsumption = nil
+			dpq.consumer.cli.goAsync(func() {
+				<-abandoned
+				dpq.redeliverFifoMessage(mv, done)
+			})
+			return
+		}
+		dpq.redeliverFifoMessage(mv, done)
 		return
 	}
 
-	if result != SUCCESS {
+	if result == TERMINATE {
+		dpq.consumer.cli.log.Infof("Terminate consumption of fifo message, maxAttempts=%d, attempt=%d, mq=%s, messageId=%s, "+
+			"clientId=%s", maxAttempts, attempt, dpq.mqstr, messageId, clientId)
+	} else if result != SUCCESS {
 		dpq.consumer.cli.log.Infof("Failed to consume fifo message finally, run out of attempt times, maxAttempts=%d, "+
 			"attempt=%d, mq=%s, messageId=%s, clientId=%s", maxAttempts, attempt, dpq.mqstr, messageId, clientId)
 	}
@@ -101,10 +134,27 @@ func (dpq *defaultProcessQueue) eraseFifoMessage(mv *MessageView, result Consume
 	} else {
 		dpq.forwardToDeadLetterQueue(mv, func(error) { dpq.evictCacheMessage(mv) })
 	}
+	if done != nil {
+		done()
+	}
+}
+
+// redeliverFifoMessage consumes the failed fifo message again after the delay of retry policy.
+func (dpq *defaultProcessQueue) redeliverFifoMessage(mv *MessageView, done func()) {
+	maxAttempts := dpq.consumer.pcSettings.GetRetryPolicy().MaxAttempts
+	nextAttemptDelay := dpq.getNextAttemptDelay(mv)
+	dpq.recordMessage(mv, ConsumeNackedMessagesM)
+	mv.deliveryAttempt += 1
+	dpq.consumer.cli.log.Debugf("Prepare to redeliver the fifo message because of the consumption failure, maxAttempt={},"+
+		" attempt=%d, mq=%s, messageId=%s, nextAttemptDelay=%v, clientId=%s", maxAttempts, mv.deliveryAttempt, dpq.mqstr,
+		mv.GetMessageId(), nextAttemptDelay, dpq.consumer.cli.clientID)
+	dpq.consumer.consumerService.consumeWithDuration(mv, nextAttemptDelay, func(result0 ConsumerResult, err0 error) {
+		dpq.eraseFifoMessage(mv, result0, done)
+	})
 }
 
 func (dpq *defaultProcessQueue) forwardToDeadLetterQueue(mv *MessageView, callback func(error)) {
-	dpq.forwardToDeadLetterQueue0(mv, 1, callback)
+	dpq.forwardToDeadLetterQueue0(mv, 1, dpq.consumer.wrapAckCallback(mv, callback))
 }
 
 func (dpq *defaultProcessQueue) forwardToDeadLetterQueue0(mv *MessageView, attempt int, callback func(error)) {
@@ -116,6 +166,10 @@ func (dpq *defaultProcessQueue) forwardToDeadLetterQueue0(mv *MessageView, attem
 	ctx := context.Background()
 	resp, err := dpq.consumer.forwardMessageToDeadLetterQueue0(ctx, mv)
 	if err != nil {
+		if attempt >= FORWARD_MESSAGE_TO_DLQ_MAX_ATTEMPTS {
+			dpq.giveUpForwardingToDeadLetterQueue(mv, attempt, err, callback)
+			return
+		}
 		dpq.consumer.cli.log.Errorf("Exception raised while acknowledging message, clientId=%s, consumerGroup=%s, "+
 			"would attempt to re-ack later, attempt=%d, messageId=%s, mq=%s, endpoints=%v, err=%w", clientId,
 			consumerGroup, attempt, messageId, dpq.mqstr, endpoints, err)
@@ -125,12 +179,21 @@ func (dpq *defaultProcessQueue) forwardToDeadLetterQueue0(mv *MessageView, attem
 	requestId := utils.GetRequestID(ctx)
 	status := resp.GetStatus()
 	code := status.GetCode()
+	if code == v2.Code_TOPIC_NOT_FOUND && dpq.consumer.pcOpts.deadLetterFallback != DeadLetterFallback_RETRY {
+		dpq.dropDeadLetterMessage(mv, callback)
+		return
+	}
 	// Log failure and retry later.
 	if code != v2.Code_OK {
+		if attempt >= FORWARD_MESSAGE_TO_DLQ_MAX_ATTEMPTS {
+			dpq.giveUpForwardingToDeadLetterQueue(mv, attempt, &ErrRpcStatus{Code: int32(code), Message: status.GetMessage()}, callback)
+			return
+		}
 		dpq.consumer.cli.log.Errorf("Failed to forward message to dead letter queue, would attempt to re-forward later, "+
 			" clientId=%s, consumerGroup=%s, messageId=%s, attempt=%d, mq=%s, endpoints=%v, requestId=%s, status message=[%s]", clientId, consumerGroup, messageId, attempt, dpq.mqstr,
 			endpoints, requestId, status.GetMessage())
 		dpq.forwardToDeadLetterQueueLater(mv, 1+attempt, callback)
+		return
 	}
 	// Set result if succeed in changing invisible time.
 	callback(nil)
@@ -154,19 +217,79 @@ func (dpq *defaultProcessQueue) forwardToDeadLetterQueueLater(mv *MessageView, a
 			if err := recover(); err != nil {
 				dpq.consumer.cli.log.Errorf("[Bug] Failed to schedule message change invisible duration request, mq=%s, messageId=%s, "+
 					"clientId=%s", dpq.mqstr, messageId, clientId)
-				dpq.ackMessageLater(mv, 1+attempt, callback)
+				dpq.forwardToDeadLetterQueueLater(mv, 1+attempt, callback)
 			}
 		}()
-		dpq.ackMessage0(mv, attempt, callback)
+		dpq.forwardToDeadLetterQueue0(mv, attempt, callback)
 	})
 }
 
+// giveUpForwardingToDeadLetterQueue stops forwarding the message to the dead letter queue after the max attempts, the
+// message is neither acked nor forwarded, so that brokers redeliver it once its invisible duration expires.
+func (dpq *defaultProcessQueue) giveUpForwardingToDeadLetterQueue(mv *MessageView, attempt int, err error, callback func(error)) {
+	dpq.consumer.cli.log.Errorf("Failed to forward message to dead letter queue, run out of attempts, leave it to be redelivered, "+
+		"clientId=%s, consumerGroup=%s, messageId=%s, attempt=%d, mq=%s, endpoints=%v, err=%v", dpq.consumer.cli.clientID,
+		dpq.consumer.groupName, mv.GetMessageId(), attempt, dpq.mqstr, mv.endpoints, err)
+	callback(err)
+}
+
+// dropDeadLetterMessage acks the message which could not be forwarded because the dead letter queue is missing,
+// see WithDeadLetterFallback.
+func (dpq *defaultProcessQueue) dropDeadLetterMessage(mv *MessageView, callback func(error)) {
+	dpq.consumer.cli.log.Warnf("Dead letter queue is not found, drop the message, consumerGroup=%s, mq=%s, messageId=%s, "+
+		"fallback=%d, clientId=%s", dpq.consumer.groupName, dpq.mqstr, mv.GetMessageId(), dpq.consumer.pcOpts.deadLetterFallback,
+		dpq.consumer.cli.clientID)
+	if f := dpq.consumer.pcOpts.onDeadLetterFallback; f != nil && dpq.consumer.pcOpts.deadLetterFallback == DeadLetterFallback_CALLBACK {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					dpq.consumer.cli.log.Errorf("dead letter fallback panicked, messageId=%s, clientId=%s, panic=%v", mv.GetMessageId(), dpq.consumer.cli.clientID, r)
+				}
+			}()
+			f(mv)
+		}()
+	}
+	dpq.consumer.droppedMessagesQuantity.Inc()
+	dpq.recordMessage(mv, ConsumeDroppedMessagesM)
+	dpq.ackMessage0(mv, 1, callback)
+}
+
+// shouldDeadLetter tells whether the failed message is forwarded to the dead letter queue without retrying, see
+// WithDeadLetterPredicate.
+func (dpq *defaultProcessQueue) shouldDeadLetter(mv *MessageView) bool {
+	predicate := dpq.consumer.pcOpts.deadLetterPredicate
+	if predicate == nil || !predicate(mv, int(mv.GetDeliveryAttempt()), mv.consumeErr) {
+		return false
+	}
+	dpq.consumer.cli.log.Infof("Dead letter predicate is satisfied by the failed message, mq=%s, messageId=%s, attempt=%d, "+
+		"clientId=%s, err=%v", dpq.mqstr, mv.GetMessageId(), mv.GetDeliveryAttempt(), dpq.consumer.cli.clientID, mv.consumeErr)
+	return true
+}
+
 func (dpq *defaultProcessQueue) eraseMessage(mv *MessageView, consumeResult ConsumerResult) {
-	if consumeResult == SUCCESS {
+	if mv.drained {
+		dpq.evictCacheMessage(mv)
+		return
+	}
+	if consumeResult == FAILURE && dpq.shouldDeadLetter(mv) {
+		consumeResult = TERMINATE
+	}
+	switch consumeResult {
+	case SUCCESS:
 		dpq.consumer.consumptionOkQuantity.Inc()
+		if mv.manualAckToken != nil {
+			dpq.evictCacheMessage(mv)
+			return
+		}
 		dpq.ackMessage(mv, func(error) { dpq.evictCacheMessage(mv) })
-	} else {
+	case TERMINATE:
+		dpq.consumer.consumptionErrorQuantity.Inc()
+		dpq.consumer.cli.log.Infof("Terminate consumption of message, forward it to dead letter queue, mq=%s, messageId=%s, clientId=%s",
+			dpq.mqstr, mv.GetMessageId(), dpq.consumer.cli.clientID)
+		dpq.forwardToDeadLetterQueue(mv, func(error) { dpq.evictCacheMessage(mv) })
+	default:
 		dpq.consumer.consumptionErrorQuantity.Inc()
+		dpq.recordMessage(mv, ConsumeNackedMessagesM)
 		dpq.nackMessage(mv, func(error) { dpq.evictCacheMessage(mv) })
 	}
 
@@ -178,9 +301,16 @@ func (dpq *defaultProcessQueue) discardMessage(mv *MessageView) {
 }
 
 func (dpq *defaultProcessQueue) nackMessage(mv *MessageView, callback func(error)) {
+	dpq.changeInvisibleDuration(mv, dpq.getNextAttemptDelay(mv), 1, dpq.consumer.wrapAckCallback(mv, callback))
+}
+
+// getNextAttemptDelay prefers the delay requested by the listener to the backoff of retry policy.
+func (dpq *defaultProcessQueue) getNextAttemptDelay(mv *MessageView) time.Duration {
+	if mv.retryAfter > 0 {
+		return mv.retryAfter
+	}
 	deliveryAttempt := mv.GetMessageCommon().deliveryAttempt
-	duration := utils.GetNextAttemptDelay(dpq.consumer.pcSettings.GetRetryPolicy(), int(deliveryAttempt))
-	dpq.changeInvisibleDuration(mv, duration, 1, callback)
+	return utils.GetNextAttemptDelay(dpq.consumer.pcSettings.GetRetryPolicy(), int(deliveryAttempt))
 }
 
 func (dpq *defaultProcessQueue) changeInvisibleDuration(mv *MessageView, duration time.Duration, attempt int, callback func(error)) {
@@ -192,6 +322,10 @@ func (dpq *defaultProcessQueue) changeInvisibleDuration(mv *MessageView, duratio
 	ctx := context.Background()
 	resp, err := dpq.consumer.changeInvisibleDuration0(ctx, mv, duration)
 	if err != nil {
+		if attempt >= CHANGE_INVISIBLE_DURATION_MAX_ATTEMPTS {
+			dpq.giveUpChangingInvisibleDuration(mv, attempt, err, callback)
+			return
+		}
 		dpq.consumer.cli.log.Errorf("Exception raised while changing invisible duration, would retry later, clientId=%s, consumerGroup=%s, messageId=%s, mq=%s, endpoints=%v, err=%w",
 			clientId, consumerGroup, messageId, dpq.mqstr, endpoints, err)
 		dpq.changeInvisibleDurationLater(mv, duration, 1+attempt, callback)
@@ -210,10 +344,16 @@ func (dpq *defaultProcessQueue) changeInvisibleDuration(mv *MessageView, duratio
 	}
 	// Log failure and retry later.
 	if code != v2.Code_OK {
+		if attempt >= CHANGE_INVISIBLE_DURATION_MAX_ATTEMPTS {
+			dpq.giveUpChangingInvisibleDuration(mv, attempt, &ErrRpcStatus{Code: int32(code), Message: status.GetMessage()}, callback)
+			return
+		}
 		dpq.consumer.cli.log.Errorf("Failed to change invisible duration, would retry later, "+
 			" clientId=%s, consumerGroup=%s, messageId=%s, attempt=%d, mq=%s, endpoints=%v, requestId=%s, status message=[%s]", clientId, consumerGroup, messageId, attempt, dpq.mqstr,
 			endpoints, requestId, status.GetMessage())
 		dpq.changeInvisibleDurationLater(mv, duration, 1+attempt, callback)
+
+		return
 	}
 	// Set result if succeed in changing invisible time.
 	callback(nil)
@@ -229,6 +369,15 @@ func (dpq *defaultProcessQueue) changeInvisibleDuration(mv *MessageView, duratio
 		requestId)
 }
 
+// giveUpChangingInvisibleDuration stops nacking the message after the max attempts, so that brokers redeliver it once
+// its invisible duration expires.
+func (dpq *defaultProcessQueue) giveUpChangingInvisibleDuration(mv *MessageView, attempt int, err error, callback func(error)) {
+	dpq.consumer.cli.log.Errorf("Failed to change invisible duration, run out of attempts, leave it to be redelivered, "+
+		"clientId=%s, consumerGroup=%s, messageId=%s, attempt=%d, mq=%s, endpoints=%v, err=%v", dpq.consumer.cli.clientID,
+		dpq.consumer.groupName, mv.GetMessageId(), attempt, dpq.mqstr, mv.endpoints, err)
+	callback(err)
+}
+
 func (dpq *defaultProcessQueue) changeInvisibleDurationLater(mv *MessageView, duration time.Duration, attempt int, callback func(error)) {
 	clientId := dpq.consumer.cli.clientID
 	messageId := mv.messageId
@@ -245,7 +394,7 @@ func (dpq *defaultProcessQueue) changeInvisibleDurationLater(mv *MessageView, du
 }
 
 func (dpq *defaultProcessQueue) ackMessage(mv *MessageView, callback func(error)) {
-	dpq.ackMessage0(mv, 1, callback)
+	dpq.ackMessage0(mv, 1, dpq.consumer.wrapAckCallback(mv, callback))
 }
 
 func (dpq *defaultProcessQueue) ackMessage0(mv *MessageView, attempt int, callback func(error)) {
@@ -256,7 +405,16 @@ func (dpq *defaultProcessQueue) ackMessage0(mv *MessageView, attempt int, callba
 
 	ctx := context.Background()
 	resp, err := dpq.consumer.ack0(ctx, mv)
+	var duplicateAck *ErrDuplicateAck
+	if errors.As(err, &duplicateAck) {
+		callback(nil)
+		return
+	}
 	if err != nil {
+		if attempt >= ACK_MESSAGE_MAX_ATTEMPTS {
+			dpq.giveUpAckingMessage(mv, attempt, err, callback)
+			return
+		}
 		dpq.consumer.cli.log.Errorf("Exception raised while acknowledging message, clientId=%s, consumerGroup=%s, "+
 			"would attempt to re-ack later, attempt=%d, messageId=%s, mq=%s, endpoints=%v, err=%w", clientId,
 			consumerGroup, attempt, messageId, dpq.mqstr, endpoints, err)
@@ -276,10 +434,16 @@ func (dpq *defaultProcessQueue) ackMessage0(mv *MessageView, attempt int, callba
 	}
 	// Log failure and retry later.
 	if code != v2.Code_OK {
+		if attempt >= ACK_MESSAGE_MAX_ATTEMPTS {
+			dpq.giveUpAckingMessage(mv, attempt, &ErrRpcStatus{Code: int32(code), Message: status.GetMessage()}, callback)
+			return
+		}
 		dpq.consumer.cli.log.Errorf("Failed to ack message, would attempt to re-ack later, "+
 			" clientId=%s, consumerGroup=%s, messageId=%s, attempt=%d, mq=%s, endpoints=%v, requestId=%s, status message=[%s]", clientId, consumerGroup, messageId, attempt, dpq.mqstr,
 			endpoints, requestId, status.GetMessage())
 		dpq.ackMessageLater(mv, 1+attempt, callback)
+
+		return
 	}
 	// Set result if succeed in changing invisible time.
 	callback(nil)
@@ -295,6 +459,15 @@ func (dpq *defaultProcessQueue) ackMessage0(mv *MessageView, attempt int, callba
 		requestId)
 }
 
+// giveUpAckingMessage stops acking the message after the max attempts, so that brokers redeliver it once its invisible
+// duration expires.
+func (dpq *defaultProcessQueue) giveUpAckingMessage(mv *MessageView, attempt int, err error, callback func(error)) {
+	dpq.consumer.cli.log.Errorf("Failed to ack message, run out of attempts, leave it to be redelivered, "+
+		"clientId=%s, consumerGroup=%s, messageId=%s, attempt=%d, mq=%s, endpoints=%v, err=%v", dpq.consumer.cli.clientID,
+		dpq.consumer.groupName, mv.GetMessageId(), attempt, dpq.mqstr, mv.endpoints, err)
+	callback(err)
+}
+
 func (dpq *defaultProcessQueue) ackMessageLater(mv *MessageView, attempt int, callback func(error)) {
 	clientId := dpq.consumer.cli.clientID
 	messageId := mv.messageId
@@ -390,6 +563,15 @@ func (dpq *defaultProcessQueue) isCacheFull() bool {
 		return true
 	}
 
+	maxInFlightBytes := dpq.consumer.pcOpts.maxInFlightBytes
+	actualInFlightBytes := dpq.consumer.inFlightBytes.Load()
+	if maxInFlightBytes > 0 && maxInFlightBytes <= actualInFlightBytes {
+		dpq.consumer.cli.log.Warnf("Consumer total in-flight messages memory exceeds the budget, budget=%d bytes, actual=%d bytes, mq=%s, clientId=%s",
+			maxInFlightBytes, actualInFlightBytes, dpq.mqstr, clientId)
+		dpq.cacheFullNanoTime.Store(time.Now().UnixNano())
+		return true
+	}
+
 	return false
 }
 
@@ -423,8 +605,20 @@ func (dpq *defaultProcessQueue) receiveMessageImmediatelyWithAttemptId(attemptId
 	dpq.consumer.cli.doBefore(MessageHookPoints_RECEIVE, make([]*MessageCommon, 0))
 
 	timeout := longPollingTimeout + dpq.consumer.cli.opts.timeout
-	go func() {
+	limiter := dpq.consumer.receiveRateLimiter
+	dpq.consumer.cli.goAsync(func() {
+		// Wait for a free slot in the goroutine rather than blocking the caller, e.g. the scan of assignments, see
+		// WithPushMaxReceiveConcurrency. At most one request of each queue is waiting.
+		if limiter != nil {
+			if err := limiter.acquire(dpq.consumer.ctx); err != nil {
+				dpq.consumer.cli.log.Infof("Stop to receive message because consumer is shutting down, mq=%s, clientId=%s", dpq.mqstr, clientId)
+				return
+			}
+		}
 		mvs, err := dpq.consumer.receiveMessage(context.TODO(), request, dpq.mq, timeout)
+		if limiter != nil {
+			limiter.release()
+		}
 		duration := time.Since(startTime)
 		if err == nil {
 			messageCommons := make([]*MessageCommon, 0, len(mvs))
@@ -432,12 +626,16 @@ func (dpq *defaultProcessQueue) receiveMessageImmediatelyWithAttemptId(attemptId
 				messageCommons = append(messageCommons, mv.GetMessageCommon())
 			}
 			dpq.consumer.cli.doAfter(MessageHookPoints_RECEIVE, messageCommons, duration, MessageHookPointsStatus_OK)
+			dpq.recoverReceptionBatchSize()
 			dpq.onReceiveMessageResult(mvs)
 		} else {
 			nextAttemptId := ""
 			if status.Code(err) == codes.DeadlineExceeded {
 				nextAttemptId = request.GetAttemptId()
 			}
+			if status.Code(err) == codes.ResourceExhausted {
+				dpq.reduceReceptionBatchSize(batchSize)
+			}
 			dpq.consumer.cli.doAfter(MessageHookPoints_RECEIVE, make([]*MessageCommon, 0), duration, MessageHookPointsStatus_ERROR)
 			// add some check to skip no message
 			dpq.consumer.cli.log.Errorf("Exception raised during message reception, mq=%s, endpoints=%v, attemptId=%d, "+
@@ -446,7 +644,7 @@ func (dpq *defaultProcessQueue) receiveMessageImmediatelyWithAttemptId(attemptId
 
 			dpq.onReceiveMessageException(err, nextAttemptId)
 		}
-	}()
+	})
 	dpq.receptionTimes.Inc()
 	dpq.consumer.receptionTimes.Inc()
 
@@ -455,7 +653,38 @@ func (dpq *defaultProcessQueue) receiveMessageImmediatelyWithAttemptId(attemptId
 func (dpq *defaultProcessQueue) getReceptionBatchSize() int32 {
 	bufferSize := float64(dpq.consumer.cacheMessageCountThresholdPerQueue() - dpq.cachedMessagesNums.Load())
 	bufferSize = math.Max(float64(bufferSize), 1)
-	return int32(math.Min(bufferSize, float64(dpq.consumer.pcSettings.receiveBatchSize)))
+	batchSize := math.Min(bufferSize, float64(dpq.consumer.pcSettings.receiveBatchSize))
+	if limit := dpq.receptionBatchSizeLimit.Load(); limit > 0 {
+		batchSize = math.Min(batchSize, float64(limit))
+	}
+	return int32(batchSize)
+}
+
+// reduceReceptionBatchSize halves the batch size once the receive response exceeds the size limit of gRPC.
+func (dpq *defaultProcessQueue) reduceReceptionBatchSize(batchSize int32) {
+	limit := batchSize / 2
+	if limit < 1 {
+		limit = 1
+	}
+	dpq.receptionBatchSizeLimit.Store(limit)
+	dpq.consumer.cli.log.Warnf("Receive response exceeds the size limit, reduce the batch size, mq=%s, batchSize=%d, reduced=%d, clientId=%s",
+		dpq.mqstr, batchSize, limit, dpq.consumer.cli.clientID)
+}
+
+// recoverReceptionBatchSize doubles the reduced batch size after a successful reception, until it is recovered.
+func (dpq *defaultProcessQueue) recoverReceptionBatchSize() {
+	limit := dpq.receptionBatchSizeLimit.Load()
+	if limit <= 0 {
+		return
+	}
+	limit *= 2
+	if limit >= dpq.consumer.pcSettings.receiveBatchSize {
+		dpq.receptionBatchSizeLimit.Store(0)
+		dpq.consumer.cli.log.Infof("Batch size of reception is recovered, mq=%s, batchSize=%d, clientId=%s",
+			dpq.mqstr, dpq.consumer.pcSettings.receiveBatchSize, dpq.consumer.cli.clientID)
+		return
+	}
+	dpq.receptionBatchSizeLimit.Store(limit)
 }
 
 func (dpq *defaultProcessQueue) onReceiveMessageException(t any, attemptId string) {
@@ -489,19 +718,129 @@ func (dpq *defaultProcessQueue) onReceiveMessageResult(mvs []*MessageView) {
 		dpq.cacheMessages(mvs)
 		dpq.receivedMessagesQuantity.Add(mvslen)
 		dpq.consumer.receivedMessagesQuantity.Add(mvslen)
-		dpq.consumer.consumerService.consume(dpq, mvs)
+		mvs = dpq.skipStaleMessages(mvs)
+		mvs = dpq.skipExpiredMessages(mvs)
+		mvs = dpq.skipSupersededMessages(mvs)
+		if dpq.consumer.pcOpts.manualAck && !dpq.consumer.pcSettings.isFifo {
+			for _, mv := range mvs {
+				mv.manualAckToken = newManualAckToken(mv)
+			}
+		}
+		if len(mvs) != 0 {
+			dpq.consumer.consumerService.consume(dpq, mvs)
+		}
 	}
 	dpq.receiveMessage()
 }
 
+func (dpq *defaultProcessQueue) skipExpiredMessages(mvs []*MessageView) []*MessageView {
+	key := dpq.consumer.pcOpts.messageExpiryProperty
+	if len(key) == 0 {
+		return mvs
+	}
+	now := time.Now().UnixMilli()
+	remaining := mvs[:0]
+	for _, mv := range mvs {
+		value, ok := mv.GetProperties()[key]
+		if !ok {
+			remaining = append(remaining, mv)
+			continue
+		}
+		expiry, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			dpq.consumer.cli.log.Warnf("Failed to parse message expiry property, key=%s, value=%s, messageId=%s, clientId=%s", key, value, mv.GetMessageId(), dpq.consumer.cli.clientID)
+			remaining = append(remaining, mv)
+			continue
+		}
+		if expiry > now {
+			remaining = append(remaining, mv)
+			continue
+		}
+		mv.expired = true
+		dpq.consumer.expiredMessagesQuantity.Inc()
+		dpq.recordMessage(mv, ConsumeExpiredMessagesM)
+		if dpq.consumer.pcOpts.deliverExpiredMessages {
+			remaining = append(remaining, mv)
+			continue
+		}
+		dpq.consumer.cli.log.Debugf("Skip expired message, mq=%s, messageId=%s, expiry=%d, clientId=%s", dpq.mqstr, mv.GetMessageId(), expiry, dpq.consumer.cli.clientID)
+		dpq.ackMessage(mv, func(error) { dpq.evictCacheMessage(mv) })
+	}
+	return remaining
+}
+
+// skipStaleMessages acknowledges messages stored earlier than the cutoff of WithSkipMessagesOlderThan.
+func (dpq *defaultProcessQueue) skipStaleMessages(mvs []*MessageView) []*MessageView {
+	olderThan := dpq.consumer.pcOpts.skipOlderThan
+	if olderThan <= 0 {
+		return mvs
+	}
+	// Store timestamps are stamped by brokers, so that the cutoff follows the clock of brokers if it is corrected.
+	cutoff := defaultClock.Now().Add(-dpq.consumer.cli.clientMeterProvider.getClockSkewCorrection()).Add(-olderThan)
+	remaining := mvs[:0]
+	for _, mv := range mvs {
+		storeTimestamp := mv.GetStoreTimestamp()
+		if storeTimestamp == nil || !storeTimestamp.Before(cutoff) {
+			remaining = append(remaining, mv)
+			continue
+		}
+		dpq.consumer.skippedMessagesQuantity.Inc()
+		dpq.recordMessage(mv, ConsumeSkippedMessagesM)
+		dpq.consumer.cli.log.Debugf("Skip stale message, mq=%s, messageId=%s, storeTimestamp=%v, clientId=%s", dpq.mqstr, mv.GetMessageId(), storeTimestamp, dpq.consumer.cli.clientID)
+		dpq.ackMessage(mv, func(error) { dpq.evictCacheMessage(mv) })
+	}
+	return remaining
+}
+
+// skipSupersededMessages keeps only the latest message per key of the batch, messages of the batch are
+// in the order of their offsets so the last one of each key wins.
+func (dpq *defaultProcessQueue) skipSupersededMessages(mvs []*MessageView) []*MessageView {
+	keyExtractor := dpq.consumer.pcOpts.keyExtractor
+	if !dpq.consumer.pcOpts.dedupByKey || keyExtractor == nil || len(mvs) < 2 {
+		return mvs
+	}
+	keys := make([]string, len(mvs))
+	latest := make(map[string]int)
+	for i, mv := range mvs {
+		keys[i] = keyExtractor(mv)
+		if len(keys[i]) != 0 {
+			latest[keys[i]] = i
+		}
+	}
+	remaining := make([]*MessageView, 0, len(mvs))
+	for i, mv := range mvs {
+		if len(keys[i]) == 0 || latest[keys[i]] == i {
+			remaining = append(remaining, mv)
+			continue
+		}
+		dpq.consumer.cli.log.Debugf("Skip superseded message, mq=%s, messageId=%s, key=%s, clientId=%s", dpq.mqstr, mv.GetMessageId(), keys[i], dpq.consumer.cli.clientID)
+		dpq.ackMessage(mv, func(error) { dpq.evictCacheMessage(mv) })
+	}
+	return remaining
+}
+
+// recordMessage increases the counter of measure by the message.
+func (dpq *defaultProcessQueue) recordMessage(mv *MessageView, measure *stats.Int64Measure) {
+	if !dpq.consumer.cli.clientMeterProvider.isEnabled() {
+		return
+	}
+	cmp := dpq.consumer.cli.clientMeterProvider
+	err := stats.RecordWithTags(cmp.tagContext(), []tag.Mutator{tag.Insert(topicTag, cmp.sanitizeTagValue(topicTag, mv.GetTopic())), tag.Insert(clientIdTag, dpq.consumer.cli.clientID), tag.Insert(consumerGroupTag, cmp.sanitizeTagValue(consumerGroupTag, dpq.consumer.groupName))}, measure.M(1))
+	if err != nil {
+		dpq.consumer.cli.log.Errorf("Failed to record %s, messageId=%s, err=%v", measure.Name(), mv.GetMessageId(), err)
+	}
+}
+
 func (dpq *defaultProcessQueue) cacheMessages(mvs []*MessageView) {
 	for _, mv := range mvs {
 		dpq.cachedMessagesNums.Inc()
 		dpq.cachedMessagesBytes.Add(int64(len(mv.body)))
+		dpq.consumer.inFlightBytes.Add(int64(len(mv.body)))
 	}
 }
 
 func (dpq *defaultProcessQueue) evictCacheMessage(mv *MessageView) {
 	dpq.cachedMessagesNums.Dec()
 	dpq.cachedMessagesBytes.Sub(int64(len(mv.body)))
+	dpq.consumer.inFlightBytes.Sub(int64(len(mv.body)))
 }
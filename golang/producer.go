@@ -21,23 +21,34 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"math/rand"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"go.uber.org/atomic"
 
 	"github.com/apache/rocketmq-clients/golang/v5/pkg/utils"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 type Producer interface {
 	Send(context.Context, *Message) ([]*SendReceipt, error)
 	SendWithTransaction(context.Context, *Message, Transaction) ([]*SendReceipt, error)
+	SendWithSession(context.Context, *Message, *SendSession) ([]*SendReceipt, error)
 	SendAsync(context.Context, *Message, func(context.Context, []*SendReceipt, error))
+	Flush(context.Context) error
+	SendBatch(context.Context, []*Message) ([]*BatchSendEntry, error)
 	BeginTransaction() Transaction
 	Start() error
 	GracefulStop() error
+	Inspect() ClientState
+	CheckCompatibility(ctx context.Context) (CompatInfo, error)
 	isClient
 }
 
@@ -49,6 +60,33 @@ type defaultProducer struct {
 	checker                        *TransactionChecker
 	isolated                       sync.Map
 	publishingRouteDataResultCache sync.Map
+	deduplicator                   *sendDeduplicator
+	// rateLimiter is nil if sending is unlimited.
+	rateLimiter *tokenBucket
+	// transactionChecks holds a token for every running transaction checker, nil means no limit.
+	transactionChecks chan struct{}
+	// asyncSends holds a token for every async send in flight, nil means no limit.
+	asyncSends chan struct{}
+	// shardingKeySequencer is nil unless WithShardingKeyOrder is enabled.
+	shardingKeySequencer *keySequencer
+	// brokerLatencies holds the moving average of send latency in nanoseconds by broker name.
+	brokerLatencies sync.Map
+	// throttleLevel is the exponent of the throttle backoff, see WithThrottleBackoff.
+	throttleLevel atomic.Int32
+
+	// asyncIssued numbers the async sends issued, asyncPending counts the ones whose callbacks have not fired yet,
+	// and asyncFlushes are the flushes waiting for the ones issued before them.
+	asyncLock    sync.Mutex
+	asyncIssued  uint64
+	asyncPending int
+	asyncFlushes []*asyncFlush
+}
+
+// asyncFlush waits for the async sends numbered up to upTo, remaining of which have not fired their callbacks yet.
+type asyncFlush struct {
+	upTo      uint64
+	remaining int
+	done      chan struct{}
 }
 
 func (p *defaultProducer) Start() error {
@@ -68,6 +106,16 @@ var _ = Producer(&defaultProducer{})
 func (p *defaultProducer) isClient() {
 }
 
+// Inspect returns a snapshot of the internal state of the producer.
+func (p *defaultProducer) Inspect() ClientState {
+	return p.cli.inspect()
+}
+
+// CheckCompatibility checks whether brokers implement the protocol of the producer, and the features they support.
+func (p *defaultProducer) CheckCompatibility(ctx context.Context) (CompatInfo, error) {
+	return p.cli.checkCompatibility(ctx)
+}
+
 func (p *defaultProducer) isOn() bool {
 	return p.cli.on.Load()
 }
@@ -78,10 +126,34 @@ func (p *defaultProducer) wrapHeartbeatRequest() *v2.HeartbeatRequest {
 	}
 }
 
-func (p *defaultProducer) takeMessageQueues(plb PublishingLoadBalancer) ([]*v2.MessageQueue, error) {
+func (p *defaultProducer) takeMessageQueues(plb PublishingLoadBalancer, priority MessagePriority) ([]*v2.MessageQueue, error) {
+	if priority >= MessagePriority_HIGH {
+		return plb.TakeMessageQueuesByScore(&p.isolated, p.getRetryMaxAttempts(), p.scoreByBrokerLatency)
+	}
+	if p.po.queueScorer != nil {
+		return plb.TakeMessageQueuesByScore(&p.isolated, p.getRetryMaxAttempts(), p.po.queueScorer)
+	}
 	return plb.TakeMessageQueues(&p.isolated, p.getRetryMaxAttempts())
 }
 
+// scoreByBrokerLatency prefers brokers with lower recent send latency, brokers never sent to are preferred most.
+func (p *defaultProducer) scoreByBrokerLatency(mq *v2.MessageQueue) float64 {
+	if v, ok := p.brokerLatencies.Load(mq.GetBroker().GetName()); ok {
+		return -float64(v.(*atomic.Int64).Load())
+	}
+	return 0
+}
+
+func (p *defaultProducer) recordBrokerLatency(brokerName string, duration time.Duration) {
+	v, loaded := p.brokerLatencies.LoadOrStore(brokerName, atomic.NewInt64(int64(duration)))
+	if !loaded {
+		return
+	}
+	latency := v.(*atomic.Int64)
+	old := latency.Load()
+	latency.Store(old + (int64(duration)-old)/8)
+}
+
 func (p *defaultProducer) getPublishingTopicRouteResult(ctx context.Context, topic string) (PublishingLoadBalancer, error) {
 	item, ok := p.publishingRouteDataResultCache.Load(topic)
 	if ok {
@@ -93,7 +165,7 @@ func (p *defaultProducer) getPublishingTopicRouteResult(ctx context.Context, top
 	if err != nil {
 		return nil, err
 	}
-	plb, err := NewPublishingLoadBalancer(route)
+	plb, err := p.newPublishingLoadBalancer(route)
 	if err != nil {
 		return nil, err
 	}
@@ -101,6 +173,21 @@ func (p *defaultProducer) getPublishingTopicRouteResult(ctx context.Context, top
 	return plb, nil
 }
 
+// newPublishingLoadBalancer creates the load balancer of a topic, whose round-robin starts from the point of
+// WithQueueSelectSeed if it is set.
+func (p *defaultProducer) newPublishingLoadBalancer(route []*v2.MessageQueue) (PublishingLoadBalancer, error) {
+	plb, err := NewPublishingLoadBalancer(route)
+	if err != nil {
+		return nil, err
+	}
+	if seed := p.po.queueSelectSeed; seed != nil {
+		if impl, ok := plb.(*publishingLoadBalancer); ok {
+			impl.index.Store(rand.New(rand.NewSource(*seed)).Int31())
+		}
+	}
+	return plb, nil
+}
+
 func (p *defaultProducer) wrapSendMessageRequest(pMsgs []*PublishingMessage) (*v2.SendMessageRequest, error) {
 	smr := &v2.SendMessageRequest{
 		Messages: []*v2.Message{},
@@ -108,13 +195,127 @@ func (p *defaultProducer) wrapSendMessageRequest(pMsgs []*PublishingMessage) (*v
 	for _, pMsg := range pMsgs {
 		msgV2, err := pMsg.toProtobuf()
 		if err != nil {
-			return nil, fmt.Errorf("wrapSendMessageRequest failed, {%v}", err)
+			return nil, newErrSerialization(pMsg.msg, err)
+		}
+		if err = p.declareBodyCharset(msgV2, pMsg.msg.Body); err != nil {
+			return nil, newErrSerialization(pMsg.msg, err)
+		}
+		p.populateDefaultProperties(msgV2)
+		if err = p.transformProperties(msgV2); err != nil {
+			return nil, newErrSerialization(pMsg.msg, err)
+		}
+		if err = validateUTF8(msgV2); err != nil {
+			return nil, newErrSerialization(pMsg.msg, err)
 		}
 		smr.Messages = append(smr.Messages, msgV2)
 	}
 	return smr, nil
 }
 
+// validateUTF8 returns an error if any string field of msg is not valid UTF-8, which fails the marshaling of the
+// send request by gRPC, so that it is told before the request is sent.
+func validateUTF8(msg *v2.Message) error {
+	sp := msg.GetSystemProperties()
+	fields := map[string]string{
+		"topic":         msg.GetTopic().GetName(),
+		"tag":           sp.GetTag(),
+		"message group": sp.GetMessageGroup(),
+		"lite topic":    sp.GetLiteTopic(),
+		"trace context": sp.GetTraceContext(),
+	}
+	for name, value := range fields {
+		if !utf8.ValidString(value) {
+			return fmt.Errorf("%s is not valid UTF-8", name)
+		}
+	}
+	for _, key := range sp.GetKeys() {
+		if !utf8.ValidString(key) {
+			return fmt.Errorf("message key %q is not valid UTF-8", key)
+		}
+	}
+	for key, value := range msg.GetUserProperties() {
+		if !utf8.ValidString(key) || !utf8.ValidString(value) {
+			return fmt.Errorf("property %q is not valid UTF-8", key)
+		}
+	}
+	return nil
+}
+
+// declareBodyCharset declares the charset of producer for messages without one, and validates UTF-8 bodies. body is
+// the body before encryption, since the charset applies to the decrypted body that consumers see.
+func (p *defaultProducer) declareBodyCharset(msg *v2.Message, body []byte) error {
+	charset, ok := msg.GetUserProperties()[BodyCharsetProperty]
+	if !ok && len(p.po.bodyCharset) != 0 {
+		charset = p.po.bodyCharset
+		properties := make(map[string]string, len(msg.GetUserProperties())+1)
+		for k, v := range msg.GetUserProperties() {
+			properties[k] = v
+		}
+		properties[BodyCharsetProperty] = charset
+		msg.UserProperties = properties
+	}
+	if (strings.EqualFold(charset, "UTF-8") || strings.EqualFold(charset, "UTF8")) && !utf8.Valid(body) {
+		return fmt.Errorf("message body is not valid UTF-8 as declared, topic=%s", msg.GetTopic().GetName())
+	}
+	return nil
+}
+
+func (p *defaultProducer) populateDefaultProperties(msg *v2.Message) {
+	if len(p.po.defaultProperties) == 0 {
+		return
+	}
+	properties := make(map[string]string, len(msg.GetUserProperties())+len(p.po.defaultProperties))
+	for k, v := range p.po.defaultProperties {
+		properties[k] = v
+	}
+	for k, v := range msg.GetUserProperties() {
+		properties[k] = v
+	}
+	msg.UserProperties = properties
+}
+
+// interceptSend calls the interceptors of WithSendInterceptor in order, the first error stops sending.
+func (p *defaultProducer) interceptSend(msg *Message) error {
+	for _, interceptor := range p.po.sendInterceptors {
+		if err := interceptor(msg); err != nil {
+			return fmt.Errorf("send interceptor rejects the message, topic=%s, err=%w", msg.Topic, err)
+		}
+	}
+	return nil
+}
+
+// checkRequiredProperties returns ErrMissingProperty if msg lacks any property required by WithRequiredProperties.
+func (p *defaultProducer) checkRequiredProperties(msg *Message) error {
+	for _, key := range p.po.requiredProperties {
+		if _, ok := msg.properties[key]; ok {
+			continue
+		}
+		if _, ok := p.po.defaultProperties[key]; ok {
+			continue
+		}
+		return &ErrMissingProperty{Topic: msg.Topic, Key: key}
+	}
+	return nil
+}
+
+func (p *defaultProducer) transformProperties(msg *v2.Message) error {
+	if p.po.propertyTransformer == nil {
+		return nil
+	}
+	properties := make(map[string]string, len(msg.GetUserProperties()))
+	for k, v := range msg.GetUserProperties() {
+		properties[k] = v
+	}
+	properties = p.po.propertyTransformer(properties)
+	for k := range properties {
+		if len(k) == 0 {
+			return fmt.Errorf("property transformer returns an empty property key, topic=%s", msg.GetTopic().GetName())
+		}
+	}
+	msg.UserProperties = properties
+	return nil
+}
+
 var NewProducer = func(config *Config, opts ...ProducerOption) (Producer, error) {
 	copyOpt := defaultProducerOptions
 	po := &copyOpt
@@ -126,15 +327,25 @@ var NewProducer = func(config *Config, opts ...ProducerOption) (Producer, error)
 		return nil, err
 	}
 	p := &defaultProducer{
-		po:      *po,
-		cli:     cli.(*defaultClient),
-		checker: po.checker,
+		po:           *po,
+		cli:          cli.(*defaultClient),
+		checker:      po.checker,
+		deduplicator: newSendDeduplicator(po.deduplicationWindow, po.deduplicationCapacity),
+		rateLimiter:  newTokenBucket(po.sendRateLimit, po.sendRateBurst, po.failFastOnRateLimit),
 	}
-	p.cli.initTopics = po.topics
-	endpoints, err := utils.ParseTarget(config.Endpoint)
-	if err != nil {
-		return nil, err
+	if po.shardingKeyOrder {
+		p.shardingKeySequencer = newKeySequencer()
+		p.shardingKeySequencer.goAsync = p.cli.goAsync
 	}
+	if po.maxConcurrentTransactionChecks > 0 {
+		p.transactionChecks = make(chan struct{}, po.maxConcurrentTransactionChecks)
+	}
+	if po.maxConcurrentAsyncSends > 0 {
+		p.asyncSends = make(chan struct{}, po.maxConcurrentAsyncSends)
+	}
+	p.cli.initTopics = po.topics
+	p.cli.failFastOnNoRoute = po.failFastOnNoRoute
+	endpoints := p.cli.getAccessPoint()
 	p.pSetting = &producerSettings{
 		clientId:   p.cli.GetClientID(),
 		endpoints:  endpoints,
@@ -152,6 +363,8 @@ var NewProducer = func(config *Config, opts ...ProducerOption) (Producer, error)
 		requestTimeout:      p.cli.opts.timeout,
 		validateMessageType: *atomic.NewBool(true),
 		maxBodySizeBytes:    *atomic.NewInt32(4 * 1024 * 1024),
+		messageIdGenerator:  po.messageIdGenerator,
+		encryptor:           po.encryptor,
 	}
 	for _, topic := range po.topics {
 		topicResource := &v2.Resource{
@@ -182,20 +395,24 @@ func (p *defaultProducer) getNextAttemptDelay(attempt int) time.Duration {
 
 func (p *defaultProducer) send1(ctx context.Context, topic string, messageType v2.MessageType,
 	candidates []*v2.MessageQueue, pubMessages []*PublishingMessage, attempt int) ([]*SendReceipt, error) {
+	return p.sendAttempt(ctx, topic, messageType, candidates, pubMessages, attempt, nil)
+}
+
+// sendAttempt sends the messages in the attempt, causes are the errors of previous attempts.
+func (p *defaultProducer) sendAttempt(ctx context.Context, topic string, messageType v2.MessageType,
+	candidates []*v2.MessageQueue, pubMessages []*PublishingMessage, attempt int, causes []error) ([]*SendReceipt, error) {
 
 	ctx = p.cli.Sign(ctx)
 
 	idx := utils.Mod(int32(attempt)-1, len(candidates))
 	selectMessageQueue := candidates[idx]
 
-	if p.pSetting.IsValidateMessageType() && !utils.MatchMessageType(selectMessageQueue, messageType) {
-		return nil, fmt.Errorf("current message type not match with topic accept message types")
-	}
-
 	endpoints := selectMessageQueue.GetBroker().GetEndpoints()
+	p.recordQueueSelection(topic, selectMessageQueue)
 
 	sendReq, err := p.wrapSendMessageRequest(pubMessages)
 	if err != nil {
+		p.observeSendResult(sendReceiptsOf(pubMessages, endpoints), err)
 		return nil, err
 	}
 	messageCommons := make([]*MessageCommon, 0)
@@ -203,9 +420,16 @@ func (p *defaultProducer) send1(ctx context.Context, topic string, messageType v
 		messageCommons = append(messageCommons, pubMessage.msg.GetMessageCommon())
 	}
 	p.cli.doBefore(MessageHookPoints_SEND, messageCommons)
-	watchTime := time.Now()
-	resp, err := p.cli.clientManager.SendMessage(ctx, endpoints, sendReq, p.pSetting.GetRequestTimeout())
-	duration := time.Since(watchTime)
+	rpcCtx := ctx
+	if p.po.sendCancellation == SendCancellation_COMPLETE {
+		// The request is still bounded by the request timeout.
+		rpcCtx = context.WithoutCancel(ctx)
+	}
+	inFlight := ctx.Err() == nil
+	watchTime := defaultClock.Now()
+	resp, err := p.cli.clientManager.SendMessage(rpcCtx, endpoints, sendReq, p.pSetting.GetRequestTimeout())
+	duration := defaultClock.Since(watchTime)
+	p.recordBrokerLatency(selectMessageQueue.GetBroker().GetName(), duration)
 	messageHookPointsStatus := MessageHookPointsStatus_OK
 	// processSendResponse
 	tooManyRequests := false
@@ -226,47 +450,136 @@ func (p *defaultProducer) send1(ctx context.Context, topic string, messageType v
 		for _, pubMessage := range pubMessages {
 			messageIds = append(messageIds, pubMessage.messageId)
 		}
+		// The request is cancelled before brokers reply, see WithSendCancellation.
+		if p.po.sendCancellation == SendCancellation_UNCERTAIN && inFlight && resp == nil && ctx.Err() != nil {
+			p.cli.log.Warnw("context is done while sending message(s), the outcome is uncertain", logFieldTopic, topic,
+				logFieldEndpoints, endpoints, logFieldError, err, "messageIds", messageIds, "attempt", attempt)
+			uncertainErr := &ErrSendUncertain{Topic: topic, MessageIDs: messageIds, Attempt: attempt, Endpoints: endpoints, Err: err}
+			p.observeSendResult(sendReceiptsOf(pubMessages, endpoints), uncertainErr)
+			return nil, uncertainErr
+		}
 		// retry
 		for _, address := range endpoints.GetAddresses() {
 			p.isolated.Store(utils.ParseAddress(address), true)
 		}
-		if attempt >= maxAttempts {
-			p.cli.log.Errorf("failed to send message(s) finally, run out of attempt times, topic=%s, messageId(s)=%v, maxAttempts=%d, attempt=%d, endpoints=%v, requestId=%s",
-				topic, messageIds, maxAttempts, attempt, endpoints, utils.GetRequestID(ctx))
-			return nil, err
+		fields := []interface{}{
+			logFieldTopic, topic,
+			logFieldBroker, selectMessageQueue.GetBroker().GetName(),
+			logFieldEndpoints, endpoints,
+			logFieldErrorCode, errorCodeOf(err),
+			logFieldError, err,
+			"messageIds", messageIds,
+			"maxAttempts", maxAttempts,
+			"attempt", attempt,
+			"requestId", utils.GetRequestID(ctx),
+		}
+		// Requests are detached from the context with SendCancellation_COMPLETE, so no more attempts are made once
+		// it is done.
+		if attempt >= maxAttempts || (p.po.sendCancellation == SendCancellation_COMPLETE && ctx.Err() != nil) {
+			p.cli.log.Errorw("failed to send message(s) finally, run out of attempt times", fields...)
+			sendErr := &SendError{causes: append(causes, err)}
+			p.observeSendResult(sendReceiptsOf(pubMessages, endpoints), sendErr)
+			return nil, sendErr
 		}
 		// Try to do more attempts.
 		nextAttempt := attempt + 1
 		// Retry immediately if the request is not throttled.
 		if tooManyRequests {
-			waitTime := p.getNextAttemptDelay(nextAttempt)
-			p.cli.log.Warnf("failed to send message due to too many requests, would attempt to resend after %v, topic=%s, messageId(s)=%v, maxAttempts=%d, attempt=%d, endpoints=%v, requestId=%s",
-				waitTime, topic, messageIds, maxAttempts, attempt, endpoints, utils.GetRequestID(ctx))
-			time.Sleep(waitTime)
+			p.recordBrokerThrottled(topic)
+			var waitTime time.Duration
+			if p.po.throttleBackoffMin > 0 {
+				waitTime = p.nextThrottleBackoff()
+			} else {
+				waitTime = p.getNextAttemptDelay(nextAttempt)
+			}
+			p.cli.log.Warnw("failed to send message due to too many requests, would attempt to resend later", append(fields, "waitTime", waitTime)...)
+			// The resend fails at once if the context is done during the wait.
+			timer := time.NewTimer(waitTime)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
 		} else {
-			p.cli.log.Warnf("failed to send message, would attempt to resend right now, topic=%s, messageId(s)=%v, maxAttempts=%d, attempt=%d, endpoints=%v, requestId=%s",
-				topic, messageIds, maxAttempts, attempt, endpoints, utils.GetRequestID(ctx))
+			p.cli.log.Warnw("failed to send message, would attempt to resend right now", fields...)
 		}
-		return p.send1(ctx, topic, messageType, candidates, pubMessages, nextAttempt)
+		return p.sendAttempt(ctx, topic, messageType, candidates, pubMessages, nextAttempt, append(causes, err))
 	}
 
+	if p.po.throttleBackoffMin > 0 {
+		p.relaxThrottleBackoff()
+	}
 	var res []*SendReceipt
 	for i := 0; i < len(resp.GetEntries()); i++ {
-		res = append(res, &SendReceipt{
-			MessageID:     resp.GetEntries()[i].GetMessageId(),
-			TransactionId: resp.GetEntries()[i].GetTransactionId(),
-			Offset:        resp.GetEntries()[i].GetOffset(),
+		entry := resp.GetEntries()[i]
+		receipt := &SendReceipt{
+			MessageID:     entry.GetMessageId(),
+			TransactionId: entry.GetTransactionId(),
+			Offset:        entry.GetOffset(),
 			Endpoints:     endpoints,
-		})
+			rawResponse:   resp,
+		}
+		// Entries without status are accepted along with the request.
+		if entry.GetStatus() != nil && entry.GetStatus().GetCode() != v2.Code_OK {
+			receipt.err = &ErrRpcStatus{
+				Code:    int32(entry.GetStatus().GetCode()),
+				Message: entry.GetStatus().GetMessage(),
+			}
+		}
+		res = append(res, receipt)
 	}
 	if attempt > 1 {
 		p.cli.log.Infof("resend message successfully, topic=%s, maxAttempts=%d, attempt=%d, endpoints=%s",
 			topic, maxAttempts, attempt, endpoints.String())
 	}
+	p.observeSendResult(res, nil)
 	return res, nil
 }
 
-func (p *defaultProducer) send0(ctx context.Context, msgs []*UnifiedMessage, txEnabled bool) ([]*SendReceipt, error) {
+// observeSendResult notifies the send result observer asynchronously, so that the send path is never blocked by it.
+func (p *defaultProducer) observeSendResult(receipts []*SendReceipt, err error) {
+	observer := p.po.sendResultObserver
+	if observer == nil {
+		return
+	}
+	p.cli.goAsync(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				p.cli.log.Errorf("send result observer panicked, err=%v", r)
+			}
+		}()
+		for _, receipt := range receipts {
+			if err == nil {
+				observer(receipt, receipt.err)
+				continue
+			}
+			observer(receipt, err)
+		}
+	})
+}
+
+// sendReceiptsOf returns the receipts of messages failed to be sent, messages not published yet have empty ids.
+func sendReceiptsOf(pubMessages []*PublishingMessage, endpoints *v2.Endpoints) []*SendReceipt {
+	receipts := make([]*SendReceipt, 0, len(pubMessages))
+	for _, pubMessage := range pubMessages {
+		receipt := &SendReceipt{Endpoints: endpoints}
+		if pubMessage != nil {
+			receipt.MessageID = pubMessage.messageId
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts
+}
+
+func (p *defaultProducer) send0(ctx context.Context, msgs []*UnifiedMessage, txEnabled bool) (receipts []*SendReceipt, err error) {
+	pubMessages := make([]*PublishingMessage, len(msgs))
+	attempted := false
+	defer func() {
+		// Failures of attempts are observed by sendAttempt.
+		if err != nil && !attempted {
+			p.observeSendResult(sendReceiptsOf(pubMessages, nil), err)
+		}
+	}()
 	// check topic Name
 	topicName := msgs[0].GetMessage().Topic
 	for _, msg := range msgs {
@@ -275,9 +588,20 @@ func (p *defaultProducer) send0(ctx context.Context, msgs []*UnifiedMessage, txE
 		}
 	}
 
-	pubMessages := make([]*PublishingMessage, len(msgs))
 	for idx, uMsg := range msgs {
 		msg := uMsg.GetMessage()
+		if uMsg.pubMsg == nil && !uMsg.intercepted {
+			if err := p.interceptSend(msg); err != nil {
+				return nil, err
+			}
+			uMsg.intercepted = true
+		}
+		if msg.GetDelayLevel() > p.po.maxDelayLevel {
+			return nil, fmt.Errorf("message delay level=%d exceeds the max delay level=%d", msg.GetDelayLevel(), p.po.maxDelayLevel)
+		}
+		if err := p.checkRequiredProperties(msg); err != nil {
+			return nil, err
+		}
 		var pubMessage *PublishingMessage
 		var err error
 		pubMessage = uMsg.pubMsg
@@ -290,6 +614,10 @@ func (p *defaultProducer) send0(ctx context.Context, msgs []*UnifiedMessage, txE
 		pubMessages[idx] = pubMessage
 	}
 
+	if err := p.checkMessageSize(pubMessages, msgs[0].batched); err != nil {
+		return nil, err
+	}
+
 	// check message Type
 	messageType := pubMessages[0].messageType
 	for _, pubMessage := range pubMessages {
@@ -308,6 +636,33 @@ func (p *defaultProducer) send0(ctx context.Context, msgs []*UnifiedMessage, txE
 			}
 		}
 	}
+	// Sharding key must be same if message group is not set, or no need to proceed.
+	var shardingKey *string
+	if messageGroup == nil {
+		shardingKey = pubMessages[0].msg.GetShardingKey()
+		for _, pubMessage := range pubMessages {
+			key := pubMessage.msg.GetShardingKey()
+			if (key == nil) != (shardingKey == nil) || (key != nil && *key != *shardingKey) {
+				return nil, fmt.Errorf("messages to send have different sharding keys")
+			}
+		}
+	}
+	if err := p.reserveDeduplicationKeys(pubMessages); err != nil {
+		return nil, err
+	}
+	defer func() {
+		p.settleDeduplicationKeys(pubMessages, receipts, err)
+	}()
+	if err := p.acquireSendPermit(ctx, topicName); err != nil {
+		return nil, err
+	}
+	// The batch is routed by the highest priority of its messages.
+	priority := pubMessages[0].msg.GetPriority()
+	for _, pubMessage := range pubMessages {
+		if pubMessage.msg.GetPriority() > priority {
+			priority = pubMessage.msg.GetPriority()
+		}
+	}
 	if _, ok := p.pSetting.topics.Load(topicName); !ok {
 		p.pSetting.topics.Store(topicName, &v2.Resource{
 			Name:              topicName,
@@ -318,24 +673,229 @@ func (p *defaultProducer) send0(ctx context.Context, msgs []*UnifiedMessage, txE
 	if err != nil {
 		return nil, err
 	}
+	if p.pSetting.IsValidateMessageType() {
+		if err := checkMessageType(topicName, messageType, pubLoadBalancer.AcceptMessageTypes()); err != nil {
+			return nil, err
+		}
+	}
+	session := msgs[0].session
+	var pinned *v2.MessageQueue
+	if session != nil {
+		pinned = session.GetMessageQueue(topicName)
+	}
 	var candidates []*v2.MessageQueue
-	if messageGroup == nil {
-		candidates, err = p.takeMessageQueues(pubLoadBalancer)
-	} else {
+	switch {
+	case messageGroup != nil:
 		candidates, err = pubLoadBalancer.TakeMessageQueueByMessageGroup(messageGroup)
+	case shardingKey != nil:
+		candidates, err = pubLoadBalancer.TakeMessageQueueByShardingKey(*shardingKey)
+	case pinned != nil:
+		candidates, err = pubLoadBalancer.TakeMessageQueueByBroker(pinned.GetBroker().GetName(), pinned.GetId())
+		if err == nil {
+			break
+		}
+		p.cli.log.Infof("pinned message queue of session is gone, select another one, topic=%s, err=%v", topicName, err)
+		fallthrough
+	default:
+		candidates, err = p.takeMessageQueues(pubLoadBalancer, priority)
 	}
 	if err != nil || len(candidates) == 0 {
 		return nil, fmt.Errorf("no broker available to sendMessage")
 	}
-	return p.send1(ctx, topicName, messageType, candidates, pubMessages, 1)
+	if !msgs[0].asyncSince.IsZero() {
+		p.recordAsyncSendWait(topicName, defaultClock.Since(msgs[0].asyncSince))
+	}
+	attempted = true
+	receipts, err = p.send1(ctx, topicName, messageType, candidates, pubMessages, 1)
+	if err == nil {
+		if session != nil && messageGroup == nil && shardingKey == nil {
+			p.pinSessionQueue(session, topicName, candidates, receipts)
+		}
+	}
+	return receipts, err
+}
+
+// checkMessageType returns ErrMessageTypeMismatch if the topic does not accept messages of messageType, e.g. messages
+// without a message group sent to a FIFO topic. Topics of brokers which do not declare message types accept any.
+func checkMessageType(topic string, messageType v2.MessageType, acceptMessageTypes []v2.MessageType) error {
+	if len(acceptMessageTypes) == 0 {
+		return nil
+	}
+	for _, accepted := range acceptMessageTypes {
+		if accepted == messageType {
+			return nil
+		}
+	}
+	return &ErrMessageTypeMismatch{Topic: topic, MessageType: messageType, AcceptMessageTypes: acceptMessageTypes}
+}
+
+// pinSessionQueue pins the candidate which the messages are sent to for the session.
+func (p *defaultProducer) pinSessionQueue(session *SendSession, topic string, candidates []*v2.MessageQueue, receipts []*SendReceipt) {
+	if len(receipts) == 0 {
+		return
+	}
+	for _, candidate := range candidates {
+		if utils.CompareEndpoints(candidate.GetBroker().GetEndpoints(), receipts[0].Endpoints) {
+			session.pin(topic, candidate)
+			return
+		}
+	}
+}
+
+// reserveDeduplicationKeys reserves the deduplication keys of the messages, it returns ErrDuplicate if any of the
+// messages has been accepted or is being sent with its key, and none of the keys is reserved then.
+func (p *defaultProducer) reserveDeduplicationKeys(pubMessages []*PublishingMessage) error {
+	if p.deduplicator == nil {
+		return nil
+	}
+	for i, pubMessage := range pubMessages {
+		key := pubMessage.msg.GetDeduplicationKey()
+		if key == nil {
+			continue
+		}
+		if messageId, ok := p.deduplicator.reserve(*key); ok {
+			p.releaseDeduplicationKeys(pubMessages[:i])
+			return &ErrDuplicate{Key: *key, MessageID: messageId}
+		}
+	}
+	return nil
+}
+
+// settleDeduplicationKeys records the keys of the messages accepted, and releases the others.
+func (p *defaultProducer) settleDeduplicationKeys(pubMessages []*PublishingMessage, receipts []*SendReceipt, err error) {
+	if p.deduplicator == nil {
+		return
+	}
+	if err != nil {
+		p.releaseDeduplicationKeys(pubMessages)
+		return
+	}
+	for i, pubMessage := range pubMessages {
+		key := pubMessage.msg.GetDeduplicationKey()
+		if key == nil {
+			continue
+		}
+		if i >= len(receipts) || receipts[i].err != nil {
+			p.deduplicator.release(*key)
+			continue
+		}
+		p.deduplicator.record(*key, receipts[i].MessageID)
+	}
+}
+
+func (p *defaultProducer) releaseDeduplicationKeys(pubMessages []*PublishingMessage) {
+	for _, pubMessage := range pubMessages {
+		if key := pubMessage.msg.GetDeduplicationKey(); key != nil {
+			p.deduplicator.release(*key)
+		}
+	}
+}
+
+// acquireSendPermit waits for the permit of WithSendRateLimit, sends throttled by the limit are counted by metric.
+func (p *defaultProducer) acquireSendPermit(ctx context.Context, topic string) error {
+	if p.rateLimiter == nil {
+		return nil
+	}
+	throttled, err := p.rateLimiter.acquire(ctx)
+	if throttled {
+		p.recordSendThrottled(topic)
+	}
+	return err
+}
+
+// nextThrottleBackoff returns the delay before resending a request throttled by brokers, see WithThrottleBackoff.
+func (p *defaultProducer) nextThrottleBackoff() time.Duration {
+	level := p.throttleLevel.Load()
+	backoff := p.po.throttleBackoffMin << level
+	if backoff >= p.po.throttleBackoffMax || backoff <= 0 {
+		backoff = p.po.throttleBackoffMax
+	} else {
+		p.throttleLevel.CAS(level, level+1)
+	}
+	if backoff <= 0 {
+		return p.po.throttleBackoffMin
+	}
+	return backoff - time.Duration(rand.Int63n(int64(backoff)/2+1))
+}
+
+func (p *defaultProducer) relaxThrottleBackoff() {
+	if level := p.throttleLevel.Load(); level > 0 {
+		p.throttleLevel.CAS(level, level-1)
+	}
+}
+
+// recordQueueSelection counts the send attempt by the message queue selected.
+func (p *defaultProducer) recordQueueSelection(topic string, mq *v2.MessageQueue) {
+	provider := p.cli.clientMeterProvider
+	if !provider.isEnabled() {
+		return
+	}
+	err := stats.RecordWithTags(provider.tagContext(), []tag.Mutator{tag.Insert(topicTag, provider.sanitizeTagValue(topicTag, topic)), tag.Insert(clientIdTag, p.cli.clientID), tag.Insert(brokerNameTag, provider.sanitizeTagValue(brokerNameTag, mq.GetBroker().GetName())), tag.Insert(queueIdTag, strconv.Itoa(int(mq.GetId())))}, PublishQueueSelectionsM.M(1))
+	if err != nil {
+		p.cli.log.Errorf("failed to record queue selection, topic=%s, err=%v", topic, err)
+	}
+}
+
+// recordBrokerThrottled counts the sends throttled by brokers, unlike recordSendThrottled for the send rate limit.
+func (p *defaultProducer) recordBrokerThrottled(topic string) {
+	provider := p.cli.clientMeterProvider
+	if !provider.isEnabled() {
+		return
+	}
+	err := stats.RecordWithTags(provider.tagContext(), []tag.Mutator{tag.Insert(topicTag, provider.sanitizeTagValue(topicTag, topic)), tag.Insert(clientIdTag, p.cli.clientID)}, PublishBrokerThrottledM.M(1))
+	if err != nil {
+		p.cli.log.Errorf("failed to record send throttled by brokers, topic=%s, err=%v", topic, err)
+	}
+}
+
+func (p *defaultProducer) recordSendThrottled(topic string) {
+	provider := p.cli.clientMeterProvider
+	if !provider.isEnabled() {
+		return
+	}
+	err := stats.RecordWithTags(provider.tagContext(), []tag.Mutator{tag.Insert(topicTag, provider.sanitizeTagValue(topicTag, topic)), tag.Insert(clientIdTag, p.cli.clientID)}, PublishThrottledM.M(1))
+	if err != nil {
+		p.cli.log.Errorf("failed to record throttled send, topic=%s, err=%v", topic, err)
+	}
+}
+
+func (p *defaultProducer) recordAsyncSendWait(topic string, duration time.Duration) {
+	provider := p.cli.clientMeterProvider
+	if !provider.isEnabled() {
+		return
+	}
+	err := stats.RecordWithTags(provider.tagContext(), []tag.Mutator{tag.Insert(topicTag, provider.sanitizeTagValue(topicTag, topic)), tag.Insert(clientIdTag, p.cli.clientID)}, PublishAsyncWaitMs.M(duration.Milliseconds()))
+	if err != nil {
+		p.cli.log.Errorf("failed to record async send wait, topic=%s, err=%v", topic, err)
+	}
 }
 
 func (p *defaultProducer) Send(ctx context.Context, msg *Message) ([]*SendReceipt, error) {
+	return p.send(ctx, msg, nil)
+}
+
+// SendWithSession sends the message to the message queue pinned by session, the first message of each topic pins the
+// queue it is sent to. Retries are made on the pinned queue as well, and another queue is pinned only if the pinned
+// one is removed from the route of topic. Messages with message group or sharding key are routed by them instead.
+func (p *defaultProducer) SendWithSession(ctx context.Context, msg *Message, session *SendSession) ([]*SendReceipt, error) {
+	if session == nil {
+		return nil, fmt.Errorf("session could not be nil")
+	}
+	return p.send(ctx, msg, session)
+}
+
+func (p *defaultProducer) send(ctx context.Context, msg *Message, session *SendSession) ([]*SendReceipt, error) {
 	if !p.isOn() {
 		return nil, fmt.Errorf("producer is not running")
 	}
+	prev, done := p.enterShardingKeyOrder(msg)
+	if err := p.shardingKeySequencer.wait(ctx, prev, done); err != nil {
+		return nil, err
+	}
+	defer done()
 	msgs := []*UnifiedMessage{{
-		msg: msg,
+		msg:     msg,
+		session: session,
 	}}
 	return p.send0(ctx, msgs, false)
 }
@@ -344,19 +904,214 @@ func (p *defaultProducer) SendAsync(ctx context.Context, msg *Message, f func(co
 	if !p.isOn() {
 		f(ctx, nil, fmt.Errorf("producer is not running"))
 	}
-	go func() {
+	since := defaultClock.Now()
+	// Block the caller rather than starting goroutines without bound, see WithMaxConcurrentAsyncSends.
+	if p.asyncSends != nil {
+		select {
+		case p.asyncSends <- struct{}{}:
+		case <-ctx.Done():
+			f(ctx, nil, ctx.Err())
+			return
+		}
+	}
+	// The turn is taken before the goroutine starts, so that async sends keep the order of calls.
+	prev, done := p.enterShardingKeyOrder(msg)
+	seq := p.beginAsyncSend()
+	p.cli.goAsync(func() {
+		defer p.endAsyncSend(seq)
+		if p.asyncSends != nil {
+			defer func() { <-p.asyncSends }()
+		}
+		if err := p.shardingKeySequencer.wait(ctx, prev, done); err != nil {
+			f(ctx, nil, err)
+			return
+		}
 		msgs := []*UnifiedMessage{{
-			msg: msg,
+			msg:        msg,
+			asyncSince: since,
 		}}
 		resp, err := p.send0(ctx, msgs, false)
+		done()
 		f(ctx, resp, err)
-	}()
+	})
+}
+
+// checkMessageSize checks the body size of messages against WithMaxBatchSize if they are sent in batch, or
+// WithMaxSingleMessageSize otherwise.
+func (p *defaultProducer) checkMessageSize(pubMessages []*PublishingMessage, batched bool) error {
+	if !batched {
+		if maxSize := p.po.maxSingleMessageSize; maxSize > 0 && pubMessages[0].bodySize() > maxSize {
+			return &ErrMessageTooLarge{Limit: MessageSizeLimit_SINGLE, Size: pubMessages[0].bodySize(), MaxSize: maxSize}
+		}
+		return nil
+	}
+	maxSize := p.po.maxBatchSize
+	if maxSize <= 0 {
+		return nil
+	}
+	total := 0
+	for _, pubMessage := range pubMessages {
+		total += pubMessage.bodySize()
+	}
+	if total > maxSize {
+		return &ErrMessageTooLarge{Limit: MessageSizeLimit_BATCH, Size: total, MaxSize: maxSize}
+	}
+	return nil
+}
+
+// enterShardingKeyOrder takes the turn of the sharding key of msg if WithShardingKeyOrder is enabled, done is a
+// no-op otherwise.
+func (p *defaultProducer) enterShardingKeyOrder(msg *Message) (prev <-chan struct{}, done func()) {
+	if p.shardingKeySequencer == nil || msg.GetShardingKey() == nil || msg.GetMessageGroup() != nil {
+		return nil, func() {}
+	}
+	return p.shardingKeySequencer.enter(msg.Topic + "@" + *msg.GetShardingKey())
+}
+
+// beginAsyncSend returns the number of the async send issued.
+func (p *defaultProducer) beginAsyncSend() uint64 {
+	p.asyncLock.Lock()
+	defer p.asyncLock.Unlock()
+	p.asyncIssued++
+	p.asyncPending++
+	return p.asyncIssued
+}
+
+func (p *defaultProducer) endAsyncSend(seq uint64) {
+	p.asyncLock.Lock()
+	defer p.asyncLock.Unlock()
+	p.asyncPending--
+	flushes := p.asyncFlushes[:0]
+	for _, flush := range p.asyncFlushes {
+		if seq <= flush.upTo {
+			flush.remaining--
+			if flush.remaining == 0 {
+				close(flush.done)
+				continue
+			}
+		}
+		flushes = append(flushes, flush)
+	}
+	p.asyncFlushes = flushes
+}
+
+// Flush blocks until the callbacks of all async sends issued so far have fired, or the context is done. Async sends
+// issued after Flush is called are not waited for. Unlike GracefulStop, the producer keeps running after flushing.
+func (p *defaultProducer) Flush(ctx context.Context) error {
+	p.asyncLock.Lock()
+	if p.asyncPending == 0 {
+		p.asyncLock.Unlock()
+		return nil
+	}
+	flush := &asyncFlush{upTo: p.asyncIssued, remaining: p.asyncPending, done: make(chan struct{})}
+	p.asyncFlushes = append(p.asyncFlushes, flush)
+	p.asyncLock.Unlock()
+	select {
+	case <-flush.done:
+		return nil
+	case <-ctx.Done():
+		p.asyncLock.Lock()
+		defer p.asyncLock.Unlock()
+		for i, f := range p.asyncFlushes {
+			if f == flush {
+				p.asyncFlushes = append(p.asyncFlushes[:i], p.asyncFlushes[i+1:]...)
+				break
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// BatchSendEntry is the outcome of a message sent by SendBatch, Err is nil if Receipt is set.
+type BatchSendEntry struct {
+	Message *Message
+	Receipt *SendReceipt
+	Err     error
+
+	intercepted bool
+}
+
+// SendBatch sends messages of the same topic in a single request and returns the outcome of each message in order,
+// along with the first failure if any message fails. The batch is not atomic: some messages could be stored while
+// others fail, use transactional messages if all-or-nothing is required. A failed request is retried as a whole by
+// the retry policy, messages failed in a succeeded request are not retried unless WithRetryFailedBatchEntries is set.
+func (p *defaultProducer) SendBatch(ctx context.Context, msgs []*Message) ([]*BatchSendEntry, error) {
+	if !p.isOn() {
+		return nil, fmt.Errorf("producer is not running")
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("no message to send")
+	}
+	entries := make([]*BatchSendEntry, len(msgs))
+	for i, msg := range msgs {
+		entries[i] = &BatchSendEntry{Message: msg}
+	}
+	maxAttempts := 1
+	if p.po.retryFailedBatchEntries {
+		maxAttempts = p.getRetryMaxAttempts()
+	}
+	pending := entries
+	for attempt := 1; ; attempt++ {
+		failed := p.sendBatchEntries(ctx, pending)
+		if len(failed) == 0 || attempt >= maxAttempts {
+			break
+		}
+		p.cli.log.Warnf("failed to send %d of %d message(s) in batch, would attempt to resend them, attempt=%d, maxAttempts=%d",
+			len(failed), len(pending), attempt, maxAttempts)
+		select {
+		case <-time.After(p.getNextAttemptDelay(attempt + 1)):
+		case <-ctx.Done():
+			return entries, ctx.Err()
+		}
+		pending = failed
+	}
+	for _, entry := range entries {
+		if entry.Err != nil {
+			return entries, entry.Err
+		}
+	}
+	return entries, nil
+}
+
+// sendBatchEntries sends the messages of entries in a request and sets their outcomes,
+// the entries failed in the succeeded request are returned to be resent.
+func (p *defaultProducer) sendBatchEntries(ctx context.Context, entries []*BatchSendEntry) []*BatchSendEntry {
+	msgs := make([]*UnifiedMessage, len(entries))
+	for i, entry := range entries {
+		msgs[i] = &UnifiedMessage{msg: entry.Message, intercepted: entry.intercepted, batched: true}
+	}
+	receipts, err := p.send0(ctx, msgs, false)
+	for i, entry := range entries {
+		entry.intercepted = msgs[i].intercepted
+	}
+	if err == nil && len(receipts) != len(entries) {
+		err = fmt.Errorf("expected %d result entries of batch, got %d", len(entries), len(receipts))
+	}
+	if err != nil {
+		for _, entry := range entries {
+			entry.Receipt, entry.Err = nil, err
+		}
+		return nil
+	}
+	var failed []*BatchSendEntry
+	for i, entry := range entries {
+		if receipts[i].err != nil {
+			entry.Receipt, entry.Err = nil, receipts[i].err
+			failed = append(failed, entry)
+			continue
+		}
+		entry.Receipt, entry.Err = receipts[i], nil
+	}
+	return failed
 }
 
 func (p *defaultProducer) SendWithTransaction(ctx context.Context, msg *Message, transaction Transaction) ([]*SendReceipt, error) {
 	if !p.isOn() {
 		return nil, fmt.Errorf("producer is not running")
 	}
+	if err := p.interceptSend(msg); err != nil {
+		return nil, err
+	}
 	t := transaction.(*transactionImpl)
 	pubMessage, err := t.tryAddMessage(msg, p.cli.config.NameSpace)
 	if err != nil {
@@ -411,9 +1166,9 @@ func (p *defaultProducer) endTransaction(ctx context.Context, endpoints *v2.Endp
 	}
 	messageCommons := []*MessageCommon{messageCommon}
 	p.cli.doBefore(messageHookPoints, messageCommons)
-	watchTime := time.Now()
+	watchTime := defaultClock.Now()
 	resp, err := p.cli.clientManager.EndTransaction(ctx, endpoints, request, requestTimeout)
-	duration := time.Since(watchTime)
+	duration := defaultClock.Since(watchTime)
 	messageHookPointsStatus := MessageHookPointsStatus_OK
 	if err == nil && resp.GetStatus().GetCode() != v2.Code_OK {
 		err = &ErrRpcStatus{
@@ -430,22 +1185,70 @@ func (p *defaultProducer) endTransaction(ctx context.Context, endpoints *v2.Endp
 
 func (p *defaultProducer) onRecoverOrphanedTransactionCommand(endpoints *v2.Endpoints, command *v2.RecoverOrphanedTransactionCommand) error {
 	transactionId := command.GetTransactionId()
-	messageId := command.GetMessage().GetSystemProperties().MessageId
-	if p.checker == nil {
+	messageId := command.GetMessage().GetSystemProperties().GetMessageId()
+	if p.checker == nil || p.checker.Check == nil {
 		return fmt.Errorf("no transaction checker registered, ignore it, messageId=%s, transactionId=%s, endpoints=%v", messageId, transactionId, endpoints)
 	}
+	if command.GetMessage().GetSystemProperties() == nil {
+		return fmt.Errorf("no message carried by the recover orphaned transaction command, transactionId=%s, endpoints=%v", transactionId, endpoints)
+	}
 	messageView := fromProtobuf_MessageView0(command.Message)
-	go func(mv *MessageView) {
-		resolution := p.po.checker.Check(mv)
+	messageView.transactionId = transactionId
+	if p.transactionChecks != nil {
+		select {
+		case p.transactionChecks <- struct{}{}:
+		default:
+			return fmt.Errorf("too many transaction checkers are running, ignore it, messageId=%s, transactionId=%s, endpoints=%v", messageId, transactionId, endpoints)
+		}
+	}
+	p.cli.goAsync(func() {
+		resolution := p.checkTransaction(messageView, endpoints)
+		if resolution != COMMIT && resolution != ROLLBACK {
+			p.cli.log.Infof("transaction is still unknown, would be checked later, messageId=%s, transactionId=%s, endpoints=%v", messageId, transactionId, endpoints)
+			return
+		}
 		err := p.endTransaction(context.TODO(), endpoints,
-			mv.GetMessageCommon(), messageId, transactionId, resolution)
+			messageView.GetMessageCommon(), messageId, transactionId, resolution)
 		if err != nil {
 			p.cli.log.Errorf("exception raised while ending the transaction, messageId=%s, transactionId=%s, endpoints=%v, err=%w", messageId, transactionId, endpoints, err)
 		}
-	}(messageView)
+	})
 	return nil
 }
 
+// checkTransaction runs the transaction checker, it returns the resolution of WithTransactionCheckTimeout if the
+// checker runs out of time, or UNKNOWN if the checker panics.
+func (p *defaultProducer) checkTransaction(mv *MessageView, endpoints *v2.Endpoints) TransactionResolution {
+	result := make(chan TransactionResolution, 1)
+	p.cli.goAsync(func() {
+		defer func() {
+			if p.transactionChecks != nil {
+				<-p.transactionChecks
+			}
+		}()
+		defer func() {
+			if e := recover(); e != nil {
+				p.cli.log.Errorf("transaction checker raised an exception, messageId=%s, transactionId=%s, endpoints=%v, err=%v", mv.GetMessageId(), mv.GetTransactionId(), endpoints, e)
+				result <- UNKNOWN
+			}
+		}()
+		result <- p.checker.Check(mv)
+	})
+	if p.po.transactionCheckTimeout <= 0 {
+		return <-result
+	}
+	timer := time.NewTimer(p.po.transactionCheckTimeout)
+	defer timer.Stop()
+	select {
+	case resolution := <-result:
+		return resolution
+	case <-timer.C:
+		p.cli.log.Warnf("transaction checker runs out of time, resolve it as %d, messageId=%s, transactionId=%s, timeout=%v, endpoints=%v",
+			p.po.transactionCheckTimeoutResolution, mv.GetMessageId(), mv.GetTransactionId(), p.po.transactionCheckTimeout, endpoints)
+		return p.po.transactionCheckTimeoutResolution
+	}
+}
+
 func (p *defaultProducer) onVerifyMessageCommand(endpoints *v2.Endpoints, command *v2.VerifyMessageCommand) error {
 	return nil
 }
@@ -28,16 +28,73 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
+// SendCancellation is the handling of a send whose context is done while a request is in flight, see
+// WithSendCancellation.
+type SendCancellation int32
+
+const (
+	// SendCancellation_FAIL fails the attempt and goes on like other failures, the send fails with SendError once
+	// the attempts run out.
+	SendCancellation_FAIL SendCancellation = iota
+	// SendCancellation_UNCERTAIN returns ErrSendUncertain at once, without retrying or isolating the endpoints.
+	SendCancellation_UNCERTAIN
+	// SendCancellation_COMPLETE keeps the request in flight until the reply of brokers or the request timeout, and
+	// returns its result, further attempts are not made once the context is done.
+	SendCancellation_COMPLETE
+)
+
 type producerOptions struct {
 	clientFunc  NewClientFunc
 	maxAttempts int32
 	topics      []string
 	checker     *TransactionChecker
+
+	propertyTransformer func(map[string]string) map[string]string
+	queueScorer         func(*v2.MessageQueue) float64
+	queueSelectSeed     *int64
+	bodyCharset         string
+	sendResultObserver  func(*SendReceipt, error)
+	sendCancellation    SendCancellation
+
+	deduplicationWindow   time.Duration
+	deduplicationCapacity int
+	maxDelayLevel         int
+	failFastOnNoRoute     bool
+
+	sendRateLimit       int
+	sendRateBurst       int
+	failFastOnRateLimit bool
+
+	throttleBackoffMin time.Duration
+	throttleBackoffMax time.Duration
+
+	retryFailedBatchEntries bool
+	maxSingleMessageSize    int
+	maxBatchSize            int
+
+	requiredProperties []string
+	defaultProperties  map[string]string
+
+	sendInterceptors []SendInterceptor
+
+	transactionCheckTimeout           time.Duration
+	transactionCheckTimeoutResolution TransactionResolution
+	maxConcurrentTransactionChecks    int
+	maxConcurrentAsyncSends           int
+
+	shardingKeyOrder bool
+
+	messageIdGenerator func() string
+	encryptor          Encryptor
 }
 
 var defaultProducerOptions = producerOptions{
 	clientFunc:  NewClient,
 	maxAttempts: 3,
+
+	deduplicationWindow:   time.Minute * 10,
+	deduplicationCapacity: 10000,
+	maxDelayLevel:         18,
 }
 
 // A ProducerOption sets options such as tls.Config, etc.
@@ -81,12 +138,246 @@ func WithTopics(t ...string) ProducerOption {
 	})
 }
 
+// WithPropertyTransformer returns a ProducerOption that transforms a copy of the user properties of every message
+// just before the send request is marshaled, e.g. to strip properties which are not needed on the wire.
+// System properties are carried separately and could not be removed by the transformer.
+func WithPropertyTransformer(f func(map[string]string) map[string]string) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.propertyTransformer = f
+	})
+}
+
+// WithQueueScorer returns a ProducerOption that sets the scorer consulted while selecting message queues,
+// queues with higher scores are preferred. The scorer is called for every queue of the topic on each
+// selection so it should be cheap. Default is nil, which selects message queues in round-robin.
+func WithQueueScorer(f func(mq *v2.MessageQueue) float64) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.queueScorer = f
+	})
+}
+
+// WithQueueSelectSeed returns a ProducerOption that makes the round-robin selection of message queues start from a
+// point derived from seed for every topic, so that a sequence of sends lands on the same queues in each run given
+// the same route. It is meant for tests and debugging. Default is nil, which makes no guarantee of the start point.
+func WithQueueSelectSeed(seed int64) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.queueSelectSeed = &seed
+	})
+}
+
+// WithBodyCharset returns a ProducerOption that declares the charset of message bodies, e.g. "GBK" or BodyCharsetBinary,
+// by BodyCharsetProperty for messages which do not declare one by themselves. Bodies declared as "UTF-8" are validated
+// before being sent. Default is empty, which declares nothing.
+func WithBodyCharset(charset string) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.bodyCharset = charset
+	})
+}
+
+// WithSendResultObserver returns a ProducerOption that sets the observer of the result of every message sent, e.g. for
+// auditing, regardless of whether metrics are enabled. The observer is called once per message after the last attempt,
+// with the message id and endpoints in receipt even if the send is failed. Messages failed before being sent to any
+// broker, e.g. by validation, routing or rate limits, are observed as well, with empty endpoints, and empty message
+// ids if they are failed before ids are assigned. It runs asynchronously with the send.
+func WithSendResultObserver(f func(receipt *SendReceipt, err error)) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.sendResultObserver = f
+	})
+}
+
+// WithSendCancellation returns a ProducerOption that sets the handling of a send whose context is done while a request
+// is in flight, which could have reached brokers and been stored even though no reply is received. With
+// SendCancellation_UNCERTAIN, callers are told the outcome is unknown by ErrSendUncertain, resending the message then
+// could duplicate it, which is the at-least-once delivery idempotent callers could rely on. With
+// SendCancellation_COMPLETE, callers block until the request completes regardless of the context, which tells the
+// outcome in most cases unless the request times out.
+// Default is SendCancellation_FAIL.
+func WithSendCancellation(behavior SendCancellation) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.sendCancellation = behavior
+	})
+}
+
+// WithDeduplicationWindow returns a ProducerOption that sets how long and at most how many deduplication keys of
+// accepted messages are remembered, see Message.SetDeduplicationKey. The least recently sent keys are forgotten
+// first once the capacity is exceeded. Default is 10 minutes and 10000 keys.
+func WithDeduplicationWindow(window time.Duration, capacity int) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.deduplicationWindow = window
+		o.deduplicationCapacity = capacity
+	})
+}
+
+// WithMaxDelayLevel returns a ProducerOption that sets the count of delay levels configured on brokers, messages
+// with a greater delay level are rejected before being sent. Default is 18, the count of default levels of brokers.
+func WithMaxDelayLevel(n int) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.maxDelayLevel = n
+	})
+}
+
+// WithFailFastOnNoRoute returns a ProducerOption that sets whether sending to a topic which is not found, or has no
+// message queue, returns ErrTopicNotFound at once instead of retrying the route lookup.
+// Default is false, the lookup is retried as configured by WithRouteMaxAttempts.
+func WithFailFastOnNoRoute(failFast bool) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.failFastOnNoRoute = failFast
+	})
+}
+
+// WithSendRateLimit returns a ProducerOption that limits the rate of sending to rps requests per second, allowing
+// bursts of up to burst requests. A batch of messages counts as one request, retries are not limited.
+// Sending blocks until it is allowed by the limit, see WithFailFastOnSendRateLimit. Default is 0, which is unlimited.
+func WithSendRateLimit(rps int, burst int) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.sendRateLimit = rps
+		o.sendRateBurst = burst
+	})
+}
+
+// WithFailFastOnSendRateLimit returns a ProducerOption that sets whether sending beyond the limit of WithSendRateLimit
+// returns ErrSendRateLimited at once instead of blocking.
+func WithFailFastOnSendRateLimit(failFast bool) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.failFastOnRateLimit = failFast
+	})
+}
+
+// WithThrottleBackoff returns a ProducerOption that sets the bounds of the delay before resending a request throttled
+// by brokers, instead of the backoff of retry policy. The delay starts from min, doubles with every throttled request
+// of the producer up to max, and halves with every successful one, a random jitter of up to half of it is subtracted
+// so that producers do not retry in lockstep. Resends still count towards the max attempts. Default is 0, which
+// uses the backoff of retry policy.
+func WithThrottleBackoff(min, max time.Duration) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.throttleBackoffMin = min
+		o.throttleBackoffMax = max
+	})
+}
+
+// WithRetryFailedBatchEntries returns a ProducerOption that sets whether SendBatch resends only the messages which
+// fail in a succeeded request, until they succeed or the max attempts of retry policy run out.
+// Default is false, the failed messages are returned to the caller at once.
+func WithRetryFailedBatchEntries(retry bool) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.retryFailedBatchEntries = retry
+	})
+}
+
+// WithMaxSingleMessageSize returns a ProducerOption that sets the max body size in bytes of a message sent alone, sends
+// beyond it fail with ErrMessageTooLarge before the request is sent. Messages are still bounded by the max body size
+// synced from brokers, which is the limit of each message sent in batch.
+// Default is 0, which means no limit besides the max body size.
+func WithMaxSingleMessageSize(n int) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.maxSingleMessageSize = n
+	})
+}
+
+// WithMaxBatchSize returns a ProducerOption that sets the max total body size in bytes of messages sent by SendBatch,
+// batches beyond it fail with ErrMessageTooLarge before the request is sent, to keep the latency of batches bounded.
+// Default is 0, which means no limit.
+func WithMaxBatchSize(n int) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.maxBatchSize = n
+	})
+}
+
+// WithRequiredProperties returns a ProducerOption that requires every message to carry the user properties of keys,
+// sending a message which lacks any of them fails with ErrMissingProperty before the request is sent.
+// Properties populated by WithDefaultProperties count as present.
+func WithRequiredProperties(keys ...string) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.requiredProperties = keys
+	})
+}
+
+// WithDefaultProperties returns a ProducerOption that adds the user properties to every message which does not
+// carry them, the message itself is left unchanged.
+func WithDefaultProperties(properties map[string]string) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.defaultProperties = properties
+	})
+}
+
+// SendInterceptor is called with every message to send before it is validated and marshaled, it could modify the
+// message, e.g. to add properties, and stops sending the message by returning an error.
+// The message is the one passed to the producer, so the modification is visible to the caller.
+type SendInterceptor func(msg *Message) error
+
+// WithSendInterceptor returns a ProducerOption that appends the interceptor to the send path, interceptors are
+// called in the order they are appended, each sees the modification of those before it.
+// Unlike the message interceptors of metrics and traces, it runs once per message rather than once per attempt.
+func WithSendInterceptor(interceptor SendInterceptor) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.sendInterceptors = append(o.sendInterceptors, interceptor)
+	})
+}
+
+// WithShardingKeyOrder returns a ProducerOption that sets whether messages with the same sharding key are sent one
+// by one in the order of Send and SendAsync calls, so that they are stored in order on the queue of the key.
+// It is weaker than FIFO topics: the queue of a key changes once the route of topic changes, a message failed
+// after all attempts does not stop the following ones, and consumers of normal topics do not consume in order.
+// It only orders messages sent by the same producer.
+func WithShardingKeyOrder(enabled bool) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.shardingKeyOrder = enabled
+	})
+}
+
+// WithMessageIDGenerator returns a ProducerOption that sets the function generating the ids of messages to send,
+// e.g. to produce stable ids in golden tests. Ids should be unique, brokers and consumers assume so, thus it is for
+// tests only. Default is nil, which generates ids by the message id codec.
+func WithMessageIDGenerator(f func() string) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.messageIdGenerator = f
+	})
+}
+
+// WithEncryptor returns a ProducerOption that sets the Encryptor of message bodies, which is applied before the body
+// is encoded for sending, and its key id is sent as EncryptionKeyIdProperty. The body size limit applies to the
+// encrypted body. Consumers should set the Decryptor by WithDecryptor or WithSimpleDecryptor.
+func WithEncryptor(encryptor Encryptor) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.encryptor = encryptor
+	})
+}
+
 func WithTransactionChecker(checker *TransactionChecker) ProducerOption {
 	return newFuncProducerOption(func(o *producerOptions) {
 		o.checker = checker
 	})
 }
 
+// WithTransactionCheckTimeout returns a ProducerOption that bounds how long the transaction checker may run, the
+// transaction is resolved as resolution once the checker runs out of time, e.g. UNKNOWN to be checked again later.
+// The checker itself could not be interrupted and keeps occupying its slot of WithMaxConcurrentTransactionChecks
+// until it returns. Default is 0, which waits for the checker forever.
+func WithTransactionCheckTimeout(timeout time.Duration, resolution TransactionResolution) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.transactionCheckTimeout = timeout
+		o.transactionCheckTimeoutResolution = resolution
+	})
+}
+
+// WithMaxConcurrentTransactionChecks returns a ProducerOption that limits the number of transaction checkers running
+// at the same time, the check requested by brokers beyond the limit is dropped and would be requested again later.
+// Default is 0, which means no limit.
+func WithMaxConcurrentTransactionChecks(n int) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.maxConcurrentTransactionChecks = n
+	})
+}
+
+// WithMaxConcurrentAsyncSends returns a ProducerOption that limits the number of async sends in flight, SendAsync
+// blocks until one of them completes once the limit is reached, or fails with the error of context if it is done
+// before. Default is 0, which means no limit.
+func WithMaxConcurrentAsyncSends(n int) ProducerOption {
+	return newFuncProducerOption(func(o *producerOptions) {
+		o.maxConcurrentAsyncSends = n
+	})
+}
+
 var _ = ClientSettings(&producerSettings{})
 
 type producerSettings struct {
@@ -98,6 +389,10 @@ type producerSettings struct {
 	requestTimeout      time.Duration
 	validateMessageType atomic.Bool
 	maxBodySizeBytes    atomic.Int32
+	// messageIdGenerator generates the ids of messages instead of the message id codec if it is not nil.
+	messageIdGenerator func() string
+	// encryptor encrypts the body of messages before sending if it is not nil.
+	encryptor Encryptor
 }
 
 func (ps *producerSettings) GetClientID() string {
@@ -19,7 +19,10 @@ package golang
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -27,6 +30,9 @@ import (
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 	gomock "github.com/golang/mock/gomock"
 	"github.com/prashantv/gostub"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.uber.org/atomic"
 )
 
 func TestProducer(t *testing.T) {
@@ -218,6 +224,18 @@ func TestProducer(t *testing.T) {
 			t.Error(err)
 		}
 	})
+	t.Run("inspect", func(t *testing.T) {
+		state := p.Inspect()
+		if state.ClientType != v2.ClientType_PRODUCER {
+			t.Errorf("expected client type PRODUCER, got %v", state.ClientType)
+		}
+		if !state.Running {
+			t.Error("expected producer to be running")
+		}
+		if _, ok := state.Routes[MOCK_TOPIC]; !ok {
+			t.Errorf("expected route of topic %s to be cached", MOCK_TOPIC)
+		}
+	})
 	t.Run("do heartbeat", func(t *testing.T) {
 		err := p.(*defaultProducer).cli.doHeartbeat(endpoints, nil)
 		if err != nil {
@@ -225,3 +243,1318 @@ func TestProducer(t *testing.T) {
 		}
 	})
 }
+
+func TestProducerPropertyTransformer(t *testing.T) {
+	msg := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+	msg.AddProperty("keep", "v1")
+	msg.AddProperty("strip", "v2")
+	p := &defaultProducer{}
+	WithPropertyTransformer(func(properties map[string]string) map[string]string {
+		delete(properties, "strip")
+		return properties
+	}).apply(&p.po)
+
+	req, err := p.wrapSendMessageRequest([]*PublishingMessage{{msg: msg, messageId: "msg-123"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := req.GetMessages()[0].GetUserProperties()
+	if _, ok := properties["strip"]; ok || properties["keep"] != "v1" {
+		t.Errorf("unexpected transformed properties %v", properties)
+	}
+	if _, ok := msg.GetProperties()["strip"]; !ok {
+		t.Error("expected properties of the original message to be untouched")
+	}
+	if req.GetMessages()[0].GetSystemProperties().GetMessageId() != "msg-123" {
+		t.Error("expected system properties to be untouched")
+	}
+
+	WithPropertyTransformer(func(map[string]string) map[string]string {
+		return map[string]string{"": "v"}
+	}).apply(&p.po)
+	if _, err := p.wrapSendMessageRequest([]*PublishingMessage{{msg: msg}}); err == nil {
+		t.Error("expected error for empty property key")
+	}
+}
+
+func TestProducerSerializationError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	// no rpc is expected.
+	cli.clientManager = NewMockClientManager(ctrl)
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 3}, requestTimeout: time.Second},
+	}
+	p.pSetting.maxBodySizeBytes.Store(4 * 1024 * 1024)
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}})
+	p.publishingRouteDataResultCache.Store(MOCK_TOPIC, plb)
+
+	msg := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+	msg.SetKeys("order-1")
+	msg.AddProperty("name", string([]byte{0xff, 0xfe}))
+	_, err := p.Send(context.TODO(), msg)
+	var serializationErr *ErrSerialization
+	if !errors.As(err, &serializationErr) || serializationErr.Topic != MOCK_TOPIC || len(serializationErr.Keys) != 1 {
+		t.Errorf("expected ErrSerialization for invalid UTF-8 property, got %v", err)
+	}
+}
+
+func TestProducerRequiredProperties(t *testing.T) {
+	p := &defaultProducer{}
+	WithRequiredProperties("content-type", "schema-version").apply(&p.po)
+	WithDefaultProperties(map[string]string{"schema-version": "1"}).apply(&p.po)
+
+	msg := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+	var missing *ErrMissingProperty
+	if err := p.checkRequiredProperties(msg); !errors.As(err, &missing) || missing.Key != "content-type" {
+		t.Errorf("expected ErrMissingProperty of content-type, got %v", err)
+	}
+	msg.AddProperty("content-type", "application/json")
+	if err := p.checkRequiredProperties(msg); err != nil {
+		t.Errorf("expected property populated by default to count as present, got %v", err)
+	}
+
+	req, err := p.wrapSendMessageRequest([]*PublishingMessage{{msg: msg}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := req.GetMessages()[0].GetUserProperties()
+	if properties["content-type"] != "application/json" || properties["schema-version"] != "1" {
+		t.Errorf("unexpected properties %v", properties)
+	}
+	if _, ok := msg.GetProperties()["schema-version"]; ok {
+		t.Error("expected properties of the original message to be untouched")
+	}
+	msg.AddProperty("schema-version", "2")
+	req, err = p.wrapSendMessageRequest([]*PublishingMessage{{msg: msg}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := req.GetMessages()[0].GetUserProperties()["schema-version"]; v != "2" {
+		t.Errorf("expected property of message to override the default, got %q", v)
+	}
+}
+
+func TestProducerBodyCharset(t *testing.T) {
+	gbk := []byte{0xc4, 0xe3, 0xba, 0xc3}
+	msg := &Message{Topic: MOCK_TOPIC, Body: gbk}
+	p := &defaultProducer{}
+	WithBodyCharset("GBK").apply(&p.po)
+
+	req, err := p.wrapSendMessageRequest([]*PublishingMessage{{msg: msg}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charset := req.GetMessages()[0].GetUserProperties()[BodyCharsetProperty]; charset != "GBK" {
+		t.Errorf("expected charset of producer to be declared, got %q", charset)
+	}
+	if _, ok := msg.GetProperties()[BodyCharsetProperty]; ok {
+		t.Error("expected properties of the original message to be untouched")
+	}
+	mv := fromProtobuf_MessageView0(req.GetMessages()[0])
+	if mv.GetBodyCharset() != "GBK" || string(mv.GetBody()) != string(gbk) {
+		t.Errorf("expected raw body and declared charset to be delivered, charset=%q", mv.GetBodyCharset())
+	}
+
+	msg.SetBodyCharset("UTF-8")
+	if _, err := p.wrapSendMessageRequest([]*PublishingMessage{{msg: msg}}); err == nil {
+		t.Error("expected error for body which is not valid UTF-8")
+	}
+
+	// The charset applies to the body before encryption.
+	WithBodyCharset("UTF-8").apply(&p.po)
+	WithEncryptor(func([]byte) (string, []byte, error) { return "key-1", gbk, nil }).apply(&p.po)
+	pSetting := &producerSettings{encryptor: p.po.encryptor}
+	pSetting.maxBodySizeBytes.Store(1024)
+	pMsg, err := NewPublishingMessage(&Message{Topic: MOCK_TOPIC, Body: []byte("你好")}, "", pSetting, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req, err = p.wrapSendMessageRequest([]*PublishingMessage{pMsg}); err != nil {
+		t.Fatalf("expected encrypted body of valid UTF-8 to be sent, got %v", err)
+	}
+	if string(req.GetMessages()[0].GetBody()) != string(gbk) {
+		t.Error("expected the encrypted body to be sent")
+	}
+}
+
+func TestProducerQueueScorer(t *testing.T) {
+	newMessageQueue := func(brokerName, address string) *v2.MessageQueue {
+		return &v2.MessageQueue{Broker: &v2.Broker{
+			Name:      brokerName,
+			Endpoints: &v2.Endpoints{Addresses: []*v2.Address{{Host: address, Port: 8081}}},
+		}}
+	}
+	scores := map[string]float64{"broker-a": 1, "broker-b": 3, "broker-c": 2}
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{
+		newMessageQueue("broker-a", "127.0.0.1"),
+		newMessageQueue("broker-b", "127.0.0.2"),
+		newMessageQueue("broker-c", "127.0.0.3"),
+	})
+	p := &defaultProducer{po: defaultProducerOptions, pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 3}}}
+	WithQueueScorer(func(mq *v2.MessageQueue) float64 {
+		return scores[mq.GetBroker().GetName()]
+	}).apply(&p.po)
+
+	candidates, err := p.takeMessageQueues(plb, MessagePriority_NORMAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var brokerNames []string
+	for _, mq := range candidates {
+		brokerNames = append(brokerNames, mq.GetBroker().GetName())
+	}
+	if fmt.Sprint(brokerNames) != "[broker-b broker-c broker-a]" {
+		t.Errorf("expected queues ordered by score, got %v", brokerNames)
+	}
+
+	p.isolated.Store("127.0.0.2:8081", true)
+	candidates, err = p.takeMessageQueues(plb, MessagePriority_NORMAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].GetBroker().GetName() != "broker-c" {
+		t.Errorf("expected isolated broker to be skipped, got %v", candidates)
+	}
+}
+
+func TestProducerQueueSelectSeed(t *testing.T) {
+	var route []*v2.MessageQueue
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("broker-%d", i)
+		route = append(route, &v2.MessageQueue{Broker: &v2.Broker{Name: name, Endpoints: fakeEndpoints()}})
+	}
+	sequence := func(seed int64) []string {
+		p := &defaultProducer{po: defaultProducerOptions, pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 1}}}
+		WithQueueSelectSeed(seed).apply(&p.po)
+		plb, err := p.newPublishingLoadBalancer(route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var brokerNames []string
+		for i := 0; i < 4; i++ {
+			candidates, err := p.takeMessageQueues(plb, MessagePriority_NORMAL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			brokerNames = append(brokerNames, candidates[0].GetBroker().GetName())
+		}
+		return brokerNames
+	}
+	first, second := sequence(42), sequence(42)
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Errorf("expected the same queues for the same seed, got %v and %v", first, second)
+	}
+}
+
+func TestProducerMessagePriority(t *testing.T) {
+	newMessageQueue := func(brokerName, address string) *v2.MessageQueue {
+		return &v2.MessageQueue{Broker: &v2.Broker{
+			Name:      brokerName,
+			Endpoints: &v2.Endpoints{Addresses: []*v2.Address{{Host: address, Port: 8081}}},
+		}}
+	}
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{
+		newMessageQueue("broker-a", "127.0.0.1"),
+		newMessageQueue("broker-b", "127.0.0.2"),
+		newMessageQueue("broker-c", "127.0.0.3"),
+	})
+	p := &defaultProducer{po: defaultProducerOptions, pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 3}}}
+	p.recordBrokerLatency("broker-a", time.Second)
+	p.recordBrokerLatency("broker-b", time.Millisecond)
+	p.recordBrokerLatency("broker-c", time.Millisecond*100)
+	p.recordBrokerLatency("broker-c", time.Millisecond*900)
+
+	candidates, err := p.takeMessageQueues(plb, MessagePriority_HIGH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var brokerNames []string
+	for _, mq := range candidates {
+		brokerNames = append(brokerNames, mq.GetBroker().GetName())
+	}
+	if fmt.Sprint(brokerNames) != "[broker-b broker-c broker-a]" {
+		t.Errorf("expected queues ordered by broker latency, got %v", brokerNames)
+	}
+
+	msg := &Message{Topic: MOCK_TOPIC}
+	if msg.GetPriority() != MessagePriority_NORMAL {
+		t.Errorf("expected normal priority by default, got %d", msg.GetPriority())
+	}
+	msg.SetPriority(MessagePriority_LOW)
+	if msg.GetPriority() != MessagePriority_LOW {
+		t.Errorf("expected low priority, got %d", msg.GetPriority())
+	}
+}
+
+func TestProducerSendFailureLogFields(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	logs := PrepareTestLogger(cli)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 1}, requestTimeout: time.Second},
+	}
+
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.SendMessageResponse{
+		Status: &v2.Status{Code: v2.Code_BAD_REQUEST},
+	}, nil)
+	mq := &v2.MessageQueue{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}
+	msg := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+	if _, err := p.send1(context.TODO(), MOCK_TOPIC, v2.MessageType_NORMAL, []*v2.MessageQueue{mq}, []*PublishingMessage{{msg: msg, messageId: "msg-123"}}, 1); err == nil {
+		t.Fatal("expected error for non-OK status")
+	}
+
+	entries := logs.FilterMessage("failed to send message(s) finally, run out of attempt times").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 send failure log, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields[logFieldTopic] != MOCK_TOPIC || fields[logFieldBroker] != "broker-a" || fields[logFieldErrorCode] != v2.Code_BAD_REQUEST.String() {
+		t.Errorf("unexpected log fields %v", fields)
+	}
+}
+
+func TestProducerSendResultObserver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 1}, requestTimeout: time.Second},
+	}
+	type result struct {
+		receipt *SendReceipt
+		err     error
+	}
+	results := make(chan result, 2)
+	WithSendResultObserver(func(receipt *SendReceipt, err error) {
+		results <- result{receipt, err}
+	}).apply(&p.po)
+
+	mq := &v2.MessageQueue{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}
+	msg := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.SendMessageResponse{
+		Status:  &v2.Status{Code: v2.Code_OK},
+		Entries: []*v2.SendResultEntry{{MessageId: "msg-ok"}},
+	}, nil)
+	if _, err := p.send1(context.TODO(), MOCK_TOPIC, v2.MessageType_NORMAL, []*v2.MessageQueue{mq}, []*PublishingMessage{{msg: msg, messageId: "msg-ok"}}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-results; r.err != nil || r.receipt.MessageID != "msg-ok" {
+		t.Errorf("unexpected observed result of success, receipt=%v, err=%v", r.receipt, r.err)
+	}
+
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.SendMessageResponse{
+		Status: &v2.Status{Code: v2.Code_BAD_REQUEST},
+	}, nil)
+	if _, err := p.send1(context.TODO(), MOCK_TOPIC, v2.MessageType_NORMAL, []*v2.MessageQueue{mq}, []*PublishingMessage{{msg: msg, messageId: "msg-failed"}}, 1); err == nil {
+		t.Fatal("expected error for non-OK status")
+	}
+	if r := <-results; r.err == nil || r.receipt.MessageID != "msg-failed" || r.receipt.Endpoints != mq.GetBroker().GetEndpoints() {
+		t.Errorf("unexpected observed result of failure, receipt=%v, err=%v", r.receipt, r.err)
+	}
+
+	// Messages failed before being sent are observed as well.
+	p.pSetting.maxBodySizeBytes.Store(1024)
+	WithMaxSingleMessageSize(8).apply(&p.po)
+	_, err := p.Send(context.TODO(), &Message{Topic: MOCK_TOPIC, Body: make([]byte, 16)})
+	var tooLarge *ErrMessageTooLarge
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+	if r := <-results; r.err != err || len(r.receipt.MessageID) == 0 || r.receipt.Endpoints != nil {
+		t.Errorf("unexpected observed result of failure before sending, receipt=%v, err=%v", r.receipt, r.err)
+	}
+}
+
+func TestProducerShardingKey(t *testing.T) {
+	var messageQueues []*v2.MessageQueue
+	for i := 0; i < 8; i++ {
+		messageQueues = append(messageQueues, &v2.MessageQueue{Id: int32(i), Broker: &v2.Broker{Name: "broker-a"}})
+	}
+	plb1, _ := NewPublishingLoadBalancer(messageQueues)
+	plb2, _ := NewPublishingLoadBalancer(messageQueues)
+	for _, key := range []string{"user-1", "user-2", "user-3"} {
+		mqs1, err := plb1.TakeMessageQueueByShardingKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Selection is independent of the round-robin index and the load balancer instance.
+		plb1.TakeMessageQueues(&sync.Map{}, 1)
+		mqs2, _ := plb1.TakeMessageQueueByShardingKey(key)
+		mqs3, _ := plb2.TakeMessageQueueByShardingKey(key)
+		if len(mqs1) != 1 || mqs1[0] != mqs2[0] || mqs1[0] != mqs3[0] {
+			t.Errorf("expected sharding key %s to land on the same queue", key)
+		}
+	}
+
+	p := &defaultProducer{pSetting: &producerSettings{}}
+	msg1 := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+	msg1.SetShardingKey("user-1")
+	msg2 := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+	msg2.SetShardingKey("user-2")
+	if _, err := p.send0(context.TODO(), []*UnifiedMessage{
+		{pubMsg: &PublishingMessage{msg: msg1, messageType: v2.MessageType_NORMAL}},
+		{pubMsg: &PublishingMessage{msg: msg2, messageType: v2.MessageType_NORMAL}},
+	}, false); err == nil {
+		t.Error("expected error for messages with different sharding keys")
+	}
+}
+
+func TestProducerSendWithSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 3}, requestTimeout: time.Second},
+	}
+	var messageQueues []*v2.MessageQueue
+	for i, brokerName := range []string{"broker-a", "broker-b", "broker-c"} {
+		messageQueues = append(messageQueues, &v2.MessageQueue{Id: int32(i), Broker: &v2.Broker{
+			Name:      brokerName,
+			Endpoints: &v2.Endpoints{Addresses: []*v2.Address{{Host: fmt.Sprintf("127.0.0.%d", i+1), Port: 8081}}},
+		}})
+	}
+	plb, _ := NewPublishingLoadBalancer(messageQueues)
+	p.publishingRouteDataResultCache.Store(MOCK_TOPIC, plb)
+	var hosts []string
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, endpoints *v2.Endpoints, _ *v2.SendMessageRequest, _ time.Duration) (*v2.SendMessageResponse, error) {
+			hosts = append(hosts, endpoints.GetAddresses()[0].GetHost())
+			return &v2.SendMessageResponse{Status: &v2.Status{Code: v2.Code_OK}, Entries: []*v2.SendResultEntry{{MessageId: "msg"}}}, nil
+		}).Times(5)
+
+	session := NewSendSession()
+	for i := 0; i < 3; i++ {
+		if _, err := p.SendWithSession(context.TODO(), &Message{Topic: MOCK_TOPIC, Body: []byte{}}, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pinned := session.GetMessageQueue(MOCK_TOPIC)
+	if pinned == nil || hosts[0] != hosts[1] || hosts[0] != hosts[2] {
+		t.Fatalf("expected sends of session to be pinned to one queue, got %v", hosts)
+	}
+	if _, err := p.Send(context.TODO(), &Message{Topic: MOCK_TOPIC, Body: []byte{}}); err != nil || hosts[3] == hosts[0] {
+		t.Errorf("expected sends without session to be balanced, got %v, err=%v", hosts, err)
+	}
+
+	// Another queue is pinned once the pinned one is removed from the route.
+	var remaining []*v2.MessageQueue
+	for _, mq := range messageQueues {
+		if mq != pinned {
+			remaining = append(remaining, mq)
+		}
+	}
+	plb, _ = NewPublishingLoadBalancer(remaining)
+	p.publishingRouteDataResultCache.Store(MOCK_TOPIC, plb)
+	if _, err := p.SendWithSession(context.TODO(), &Message{Topic: MOCK_TOPIC, Body: []byte{}}, session); err != nil {
+		t.Fatal(err)
+	}
+	if session.GetMessageQueue(MOCK_TOPIC) == pinned || hosts[4] == hosts[0] {
+		t.Errorf("expected another queue to be pinned, got %v", hosts)
+	}
+}
+
+func TestProducerReceiptRawResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 1}, requestTimeout: time.Second},
+	}
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}})
+	p.publishingRouteDataResultCache.Store(MOCK_TOPIC, plb)
+	resp := &v2.SendMessageResponse{Status: &v2.Status{Code: v2.Code_OK, Message: "OK"}, Entries: []*v2.SendResultEntry{{MessageId: "msg"}}}
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(resp, nil)
+
+	receipts, err := p.Send(context.TODO(), &Message{Topic: MOCK_TOPIC, Body: []byte{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipts[0].RawResponse() != resp {
+		t.Errorf("expected raw response %v, got %v", resp, receipts[0].RawResponse())
+	}
+}
+
+func TestProducerMessageTypeMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 1}, requestTimeout: time.Second},
+	}
+	p.pSetting.validateMessageType.Store(true)
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{{
+		Broker:             &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()},
+		AcceptMessageTypes: []v2.MessageType{v2.MessageType_FIFO},
+	}})
+	p.publishingRouteDataResultCache.Store(MOCK_TOPIC, plb)
+
+	_, err := p.Send(context.TODO(), &Message{Topic: MOCK_TOPIC, Body: []byte{}})
+	var mismatch *ErrMessageTypeMismatch
+	if !errors.As(err, &mismatch) || mismatch.MessageType != v2.MessageType_NORMAL {
+		t.Errorf("expected ErrMessageTypeMismatch for message without message group, got %v", err)
+	}
+
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.SendMessageResponse{Status: &v2.Status{Code: v2.Code_OK}, Entries: []*v2.SendResultEntry{{MessageId: "msg"}}}, nil)
+	msg := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+	msg.SetMessageGroup("group")
+	if _, err := p.Send(context.TODO(), msg); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProducerRouteRefreshAddsQueues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{cli: cli, po: defaultProducerOptions, pSetting: &producerSettings{}}
+	cli.clientImpl = p
+
+	var route []*v2.MessageQueue
+	for i, brokerName := range []string{"broker-a", "broker-b", "broker-c", "broker-d"} {
+		route = append(route, &v2.MessageQueue{Id: int32(i), Broker: &v2.Broker{
+			Name:      brokerName,
+			Endpoints: &v2.Endpoints{Addresses: []*v2.Address{{Host: fmt.Sprintf("127.0.0.%d", i+1), Port: 8081}}},
+		}})
+	}
+	// The topic is scaled out from 2 queues to 4 queues.
+	oldRoute := route[:2]
+	cli.router.Store(MOCK_TOPIC, oldRoute)
+	plb, _ := NewPublishingLoadBalancer(oldRoute)
+	p.publishingRouteDataResultCache.Store(MOCK_TOPIC, plb)
+	cm.EXPECT().QueryRoute(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.QueryRouteResponse{Status: &v2.Status{Code: v2.Code_OK}, MessageQueues: route}, nil)
+	cli.refreshRoute(MOCK_TOPIC, oldRoute)
+
+	plb, err := p.getPublishingTopicRouteResult(context.TODO(), MOCK_TOPIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected := make(map[int32]bool)
+	for i := 0; i < len(route); i++ {
+		mqs, err := plb.TakeMessageQueues(&sync.Map{}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected[mqs[0].GetId()] = true
+	}
+	if len(selected) != len(route) {
+		t.Errorf("expected all %d queues to be selected in round-robin, got %v", len(route), selected)
+	}
+	// Candidates for retries are taken from all brokers.
+	if candidates, _ := plb.TakeMessageQueues(&sync.Map{}, len(route)); len(candidates) != len(route) {
+		t.Errorf("expected %d candidates on different brokers, got %v", len(route), candidates)
+	}
+}
+
+func TestProducerRecoverOrphanedTransaction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	checked := make(chan *MessageView, 1)
+	resolution := COMMIT
+	checker := &TransactionChecker{Check: func(mv *MessageView) TransactionResolution {
+		checked <- mv
+		return resolution
+	}}
+	p := &defaultProducer{cli: cli, checker: checker, pSetting: &producerSettings{requestTimeout: time.Second}}
+	p.po.checker = checker
+
+	command := &v2.RecoverOrphanedTransactionCommand{
+		TransactionId: "tx-123",
+		Message: &v2.Message{
+			Topic:            &v2.Resource{Name: MOCK_TOPIC},
+			SystemProperties: &v2.SystemProperties{MessageId: "msg-123", Keys: []string{"order-1"}, BodyEncoding: v2.Encoding_IDENTITY},
+			UserProperties:   map[string]string{"orderId": "1"},
+			Body:             []byte{},
+		},
+	}
+	running := cli.goroutines.Load()
+	ended := make(chan *v2.EndTransactionRequest, 1)
+	cm.EXPECT().EndTransaction(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *v2.Endpoints, req *v2.EndTransactionRequest, _ time.Duration) (*v2.EndTransactionResponse, error) {
+			ended <- req
+			return &v2.EndTransactionResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil
+		})
+	if err := p.onRecoverOrphanedTransactionCommand(fakeEndpoints(), command); err != nil {
+		t.Fatal(err)
+	}
+	mv := <-checked
+	if mv.GetTransactionId() != "tx-123" || mv.GetProperties()["orderId"] != "1" || mv.GetKeys()[0] != "order-1" {
+		t.Errorf("expected the checker to receive the full message, got %+v", mv)
+	}
+	req := <-ended
+	if req.GetResolution() != v2.TransactionResolution_COMMIT || req.GetTransactionId() != "tx-123" || req.GetMessageId() != "msg-123" {
+		t.Errorf("unexpected end transaction request %v", req)
+	}
+
+	// Unknown resolution leaves the transaction to be checked later, the transaction is not ended.
+	resolution = UNKNOWN
+	if err := p.onRecoverOrphanedTransactionCommand(fakeEndpoints(), command); err != nil {
+		t.Fatal(err)
+	}
+	<-checked
+	for deadline := time.Now().Add(5 * time.Second); cli.goroutines.Load() > running; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the recovery to return")
+		}
+		runtime.Gosched()
+	}
+	if len(ended) != 0 {
+		t.Errorf("expected the unknown transaction not to be ended, got %v", <-ended)
+	}
+}
+
+func TestProducerTransactionCheckTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	release := make(chan struct{})
+	checker := &TransactionChecker{Check: func(mv *MessageView) TransactionResolution {
+		<-release
+		return COMMIT
+	}}
+	p := &defaultProducer{cli: cli, checker: checker, pSetting: &producerSettings{requestTimeout: time.Second}}
+	WithTransactionCheckTimeout(50*time.Millisecond, ROLLBACK).apply(&p.po)
+	p.transactionChecks = make(chan struct{}, 1)
+	running := cli.goroutines.Load()
+
+	command := &v2.RecoverOrphanedTransactionCommand{
+		TransactionId: "tx-123",
+		Message: &v2.Message{
+			Topic:            &v2.Resource{Name: MOCK_TOPIC},
+			SystemProperties: &v2.SystemProperties{MessageId: "msg-123", BodyEncoding: v2.Encoding_IDENTITY},
+			Body:             []byte{},
+		},
+	}
+	done := make(chan struct{})
+	cm.EXPECT().EndTransaction(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *v2.Endpoints, req *v2.EndTransactionRequest, _ time.Duration) (*v2.EndTransactionResponse, error) {
+			defer close(done)
+			if req.GetResolution() != v2.TransactionResolution_ROLLBACK {
+				t.Errorf("expected the resolution of timeout, got %v", req.GetResolution())
+			}
+			return &v2.EndTransactionResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil
+		})
+	if err := p.onRecoverOrphanedTransactionCommand(fakeEndpoints(), command); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	// The stuck checker still occupies the only slot.
+	if err := p.onRecoverOrphanedTransactionCommand(fakeEndpoints(), command); err == nil {
+		t.Error("expected check beyond the concurrency limit to be dropped")
+	}
+	if cli.goroutines.Load() <= running {
+		t.Error("expected the stuck checker to be counted in the goroutines of the client")
+	}
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	if len(p.transactionChecks) != 0 {
+		t.Error("expected the slot to be released once the checker returns")
+	}
+	if n := cli.goroutines.Load(); n != running {
+		t.Errorf("expected the goroutine of the checker to be finished, got %d goroutine(s) running", n-running)
+	}
+}
+
+func TestProducerDeduplication(t *testing.T) {
+	p := &defaultProducer{deduplicator: newSendDeduplicator(time.Minute, 2)}
+	newPubMessage := func(key string) *PublishingMessage {
+		msg := &Message{Topic: MOCK_TOPIC}
+		msg.SetDeduplicationKey(key)
+		return &PublishingMessage{msg: msg}
+	}
+	send := func(receipt *SendReceipt, err error, keys ...string) {
+		pubMessages := make([]*PublishingMessage, 0, len(keys))
+		for _, key := range keys {
+			pubMessages = append(pubMessages, newPubMessage(key))
+		}
+		if err := p.reserveDeduplicationKeys(pubMessages); err != nil {
+			t.Fatalf("expected keys %v to be reserved, got %v", keys, err)
+		}
+		receipts := make([]*SendReceipt, 0, len(keys))
+		for range keys {
+			receipts = append(receipts, receipt)
+		}
+		p.settleDeduplicationKeys(pubMessages, receipts, err)
+	}
+	send(&SendReceipt{MessageID: "m1"}, nil, "k1")
+	var errDuplicate *ErrDuplicate
+	if err := p.reserveDeduplicationKeys([]*PublishingMessage{newPubMessage("k1")}); !errors.As(err, &errDuplicate) || errDuplicate.MessageID != "m1" {
+		t.Errorf("expected ErrDuplicate with the accepted message id, got %v", err)
+	}
+
+	// A key being sent is reserved until the send is settled, and released if the send fails.
+	if err := p.reserveDeduplicationKeys([]*PublishingMessage{newPubMessage("k2")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.reserveDeduplicationKeys([]*PublishingMessage{newPubMessage("k4"), newPubMessage("k2")}); !errors.As(err, &errDuplicate) || errDuplicate.MessageID != "" {
+		t.Errorf("expected ErrDuplicate for the key being sent, got %v", err)
+	}
+	p.settleDeduplicationKeys([]*PublishingMessage{newPubMessage("k2")}, nil, errors.New("send failed"))
+	send(&SendReceipt{MessageID: "m2"}, nil, "k2")
+	// k4 is released along with the duplicate one.
+	send(nil, errors.New("send failed"), "k4")
+
+	// k1 is the least recently sent one, and is evicted by k3.
+	send(&SendReceipt{MessageID: "m3"}, nil, "k3")
+	send(&SendReceipt{MessageID: "m1"}, nil, "k1")
+
+	p.deduplicator.window = 0
+	send(&SendReceipt{MessageID: "m2"}, nil, "k2")
+}
+
+func TestProducerDeduplicationConcurrentSends(t *testing.T) {
+	p := &defaultProducer{deduplicator: newSendDeduplicator(time.Minute, 16)}
+	var reserved atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg := &Message{Topic: MOCK_TOPIC}
+			msg.SetDeduplicationKey("key")
+			if p.reserveDeduplicationKeys([]*PublishingMessage{{msg: msg}}) == nil {
+				reserved.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved.Load() != 1 {
+		t.Errorf("expected only one of the concurrent sends with the same key to be sent, got %d", reserved.Load())
+	}
+}
+
+func TestProducerSendError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 3}, requestTimeout: time.Second},
+	}
+	errTransient := errors.New("transient")
+	errPersistent := errors.New("persistent")
+	gomock.InOrder(
+		cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errTransient),
+		cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.SendMessageResponse{
+			Status: &v2.Status{Code: v2.Code_INTERNAL_SERVER_ERROR},
+		}, nil),
+		cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errPersistent),
+	)
+	mq := &v2.MessageQueue{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}
+	msg := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+	_, err := p.send1(context.TODO(), MOCK_TOPIC, v2.MessageType_NORMAL, []*v2.MessageQueue{mq}, []*PublishingMessage{{msg: msg, messageId: "msg-123"}}, 1)
+
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) {
+		t.Fatalf("expected SendError, got %v", err)
+	}
+	if sendErr.Attempts() != 3 || len(sendErr.Causes()) != 3 {
+		t.Errorf("expected 3 attempts, got %d", sendErr.Attempts())
+	}
+	if sendErr.Causes()[0] != errTransient || errorCodeOf(sendErr.Causes()[1]) != v2.Code_INTERNAL_SERVER_ERROR.String() {
+		t.Errorf("unexpected causes %v", sendErr.Causes())
+	}
+	if !errors.Is(err, errPersistent) || errors.Is(err, errTransient) {
+		t.Error("expected SendError to unwrap to the error of the last attempt")
+	}
+}
+
+func TestProducerFlush(t *testing.T) {
+	p := &defaultProducer{}
+	if err := p.Flush(context.TODO()); err != nil {
+		t.Errorf("expected flush without pending sends to return immediately, err=%v", err)
+	}
+
+	first := p.beginAsyncSend()
+	second := p.beginAsyncSend()
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected flush to respect the deadline, err=%v", err)
+	}
+	if len(p.asyncFlushes) != 0 {
+		t.Errorf("expected the flush given up to be forgotten, got %d", len(p.asyncFlushes))
+	}
+
+	flushed := make(chan error, 1)
+	go func() { flushed <- p.Flush(context.TODO()) }()
+	for {
+		p.asyncLock.Lock()
+		waiting := len(p.asyncFlushes)
+		p.asyncLock.Unlock()
+		if waiting == 1 {
+			break
+		}
+		runtime.Gosched()
+	}
+	// Sends issued after the flush are not waited for.
+	p.beginAsyncSend()
+	p.endAsyncSend(second)
+	select {
+	case <-flushed:
+		t.Fatal("expected flush to wait for all pending sends")
+	case <-time.After(10 * time.Millisecond):
+	}
+	p.endAsyncSend(first)
+	if err := <-flushed; err != nil {
+		t.Errorf("unexpected flush error, err=%v", err)
+	}
+}
+
+func TestProducerFailFastOnNoRoute(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p, err := NewProducer(&Config{
+		Endpoint:    fakeAddress,
+		Credentials: &credentials.SessionCredentials{},
+	}, WithFailFastOnNoRoute(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp := p.(*defaultProducer)
+	cm := NewMockClientManager(ctrl)
+	dp.cli.clientManager = cm
+	dp.cli.opts.routeMaxAttempts = 3
+	dp.cli.opts.routeRetryBackoff = time.Millisecond
+	msg := &Message{Topic: MOCK_TOPIC, Body: []byte{}}
+
+	cm.EXPECT().QueryRoute(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.QueryRouteResponse{
+		Status: &v2.Status{Code: v2.Code_TOPIC_NOT_FOUND},
+	}, nil).Times(1)
+	_, err = p.Send(context.TODO(), msg)
+	var notFound *ErrTopicNotFound
+	if !errors.As(err, &notFound) || notFound.Topic != MOCK_TOPIC {
+		t.Errorf("expected ErrTopicNotFound at once, got %v", err)
+	}
+
+	dp.cli.failFastOnNoRoute = false
+	cm.EXPECT().QueryRoute(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.QueryRouteResponse{
+		Status: &v2.Status{Code: v2.Code_OK},
+	}, nil).Times(3)
+	_, err = p.Send(context.TODO(), msg)
+	var routeErr *ErrRouteUnavailable
+	if !errors.As(err, &routeErr) || !errors.As(err, &notFound) {
+		t.Errorf("expected route lookup of topic without queues to be retried, got %v", err)
+	}
+}
+
+func TestProducerSendRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p, err := NewProducer(&Config{
+		Endpoint:    fakeAddress,
+		Credentials: &credentials.SessionCredentials{},
+	}, WithFailFastOnNoRoute(true), WithSendRateLimit(1, 1), WithFailFastOnSendRateLimit(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp := p.(*defaultProducer)
+	dp.cli.clientMeterProvider.(*defaultClientMeterProvider).clientMeter.enabled.Store(true)
+	cm := NewMockClientManager(ctrl)
+	dp.cli.clientManager = cm
+	msg := &Message{Topic: "throttled-topic", Body: []byte{}}
+
+	cm.EXPECT().QueryRoute(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.QueryRouteResponse{
+		Status: &v2.Status{Code: v2.Code_TOPIC_NOT_FOUND},
+	}, nil).Times(1)
+	_, err = p.Send(context.TODO(), msg)
+	var notFound *ErrTopicNotFound
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected first send to be allowed, got %v", err)
+	}
+	if _, err = p.Send(context.TODO(), msg); !errors.Is(err, ErrSendRateLimited) {
+		t.Errorf("expected second send to be rejected by rate limit, got %v", err)
+	}
+
+	rows, err := view.RetrieveData(PublishThrottledView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key == topicTag && tag.Value == "throttled-topic" {
+				count += row.Data.(*view.CountData).Value
+			}
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected 1 throttled send to be recorded, got %d", count)
+	}
+}
+
+func TestProducerAsyncSendWaitMetric(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cli.clientMeterProvider.(*defaultClientMeterProvider).clientMeter.enabled.Store(true)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 1}, requestTimeout: time.Second},
+	}
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}})
+	p.publishingRouteDataResultCache.Store("async-topic", plb)
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.SendMessageResponse{
+		Status:  &v2.Status{Code: v2.Code_OK},
+		Entries: []*v2.SendResultEntry{{MessageId: "msg"}},
+	}, nil).Times(2)
+
+	waits := func() (count int64) {
+		rows, err := view.RetrieveData(PublishAsyncWaitView.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			for _, tag := range row.Tags {
+				if tag.Key == topicTag && tag.Value == "async-topic" {
+					count += row.Data.(*view.DistributionData).Count
+				}
+			}
+		}
+		return count
+	}
+	before := waits()
+	if _, err := p.Send(context.TODO(), &Message{Topic: "async-topic", Body: []byte{}}); err != nil {
+		t.Fatal(err)
+	}
+	p.SendAsync(context.TODO(), &Message{Topic: "async-topic", Body: []byte{}}, func(_ context.Context, _ []*SendReceipt, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	if err := p.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if count := waits() - before; count != 1 {
+		t.Errorf("expected wait of the async send only to be recorded, got %d", count)
+	}
+}
+
+func TestProducerThrottleBackoff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cli.clientMeterProvider.(*defaultClientMeterProvider).clientMeter.enabled.Store(true)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 2}, requestTimeout: time.Second},
+	}
+	WithThrottleBackoff(20*time.Millisecond, time.Second).apply(&p.po)
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}})
+	p.publishingRouteDataResultCache.Store("throttled-topic", plb)
+	gomock.InOrder(
+		cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.SendMessageResponse{
+			Status: &v2.Status{Code: v2.Code_TOO_MANY_REQUESTS},
+		}, nil),
+		cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(context.Context, *v2.Endpoints, *v2.SendMessageRequest, time.Duration) (*v2.SendMessageResponse, error) {
+				if level := p.throttleLevel.Load(); level != 1 {
+					t.Errorf("expected throttle backoff to grow, level=%d", level)
+				}
+				return &v2.SendMessageResponse{
+					Status:  &v2.Status{Code: v2.Code_OK},
+					Entries: []*v2.SendResultEntry{{MessageId: "msg"}},
+				}, nil
+			}),
+	)
+
+	throttled := func() (count int64) {
+		rows, err := view.RetrieveData(PublishBrokerThrottledView.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			for _, tag := range row.Tags {
+				if tag.Key == topicTag && tag.Value == "throttled-topic" {
+					count += row.Data.(*view.CountData).Value
+				}
+			}
+		}
+		return count
+	}
+	before := throttled()
+	start := time.Now()
+	if _, err := p.Send(context.TODO(), &Message{Topic: "throttled-topic", Body: []byte{}}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("expected resend to wait for the throttle backoff, elapsed=%v", elapsed)
+	}
+	if level := p.throttleLevel.Load(); level != 0 {
+		t.Errorf("expected throttle backoff to be relaxed by the success, level=%d", level)
+	}
+	if count := throttled() - before; count != 1 {
+		t.Errorf("expected 1 throttled send to be recorded, got %d", count)
+	}
+}
+
+func TestProducerMaxConcurrentAsyncSends(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:        cli,
+		po:         defaultProducerOptions,
+		pSetting:   &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 1}, requestTimeout: time.Second},
+		asyncSends: make(chan struct{}, 1),
+	}
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}})
+	p.publishingRouteDataResultCache.Store("async-topic", plb)
+	release := make(chan struct{})
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(context.Context, *v2.Endpoints, *v2.SendMessageRequest, time.Duration) (*v2.SendMessageResponse, error) {
+			<-release
+			return &v2.SendMessageResponse{
+				Status:  &v2.Status{Code: v2.Code_OK},
+				Entries: []*v2.SendResultEntry{{MessageId: "msg"}},
+			}, nil
+		}).Times(1)
+
+	running := cli.inspect().Goroutines
+	p.SendAsync(context.TODO(), &Message{Topic: "async-topic", Body: []byte{}}, func(context.Context, []*SendReceipt, error) {})
+	if goroutines := cli.inspect().Goroutines - running; goroutines != 1 {
+		t.Errorf("expected 1 goroutine of the async send, got %d", goroutines)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+	defer cancel()
+	var asyncErr error
+	p.SendAsync(ctx, &Message{Topic: "async-topic", Body: []byte{}}, func(_ context.Context, _ []*SendReceipt, err error) {
+		asyncErr = err
+	})
+	if !errors.Is(asyncErr, context.DeadlineExceeded) {
+		t.Errorf("expected async send beyond the limit to wait until the context is done, err=%v", asyncErr)
+	}
+	close(release)
+	if err := p.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProducerSendBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p, err := NewProducer(&Config{
+		Endpoint:    fakeAddress,
+		Credentials: &credentials.SessionCredentials{},
+	}, WithRetryFailedBatchEntries(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp := p.(*defaultProducer)
+	cm := NewMockClientManager(ctrl)
+	dp.cli.clientManager = cm
+	dp.cli.router.Store(MOCK_TOPIC, []*v2.MessageQueue{{
+		Topic:              &v2.Resource{Name: MOCK_TOPIC},
+		Broker:             &v2.Broker{Name: "broker-0", Endpoints: fakeEndpoints()},
+		AcceptMessageTypes: []v2.MessageType{v2.MessageType_NORMAL},
+	}})
+	msgs := []*Message{
+		{Topic: MOCK_TOPIC, Body: []byte("a")},
+		{Topic: MOCK_TOPIC, Body: []byte("b")},
+	}
+
+	failedEntry := &v2.SendResultEntry{Status: &v2.Status{Code: v2.Code_INTERNAL_SERVER_ERROR, Message: "disk full"}}
+	first := cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.SendMessageResponse{
+		Status:  &v2.Status{Code: v2.Code_OK},
+		Entries: []*v2.SendResultEntry{{MessageId: "a", Status: &v2.Status{Code: v2.Code_OK}}, failedEntry},
+	}, nil)
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *v2.Endpoints, req *v2.SendMessageRequest, _ time.Duration) (*v2.SendMessageResponse, error) {
+			if len(req.GetMessages()) != 1 || string(req.GetMessages()[0].GetBody()) != "b" {
+				t.Errorf("expected only the failed message to be resent, got %v", req.GetMessages())
+			}
+			return &v2.SendMessageResponse{
+				Status:  &v2.Status{Code: v2.Code_OK},
+				Entries: []*v2.SendResultEntry{{MessageId: "b"}},
+			}, nil
+		}).After(first)
+	entries, err := p.SendBatch(context.TODO(), msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []string{"a", "b"} {
+		if entries[i].Message != msgs[i] || entries[i].Err != nil || entries[i].Receipt.MessageID != expected {
+			t.Errorf("unexpected outcome of message %d: %+v", i, entries[i])
+		}
+	}
+
+	dp.po.retryFailedBatchEntries = false
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.SendMessageResponse{
+		Status:  &v2.Status{Code: v2.Code_OK},
+		Entries: []*v2.SendResultEntry{{MessageId: "a"}, failedEntry},
+	}, nil).Times(1)
+	entries, err = p.SendBatch(context.TODO(), msgs)
+	var rpcErr *ErrRpcStatus
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "disk full" {
+		t.Errorf("expected failure of the second message, got %v", err)
+	}
+	if entries[0].Err != nil || entries[0].Receipt == nil || entries[1].Err == nil || entries[1].Receipt != nil {
+		t.Errorf("expected per-message outcomes, got %+v, %+v", entries[0], entries[1])
+	}
+}
+
+func TestProducerSendInterceptor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	var order []string
+	p, err := NewProducer(&Config{
+		Endpoint:    fakeAddress,
+		Credentials: &credentials.SessionCredentials{},
+	}, WithRequiredProperties("tenant"),
+		WithSendInterceptor(func(msg *Message) error {
+			order = append(order, "first")
+			msg.AddProperty("tenant", "t1")
+			return nil
+		}),
+		WithSendInterceptor(func(msg *Message) error {
+			order = append(order, "second")
+			if msg.GetProperties()["tenant"] != "t1" {
+				t.Error("expected modification of the first interceptor to be visible")
+			}
+			if len(msg.Body) == 0 {
+				return errors.New("empty body")
+			}
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp := p.(*defaultProducer)
+	cm := NewMockClientManager(ctrl)
+	dp.cli.clientManager = cm
+	dp.cli.router.Store(MOCK_TOPIC, []*v2.MessageQueue{{
+		Topic:              &v2.Resource{Name: MOCK_TOPIC},
+		Broker:             &v2.Broker{Name: "broker-0", Endpoints: fakeEndpoints()},
+		AcceptMessageTypes: []v2.MessageType{v2.MessageType_NORMAL},
+	}})
+
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *v2.Endpoints, req *v2.SendMessageRequest, _ time.Duration) (*v2.SendMessageResponse, error) {
+			if req.GetMessages()[0].GetUserProperties()["tenant"] != "t1" {
+				t.Errorf("expected property added by interceptor to be sent, got %v", req.GetMessages()[0].GetUserProperties())
+			}
+			return &v2.SendMessageResponse{Status: &v2.Status{Code: v2.Code_OK}, Entries: []*v2.SendResultEntry{{}}}, nil
+		})
+	if _, err = p.Send(context.TODO(), &Message{Topic: MOCK_TOPIC, Body: []byte("body")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("expected interceptors to be called in order, got %v", order)
+	}
+
+	if _, err = p.Send(context.TODO(), &Message{Topic: MOCK_TOPIC}); err == nil {
+		t.Error("expected message rejected by interceptor not to be sent")
+	}
+}
+
+func TestProducerCheckCompatibility(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{cli: cli, po: defaultProducerOptions, pSetting: &producerSettings{}}
+	cli.clientImpl = p
+	cli.router.Store("fifo-topic", []*v2.MessageQueue{})
+	cm.EXPECT().QueryRoute(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.QueryRouteResponse{
+		Status: &v2.Status{Code: v2.Code_OK},
+		MessageQueues: []*v2.MessageQueue{{
+			Broker:             &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()},
+			AcceptMessageTypes: []v2.MessageType{v2.MessageType_FIFO},
+		}},
+	}, nil).AnyTimes()
+
+	cm.EXPECT().HeartBeat(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.HeartbeatResponse{
+		Status: &v2.Status{Code: v2.Code_OK},
+	}, nil)
+	info, err := p.CheckCompatibility(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Compatible || info.BrokerProtocolVersion != ProtocolVersion {
+		t.Errorf("expected brokers to be compatible, got %+v", info)
+	}
+	if info.Fifo != FeatureSupport_SUPPORTED || info.Transaction != FeatureSupport_UNKNOWN || info.Sql92 != FeatureSupport_UNKNOWN {
+		t.Errorf("unexpected feature support, got %+v", info)
+	}
+
+	cm.EXPECT().HeartBeat(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.HeartbeatResponse{
+		Status: &v2.Status{Code: v2.Code_VERSION_UNSUPPORTED, Message: "unsupported version"},
+	}, nil)
+	cli.observeReceiveStatus(&v2.ReceiveMessageRequest{FilterExpression: &v2.FilterExpression{Type: v2.FilterType_SQL}}, v2.Code_NOT_IMPLEMENTED)
+	info, err = p.CheckCompatibility(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Compatible || info.BrokerProtocolVersion != "" || len(info.Mismatches) != 2 {
+		t.Errorf("expected the protocol and SQL92 mismatches, got %+v", info)
+	}
+}
+
+func TestProducerMessageSizeLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cli.clientManager = NewMockClientManager(ctrl)
+	p := &defaultProducer{cli: cli, po: defaultProducerOptions, pSetting: &producerSettings{}}
+	p.pSetting.maxBodySizeBytes.Store(64)
+	WithMaxSingleMessageSize(32).apply(&p.po)
+	WithMaxBatchSize(48).apply(&p.po)
+
+	var tooLarge *ErrMessageTooLarge
+	_, err := p.Send(context.TODO(), &Message{Topic: "size-topic", Body: make([]byte, 33)})
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != MessageSizeLimit_SINGLE || tooLarge.Size != 33 {
+		t.Errorf("expected single send to exceed the max single message size, err=%v", err)
+	}
+	_, err = p.Send(context.TODO(), &Message{Topic: "size-topic", Body: make([]byte, 65)})
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != MessageSizeLimit_BODY {
+		t.Errorf("expected single send to exceed the max body size, err=%v", err)
+	}
+	_, err = p.SendBatch(context.TODO(), []*Message{
+		{Topic: "size-topic", Body: make([]byte, 24)},
+		{Topic: "size-topic", Body: make([]byte, 25)},
+	})
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != MessageSizeLimit_BATCH || tooLarge.Size != 49 || tooLarge.MaxSize != 48 {
+		t.Errorf("expected batch to exceed the max batch size, err=%v", err)
+	}
+}
+
+func TestProducerQueueSelectionMetric(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cli.clientMeterProvider.(*defaultClientMeterProvider).clientMeter.enabled.Store(true)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 1}, requestTimeout: time.Second},
+	}
+	p.pSetting.maxBodySizeBytes.Store(1024)
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{
+		{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}, Id: 0},
+		{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}, Id: 1},
+	})
+	p.publishingRouteDataResultCache.Store("selection-topic", plb)
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&v2.SendMessageResponse{
+		Status:  &v2.Status{Code: v2.Code_OK},
+		Entries: []*v2.SendResultEntry{{MessageId: "msg"}},
+	}, nil).Times(4)
+
+	for i := 0; i < 4; i++ {
+		if _, err := p.Send(context.TODO(), &Message{Topic: "selection-topic", Body: []byte{}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := view.RetrieveData(PublishQueueSelectionsView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selections := make(map[string]int64)
+	for _, row := range rows {
+		tags := make(map[tag.Key]string)
+		for _, tag := range row.Tags {
+			tags[tag.Key] = tag.Value
+		}
+		if tags[topicTag] == "selection-topic" && tags[brokerNameTag] == "broker-a" {
+			selections[tags[queueIdTag]] += row.Data.(*view.CountData).Value
+		}
+	}
+	if selections["0"] != 2 || selections["1"] != 2 {
+		t.Errorf("expected sends to be spread evenly across queues, got %v", selections)
+	}
+}
+
+func TestProducerSendCancellation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cli := BuildCLient(t)
+	cm := NewMockClientManager(ctrl)
+	cli.clientManager = cm
+	p := &defaultProducer{
+		cli:      cli,
+		po:       defaultProducerOptions,
+		pSetting: &producerSettings{retryPolicy: &v2.RetryPolicy{MaxAttempts: 3}, requestTimeout: time.Second},
+	}
+	p.pSetting.maxBodySizeBytes.Store(1024)
+	plb, _ := NewPublishingLoadBalancer([]*v2.MessageQueue{{Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}})
+	p.publishingRouteDataResultCache.Store("cancel-topic", plb)
+
+	WithSendCancellation(SendCancellation_UNCERTAIN).apply(&p.po)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ *v2.Endpoints, _ *v2.SendMessageRequest, _ time.Duration) (*v2.SendMessageResponse, error) {
+			cancel()
+			return nil, ctx.Err()
+		}).Times(1)
+	_, err := p.Send(ctx, &Message{Topic: "cancel-topic", Body: []byte{}})
+	var uncertain *ErrSendUncertain
+	if !errors.As(err, &uncertain) || uncertain.Attempt != 1 || len(uncertain.MessageIDs) != 1 {
+		t.Errorf("expected the send to be uncertain without retrying, err=%v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the error of request to be wrapped, err=%v", err)
+	}
+
+	WithSendCancellation(SendCancellation_COMPLETE).apply(&p.po)
+	ctx, cancel = context.WithCancel(context.TODO())
+	cm.EXPECT().SendMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ *v2.Endpoints, _ *v2.SendMessageRequest, _ time.Duration) (*v2.SendMessageResponse, error) {
+			cancel()
+			if ctx.Err() != nil {
+				t.Errorf("expected the request to be detached from the cancellation, err=%v", ctx.Err())
+			}
+			return &v2.SendMessageResponse{
+				Status:  &v2.Status{Code: v2.Code_OK},
+				Entries: []*v2.SendResultEntry{{MessageId: "msg"}},
+			}, nil
+		}).Times(1)
+	if _, err := p.Send(ctx, &Message{Topic: "cancel-topic", Body: []byte{}}); err != nil {
+		t.Errorf("expected the send to complete, err=%v", err)
+	}
+}
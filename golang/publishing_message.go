@@ -19,12 +19,20 @@ package golang
 
 import (
 	"fmt"
+	"strconv"
+	"time"
 
 	innerOS "github.com/apache/rocketmq-clients/golang/v5/pkg/os"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// delayLevelProperty is the property of classic delay level understood by brokers.
+const delayLevelProperty = "DELAY"
+
+// maxBornTimestampAhead is how far the overridden born timestamp could be ahead of now without a warning.
+const maxBornTimestampAhead = time.Minute
+
 type PublishingMessage struct {
 	namespace    string
 	msg          *Message
@@ -32,6 +40,10 @@ type PublishingMessage struct {
 	messageId    string
 	messageType  v2.MessageType
 	traceContext *string
+	// encryptedBody is sent instead of the body of msg if the producer has an Encryptor.
+	encryptedBody []byte
+	// encryptionKeyId is the key id returned by the Encryptor, empty if the body is not encrypted.
+	encryptionKeyId string
 }
 
 var NewPublishingMessage = func(msg *Message, namespace string, settings *producerSettings, txEnabled bool) (*PublishingMessage, error) {
@@ -42,11 +54,42 @@ var NewPublishingMessage = func(msg *Message, namespace string, settings *produc
 		msg: msg,
 	}
 
-	maxBodySizeBytes := int(settings.maxBodySizeBytes.Load())
-
+	// Encryption is done before any encoding of the body.
 	length := len(msg.Body)
+	if settings.encryptor != nil {
+		keyId, encrypted, err := settings.encryptor(msg.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt message body, topic=%s, err=%w", msg.Topic, err)
+		}
+		if len(keyId) == 0 {
+			return nil, fmt.Errorf("key id of encryption is empty, topic=%s", msg.Topic)
+		}
+		pMsg.encryptedBody = encrypted
+		pMsg.encryptionKeyId = keyId
+		length = len(encrypted)
+	}
+
+	maxBodySizeBytes := int(settings.maxBodySizeBytes.Load())
 	if length > maxBodySizeBytes {
-		return nil, fmt.Errorf("message body size exceeds the threshold, max size=%d bytes", maxBodySizeBytes)
+		return nil, &ErrMessageTooLarge{Limit: MessageSizeLimit_BODY, Size: length, MaxSize: maxBodySizeBytes}
+	}
+
+	if msg.GetDelayLevel() != 0 {
+		if msg.GetDeliveryTimestamp() != nil {
+			return nil, fmt.Errorf("message should not set both delay level and delivery timestamp")
+		}
+		if msg.GetDelayLevel() < 0 {
+			return nil, fmt.Errorf("message delay level=%d is out of range", msg.GetDelayLevel())
+		}
+	}
+
+	if bornTimestamp := msg.GetBornTimestamp(); bornTimestamp != nil {
+		if bornTimestamp.UnixMilli() <= 0 {
+			return nil, fmt.Errorf("message born timestamp=%v is out of range", *bornTimestamp)
+		}
+		if ahead := time.Until(*bornTimestamp); ahead > maxBornTimestampAhead {
+			sugarBaseLogger.Warnf("message born timestamp is %v ahead of now, topic=%s, bornTimestamp=%v", ahead, msg.Topic, *bornTimestamp)
+		}
 	}
 
 	// No need to compress message body.
@@ -55,7 +98,11 @@ var NewPublishingMessage = func(msg *Message, namespace string, settings *produc
 	pMsg.namespace = namespace
 
 	// Generate message id.
-	pMsg.messageId = GetMessageIdCodecInstance().NextMessageId().String()
+	if settings.messageIdGenerator != nil {
+		pMsg.messageId = settings.messageIdGenerator()
+	} else {
+		pMsg.messageId = GetMessageIdCodecInstance().NextMessageId().String()
+	}
 	// Normal message.
 	if msg.GetMessageGroup() == nil && msg.GetDeliveryTimestamp() == nil && !txEnabled && msg.GetLiteTopic() == nil {
 		pMsg.messageType = v2.MessageType_NORMAL
@@ -85,6 +132,14 @@ var NewPublishingMessage = func(msg *Message, namespace string, settings *produc
 	return nil, fmt.Errorf("transactional message should not set messageGroup or deliveryTimestamp")
 }
 
+// bodySize returns the size of the body sent, which is encrypted if the producer has an Encryptor.
+func (pMsg *PublishingMessage) bodySize() int {
+	if len(pMsg.encryptionKeyId) > 0 {
+		return len(pMsg.encryptedBody)
+	}
+	return len(pMsg.msg.Body)
+}
+
 func (pMsg *PublishingMessage) toProtobuf() (*v2.Message, error) {
 	if pMsg == nil {
 		return nil, fmt.Errorf("publishingMessage is nil")
@@ -112,6 +167,9 @@ func (pMsg *PublishingMessage) toProtobuf() (*v2.Message, error) {
 	if pMsg.traceContext != nil {
 		msg.SystemProperties.TraceContext = pMsg.traceContext
 	}
+	if pMsg.msg.GetBornTimestamp() != nil {
+		msg.SystemProperties.BornTimestamp = timestamppb.New(*pMsg.msg.GetBornTimestamp())
+	}
 	if pMsg.msg.GetDeliveryTimestamp() != nil {
 		msg.SystemProperties.DeliveryTimestamp = timestamppb.New(*pMsg.msg.GetDeliveryTimestamp())
 	}
@@ -121,5 +179,22 @@ func (pMsg *PublishingMessage) toProtobuf() (*v2.Message, error) {
 	if pMsg.msg.LiteTopic != nil {
 		msg.SystemProperties.LiteTopic = pMsg.msg.LiteTopic
 	}
+	if level := pMsg.msg.GetDelayLevel(); level > 0 {
+		properties := make(map[string]string, len(msg.UserProperties)+1)
+		for k, v := range msg.UserProperties {
+			properties[k] = v
+		}
+		properties[delayLevelProperty] = strconv.Itoa(level)
+		msg.UserProperties = properties
+	}
+	if len(pMsg.encryptionKeyId) != 0 {
+		msg.Body = pMsg.encryptedBody
+		properties := make(map[string]string, len(msg.UserProperties)+1)
+		for k, v := range msg.UserProperties {
+			properties[k] = v
+		}
+		properties[EncryptionKeyIdProperty] = pMsg.encryptionKeyId
+		msg.UserProperties = properties
+	}
 	return msg, nil
 }
@@ -18,8 +18,10 @@
 package golang
 
 import (
+	"fmt"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 	"testing"
+	"time"
 )
 
 func TestNewPublishingMessage(t *testing.T) {
@@ -54,6 +56,202 @@ func TestNewPublishingMessage_LiteMessage(t *testing.T) {
 	}
 }
 
+func TestNewPublishingMessage_DelayLevel(t *testing.T) {
+	pSetting := &producerSettings{}
+	msg := &Message{}
+	msg.SetDelayLevel(3)
+	pMsg, err := NewPublishingMessage(msg, "ns-test", pSetting, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2Msg, err := pMsg.toProtobuf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2Msg.GetUserProperties()[delayLevelProperty] != "3" {
+		t.Errorf("expected delay level property, got %v", v2Msg.GetUserProperties())
+	}
+	if _, ok := msg.GetProperties()[delayLevelProperty]; ok {
+		t.Error("expected properties of the original message to be untouched")
+	}
+
+	msg.SetDelayTimestamp(time.Now())
+	if _, err := NewPublishingMessage(msg, "ns-test", pSetting, false); err == nil {
+		t.Error("expected error for both delay level and delivery timestamp")
+	}
+}
+
+func TestNewPublishingMessage_BornTimestamp(t *testing.T) {
+	pSetting := &producerSettings{}
+	msg := &Message{}
+	pMsg, err := NewPublishingMessage(msg, "ns-test", pSetting, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2Msg, err := pMsg.toProtobuf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(v2Msg.GetSystemProperties().GetBornTimestamp().AsTime()) > time.Minute {
+		t.Errorf("expected born timestamp to be now by default, got %v", v2Msg.GetSystemProperties().GetBornTimestamp().AsTime())
+	}
+
+	bornTimestamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg.SetBornTimestamp(bornTimestamp)
+	if pMsg, err = NewPublishingMessage(msg, "ns-test", pSetting, false); err != nil {
+		t.Fatal(err)
+	}
+	if v2Msg, err = pMsg.toProtobuf(); err != nil {
+		t.Fatal(err)
+	}
+	if !v2Msg.GetSystemProperties().GetBornTimestamp().AsTime().Equal(bornTimestamp) {
+		t.Errorf("expected overridden born timestamp, got %v", v2Msg.GetSystemProperties().GetBornTimestamp().AsTime())
+	}
+
+	msg.SetBornTimestamp(time.Time{})
+	if _, err = NewPublishingMessage(msg, "ns-test", pSetting, false); err == nil {
+		t.Error("expected error for born timestamp out of range")
+	}
+}
+
 func ptrToString(s string) *string {
 	return &s
 }
+
+func TestNewPublishingMessage_TypedProperties(t *testing.T) {
+	pSetting := &producerSettings{}
+	msg := &Message{Topic: "test-topic"}
+	msg.AddIntProperty("int", -42)
+	msg.AddBoolProperty("bool", true)
+	msg.AddFloatProperty("float", 1.5e6)
+	pMsg, err := NewPublishingMessage(msg, "", pSetting, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2Msg, err := pMsg.toProtobuf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]string{"int": "-42", "bool": "true", "float": "1500000"} {
+		if actual := v2Msg.GetUserProperties()[key]; actual != expected {
+			t.Errorf("expected property %s to be encoded as %s, got %s", key, expected, actual)
+		}
+	}
+
+	mv := fromProtobuf_MessageView0(v2Msg)
+	if value, ok := mv.GetIntProperty("int"); !ok || value != -42 {
+		t.Errorf("unexpected int property %d, ok=%v", value, ok)
+	}
+	if value, ok := mv.GetBoolProperty("bool"); !ok || !value {
+		t.Errorf("unexpected bool property %v, ok=%v", value, ok)
+	}
+	if value, ok := mv.GetFloatProperty("float"); !ok || value != 1.5e6 {
+		t.Errorf("unexpected float property %v, ok=%v", value, ok)
+	}
+	if _, ok := mv.GetIntProperty("float-absent"); ok {
+		t.Error("expected absent property not to be decoded")
+	}
+	if _, ok := mv.GetIntProperty("bool"); ok {
+		t.Error("expected bool property not to be decoded as int")
+	}
+}
+
+func TestNewPublishingMessage_MessageIDGenerator(t *testing.T) {
+	var seq int
+	pSetting := &producerSettings{messageIdGenerator: func() string {
+		seq++
+		return fmt.Sprintf("msg-%d", seq)
+	}}
+	for _, expected := range []string{"msg-1", "msg-2"} {
+		pMsg, err := NewPublishingMessage(&Message{Topic: "test-topic"}, "", pSetting, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2Msg, err := pMsg.toProtobuf()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v2Msg.GetSystemProperties().GetMessageId() != expected {
+			t.Errorf("expected message id %s, got %s", expected, v2Msg.GetSystemProperties().GetMessageId())
+		}
+	}
+}
+
+func TestNewPublishingMessage_Encryption(t *testing.T) {
+	reverse := func(body []byte) []byte {
+		reversed := make([]byte, len(body))
+		for i, b := range body {
+			reversed[len(body)-1-i] = b
+		}
+		return reversed
+	}
+	pSetting := &producerSettings{encryptor: func(body []byte) (string, []byte, error) {
+		return "key-1", reverse(body), nil
+	}}
+	pSetting.maxBodySizeBytes.Store(1024)
+	msg := &Message{Topic: "test-topic", Body: []byte("secret")}
+	pMsg, err := NewPublishingMessage(msg, "", pSetting, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2Msg, err := pMsg.toProtobuf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v2Msg.GetBody()) != "terces" || v2Msg.GetUserProperties()[EncryptionKeyIdProperty] != "key-1" {
+		t.Errorf("expected encrypted body with key id, got body=%s, properties=%v", v2Msg.GetBody(), v2Msg.GetUserProperties())
+	}
+	if string(msg.Body) != "secret" {
+		t.Error("expected body of the original message to be untouched")
+	}
+
+	var keyIds []string
+	mv := fromProtobuf_MessageView0(v2Msg)
+	decryptMessageView(mv, func(keyId string, body []byte) ([]byte, error) {
+		keyIds = append(keyIds, keyId)
+		return reverse(body), nil
+	})
+	if string(mv.GetBody()) != "secret" || len(keyIds) != 1 || keyIds[0] != "key-1" {
+		t.Errorf("expected decrypted body, got body=%s, keyIds=%v", mv.GetBody(), keyIds)
+	}
+	if _, ok := mv.GetProperties()[EncryptionKeyIdProperty]; ok {
+		t.Error("expected key id property to be removed after decryption")
+	}
+
+	mv = fromProtobuf_MessageView0(v2Msg)
+	decryptMessageView(mv, func(string, []byte) ([]byte, error) { return nil, fmt.Errorf("unknown key") })
+	if !mv.isCorrupted() {
+		t.Error("expected message failed to be decrypted to be corrupted")
+	}
+}
+
+func TestNewMessageFromView(t *testing.T) {
+	tag := "tag-a"
+	messageGroup := "group-a"
+	receiptHandle := "handle"
+	mv := fromProtobuf_MessageView0(&v2.Message{
+		Topic: &v2.Resource{Name: "test-topic"},
+		SystemProperties: &v2.SystemProperties{
+			MessageId:     "msg",
+			Tag:           &tag,
+			Keys:          []string{"key-a", "key-b"},
+			MessageGroup:  &messageGroup,
+			ReceiptHandle: &receiptHandle,
+		},
+		UserProperties: map[string]string{"k": "v"},
+		Body:           []byte("body"),
+	})
+	msg := NewMessageFromView(mv)
+	if msg.Topic != "test-topic" || string(msg.Body) != "body" || *msg.GetTag() != tag ||
+		fmt.Sprint(msg.GetKeys()) != "[key-a key-b]" || msg.GetProperties()["k"] != "v" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if msg.GetMessageGroup() != nil {
+		t.Error("expected message group not to be carried over")
+	}
+	msg.Body[0] = 'B'
+	msg.AddProperty("k", "changed")
+	if string(mv.GetBody()) != "body" || mv.GetProperties()["k"] != "v" {
+		t.Error("expected the consumed message to be untouched")
+	}
+}
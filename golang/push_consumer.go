@@ -22,12 +22,14 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.uber.org/atomic"
 
-	"github.com/apache/rocketmq-clients/golang/v5/pkg/ticker"
 	"github.com/apache/rocketmq-clients/golang/v5/pkg/utils"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 	"github.com/google/uuid"
@@ -43,15 +45,28 @@ type PushConsumer interface {
 
 	Subscribe(topic string, filterExpression *FilterExpression) error
 	Unsubscribe(topic string) error
+	Subscriptions() map[string]FilterExpression
 	Ack(ctx context.Context, messageView *MessageView) error
+	AckManually(ctx context.Context, token *ManualAckToken) error
 	ChangeInvisibleDuration(messageView *MessageView, invisibleDuration time.Duration) error
 	ChangeInvisibleDurationAsync(messageView *MessageView, invisibleDuration time.Duration)
+	QueryAssignment(ctx context.Context, topic string) ([]MessageQueue, error)
+	OnDeliveryLatencyExceeded(topic string, threshold time.Duration, f func(actual time.Duration))
+	Inspect() ClientState
+	CheckCompatibility(ctx context.Context) (CompatInfo, error)
+	WaitForAssignment(ctx context.Context) error
+	Seek(ctx context.Context, messageQueue *MessageQueue, offset int64) error
+	SeekToTimestamp(ctx context.Context, messageQueue *MessageQueue, timestamp time.Time) error
+	CommittedOffsets(ctx context.Context) (map[MessageQueue]int64, error)
+	DrainAndClose(ctx context.Context) ([]*MessageView, error)
 }
 
 var _ = PushConsumer(&defaultPushConsumer{})
 
 type defaultPushConsumer struct {
-	cli *defaultClient
+	cli    *defaultClient
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	groupName                    string
 	pcOpts                       pushConsumerOptions
@@ -67,6 +82,29 @@ type defaultPushConsumer struct {
 
 	consumptionOkQuantity    atomic.Int64
 	consumptionErrorQuantity atomic.Int64
+	expiredMessagesQuantity  atomic.Int64
+	skippedMessagesQuantity  atomic.Int64
+	droppedMessagesQuantity  atomic.Int64
+	// rebalanceChurnQuantity counts the message queues taken or dropped by rebalances.
+	rebalanceChurnQuantity atomic.Int64
+	// unassignedSince keeps the time each held message queue went missing from the assignments, see
+	// AssignmentStrategy_STICKY.
+	unassignedSince sync.Map
+	// inFlightBytes is the total body size of messages cached by all process queues.
+	inFlightBytes atomic.Int64
+	// ackedReceiptHandles guards against duplicate acks, see WithPushDuplicateAckGuard.
+	ackedReceiptHandles *ackedReceiptHandles
+	// awaitingMessages counts the messages of each topic waiting for a free consumption thread.
+	awaitingMessages sync.Map
+	// offsetStore keeps consume offsets, see WithOffsetStore.
+	offsetStore OffsetStore
+	// receiveRateLimiter is nil unless WithPushMaxReceiveConcurrency is set.
+	receiveRateLimiter *receiveRateLimiter
+	// draining is set by DrainAndClose, messages not dispatched to the listener yet are collected to drainedMessages
+	// since then.
+	draining        atomic.Bool
+	drainedMessages []*MessageView
+	drainedLock     sync.Mutex
 
 	stopping                        atomic.Bool
 	inflightRequestCountInterceptor *defultInflightRequestCountInterceptor
@@ -168,6 +206,16 @@ func (pc *defaultPushConsumer) Unsubscribe(topic string) error {
 	return nil
 }
 
+// Subscriptions returns a copy of the current subscriptions, including the changes made by Subscribe and Unsubscribe.
+func (pc *defaultPushConsumer) Subscriptions() map[string]FilterExpression {
+	subscriptions := make(map[string]FilterExpression)
+	pc.subscriptionExpressions.Range(func(k, v interface{}) bool {
+		subscriptions[k.(string)] = *v.(*FilterExpression)
+		return true
+	})
+	return subscriptions
+}
+
 func (pc *defaultPushConsumer) wrapReceiveMessageRequest(batchSize int, messageQueue *v2.MessageQueue, filterExpression *FilterExpression, longPollingTimeout time.Duration) *v2.ReceiveMessageRequest {
 	return pc.pushConsumerExtension.WrapReceiveMessageRequest(batchSize, messageQueue, filterExpression, longPollingTimeout)
 }
@@ -269,8 +317,10 @@ func (pc *defaultPushConsumer) receiveMessage(ctx context.Context, request *v2.R
 		}
 		for _, message := range messageList {
 			messageView := fromProtobuf_MessageView2(message, messageQueue, deliveryTimestamp)
+			decryptMessageView(messageView, pc.pcOpts.decryptor)
 			messageViewList = append(messageViewList, messageView)
 		}
+		pc.cli.observeReceiveStatus(request, status.GetCode())
 		if status.GetCode() == v2.Code_OK {
 			return messageViewList, nil
 		} else {
@@ -337,6 +387,11 @@ var newPushConsumer = func(config *Config, opts ...PushConsumerOption) (*default
 		processQueueTable:               &sync.Map{},
 		stopping:                        *atomic.NewBool(false),
 		inflightRequestCountInterceptor: NewDefultInflightRequestCountInterceptor(),
+		ackedReceiptHandles:             newAckedReceiptHandles(pcOpts.ackedReceiptHandleCapacity),
+	}
+	pc.ctx, pc.cancel = context.WithCancel(pcOpts.ctx)
+	if pcOpts.maxReceiveConcurrency > 0 {
+		pc.receiveRateLimiter = newReceiveRateLimiter(pcOpts.maxReceiveConcurrency)
 	}
 	pc.pushConsumerExtension = pc
 	pc.cli.initTopics = make([]string, 0)
@@ -344,10 +399,7 @@ var newPushConsumer = func(config *Config, opts ...PushConsumerOption) (*default
 		pc.cli.initTopics = append(pc.cli.initTopics, key.(string))
 		return true
 	})
-	endpoints, err := utils.ParseTarget(config.Endpoint)
-	if err != nil {
-		return nil, err
-	}
+	endpoints := pc.cli.getAccessPoint()
 	pc.pcSettings = &pushConsumerSettings{
 		clientId:       pc.cli.GetClientID(),
 		endpoints:      endpoints,
@@ -367,6 +419,10 @@ var newPushConsumer = func(config *Config, opts ...PushConsumerOption) (*default
 		longPollingTimeout:      time.Second * 30,
 		subscriptionExpressions: pcOpts.subscriptionExpressions,
 	}
+	pc.offsetStore = pcOpts.offsetStore
+	if pc.offsetStore == nil {
+		pc.offsetStore = &brokerOffsetStore{cli: pc.cli, group: pc.pcSettings.groupName, resolve: pc.resolveMessageQueue}
+	}
 	pc.cli.settings = pc.pcSettings
 	pc.cli.clientImpl = pc
 	pc.cli.registerMessageInterceptor(pc.inflightRequestCountInterceptor)
@@ -376,21 +432,39 @@ var newPushConsumer = func(config *Config, opts ...PushConsumerOption) (*default
 func (pc *defaultPushConsumer) Start() error {
 	err := pc.cli.startUp()
 
-	threadPool := NewSimpleThreadPool("MessageConsumption", int(pc.pcOpts.maxCacheMessageCount), int(pc.pcOpts.consumptionThreadCount))
+	threadPool := NewSimpleThreadPool("MessageConsumption", int(pc.maxCacheMessageCount()), int(pc.pcOpts.consumptionThreadCount))
+	consumeRateLimiter := newTokenBucket(pc.pcOpts.consumeRateLimit, pc.pcOpts.consumeRateBurst, false)
 	if pc.pcSettings.isFifo {
-		pc.consumerService = NewFiFoConsumeService(pc.cli.clientID, pc.pcOpts.messageListener, threadPool, pc.cli, pc.pcOpts.enableFifoConsumeAccelerator)
+		fcs := NewFiFoConsumeService(pc.cli.clientID, pc.pcOpts.messageListener, threadPool, pc.cli, pc.pcOpts.enableFifoConsumeAccelerator)
+		fcs.ctx = pc.ctx
+		fcs.consumeRateLimiter = consumeRateLimiter
+		fcs.orderedRetry = pc.pcOpts.orderedRetry
+		fcs.consumeTimeout = pc.pcOpts.consumeTimeout
+		fcs.onConsumeTimeout = pc.recordConsumeTimeout
+		fcs.onAwaitingChange = pc.updateAwaitingMessages
+		fcs.goAsync = pc.cli.goAsync
+		fcs.onDrain = pc.drainMessage
+		pc.consumerService = fcs
 		pc.cli.log.Infof("Create FIFO consume service, consumerGroup=%s, clientId=%s, enableFifoConsumeAccelerator=%t", pc.cli.config.ConsumerGroup, pc.cli.clientID, pc.pcOpts.enableFifoConsumeAccelerator)
 	} else {
-		pc.consumerService = NewStandardConsumeService(pc.cli.clientID, pc.pcOpts.messageListener, threadPool, pc.cli)
+		scs := NewStandardConsumeService(pc.cli.clientID, pc.pcOpts.messageListener, threadPool, pc.cli)
+		scs.ctx = pc.ctx
+		scs.consumeRateLimiter = consumeRateLimiter
+		scs.consumeTimeout = pc.pcOpts.consumeTimeout
+		scs.onConsumeTimeout = pc.recordConsumeTimeout
+		scs.onAwaitingChange = pc.updateAwaitingMessages
+		scs.goAsync = pc.cli.goAsync
+		scs.onDrain = pc.drainMessage
+		pc.consumerService = scs
 		pc.cli.log.Infof("Create standard consume service, consumerGroup=%s, clientId=%s", pc.cli.config.ConsumerGroup, pc.cli.clientID)
 	}
 
 	if err == nil {
-		go func() {
+		pc.cli.goAsync(func() {
 			time.Sleep(time.Second)
 			pc.scanAssignments()
-			ticker.Tick(pc.scanAssignments, 5*time.Second, pc.cli.done)
-		}()
+			pc.cli.tick(pc.scanAssignments, 5*time.Second)
+		})
 		return nil
 	}
 	err2 := pc.GracefulStop()
@@ -408,10 +482,16 @@ func (pc *defaultPushConsumer) scanAssignments() {
 	pc.subscriptionExpressions.Range(func(key, value interface{}) bool {
 		topic := key.(string)
 		filterExpression := value.(*FilterExpression)
-		newest, err := pc.cli.queryAssignments(context.TODO(), topic, pc.groupName, pc.cli.opts.timeout)
+		var newest *[]*v2.Assignment
+		var err error
+		if queueIds, ok := pc.pcOpts.staticQueueAssignments[topic]; ok {
+			newest, err = pc.queryStaticAssignments(context.TODO(), topic, queueIds)
+		} else {
+			newest, err = pc.cli.queryAssignments(context.TODO(), topic, pc.groupName, pc.cli.opts.timeout)
+		}
 		if err != nil {
-			pc.cli.log.Errorf("Exception raised while scanning the assignments, topic=%s, clientId=%s, err=%v",
-				topic, pc.cli.clientID, err)
+			pc.cli.log.Errorw("Exception raised while scanning the assignments", logFieldTopic, topic,
+				logFieldErrorCode, errorCodeOf(err), logFieldError, err)
 		}
 		val, _ := pc.cacheAssignments.Load(topic)
 		var existed *[]*v2.Assignment
@@ -420,15 +500,13 @@ func (pc *defaultPushConsumer) scanAssignments() {
 		}
 		if utils.IsAssignmentsEmpty(newest) {
 			if utils.IsAssignmentsEmpty(existed) {
-				pc.cli.log.Infof("Acquired empty assignments from remote, would scan later, topic=%s, clientId=%s", topic, pc.cli.clientID)
+				pc.cli.log.Infow("Acquired empty assignments from remote, would scan later", logFieldTopic, topic)
 				return true
 			}
-			pc.cli.log.Infof("Attention!!! acquired empty assignments from remote, but existed assignments is not empty, topic=%s, clientId=%d",
-				topic, pc.cli.clientID)
+			pc.cli.log.Infow("Attention!!! acquired empty assignments from remote, but existed assignments is not empty", logFieldTopic, topic)
 		}
 		if !utils.CompareAssignments(newest, existed) {
-			pc.cli.log.Infof("Assignments of topic=%s has changed, %v => %v, clientId=%s", topic, existed,
-				newest, pc.cli.clientID)
+			pc.cli.log.Infow("Assignments of topic has changed", logFieldTopic, topic, "existed", existed, "newest", newest)
 			pc.syncProcessQueue(topic, newest, filterExpression)
 			pc.cacheAssignments.Store(topic, newest)
 			return true
@@ -440,13 +518,45 @@ func (pc *defaultPushConsumer) scanAssignments() {
 	})
 }
 
+// queryStaticAssignments picks the readable message queues of topic with the given ids as the assignments,
+// without querying brokers.
+func (pc *defaultPushConsumer) queryStaticAssignments(ctx context.Context, topic string, queueIds []int) (*[]*v2.Assignment, error) {
+	mqs, err := pc.cli.getMessageQueues(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[int32]bool, len(queueIds))
+	for _, id := range queueIds {
+		owned[int32(id)] = true
+	}
+	assignments := make([]*v2.Assignment, 0, len(queueIds))
+	for _, mq := range mqs {
+		if !owned[mq.GetId()] {
+			continue
+		}
+		if permission := mq.GetPermission(); permission != v2.Permission_READ && permission != v2.Permission_READ_WRITE {
+			continue
+		}
+		assignments = append(assignments, &v2.Assignment{MessageQueue: mq})
+	}
+	return &assignments, nil
+}
+
 func (pc *defaultPushConsumer) syncProcessQueue(topic string, assignments *[]*v2.Assignment, filterExpression *FilterExpression) {
 	latest := make(map[utils.MessageQueueStr]*v2.MessageQueue)
 	if assignments != nil {
 		for _, a := range *assignments {
+			if !pc.isBrokerConsumed(a.MessageQueue.GetBroker()) {
+				pc.cli.log.Debugf("Ignore message queue of broker not matching the filter, broker=%s, topic=%s, clientId=%s",
+					a.MessageQueue.GetBroker().GetName(), topic, pc.cli.clientID)
+				continue
+			}
 			latest[utils.ParseMessageQueue2Str(a.MessageQueue)] = a.MessageQueue
 		}
 	}
+	pc.retainUnassignedQueues(topic, latest)
+	pc.declineExcessAssignments(topic, latest)
+	moved := 0
 	activeMqs := make(map[utils.MessageQueueStr]*v2.MessageQueue)
 	pc.processQueueTable.Range(func(key, value interface{}) bool {
 		messageQueueStr := key.(utils.MessageQueueStr)
@@ -459,6 +569,7 @@ func (pc *defaultPushConsumer) syncProcessQueue(topic string, assignments *[]*v2
 		if _, ok := latest[messageQueueStr]; !ok {
 			pc.cli.log.Infof("Drop message queue according to the latest assignmentList, mq=%s, clientId=%s", messageQueueStr, pc.cli.clientID)
 			pc.dropProcessQueue(messageQueueStr)
+			moved++
 			return true
 		}
 		if processQueue.expired() {
@@ -477,9 +588,125 @@ func (pc *defaultPushConsumer) syncProcessQueue(topic string, assignments *[]*v2
 		if optionalProcessQueue != nil {
 			pc.cli.log.Infof("Start to fetch message from remote, mq=%s, clientId={}", mqs, pc.cli.clientID)
 			optionalProcessQueue.fetchMessageImmediately()
+			moved++
+		}
+	}
+	pc.recordRebalanceChurn(topic, moved)
+}
+
+// retainUnassignedQueues adds the message queues of topic held by the consumer but missing from latest back to
+// latest, until they have been missing for the grace period, see AssignmentStrategy_STICKY. Brokers compute the
+// assignments regardless, so the consumer which a retained queue is assigned to receives from it meanwhile too,
+// which is safe as messages are locked by invisible durations. Retained queues count against WithMaxAssignedQueues.
+func (pc *defaultPushConsumer) retainUnassignedQueues(topic string, latest map[utils.MessageQueueStr]*v2.MessageQueue) {
+	if pc.pcOpts.assignmentStrategy != AssignmentStrategy_STICKY {
+		return
+	}
+	now := time.Now()
+	pc.processQueueTable.Range(func(key, value interface{}) bool {
+		messageQueueStr := key.(utils.MessageQueueStr)
+		messageQueue := value.([]interface{})[0].(*v2.MessageQueue)
+		if topic != messageQueue.GetTopic().GetName() {
+			return true
+		}
+		if _, ok := latest[messageQueueStr]; ok {
+			pc.unassignedSince.Delete(messageQueueStr)
+			return true
+		}
+		since, _ := pc.unassignedSince.LoadOrStore(messageQueueStr, now)
+		if now.Sub(since.(time.Time)) < pc.pcOpts.assignmentGracePeriod {
+			pc.cli.log.Debugf("Keep message queue missing from the assignments, mq=%s, clientId=%s", messageQueueStr, pc.cli.clientID)
+			latest[messageQueueStr] = messageQueue
+		}
+		return true
+	})
+}
+
+// recordRebalanceChurn counts the message queues of topic taken or dropped by a rebalance.
+func (pc *defaultPushConsumer) recordRebalanceChurn(topic string, moved int) {
+	if moved == 0 {
+		return
+	}
+	pc.rebalanceChurnQuantity.Add(int64(moved))
+	cmp := pc.cli.clientMeterProvider
+	if !cmp.isEnabled() {
+		return
+	}
+	err := stats.RecordWithTags(cmp.tagContext(), []tag.Mutator{tag.Insert(topicTag, cmp.sanitizeTagValue(topicTag, topic)), tag.Insert(clientIdTag, pc.cli.clientID), tag.Insert(consumerGroupTag, cmp.sanitizeTagValue(consumerGroupTag, pc.groupName))}, ConsumeRebalanceChurnM.M(int64(moved)))
+	if err != nil {
+		pc.cli.log.Errorf("Failed to record %s, topic=%s, err=%v", ConsumeRebalanceChurnM.Name(), topic, err)
+	}
+}
+
+// declineExcessAssignments removes the message queues of topic beyond the cap of WithMaxAssignedQueues from latest,
+// message queues already held are kept in preference to the new ones. Brokers are not aware of the declined queues,
+// which are left unconsumed until a later rebalance moves them to other consumers, so a group whose caps can not
+// hold all of its queues together leaves queues unowned.
+func (pc *defaultPushConsumer) declineExcessAssignments(topic string, latest map[utils.MessageQueueStr]*v2.MessageQueue) {
+	maxAssignedQueues := pc.pcOpts.maxAssignedQueues
+	if maxAssignedQueues <= 0 {
+		return
+	}
+	held := make([]utils.MessageQueueStr, 0)
+	fresh := make([]utils.MessageQueueStr, 0)
+	pc.processQueueTable.Range(func(key, value interface{}) bool {
+		messageQueueStr := key.(utils.MessageQueueStr)
+		if topic != value.([]interface{})[0].(*v2.MessageQueue).GetTopic().GetName() {
+			maxAssignedQueues--
+		} else if _, ok := latest[messageQueueStr]; ok {
+			held = append(held, messageQueueStr)
 		}
+		return true
+	})
+	for messageQueueStr := range latest {
+		if _, ok := pc.processQueueTable.Load(messageQueueStr); !ok {
+			fresh = append(fresh, messageQueueStr)
+		}
+	}
+	sort.Slice(held, func(i, j int) bool { return held[i] < held[j] })
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i] < fresh[j] })
+	for i, messageQueueStr := range append(held, fresh...) {
+		if i < maxAssignedQueues {
+			continue
+		}
+		pc.cli.log.Warnf("Decline message queue beyond the max assigned queues, mq=%s, maxAssignedQueues=%d, clientId=%s",
+			messageQueueStr, pc.pcOpts.maxAssignedQueues, pc.cli.clientID)
+		delete(latest, messageQueueStr)
+	}
+}
+
+func (pc *defaultPushConsumer) recordConsumeTimeout(mv *MessageView) {
+	cmp := pc.cli.clientMeterProvider
+	if !cmp.isEnabled() {
+		return
+	}
+	err := stats.RecordWithTags(cmp.tagContext(), []tag.Mutator{tag.Insert(topicTag, cmp.sanitizeTagValue(topicTag, mv.GetTopic())), tag.Insert(clientIdTag, pc.cli.clientID), tag.Insert(consumerGroupTag, cmp.sanitizeTagValue(consumerGroupTag, pc.groupName))}, ConsumeTimeoutsM.M(1))
+	if err != nil {
+		pc.cli.log.Errorf("Failed to record %s, messageId=%s, err=%v", ConsumeTimeoutsM.Name(), mv.GetMessageId(), err)
+	}
+}
+
+// updateAwaitingMessages adds delta to the count of messages of topic waiting for a free consumption thread, and
+// records the count.
+func (pc *defaultPushConsumer) updateAwaitingMessages(topic string, delta int64) {
+	v, _ := pc.awaitingMessages.LoadOrStore(topic, atomic.NewInt64(0))
+	count := v.(*atomic.Int64).Add(delta)
+	cmp := pc.cli.clientMeterProvider
+	if !cmp.isEnabled() {
+		return
 	}
+	err := stats.RecordWithTags(cmp.tagContext(), []tag.Mutator{tag.Insert(topicTag, cmp.sanitizeTagValue(topicTag, topic)), tag.Insert(clientIdTag, pc.cli.clientID), tag.Insert(consumerGroupTag, cmp.sanitizeTagValue(consumerGroupTag, pc.groupName))}, ConsumeAwaitingMessagesM.M(count))
+	if err != nil {
+		pc.cli.log.Errorf("Failed to record %s, topic=%s, err=%v", ConsumeAwaitingMessagesM.Name(), topic, err)
+	}
+}
+
+// isBrokerConsumed tells whether message queues of broker are consumed, see WithBrokerNameFilter.
+func (pc *defaultPushConsumer) isBrokerConsumed(broker *v2.Broker) bool {
+	filter := pc.pcOpts.brokerNameFilter
+	return filter == nil || filter.MatchString(broker.GetName())
 }
+
 func (pc *defaultPushConsumer) createProcessQueue(mqstr utils.MessageQueueStr, mq *v2.MessageQueue, fe *FilterExpression) ProcessQueue {
 	pq := newDefaultProcessQueue(pc, mqstr, mq, fe)
 	_, existed := pc.processQueueTable.LoadOrStore(mqstr, []interface{}{mq, pq})
@@ -490,6 +717,7 @@ func (pc *defaultPushConsumer) createProcessQueue(mqstr utils.MessageQueueStr, m
 }
 func (pc *defaultPushConsumer) dropProcessQueue(mqstr utils.MessageQueueStr) {
 	v, _ := pc.processQueueTable.LoadAndDelete(mqstr)
+	pc.unassignedSince.Delete(mqstr)
 	if v != nil {
 		if v2, ok := v.([]interface{}); ok {
 			v2[1].(ProcessQueue).drop()
@@ -507,25 +735,95 @@ func (pc *defaultPushConsumer) dropProcessQueue(mqstr utils.MessageQueueStr) {
  * 6. shutdown clientImpl
  */
 func (pc *defaultPushConsumer) GracefulStop() error {
+	return pc.shutdown(context.Background(), nil)
+}
+
+// shutdown closes the consumer in the order above, and stops waiting once ctx is done. beforeConsumptionShutdown is
+// run between step 3 and 4 if it is not nil. The first error of waiting or closing is returned.
+func (pc *defaultPushConsumer) shutdown(ctx context.Context, beforeConsumptionShutdown func(context.Context) error) error {
 	// step 1 and 2
 	pc.stopping.Store(true)
 
 	// step 3
 	pc.cli.log.Infof("Waiting for the inflight receive requests to be finished, clientId=%s", pc.cli.clientID)
-	pc.waitingReceiveRequestFinished()
+	err := pc.waitingReceiveRequestFinished(ctx)
+	if err == nil && beforeConsumptionShutdown != nil {
+		err = beforeConsumptionShutdown(ctx)
+	}
 	pc.cli.log.Infof("Begin to Shutdown consumption executor, clientId=%s", pc.cli.clientID)
 
-	// step 4
+	// step 4, contexts of listeners are cancelled before waiting for them to return.
+	pc.cancel()
 	pc.consumerService.Shutdown()
 
 	// step 5
-	time.Sleep(time.Second)
+	select {
+	case <-time.After(time.Second):
+	case <-ctx.Done():
+	}
 
 	// step 6
-	return pc.cli.GracefulStop()
+	if stopErr := pc.cli.GracefulStop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// DrainAndClose stops receiving messages and closes the consumer like GracefulStop, but returns the messages received
+// and not dispatched to the listener yet instead of consuming them, e.g. to hand them off to another consumer during
+// migration. Messages being consumed are waited for and acknowledged as usual.
+// The returned messages are neither acknowledged nor nacked, and could not be after the consumer is closed, so brokers
+// redeliver them to consumers of the group once their invisible durations expire, even if they have been processed
+// elsewhere, so whoever takes them over should tolerate duplicates.
+// If ctx is done before all cached messages are drained or consumed, the consumer is closed anyway, and the messages
+// drained so far are returned with the error of ctx.
+func (pc *defaultPushConsumer) DrainAndClose(ctx context.Context) ([]*MessageView, error) {
+	// Messages received by the inflight receive requests are drained as well.
+	pc.draining.Store(true)
+	err := pc.shutdown(ctx, pc.waitForCachedMessagesEvicted)
+	pc.drainedLock.Lock()
+	defer pc.drainedLock.Unlock()
+	return pc.drainedMessages, err
+}
+
+// drainMessage collects mv and returns true if DrainAndClose is in progress.
+func (pc *defaultPushConsumer) drainMessage(mv *MessageView) bool {
+	if !pc.draining.Load() {
+		return false
+	}
+	pc.drainedLock.Lock()
+	defer pc.drainedLock.Unlock()
+	pc.drainedMessages = append(pc.drainedMessages, mv)
+	return true
+}
+
+// waitForCachedMessagesEvicted blocks until every message cached by process queues is drained or consumed.
+func (pc *defaultPushConsumer) waitForCachedMessagesEvicted(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		cached := int32(0)
+		pc.processQueueTable.Range(func(_, v interface{}) bool {
+			if dpq, ok := v.([]interface{})[1].(*defaultProcessQueue); ok {
+				cached += dpq.cachedMessagesNums.Load()
+			}
+			return true
+		})
+		if cached <= 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			pc.cli.log.Warnf("Stop waiting for cached messages to be drained, cachedMessagesCount=%d, clientId=%s", cached, pc.cli.clientID)
+			return ctx.Err()
+		}
+	}
 }
 
-func (pc *defaultPushConsumer) waitingReceiveRequestFinished() error {
+// waitingReceiveRequestFinished blocks until the inflight receive requests are finished or time out, it returns the
+// error of ctx if ctx is done before.
+func (pc *defaultPushConsumer) waitingReceiveRequestFinished(ctx context.Context) error {
 	maxWaitingTime := pc.pcSettings.GetRequestTimeout() + pc.pcSettings.longPollingTimeout
 	endTime := time.Now().Add(maxWaitingTime)
 	defer func() {
@@ -545,11 +843,167 @@ func (pc *defaultPushConsumer) waitingReceiveRequestFinished() error {
 				"inflightReceiveRequestCount=%d", pc.cli.clientID, inflightReceiveRequestCount)
 			break
 		}
-		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			pc.cli.log.Warnf("Stop waiting for the inflight receive requests to be finished, clientId=%s, "+
+				"inflightReceiveRequestCount=%d", pc.cli.clientID, inflightReceiveRequestCount)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// QueryAssignment queries the broker for the message queues currently assigned to this consumer group on the topic.
+// The protocol does not carry the owning client id, so only the queues are returned.
+func (pc *defaultPushConsumer) QueryAssignment(ctx context.Context, topic string) ([]MessageQueue, error) {
+	if !pc.isOn() {
+		return nil, fmt.Errorf("push consumer is not running")
+	}
+	assignments, err := pc.cli.queryAssignments(ctx, topic, pc.groupName, pc.cli.opts.timeout)
+	if err != nil {
+		return nil, err
+	}
+	messageQueues := make([]MessageQueue, 0, len(*assignments))
+	for _, assignment := range *assignments {
+		messageQueues = append(messageQueues, toMessageQueue(assignment.GetMessageQueue()))
+	}
+	return messageQueues, nil
+}
+
+// OnDeliveryLatencyExceeded registers a callback invoked asynchronously once the delivery latency of received messages
+// of the topic exceeds threshold. A nil callback removes the registration.
+func (pc *defaultPushConsumer) OnDeliveryLatencyExceeded(topic string, threshold time.Duration, f func(actual time.Duration)) {
+	pc.cli.clientMeterProvider.onDeliveryLatencyExceeded(topic, threshold, f)
+}
+
+// WaitForAssignment blocks until at least one message queue is assigned to the push consumer and is being received from,
+// or returns the error of ctx once it is done.
+func (pc *defaultPushConsumer) WaitForAssignment(ctx context.Context) error {
+	for {
+		if utils.CountSyncMapSize(pc.processQueueTable) > 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Inspect returns a snapshot of the internal state of the push consumer.
+func (pc *defaultPushConsumer) Inspect() ClientState {
+	state := pc.cli.inspect()
+	state.Subscriptions = make(map[string]*FilterExpression)
+	pc.subscriptionExpressions.Range(func(k, v interface{}) bool {
+		state.Subscriptions[k.(string)] = v.(*FilterExpression)
+		return true
+	})
+	state.InflightReceiveRequests = pc.inflightRequestCountInterceptor.getInflightReceiveRequestCount()
+	pc.processQueueTable.Range(func(_, v interface{}) bool {
+		if dpq, ok := v.([]interface{})[1].(*defaultProcessQueue); ok {
+			state.CachedMessagesCount += int64(dpq.cachedMessagesNums.Load())
+			state.CachedMessagesBytes += dpq.cachedMessagesBytes.Load()
+		}
+		return true
+	})
+	return state
+}
+
+// CheckCompatibility checks whether brokers implement the protocol of the push consumer, and the features they support.
+func (pc *defaultPushConsumer) CheckCompatibility(ctx context.Context) (CompatInfo, error) {
+	return pc.cli.checkCompatibility(ctx)
+}
+
+// Seek resets the consume offset of the consumer group on the message queue, so that consumption resumes from offset.
+// The message queue is one of QueryAssignment or CommittedOffsets, or any queue in the route of its topic.
+// The offset is written to the OffsetStore, see WithOffsetStore. The default store keeps it on the server for the
+// whole consumer group, thus the seek survives rebalance and applies to whichever client the queue is assigned to,
+// while a custom store decides for itself how far the seek is shared. Offsets are never committed by the client
+// itself, so nothing clobbers the seek, but messages which have been received before are still consumed and
+// acknowledged.
+func (pc *defaultPushConsumer) Seek(ctx context.Context, messageQueue *MessageQueue, offset int64) error {
+	if !pc.isOn() {
+		return fmt.Errorf("push consumer is not running")
+	}
+	if err := pc.offsetStore.UpdateOffset(ctx, messageQueue, offset); err != nil {
+		return err
 	}
+	pc.cli.log.Infof("seek successfully, mq=%+v, offset=%d", *messageQueue, offset)
 	return nil
 }
 
+// SeekToTimestamp resets the consume offset of the consumer group on the message queue to the first message stored
+// at or after timestamp, see Seek.
+func (pc *defaultPushConsumer) SeekToTimestamp(ctx context.Context, messageQueue *MessageQueue, timestamp time.Time) error {
+	if !pc.isOn() {
+		return fmt.Errorf("push consumer is not running")
+	}
+	offset, err := pc.offsetStore.QueryOffset(ctx, messageQueue, timestamp)
+	if err != nil {
+		return err
+	}
+	return pc.Seek(ctx, messageQueue, offset)
+}
+
+// MessageQueue identifies a message queue, it is comparable so that it could be used as a map key.
+type MessageQueue struct {
+	Topic      string
+	BrokerName string
+	QueueId    int32
+}
+
+// CommittedOffsets returns the offsets committed by the consumer group on the message queues assigned to this
+// consumer, which are the offsets that consumption resumes from on restart. The offsets are read from the OffsetStore,
+// see Seek.
+func (pc *defaultPushConsumer) CommittedOffsets(ctx context.Context) (map[MessageQueue]int64, error) {
+	if !pc.isOn() {
+		return nil, fmt.Errorf("push consumer is not running")
+	}
+	messageQueues := make([]MessageQueue, 0)
+	pc.processQueueTable.Range(func(_, value interface{}) bool {
+		messageQueues = append(messageQueues, toMessageQueue(value.([]interface{})[0].(*v2.MessageQueue)))
+		return true
+	})
+	offsets := make(map[MessageQueue]int64, len(messageQueues))
+	for i := range messageQueues {
+		offset, err := pc.offsetStore.GetOffset(ctx, &messageQueues[i])
+		if err != nil {
+			return nil, err
+		}
+		offsets[messageQueues[i]] = offset
+	}
+	return offsets, nil
+}
+
+// resolveMessageQueue returns the message queue identified by messageQueue, preferring the assigned ones to the ones
+// of the topic route.
+func (pc *defaultPushConsumer) resolveMessageQueue(ctx context.Context, messageQueue *MessageQueue) (*v2.MessageQueue, error) {
+	var resolved *v2.MessageQueue
+	pc.processQueueTable.Range(func(_, value interface{}) bool {
+		mq := value.([]interface{})[0].(*v2.MessageQueue)
+		if toMessageQueue(mq) == *messageQueue {
+			resolved = mq
+			return false
+		}
+		return true
+	})
+	if resolved != nil {
+		return resolved, nil
+	}
+	route, err := pc.cli.getMessageQueues(ctx, messageQueue.Topic)
+	if err != nil {
+		return nil, err
+	}
+	for _, mq := range route {
+		if toMessageQueue(mq) == *messageQueue {
+			return mq, nil
+		}
+	}
+	return nil, fmt.Errorf("message queue is not found in the route, mq=%+v", *messageQueue)
+}
+
 func (pc *defaultPushConsumer) getSubscriptionTopicRouteResult(ctx context.Context, topic string) (SubscriptionLoadBalancer, error) {
 	item, ok := pc.subTopicRouteDataResultCache.Load(topic)
 	if ok {
@@ -581,23 +1035,109 @@ func (pc *defaultPushConsumer) Ack(ctx context.Context, messageView *MessageView
 	messageHookPointsStatus := MessageHookPointsStatus_ERROR
 	if err != nil {
 		pc.cli.doAfter(MessageHookPoints_ACK, messageCommons, duration, messageHookPointsStatus)
+		pc.notifyAckCallback(messageView, err)
 		return err
 	}
 	if resp.GetStatus().GetCode() != v2.Code_OK {
 		messageHookPointsStatus = MessageHookPointsStatus_OK
 	}
 	pc.cli.doAfter(MessageHookPoints_ACK, messageCommons, duration, messageHookPointsStatus)
+	var ackErr error
+	if resp.GetStatus().GetCode() != v2.Code_OK {
+		ackErr = &ErrRpcStatus{
+			Code:    int32(resp.GetStatus().GetCode()),
+			Message: resp.GetStatus().GetMessage(),
+		}
+	}
+	pc.notifyAckCallback(messageView, ackErr)
 	return nil
 }
 
+// wrapAckCallback makes callback report the final result of acknowledgement to the callback set by WithAckCallback.
+func (pc *defaultPushConsumer) wrapAckCallback(mv *MessageView, callback func(error)) func(error) {
+	if pc.pcOpts.ackCallback == nil {
+		return callback
+	}
+	return func(err error) {
+		pc.notifyAckCallback(mv, err)
+		callback(err)
+	}
+}
+
+func (pc *defaultPushConsumer) notifyAckCallback(mv *MessageView, err error) {
+	if pc.pcOpts.ackCallback == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			pc.cli.log.Errorf("ack callback panicked, messageId=%s, clientId=%s, panic=%v", mv.GetMessageId(), pc.cli.clientID, r)
+		}
+	}()
+	pc.pcOpts.ackCallback(mv.GetMessageId(), err)
+}
+
+// ManualAckToken identifies a message consumed in manual-ack mode, see WithManualAck.
+type ManualAckToken struct {
+	MessageId     string
+	ReceiptHandle string
+
+	messageView *MessageView
+}
+
+func newManualAckToken(mv *MessageView) *ManualAckToken {
+	return &ManualAckToken{
+		MessageId:     mv.GetMessageId(),
+		ReceiptHandle: mv.GetReceiptHandle(),
+		messageView:   mv,
+	}
+}
+
+func (pc *defaultPushConsumer) AckManually(ctx context.Context, token *ManualAckToken) error {
+	if token == nil || token.messageView == nil {
+		return fmt.Errorf("ackManually failed, err = the token is invalid")
+	}
+	messageView := token.messageView
+	messageCommons := []*MessageCommon{messageView.GetMessageCommon()}
+	pc.cli.doBefore(MessageHookPoints_ACK, messageCommons)
+
+	watchTime := time.Now()
+	resp, err := pc.ack0(ctx, messageView)
+	duration := time.Since(watchTime)
+	if err == nil && resp.GetStatus().GetCode() != v2.Code_OK {
+		err = &ErrRpcStatus{
+			Code:    int32(resp.GetStatus().GetCode()),
+			Message: resp.GetStatus().GetMessage(),
+		}
+	}
+	messageHookPointsStatus := MessageHookPointsStatus_OK
+	if err != nil {
+		messageHookPointsStatus = MessageHookPointsStatus_ERROR
+		pc.cli.log.Errorf("failed to ack message manually, messageId=%s, endpoints=%v, err=%v", messageView.GetMessageId(), messageView.endpoints, err)
+	}
+	pc.cli.doAfter(MessageHookPoints_ACK, messageCommons, duration, messageHookPointsStatus)
+	pc.notifyAckCallback(messageView, err)
+	return err
+}
+
 func (pc *defaultPushConsumer) ack0(ctx context.Context, messageView *MessageView) (*v2.AckMessageResponse, error) {
 	if !pc.isOn() {
 		return nil, fmt.Errorf("push consumer is not running")
 	}
+	if pc.ackedReceiptHandles.contains(messageView.GetReceiptHandle()) {
+		pc.cli.log.Debugf("Skip duplicate ack of message, messageId=%s", messageView.GetMessageId())
+		if pc.pcOpts.duplicateAckAsSuccess {
+			return &v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil
+		}
+		return nil, &ErrDuplicateAck{MessageID: messageView.GetMessageId()}
+	}
 	endpoints := messageView.endpoints
 	request := pc.wrapAckMessageRequest(messageView)
 	ctx = pc.cli.Sign(ctx)
-	return pc.cli.clientManager.AckMessage(ctx, endpoints, request, pc.cli.opts.timeout)
+	resp, err := pc.cli.clientManager.AckMessage(ctx, endpoints, request, pc.cli.opts.timeout)
+	if err == nil && resp.GetStatus().GetCode() == v2.Code_OK {
+		pc.ackedReceiptHandles.add(messageView.GetReceiptHandle())
+	}
+	return resp, err
 }
 
 func (pc *defaultPushConsumer) wrapForwardMessageToDeadLetterQueueRequest(messageView *MessageView) *v2.ForwardMessageToDeadLetterQueueRequest {
@@ -659,7 +1199,16 @@ func (pc *defaultPushConsumer) cacheMessageCountThresholdPerQueue() int32 {
 	if size <= 0 {
 		return 0
 	}
-	return int32(math.Max(1, float64(pc.pcOpts.maxCacheMessageCount)/float64(size)))
+	return int32(math.Max(1, float64(pc.maxCacheMessageCount())/float64(size)))
+}
+
+// maxCacheMessageCount returns the max count of messages cached by all process queues, which is the count of messages
+// being processed plus the prefetched ones if WithPrefetchCount is set.
+func (pc *defaultPushConsumer) maxCacheMessageCount() int32 {
+	if pc.pcOpts.prefetchCount > 0 {
+		return pc.pcOpts.consumptionThreadCount + pc.pcOpts.prefetchCount
+	}
+	return pc.pcOpts.maxCacheMessageCount
 }
 
 func (pc *defaultPushConsumer) cacheMessageBytesThresholdPerQueue() int64 {
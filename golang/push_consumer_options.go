@@ -18,7 +18,9 @@
 package golang
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 	"sync"
 	"time"
 
@@ -37,24 +39,145 @@ const (
 	 * Failed to consume message.
 	 */
 	FAILURE ConsumerResult = 1
+	/**
+	 * Failed to consume message and it would never succeed, forward it to the dead letter queue without retrying.
+	 */
+	TERMINATE ConsumerResult = 2
+)
+
+// DeadLetterFallback is the handling of messages which should be forwarded to the dead letter queue while the dead
+// letter queue topic of the consumer group does not exist, see WithDeadLetterFallback.
+type DeadLetterFallback int32
+
+const (
+	// DeadLetterFallback_RETRY keeps retrying to forward the message until the dead letter queue is provisioned, the
+	// message is left to be redelivered by brokers after FORWARD_MESSAGE_TO_DLQ_MAX_ATTEMPTS attempts.
+	DeadLetterFallback_RETRY DeadLetterFallback = iota
+	// DeadLetterFallback_DROP acks the message, which is counted by the dropped messages metric.
+	DeadLetterFallback_DROP
+	// DeadLetterFallback_CALLBACK hands over the message to the callback, and then drops it like DeadLetterFallback_DROP.
+	DeadLetterFallback_CALLBACK
+)
+
+// AssignmentStrategy is the way the consumer follows the message queues assigned by brokers, see WithAssignmentStrategy.
+type AssignmentStrategy int32
+
+const (
+	// AssignmentStrategy_DEFAULT follows the assignments of brokers as soon as they change.
+	AssignmentStrategy_DEFAULT AssignmentStrategy = iota
+	// AssignmentStrategy_STICKY delays dropping message queues the consumer already holds once they are missing from
+	// the assignments, by the grace period of WithAssignmentGracePeriod, so transient reshuffles during deploys do
+	// not move them.
+	AssignmentStrategy_STICKY
 )
 
 type MessageListener interface {
-	consume(*MessageView) ConsumerResult
+	consume(context.Context, *MessageView) ConsumerResult
+}
+
+// reportingMessageListener is implemented by listeners which report more than the result of consumption. The report
+// is set on the message by the caller, so that listeners abandoned by WithConsumeTimeout never write the message.
+type reportingMessageListener interface {
+	consumeAndReport(context.Context, *MessageView) (ConsumerResult, consumeReport)
+}
+
+// consumeReport is what a reportingMessageListener reports besides the result of consumption.
+type consumeReport struct {
+	// err is the error of consumption, see FuncErrorMessageListener.
+	err error
+	// retryAfter is the delay before redelivery, see FuncRetryAfterMessageListener.
+	retryAfter time.Duration
 }
 
+func (r consumeReport) applyTo(msg *MessageView) {
+	msg.consumeErr = r.err
+	msg.retryAfter = r.retryAfter
+}
+
+// FuncMessageListener adapts a listener which does not need the consumption context.
 type FuncMessageListener struct {
 	Consume func(*MessageView) ConsumerResult
 }
 
 // consume implements MessageListener
-func (l *FuncMessageListener) consume(msg *MessageView) ConsumerResult {
+func (l *FuncMessageListener) consume(_ context.Context, msg *MessageView) ConsumerResult {
 	return l.Consume(msg)
 }
 
 var _ = MessageListener(&FuncMessageListener{})
 
+// FuncContextMessageListener receives a context derived from the consumer's root context,
+// which is cancelled once the root context is cancelled or the consumer is stopped.
+type FuncContextMessageListener struct {
+	Consume func(ctx context.Context, msg *MessageView) ConsumerResult
+}
+
+// consume implements MessageListener
+func (l *FuncContextMessageListener) consume(ctx context.Context, msg *MessageView) ConsumerResult {
+	return l.Consume(ctx, msg)
+}
+
+var _ = MessageListener(&FuncContextMessageListener{})
+
+// MaxRetryAfter is the max delay before redelivery that brokers accept for changing the invisible duration.
+const MaxRetryAfter = 12 * time.Hour
+
+// FuncRetryAfterMessageListener lets the listener decide how long to wait before a failed message is redelivered,
+// instead of the backoff of retry policy, e.g. for a rate limited downstream. The delay is ignored unless the
+// result is FAILURE, a non-positive delay falls back to the retry policy and a delay beyond MaxRetryAfter is
+// truncated to it.
+type FuncRetryAfterMessageListener struct {
+	Consume func(ctx context.Context, msg *MessageView) (result ConsumerResult, retryAfter time.Duration)
+}
+
+// consume implements MessageListener
+func (l *FuncRetryAfterMessageListener) consume(ctx context.Context, msg *MessageView) ConsumerResult {
+	result, report := l.consumeAndReport(ctx, msg)
+	report.applyTo(msg)
+	return result
+}
+
+// consumeAndReport implements reportingMessageListener
+func (l *FuncRetryAfterMessageListener) consumeAndReport(ctx context.Context, msg *MessageView) (ConsumerResult, consumeReport) {
+	result, retryAfter := l.Consume(ctx, msg)
+	if result != FAILURE || retryAfter <= 0 {
+		retryAfter = 0
+	}
+	if retryAfter > MaxRetryAfter {
+		sugarBaseLogger.Warnf("Delay before redelivery exceeds the limit of brokers, truncate it, messageId=%s, retryAfter=%v, max=%v",
+			msg.GetMessageId(), retryAfter, MaxRetryAfter)
+		retryAfter = MaxRetryAfter
+	}
+	return result, consumeReport{retryAfter: retryAfter}
+}
+
+var _ = MessageListener(&FuncRetryAfterMessageListener{})
+
+// FuncErrorMessageListener reports the failure of consumption by a non-nil error, which is passed to the predicate
+// of WithDeadLetterPredicate. The message is consumed successfully if the error is nil.
+type FuncErrorMessageListener struct {
+	Consume func(ctx context.Context, msg *MessageView) error
+}
+
+// consume implements MessageListener
+func (l *FuncErrorMessageListener) consume(ctx context.Context, msg *MessageView) ConsumerResult {
+	result, report := l.consumeAndReport(ctx, msg)
+	report.applyTo(msg)
+	return result
+}
+
+// consumeAndReport implements reportingMessageListener
+func (l *FuncErrorMessageListener) consumeAndReport(ctx context.Context, msg *MessageView) (ConsumerResult, consumeReport) {
+	if err := l.Consume(ctx, msg); err != nil {
+		return FAILURE, consumeReport{err: err}
+	}
+	return SUCCESS, consumeReport{}
+}
+
+var _ = MessageListener(&FuncErrorMessageListener{})
+
 type pushConsumerOptions struct {
+	ctx                             context.Context
 	subscriptionExpressions         *sync.Map
 	awaitDuration                   time.Duration
 	maxCacheMessageCount            int32
@@ -63,14 +186,42 @@ type pushConsumerOptions struct {
 	messageListener                 MessageListener
 	clientFunc                      NewClientFunc
 	enableFifoConsumeAccelerator    bool
+	messageExpiryProperty           string
+	deliverExpiredMessages          bool
+	skipOlderThan                   time.Duration
+	keyExtractor                    func(*MessageView) string
+	dedupByKey                      bool
+	manualAck                       bool
+	staticQueueAssignments          map[string][]int
+	maxInFlightBytes                int64
+	ackedReceiptHandleCapacity      int
+	duplicateAckAsSuccess           bool
+	brokerNameFilter                *regexp.Regexp
+	ackCallback                     func(msgId string, err error)
+	consumeRateLimit                int
+	consumeRateBurst                int
+	deadLetterPredicate             func(msg *MessageView, attempt int, err error) bool
+	orderedRetry                    bool
+	offsetStore                     OffsetStore
+	maxAssignedQueues               int
+	consumeTimeout                  time.Duration
+	prefetchCount                   int32
+	deadLetterFallback              DeadLetterFallback
+	onDeadLetterFallback            func(msg *MessageView)
+	decryptor                       Decryptor
+	maxReceiveConcurrency           int
+	assignmentStrategy              AssignmentStrategy
+	assignmentGracePeriod           time.Duration
 }
 
 var defaultPushConsumerOptions = pushConsumerOptions{
+	ctx:                           context.Background(),
 	clientFunc:                    NewClient,
 	awaitDuration:                 0,
 	maxCacheMessageCount:          1024,
 	maxCacheMessageSizeInBytes:    64 * 1024 * 1024,
 	consumptionThreadCount:        20,
+	assignmentGracePeriod:         15 * time.Second,
 	enableFifoConsumeAccelerator:   false,
 }
 
@@ -126,6 +277,20 @@ func WithPushMaxCacheMessageCount(maxCacheMessageCount int32) PushConsumerOption
 	})
 }
 
+// WithPrefetchCount sets the count of messages received ahead of processing, which wait in the cache while the
+// consumption threads are busy, so that the threads are fed without waiting for receptions. The cache of consumer
+// holds the messages being processed plus the prefetched ones, which overrides WithPushMaxCacheMessageCount, so the
+// depth of prefetch is tuned independently of WithPushConsumptionThreadCount. The time messages wait in the cache
+// is measured by the await time metric. Default is 0, which caches by WithPushMaxCacheMessageCount.
+func WithPrefetchCount(n int32) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.prefetchCount = n
+	})
+}
+
+// WithPushConsumptionThreadCount sets the number of goroutines dispatching messages to the listener. Messages waiting
+// for them are queued up to WithPushMaxCacheMessageCount, beyond which the dispatch blocks rather than starting more
+// goroutines.
 func WithPushConsumptionThreadCount(consumptionThreadCount int32) PushConsumerOption {
 	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
 		o.consumptionThreadCount = consumptionThreadCount
@@ -138,6 +303,222 @@ func WithPushMessageListener(messageListener MessageListener) PushConsumerOption
 	})
 }
 
+// WithPushConsumerContext sets the root context of the consumer, which message listeners derive their context from.
+// Default is context.Background().
+func WithPushConsumerContext(ctx context.Context) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.ctx = ctx
+	})
+}
+
+// WithMessageExpiryProperty sets the message property which holds the expiry timestamp in milliseconds.
+// Expired messages are acknowledged without being consumed, unless WithDeliverExpiredMessages is set.
+func WithMessageExpiryProperty(key string) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.messageExpiryProperty = key
+	})
+}
+
+// WithDeliverExpiredMessages sets whether expired messages are still delivered to the listener,
+// which could tell them by MessageView.IsExpired.
+func WithDeliverExpiredMessages(deliverExpiredMessages bool) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.deliverExpiredMessages = deliverExpiredMessages
+	})
+}
+
+// WithSkipMessagesOlderThan acknowledges messages stored earlier than d ago without consuming them,
+// e.g. to catch up with the latest messages after a long downtime. The age is measured by the clock of brokers if
+// WithClockSkewCorrection of the meter is enabled. Non-positive d disables it.
+func WithSkipMessagesOlderThan(d time.Duration) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.skipOlderThan = d
+	})
+}
+
+// WithKeyExtractor sets the function which extracts the key of a message, used by WithDedupByKey.
+// Messages with an empty key are never deduplicated.
+func WithKeyExtractor(keyExtractor func(*MessageView) string) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.keyExtractor = keyExtractor
+	})
+}
+
+// WithDedupByKey sets whether only the latest message per key within a received batch is delivered to the listener,
+// which suits consumers replaying state topics. The superseded messages are acknowledged without being consumed.
+// It takes effect only if WithKeyExtractor is set.
+func WithDedupByKey(dedupByKey bool) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.dedupByKey = dedupByKey
+	})
+}
+
+// WithManualAck sets whether successfully consumed messages are left unacknowledged, they should be acknowledged
+// by PushConsumer.AckManually with the token of MessageView.GetManualAckToken instead.
+// The message would be redelivered if it is not acknowledged before its invisible duration expires, and the
+// consumer could no longer tell it is being processed, so ack it in time. Fifo messages are always acknowledged
+// automatically to keep their order.
+func WithManualAck(manualAck bool) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.manualAck = manualAck
+	})
+}
+
+// WithStaticQueueAssignment sets the ids of message queues of topic owned by the consumer, which receives from
+// these queues only instead of the queues assigned by brokers, e.g. for stateful consumers pinned to queues.
+// Queues are picked from the route of topic, so the ids should be kept in the range of its readable queues.
+// The consumer is still a member of the group, brokers may assign the same queues to other consumers which
+// are not statically assigned, so use different groups for them.
+func WithStaticQueueAssignment(topic string, queueIds []int) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		if o.staticQueueAssignments == nil {
+			o.staticQueueAssignments = make(map[string][]int)
+		}
+		o.staticQueueAssignments[topic] = queueIds
+	})
+}
+
+// WithMaxInFlightBytes sets the budget of the total body size of messages cached by the consumer across all
+// queues. Receiving is paused once the budget is exceeded, and resumed as messages are acknowledged or nacked.
+// Unlike WithPushMaxCacheMessageSizeInBytes, which is divided among queues, the budget is shared, so a few
+// huge messages in one queue would pause the others.
+// Default is 0, which means no budget.
+func WithMaxInFlightBytes(maxInFlightBytes int64) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.maxInFlightBytes = maxInFlightBytes
+	})
+}
+
+// WithPushDuplicateAckGuard sets the count of receipt handles acknowledged recently which are remembered, a repeated
+// ack of them is not sent to brokers but returns ErrDuplicateAck, or nil if duplicateAckAsSuccess is true.
+// Default is 0, which remembers nothing.
+func WithPushDuplicateAckGuard(capacity int, duplicateAckAsSuccess bool) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.ackedReceiptHandleCapacity = capacity
+		o.duplicateAckAsSuccess = duplicateAckAsSuccess
+	})
+}
+
+// WithBrokerNameFilter sets the pattern of names of brokers whose message queues are consumed, message queues of
+// other brokers are ignored even if they are assigned to the consumer, e.g. for tests of data locality.
+// Brokers still assign the ignored queues to the consumer, so they are left unconsumed unless they are assigned to
+// other consumers, which is only helpful with queues statically assigned by WithStaticQueueAssignment or consumers
+// of other groups.
+func WithBrokerNameFilter(pattern *regexp.Regexp) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.brokerNameFilter = pattern
+	})
+}
+
+// WithMaxAssignedQueues sets the max count of message queues across all topics held by the consumer, queues assigned
+// beyond it are declined. Default is 0, which means no cap.
+func WithMaxAssignedQueues(n int) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.maxAssignedQueues = n
+	})
+}
+
+// WithAssignmentStrategy sets the way the consumer follows the message queues assigned by brokers during rebalance.
+// Default is AssignmentStrategy_DEFAULT.
+func WithAssignmentStrategy(strategy AssignmentStrategy) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.assignmentStrategy = strategy
+	})
+}
+
+// WithAssignmentGracePeriod sets how long AssignmentStrategy_STICKY keeps a held queue after it is missing from the
+// assignments. Default is 15 seconds.
+func WithAssignmentGracePeriod(d time.Duration) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.assignmentGracePeriod = d
+	})
+}
+
+// WithAckCallback sets the callback which is invoked once the broker finally confirms or rejects the ack of a message,
+// including the nack of failed messages and the forwarding of terminated messages to the dead letter queue.
+// err is nil if the broker accepts it, requests failed transiently are retried and not reported to the callback.
+func WithAckCallback(f func(msgId string, err error)) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.ackCallback = f
+	})
+}
+
+// WithConsumeRateLimit sets the rate of dispatching messages to the listener to rps messages per second, allowing
+// bursts of up to burst messages. Received messages wait in the cache until they are allowed by the limit, and the
+// wait is counted in the await time of messages. Default is 0, which is unlimited.
+func WithConsumeRateLimit(rps int, burst int) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.consumeRateLimit = rps
+		o.consumeRateBurst = burst
+	})
+}
+
+// WithDeadLetterPredicate sets the function consulted once the consumption of a message fails. Returning true
+// forwards the message to the dead letter queue at once, e.g. for validation errors, and false retries it by the
+// retry policy until the max attempts run out. attempt is the delivery attempt of the message starting from 1, and
+// err is the error returned by FuncErrorMessageListener or the panic of listener, nil for other listeners.
+func WithDeadLetterPredicate(f func(msg *MessageView, attempt int, err error) bool) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.deadLetterPredicate = f
+	})
+}
+
+// WithDeadLetterFallback sets the handling of messages which run out of attempts, or are terminated, while the dead
+// letter queue topic of the consumer group is missing. callback is invoked with such messages before they are dropped
+// if fallback is DeadLetterFallback_CALLBACK, and ignored otherwise. Default is DeadLetterFallback_RETRY.
+func WithDeadLetterFallback(fallback DeadLetterFallback, callback func(msg *MessageView)) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.deadLetterFallback = fallback
+		o.onDeadLetterFallback = callback
+	})
+}
+
+// WithDecryptor sets the Decryptor of messages encrypted by the Encryptor of producers, which is applied after the
+// body is decoded. Messages failed to be decrypted are handled like corrupted ones. Messages without
+// EncryptionKeyIdProperty are delivered as they are.
+func WithDecryptor(decryptor Decryptor) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.decryptor = decryptor
+	})
+}
+
+// WithPushMaxReceiveConcurrency limits the number of receive requests in flight across all message queues, the
+// reception of other queues waits for a free slot once the limit is reached. Messages are decoded by the goroutine
+// of their receive request, so that decoding is limited too. Default is 0, which means no limit, that is at most one
+// request for each assigned queue.
+func WithPushMaxReceiveConcurrency(n int) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.maxReceiveConcurrency = n
+	})
+}
+
+// WithConsumeTimeout sets the max time of consuming a message, after which the message fails with ErrConsumeTimeout
+// and the context of listener is cancelled. Default is 0, which means no timeout.
+func WithConsumeTimeout(timeout time.Duration) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.consumeTimeout = timeout
+	})
+}
+
+// WithOrderedRetry sets whether a failed message of FIFO consumer groups is redelivered before any following message
+// of its queue, or of its message group if WithPushEnableFifoConsumeAccelerator is enabled, so that the order holds
+// through retries. The following messages wait until the failed one succeeds or is forwarded to the dead letter queue,
+// which blocks the queue for up to the max attempts of retry policy, use WithDeadLetterPredicate to give up poison
+// messages early. It is ignored by normal consumer groups. Default is false.
+func WithOrderedRetry(enabled bool) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.orderedRetry = enabled
+	})
+}
+
+// WithOffsetStore sets the store of consume offsets which Seek, SeekToTimestamp and CommittedOffsets go through,
+// e.g. NewMemoryOffsetStore for tests without a broker. Default is nil, which keeps offsets on the server.
+func WithOffsetStore(store OffsetStore) PushConsumerOption {
+	return newFuncPushConsumerOption(func(o *pushConsumerOptions) {
+		o.offsetStore = store
+	})
+}
+
 // WithPushEnableFifoConsumeAccelerator sets enable fifo consume accelerator.
 // If enabled, the consumer will consume messages in parallel by messageGroup,
 func WithPushEnableFifoConsumeAccelerator(enableFifoConsumeAccelerator bool) PushConsumerOption {
@@ -18,10 +18,24 @@
 package golang
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/apache/rocketmq-clients/golang/v5/pkg/utils"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/prashantv/gostub"
+	"go.opencensus.io/stats/view"
+	"go.uber.org/atomic"
 )
 
 func TestDefaultPushConsumer_WrapReceiveMessageRequest(t *testing.T) {
@@ -233,3 +247,1406 @@ func TestDefaultLitePushConsumer_Wraps(t *testing.T) {
 		t.Errorf("expected client type LITE_PUSH_CONSUMER, got %v", hb.GetClientType())
 	}
 }
+
+func TestConsumeTask_ListenerContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var listenerErr error
+	listener := &FuncContextMessageListener{Consume: func(ctx context.Context, mv *MessageView) ConsumerResult {
+		listenerErr = ctx.Err()
+		return SUCCESS
+	}}
+	bcs := NewBaseConsumeService("test-client", listener, nil, NewDefultInflightRequestCountInterceptor())
+	bcs.ctx = ctx
+	mv := &MessageView{messageId: "msg-123", topic: "test-topic"}
+
+	var result ConsumerResult
+	bcs.newConsumeTask(bcs.clientId, listener, mv, bcs.messageInterceptor, func(r ConsumerResult, err error) { result = r })()
+	if result != SUCCESS || listenerErr != nil {
+		t.Errorf("expected SUCCESS with live context, got result=%v, err=%v", result, listenerErr)
+	}
+
+	cancel()
+	bcs.newConsumeTask(bcs.clientId, listener, mv, bcs.messageInterceptor, func(r ConsumerResult, err error) { result = r })()
+	if listenerErr != context.Canceled {
+		t.Errorf("expected listener context to be cancelled, got %v", listenerErr)
+	}
+}
+
+func TestConsumeTask_RateLimit(t *testing.T) {
+	consumed := 0
+	listener := &FuncMessageListener{Consume: func(*MessageView) ConsumerResult {
+		consumed++
+		return SUCCESS
+	}}
+	bcs := NewBaseConsumeService("test-client", listener, nil, NewDefultInflightRequestCountInterceptor())
+	bcs.consumeRateLimiter = newTokenBucket(20, 1, false)
+	mv := &MessageView{messageId: "msg-123", topic: "test-topic"}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		bcs.newConsumeTask(bcs.clientId, listener, mv, bcs.messageInterceptor, func(ConsumerResult, error) {})()
+	}
+	if consumed != 3 {
+		t.Errorf("expected 3 messages consumed, got %d", consumed)
+	}
+	// The first message is allowed by the burst, the others wait for 50ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected consumption to be paced, elapsed=%v", elapsed)
+	}
+}
+
+func TestDefaultProcessQueue_skipExpiredMessages(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithMessageExpiryProperty("expiry"),
+		WithDeliverExpiredMessages(true),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).UnixMilli(), 10)
+	future := strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10)
+	mvs := []*MessageView{
+		{messageId: "expired", topic: "test-topic", properties: map[string]string{"expiry": past}},
+		{messageId: "fresh", topic: "test-topic", properties: map[string]string{"expiry": future}},
+		{messageId: "no-expiry", topic: "test-topic"},
+		{messageId: "malformed", topic: "test-topic", properties: map[string]string{"expiry": "x"}},
+	}
+	remaining := dpq.skipExpiredMessages(mvs)
+	if len(remaining) != 4 {
+		t.Fatalf("expected all messages to be delivered, got %d", len(remaining))
+	}
+	for _, mv := range remaining {
+		if mv.IsExpired() != (mv.GetMessageId() == "expired") {
+			t.Errorf("unexpected expiry decision for message %s, expired=%v", mv.GetMessageId(), mv.IsExpired())
+		}
+	}
+	if pc.expiredMessagesQuantity.Load() != 1 {
+		t.Errorf("expected 1 expired message, got %d", pc.expiredMessagesQuantity.Load())
+	}
+}
+
+func TestDefaultProcessQueue_skipSupersededMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithKeyExtractor(func(mv *MessageView) string { return mv.GetProperties()["key"] }),
+		WithDedupByKey(true),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	mvs := []*MessageView{
+		{messageId: "a1", topic: "test-topic", body: []byte("1"), endpoints: fakeEndpoints(), properties: map[string]string{"key": "a"}},
+		{messageId: "b1", topic: "test-topic", body: []byte("1"), endpoints: fakeEndpoints(), properties: map[string]string{"key": "b"}},
+		{messageId: "no-key", topic: "test-topic", body: []byte("1"), endpoints: fakeEndpoints()},
+		{messageId: "a2", topic: "test-topic", body: []byte("1"), endpoints: fakeEndpoints(), properties: map[string]string{"key": "a"}},
+	}
+	dpq.cacheMessages(mvs)
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil).Times(1)
+
+	remaining := dpq.skipSupersededMessages(mvs)
+	var ids []string
+	for _, mv := range remaining {
+		ids = append(ids, mv.GetMessageId())
+	}
+	if strings.Join(ids, ",") != "b1,no-key,a2" {
+		t.Errorf("unexpected remaining messages: %v", ids)
+	}
+	if dpq.cachedMessagesNums.Load() != 3 {
+		t.Errorf("expected superseded message to be evicted from cache, cached=%d", dpq.cachedMessagesNums.Load())
+	}
+}
+
+func TestDefaultProcessQueue_skipStaleMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithSkipMessagesOlderThan(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+	fc := &fakeClock{now: time.Unix(1700000000, 0)}
+	stubs := gostub.Stub(&defaultClock, clock(fc))
+	defer stubs.Reset()
+	// The client is 30 minutes ahead of brokers.
+	dcmp := pc.cli.clientMeterProvider.(*defaultClientMeterProvider)
+	dcmp.opts.clockSkewCorrected = true
+	dcmp.messageMeterInterceptor.clockSkew.Store(int64(30 * time.Minute))
+
+	stale := fc.now.Add(-2 * time.Hour)
+	fresh := fc.now.Add(-70 * time.Minute)
+	mvs := []*MessageView{
+		{messageId: "stale", topic: "test-topic", body: []byte("1"), endpoints: fakeEndpoints(), storeTimestamp: &stale},
+		{messageId: "fresh", topic: "test-topic", body: []byte("1"), endpoints: fakeEndpoints(), storeTimestamp: &fresh},
+		{messageId: "no-timestamp", topic: "test-topic", body: []byte("1"), endpoints: fakeEndpoints()},
+	}
+	dpq.cacheMessages(mvs)
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil).Times(1)
+
+	remaining := dpq.skipStaleMessages(mvs)
+	var ids []string
+	for _, mv := range remaining {
+		ids = append(ids, mv.GetMessageId())
+	}
+	if strings.Join(ids, ",") != "fresh,no-timestamp" {
+		t.Errorf("unexpected remaining messages: %v", ids)
+	}
+	if pc.skippedMessagesQuantity.Load() != 1 {
+		t.Errorf("expected 1 skipped message, got %d", pc.skippedMessagesQuantity.Load())
+	}
+	if dpq.cachedMessagesNums.Load() != 2 {
+		t.Errorf("expected stale message to be evicted from cache, cached=%d", dpq.cachedMessagesNums.Load())
+	}
+}
+
+func TestDefaultPushConsumer_AckManually(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithManualAck(true),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	mv := &MessageView{messageId: "manual", topic: "test-topic", body: []byte("body"), endpoints: fakeEndpoints(), ReceiptHandle: "receipt-123"}
+	mv.manualAckToken = newManualAckToken(mv)
+	dpq.cacheMessages([]*MessageView{mv})
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	dpq.eraseMessage(mv, SUCCESS)
+	if dpq.cachedMessagesNums.Load() != 0 {
+		t.Error("expected consumed message to be evicted from cache")
+	}
+	ctrl.Finish()
+
+	ctrl = gomock.NewController(t)
+	cm = NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	token := mv.GetManualAckToken()
+	if token.ReceiptHandle != "receipt-123" {
+		t.Errorf("expected receipt handle 'receipt-123', got %s", token.ReceiptHandle)
+	}
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_INVALID_RECEIPT_HANDLE}}, nil)
+	if err := pc.AckManually(context.TODO(), token); err == nil {
+		t.Error("expected error for invalid receipt handle")
+	}
+	if err := pc.AckManually(context.TODO(), nil); err == nil {
+		t.Error("expected error for nil token")
+	}
+	ctrl.Finish()
+}
+
+func TestDefaultPushConsumer_WaitForAssignment(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := pc.WaitForAssignment(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded without assignment, got %v", err)
+	}
+
+	pc.processQueueTable.Store(utils.MessageQueueStr("test-mq"), []interface{}{&v2.MessageQueue{}, &defaultProcessQueue{}})
+	if err := pc.WaitForAssignment(context.Background()); err != nil {
+		t.Errorf("expected to return promptly once assigned, got %v", err)
+	}
+}
+
+func TestDefaultPushConsumer_queryStaticAssignments(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithStaticQueueAssignment("test-topic", []int{1, 2}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	pc.cli.router.Store("test-topic", []*v2.MessageQueue{
+		{Id: 0, Permission: v2.Permission_READ_WRITE},
+		{Id: 1, Permission: v2.Permission_READ_WRITE},
+		{Id: 2, Permission: v2.Permission_WRITE},
+	})
+
+	assignments, err := pc.queryStaticAssignments(context.TODO(), "test-topic", pc.pcOpts.staticQueueAssignments["test-topic"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*assignments) != 1 || (*assignments)[0].GetMessageQueue().GetId() != 1 {
+		t.Errorf("expected only the readable owned queue to be assigned, got %v", *assignments)
+	}
+}
+
+func TestDefaultPushConsumer_SeekToTimestamp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+
+	// The queue is not assigned, so it is resolved from the route.
+	pc.cli.router.Store("test-topic", []*v2.MessageQueue{{
+		Topic:  &v2.Resource{Name: "test-topic", ResourceNamespace: "test-namespace"},
+		Id:     1,
+		Broker: &v2.Broker{Name: "test-broker", Endpoints: fakeEndpoints()},
+	}})
+	messageQueue := &MessageQueue{Topic: "test-topic", BrokerName: "test-broker", QueueId: 1}
+	timestamp := time.Now().Add(-time.Hour)
+	cm.EXPECT().QueryOffset(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *v2.Endpoints, req *v2.QueryOffsetRequest, _ time.Duration) (*v2.QueryOffsetResponse, error) {
+			if req.GetQueryOffsetPolicy() != v2.QueryOffsetPolicy_TIMESTAMP || !req.GetTimestamp().AsTime().Equal(timestamp) {
+				t.Errorf("unexpected query offset request %v", req)
+			}
+			return &v2.QueryOffsetResponse{Status: &v2.Status{Code: v2.Code_OK}, Offset: 42}, nil
+		})
+	cm.EXPECT().UpdateOffset(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *v2.Endpoints, req *v2.UpdateOffsetRequest, _ time.Duration) (*v2.UpdateOffsetResponse, error) {
+			if req.GetOffset() != 42 || req.GetGroup().GetName() != "test-group" || req.GetMessageQueue().GetId() != 1 {
+				t.Errorf("unexpected update offset request %v", req)
+			}
+			return &v2.UpdateOffsetResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil
+		})
+	if err := pc.SeekToTimestamp(context.TODO(), messageQueue, timestamp); err != nil {
+		t.Error(err)
+	}
+
+	cm.EXPECT().UpdateOffset(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.UpdateOffsetResponse{Status: &v2.Status{Code: v2.Code_BAD_REQUEST, Message: "illegal offset"}}, nil)
+	if err := pc.Seek(context.TODO(), messageQueue, -1); err == nil {
+		t.Error("expected error for non-OK status")
+	}
+	if err := pc.Seek(context.TODO(), &MessageQueue{Topic: "test-topic", BrokerName: "test-broker", QueueId: 2}, 0); err == nil {
+		t.Error("expected error for the queue missing from the route")
+	}
+}
+
+func TestDefaultPushConsumer_CommittedOffsets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+
+	messageQueue := &v2.MessageQueue{
+		Topic:  &v2.Resource{Name: "test-topic", ResourceNamespace: "test-namespace"},
+		Id:     1,
+		Broker: &v2.Broker{Name: "test-broker", Endpoints: fakeEndpoints()},
+	}
+	pc.createProcessQueue(utils.ParseMessageQueue2Str(messageQueue), messageQueue, NewFilterExpression("*"))
+	cm.EXPECT().GetOffset(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *v2.Endpoints, req *v2.GetOffsetRequest, _ time.Duration) (*v2.GetOffsetResponse, error) {
+			if req.GetGroup().GetName() != "test-group" || req.GetMessageQueue().GetId() != 1 {
+				t.Errorf("unexpected get offset request %v", req)
+			}
+			return &v2.GetOffsetResponse{Status: &v2.Status{Code: v2.Code_OK}, Offset: 42}, nil
+		})
+	offsets, err := pc.CommittedOffsets(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[MessageQueue]int64{{Topic: "test-topic", BrokerName: "test-broker", QueueId: 1}: 42}
+	if !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+
+	cm.EXPECT().GetOffset(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.GetOffsetResponse{Status: &v2.Status{Code: v2.Code_NOT_FOUND, Message: "offset not found"}}, nil)
+	if _, err := pc.CommittedOffsets(context.TODO()); err == nil {
+		t.Error("expected error for non-OK status")
+	}
+}
+
+func TestDefaultPushConsumer_QueryAssignment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+
+	cm.EXPECT().QueryAssignments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *v2.Endpoints, req *v2.QueryAssignmentRequest, _ time.Duration) (*v2.QueryAssignmentResponse, error) {
+			if req.GetGroup().GetName() != "test-group" || req.GetTopic().GetName() != "test-topic" {
+				t.Errorf("unexpected query assignment request %v", req)
+			}
+			return &v2.QueryAssignmentResponse{
+				Status: &v2.Status{Code: v2.Code_OK},
+				Assignments: []*v2.Assignment{{MessageQueue: &v2.MessageQueue{
+					Topic:  &v2.Resource{Name: "test-topic", ResourceNamespace: "test-namespace"},
+					Id:     1,
+					Broker: &v2.Broker{Name: "test-broker", Endpoints: fakeEndpoints()},
+				}}},
+			}, nil
+		})
+	messageQueues, err := pc.QueryAssignment(context.TODO(), "test-topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []MessageQueue{{Topic: "test-topic", BrokerName: "test-broker", QueueId: 1}}
+	if !reflect.DeepEqual(messageQueues, expected) {
+		t.Errorf("expected assignments %v, got %v", expected, messageQueues)
+	}
+
+	cm.EXPECT().QueryAssignments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.QueryAssignmentResponse{Status: &v2.Status{Code: v2.Code_FORBIDDEN, Message: "no permission"}}, nil)
+	var rpcErr *ErrRpcStatus
+	if _, err := pc.QueryAssignment(context.TODO(), "test-topic"); !errors.As(err, &rpcErr) {
+		t.Errorf("expected ErrRpcStatus for non-OK status, got %v", err)
+	}
+}
+
+func TestDefaultPushConsumer_MemoryOffsetStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	store := NewMemoryOffsetStore(1)
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithOffsetStore(store),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	// no rpc is expected.
+	pc.cli.clientManager = NewMockClientManager(ctrl)
+
+	assigned := &v2.MessageQueue{
+		Topic:  &v2.Resource{Name: "test-topic", ResourceNamespace: "test-namespace"},
+		Id:     1,
+		Broker: &v2.Broker{Name: "test-broker", Endpoints: fakeEndpoints()},
+	}
+	pc.createProcessQueue(utils.ParseMessageQueue2Str(assigned), assigned, NewFilterExpression("*"))
+	if _, err := pc.CommittedOffsets(context.TODO()); err == nil {
+		t.Error("expected error for uncommitted offset")
+	}
+	messageQueue := &MessageQueue{Topic: "test-topic", BrokerName: "test-broker", QueueId: 1}
+
+	now := time.Now()
+	store.IndexTimestamp(messageQueue, 10, now.Add(-time.Hour))
+	store.IndexTimestamp(messageQueue, 11, now)
+	if err := pc.SeekToTimestamp(context.TODO(), messageQueue, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	offsets, err := pc.CommittedOffsets(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[MessageQueue]int64{{Topic: "test-topic", BrokerName: "test-broker", QueueId: 1}: 11}
+	if !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets %v, got %v", expected, offsets)
+	}
+	if err := pc.SeekToTimestamp(context.TODO(), messageQueue, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if offset, _ := store.GetOffset(context.TODO(), messageQueue); offset != 12 {
+		t.Errorf("expected seeking past the last message to offset 12, got %d", offset)
+	}
+	if err := pc.Seek(context.TODO(), messageQueue, -1); err == nil {
+		t.Error("expected error for illegal offset")
+	}
+
+	// the least recently used queue is forgotten beyond capacity.
+	otherQueue := &MessageQueue{Topic: "test-topic", BrokerName: "test-broker", QueueId: 2}
+	if err := pc.Seek(context.TODO(), otherQueue, 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetOffset(context.TODO(), messageQueue); err == nil {
+		t.Error("expected the offset of evicted queue to be forgotten")
+	}
+}
+
+func TestDefaultProcessQueue_eraseMessage_terminate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return TERMINATE }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	mv := &MessageView{messageId: "poison", topic: "test-topic", body: []byte("body"), endpoints: fakeEndpoints()}
+	dpq.cachedMessagesNums.Store(1)
+	dpq.cachedMessagesBytes.Store(int64(len(mv.body)))
+	cm.EXPECT().ForwardMessageToDeadLetterQueue(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.ForwardMessageToDeadLetterQueueResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil)
+	cm.EXPECT().ChangeInvisibleDuration(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	dpq.eraseMessage(mv, TERMINATE)
+	if dpq.cachedMessagesNums.Load() != 0 || dpq.cachedMessagesBytes.Load() != 0 {
+		t.Error("expected terminated message to be evicted from cache")
+	}
+	if pc.consumptionErrorQuantity.Load() != 1 {
+		t.Errorf("expected 1 consumption error, got %d", pc.consumptionErrorQuantity.Load())
+	}
+}
+
+func TestDefaultProcessQueue_deadLetterFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	var handed []string
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return TERMINATE }}),
+		WithDeadLetterFallback(DeadLetterFallback_CALLBACK, func(mv *MessageView) { handed = append(handed, mv.GetMessageId()) }),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	mv := &MessageView{messageId: "poison", topic: "test-topic", body: []byte("body"), endpoints: fakeEndpoints()}
+	dpq.cachedMessagesNums.Store(1)
+	dpq.cachedMessagesBytes.Store(int64(len(mv.body)))
+	cm.EXPECT().ForwardMessageToDeadLetterQueue(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.ForwardMessageToDeadLetterQueueResponse{Status: &v2.Status{Code: v2.Code_TOPIC_NOT_FOUND}}, nil).Times(1)
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil).Times(1)
+
+	dpq.eraseMessage(mv, TERMINATE)
+	if len(handed) != 1 || handed[0] != "poison" {
+		t.Errorf("expected the message to be handed over to the fallback, got %v", handed)
+	}
+	if pc.droppedMessagesQuantity.Load() != 1 {
+		t.Errorf("expected 1 dropped message, got %d", pc.droppedMessagesQuantity.Load())
+	}
+	if dpq.cachedMessagesNums.Load() != 0 {
+		t.Error("expected dropped message to be evicted from cache")
+	}
+}
+
+func TestDefaultProcessQueue_forwardToDeadLetterQueueMaxAttempts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return TERMINATE }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	// The last attempt fails without scheduling another one.
+	cm.EXPECT().ForwardMessageToDeadLetterQueue(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.ForwardMessageToDeadLetterQueueResponse{Status: &v2.Status{Code: v2.Code_INTERNAL_SERVER_ERROR}}, nil).Times(1)
+	var results []error
+	mv := &MessageView{messageId: "poison", topic: "test-topic", endpoints: fakeEndpoints()}
+	dpq.forwardToDeadLetterQueue0(mv, FORWARD_MESSAGE_TO_DLQ_MAX_ATTEMPTS, func(err error) { results = append(results, err) })
+	var rpcErr *ErrRpcStatus
+	if len(results) != 1 || !errors.As(results[0], &rpcErr) || rpcErr.GetCode() != int32(v2.Code_INTERNAL_SERVER_ERROR) {
+		t.Errorf("expected forwarding to give up with ErrRpcStatus, got %v", results)
+	}
+}
+
+func TestDefaultProcessQueue_ackMaxAttempts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+	mv := &MessageView{messageId: "unacked", topic: "test-topic", endpoints: fakeEndpoints()}
+
+	// The last attempts fail without scheduling another one, for transport errors as well.
+	transportErr := errors.New("connection reset")
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, transportErr).Times(1)
+	cm.EXPECT().ChangeInvisibleDuration(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, transportErr).Times(1)
+	var results []error
+	dpq.ackMessage0(mv, ACK_MESSAGE_MAX_ATTEMPTS, func(err error) { results = append(results, err) })
+	dpq.changeInvisibleDuration(mv, time.Second, CHANGE_INVISIBLE_DURATION_MAX_ATTEMPTS, func(err error) { results = append(results, err) })
+	if len(results) != 2 || !errors.Is(results[0], transportErr) || !errors.Is(results[1], transportErr) {
+		t.Errorf("expected acking and nacking to give up with the error, got %v", results)
+	}
+}
+
+func TestDefaultProcessQueue_receiveWaitsForFreeSlotAsync(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithPushMaxReceiveConcurrency(1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	pc.cli.on.Store(true)
+	if err := pc.receiveRateLimiter.acquire(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	mq := &v2.MessageQueue{Topic: &v2.Resource{Name: "test-topic"}, Broker: &v2.Broker{Name: "broker-a", Endpoints: fakeEndpoints()}}
+	dpq := newDefaultProcessQueue(pc, utils.ParseMessageQueue2Str(mq), mq, NewFilterExpression("*"))
+
+	running := pc.cli.goroutines.Load()
+	returned := make(chan struct{})
+	go func() {
+		dpq.receiveMessageImmediately()
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the caller not to wait for a free slot of receive requests")
+	}
+	if waiting := pc.cli.goroutines.Load() - running; waiting != 1 {
+		t.Errorf("expected the request to wait for a free slot in its goroutine, got %d goroutine(s)", waiting)
+	}
+	// The waiting request gives up once the consumer is shutting down.
+	pc.cancel()
+	for deadline := time.Now().Add(5 * time.Second); pc.cli.goroutines.Load() > running; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the waiting request to give up")
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestDefaultProcessQueue_eraseMessage_nackedMetric(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "nack-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return FAILURE }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	pc.cli.clientMeterProvider.(*defaultClientMeterProvider).clientMeter.enabled.Store(true)
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	cm.EXPECT().ChangeInvisibleDuration(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.ChangeInvisibleDurationResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil)
+	dpq.eraseMessage(&MessageView{messageId: "flapping", topic: "test-topic", endpoints: fakeEndpoints()}, FAILURE)
+
+	rows, err := view.RetrieveData(ConsumeNackedMessagesView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key == consumerGroupTag && tag.Value == "nack-group" {
+				count += row.Data.(*view.CountData).Value
+			}
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected 1 nacked message to be recorded, got %d", count)
+	}
+}
+
+func TestDefaultProcessQueue_deadLetterPredicate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	errInvalid := errors.New("invalid message")
+	listener := &FuncErrorMessageListener{Consume: func(_ context.Context, mv *MessageView) error {
+		if mv.GetMessageId() == "invalid" {
+			return errInvalid
+		}
+		return errors.New("downstream unavailable")
+	}}
+	var attempts []int
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(listener),
+		WithDeadLetterPredicate(func(_ *MessageView, attempt int, err error) bool {
+			attempts = append(attempts, attempt)
+			return errors.Is(err, errInvalid)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	cm.EXPECT().ForwardMessageToDeadLetterQueue(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.ForwardMessageToDeadLetterQueueResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil)
+	mv := &MessageView{messageId: "invalid", topic: "test-topic", endpoints: fakeEndpoints(), deliveryAttempt: 1}
+	dpq.eraseMessage(mv, listener.consume(context.TODO(), mv))
+
+	cm.EXPECT().ChangeInvisibleDuration(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.ChangeInvisibleDurationResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil)
+	mv = &MessageView{messageId: "transient", topic: "test-topic", endpoints: fakeEndpoints(), deliveryAttempt: 2}
+	dpq.eraseMessage(mv, listener.consume(context.TODO(), mv))
+
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("expected predicate to be consulted with delivery attempts, got %v", attempts)
+	}
+}
+
+func TestFifoConsumeService_orderedRetry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	var lock sync.Mutex
+	var consumed []string
+	listener := &FuncRetryAfterMessageListener{Consume: func(_ context.Context, mv *MessageView) (ConsumerResult, time.Duration) {
+		lock.Lock()
+		defer lock.Unlock()
+		consumed = append(consumed, mv.GetMessageId())
+		if mv.GetMessageId() == "flapping" && mv.GetDeliveryAttempt() == 1 {
+			return FAILURE, 50 * time.Millisecond
+		}
+		return SUCCESS, 0
+	}}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(listener),
+		WithOrderedRetry(true),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	fcs := NewFiFoConsumeService(pc.cli.clientID, listener, NewSimpleThreadPool("test", 8, 2), pc.cli, false)
+	fcs.orderedRetry = pc.pcOpts.orderedRetry
+	pc.consumerService = fcs
+	dpq := &defaultProcessQueue{consumer: pc, mq: &v2.MessageQueue{}}
+
+	acked := make(chan struct{}, 2)
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(context.Context, *v2.Endpoints, *v2.AckMessageRequest, time.Duration) (*v2.AckMessageResponse, error) {
+			acked <- struct{}{}
+			return &v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil
+		}).Times(2)
+	fcs.consume(dpq, []*MessageView{
+		{messageId: "flapping", topic: "test-topic", endpoints: fakeEndpoints(), deliveryAttempt: 1, messageQueue: &v2.MessageQueue{}},
+		{messageId: "next", topic: "test-topic", endpoints: fakeEndpoints(), deliveryAttempt: 1, messageQueue: &v2.MessageQueue{}},
+	})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-acked:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected messages to be acked")
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if strings.Join(consumed, ",") != "flapping,flapping,next" {
+		t.Errorf("expected failed message to be redelivered before the next one, got %v", consumed)
+	}
+}
+
+func TestStandardConsumeService_consumeTimeout(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "timeout-group"}
+	released := make(chan struct{})
+	defer close(released)
+	listener := &FuncErrorMessageListener{Consume: func(ctx context.Context, mv *MessageView) error {
+		if mv.GetMessageId() == "stuck" {
+			<-ctx.Done()
+			<-released
+		}
+		return nil
+	}}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(listener),
+		WithConsumeTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	pc.cli.clientMeterProvider.(*defaultClientMeterProvider).clientMeter.enabled.Store(true)
+	scs := NewStandardConsumeService(pc.cli.clientID, listener, NewSimpleThreadPool("test", 8, 1), pc.cli)
+	scs.consumeTimeout = pc.pcOpts.consumeTimeout
+	scs.onConsumeTimeout = pc.recordConsumeTimeout
+
+	results := make(chan ConsumerResult, 2)
+	stuck := &MessageView{messageId: "stuck", topic: "test-topic", messageQueue: &v2.MessageQueue{}}
+	scs.consumeImmediately(stuck, func(result ConsumerResult, _ error) { results <- result })
+	// the only worker is freed for the next message.
+	scs.consumeImmediately(&MessageView{messageId: "next", topic: "test-topic", messageQueue: &v2.MessageQueue{}},
+		func(result ConsumerResult, _ error) { results <- result })
+	for _, expected := range []ConsumerResult{FAILURE, SUCCESS} {
+		select {
+		case result := <-results:
+			if result != expected {
+				t.Errorf("expected result %v, got %v", expected, result)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected consumption to finish")
+		}
+	}
+	var timeoutErr *ErrConsumeTimeout
+	if !errors.As(stuck.consumeErr, &timeoutErr) {
+		t.Errorf("expected consume error to be ErrConsumeTimeout, got %v", stuck.consumeErr)
+	}
+
+	rows, err := view.RetrieveData(ConsumeTimeoutsView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key == consumerGroupTag && tag.Value == "timeout-group" {
+				count += row.Data.(*view.CountData).Value
+			}
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected 1 consume timeout to be recorded, got %d", count)
+	}
+}
+
+func TestFifoConsumeService_consumeTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	released := make(chan struct{})
+	invoked := make(chan int32, 2)
+	var running atomic.Int32
+	listener := &FuncErrorMessageListener{Consume: func(ctx context.Context, mv *MessageView) error {
+		if running.Inc() > 1 {
+			t.Error("expected the message not to be consumed by two invocations at the same time")
+		}
+		defer running.Dec()
+		invoked <- mv.GetDeliveryAttempt()
+		if mv.GetDeliveryAttempt() == 1 {
+			<-ctx.Done()
+			<-released
+			return fmt.Errorf("abandoned")
+		}
+		return nil
+	}}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(listener),
+		WithConsumeTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	fcs := NewFiFoConsumeService(pc.cli.clientID, listener, NewSimpleThreadPool("test", 8, 2), pc.cli, false)
+	fcs.consumeTimeout = pc.pcOpts.consumeTimeout
+	fcs.goAsync = pc.cli.goAsync
+	pc.consumerService = fcs
+	dpq := &defaultProcessQueue{consumer: pc, mq: &v2.MessageQueue{}}
+
+	acked := make(chan struct{}, 1)
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(context.Context, *v2.Endpoints, *v2.AckMessageRequest, time.Duration) (*v2.AckMessageResponse, error) {
+			acked <- struct{}{}
+			return &v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil
+		}).Times(1)
+	mv := &MessageView{messageId: "stuck", topic: "test-topic", endpoints: fakeEndpoints(), deliveryAttempt: 1, messageQueue: &v2.MessageQueue{}}
+	fcs.consume(dpq, []*MessageView{mv})
+	if attempt := <-invoked; attempt != 1 {
+		t.Fatalf("expected the first attempt, got %d", attempt)
+	}
+	select {
+	case attempt := <-invoked:
+		t.Fatalf("expected no redelivery while the timed out invocation is running, got attempt %d", attempt)
+	case <-time.After(300 * time.Millisecond):
+	}
+	close(released)
+	select {
+	case attempt := <-invoked:
+		if attempt != 2 {
+			t.Errorf("expected the second attempt, got %d", attempt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the message to be redelivered once the timed out invocation returns")
+	}
+	select {
+	case <-acked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the message to be acked")
+	}
+}
+
+func TestStandardConsumeService_awaitingMessages(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	started := make(chan struct{})
+	released := make(chan struct{})
+	listener := &FuncMessageListener{Consume: func(mv *MessageView) ConsumerResult {
+		if mv.GetMessageId() == "busy" {
+			close(started)
+			<-released
+		}
+		return SUCCESS
+	}}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(listener),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	pc.cli.clientMeterProvider.(*defaultClientMeterProvider).clientMeter.enabled.Store(true)
+	scs := NewStandardConsumeService(pc.cli.clientID, listener, NewSimpleThreadPool("test", 8, 1), pc.cli)
+	scs.onAwaitingChange = pc.updateAwaitingMessages
+	awaiting := func() int64 {
+		rows, err := view.RetrieveData(ConsumeAwaitingMessagesView.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			for _, tag := range row.Tags {
+				if tag.Key == clientIdTag && tag.Value == pc.cli.clientID {
+					return int64(row.Data.(*view.LastValueData).Value)
+				}
+			}
+		}
+		return -1
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	scs.consumeImmediately(&MessageView{messageId: "busy", topic: "test-topic", messageQueue: &v2.MessageQueue{}}, func(ConsumerResult, error) { wg.Done() })
+	<-started
+	for _, id := range []string{"next-1", "next-2"} {
+		scs.consumeImmediately(&MessageView{messageId: id, topic: "test-topic", messageQueue: &v2.MessageQueue{}}, func(ConsumerResult, error) { wg.Done() })
+	}
+	if count := awaiting(); count != 2 {
+		t.Errorf("expected 2 messages waiting for the busy thread, got %d", count)
+	}
+	close(released)
+	wg.Wait()
+	if count := awaiting(); count != 0 {
+		t.Errorf("expected no message waiting once consumed, got %d", count)
+	}
+}
+
+func TestStandardConsumeService_drain(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	consumed := atomic.NewInt32(0)
+	listener := &FuncMessageListener{Consume: func(*MessageView) ConsumerResult {
+		consumed.Inc()
+		return SUCCESS
+	}}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(listener),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	ctrl := gomock.NewController(t)
+	pc.cli.clientManager = NewMockClientManager(ctrl)
+	scs := NewStandardConsumeService(pc.cli.clientID, listener, NewSimpleThreadPool("test", 8, 1), pc.cli)
+	scs.onDrain = pc.drainMessage
+	dpq := &defaultProcessQueue{consumer: pc, mqstr: "test-mq"}
+	pc.processQueueTable.Store(utils.MessageQueueStr("test-mq"), []interface{}{&v2.MessageQueue{}, dpq})
+
+	pc.draining.Store(true)
+	mvs := []*MessageView{
+		{messageId: "drained-1", topic: "test-topic", body: []byte("a"), messageQueue: &v2.MessageQueue{}},
+		{messageId: "drained-2", topic: "test-topic", body: []byte("b"), messageQueue: &v2.MessageQueue{}},
+	}
+	dpq.cacheMessages(mvs)
+	scs.consume(dpq, mvs)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pc.waitForCachedMessagesEvicted(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if consumed.Load() != 0 {
+		t.Errorf("expected drained messages not to be consumed, got %d consumed", consumed.Load())
+	}
+	if len(pc.drainedMessages) != 2 || !pc.drainedMessages[0].drained {
+		t.Errorf("expected 2 messages to be drained, got %v", pc.drainedMessages)
+	}
+}
+
+func TestDefaultPushConsumer_DrainAndCloseRespectsContext(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	listener := &FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(listener),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	ctrl := gomock.NewController(t)
+	cm := NewMockClientManager(ctrl)
+	cm.EXPECT().UnRegisterClient(gomock.Any()).AnyTimes()
+	cm.EXPECT().NotifyClientTermination(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	pc.cli.clientManager = cm
+	pc.cli.on.Store(true)
+	scs := NewStandardConsumeService(pc.cli.clientID, listener, NewSimpleThreadPool("test", 8, 1), pc.cli)
+	scs.ctx = pc.ctx
+	pc.consumerService = scs
+	// A receive request hangs for long polling.
+	pc.pcSettings.longPollingTimeout = time.Minute
+	pc.inflightRequestCountInterceptor.doBefore(MessageHookPoints_RECEIVE, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := pc.DrainAndClose(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the error of ctx, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected DrainAndClose to return once ctx is done, took %v", elapsed)
+	}
+	if pc.ctx.Err() == nil || pc.cli.isRunning() {
+		t.Error("expected the consumer to be closed anyway")
+	}
+}
+
+func TestDefaultProcessQueue_adaptReceptionBatchSize(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	pc.pcSettings.receiveBatchSize = 32
+	dpq := &defaultProcessQueue{consumer: pc, mqstr: "test-mq"}
+	pc.processQueueTable.Store(utils.MessageQueueStr("test-mq"), dpq)
+
+	if size := dpq.getReceptionBatchSize(); size != 32 {
+		t.Fatalf("expected configured batch size, got %d", size)
+	}
+	dpq.reduceReceptionBatchSize(dpq.getReceptionBatchSize())
+	dpq.reduceReceptionBatchSize(dpq.getReceptionBatchSize())
+	if size := dpq.getReceptionBatchSize(); size != 8 {
+		t.Errorf("expected batch size to be reduced to 8, got %d", size)
+	}
+	dpq.recoverReceptionBatchSize()
+	if size := dpq.getReceptionBatchSize(); size != 16 {
+		t.Errorf("expected batch size to be recovering to 16, got %d", size)
+	}
+	dpq.recoverReceptionBatchSize()
+	if size := dpq.getReceptionBatchSize(); size != 32 || dpq.receptionBatchSizeLimit.Load() != 0 {
+		t.Errorf("expected batch size to be recovered, got %d", size)
+	}
+	for i := 0; i < 10; i++ {
+		dpq.reduceReceptionBatchSize(dpq.getReceptionBatchSize())
+	}
+	if size := dpq.getReceptionBatchSize(); size != 1 {
+		t.Errorf("expected batch size to be at least 1, got %d", size)
+	}
+}
+
+func TestDefaultProcessQueue_maxInFlightBytes(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithMaxInFlightBytes(1024),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	dpq1 := &defaultProcessQueue{consumer: pc, mqstr: "test-mq-1"}
+	dpq2 := &defaultProcessQueue{consumer: pc, mqstr: "test-mq-2"}
+	pc.processQueueTable.Store(utils.MessageQueueStr("test-mq-1"), dpq1)
+	pc.processQueueTable.Store(utils.MessageQueueStr("test-mq-2"), dpq2)
+
+	mv := &MessageView{messageId: "huge", topic: "test-topic", body: make([]byte, 1024)}
+	dpq1.cacheMessages([]*MessageView{mv})
+	if !dpq2.isCacheFull() {
+		t.Error("expected receiving to be paused once in-flight bytes exceed the budget")
+	}
+	dpq1.evictCacheMessage(mv)
+	if dpq2.isCacheFull() {
+		t.Error("expected receiving to be resumed after in-flight messages are evicted")
+	}
+}
+
+func TestDefaultProcessQueue_retryAfter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	listener := &FuncRetryAfterMessageListener{Consume: func(_ context.Context, mv *MessageView) (ConsumerResult, time.Duration) {
+		switch mv.GetMessageId() {
+		case "rate-limited":
+			return FAILURE, time.Minute
+		case "too-late":
+			return FAILURE, 24 * time.Hour
+		default:
+			return SUCCESS, time.Minute
+		}
+	}}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(listener),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	for id, expected := range map[string]time.Duration{"rate-limited": time.Minute, "too-late": MaxRetryAfter} {
+		mv := &MessageView{messageId: id, topic: "test-topic", endpoints: fakeEndpoints()}
+		result := listener.consume(context.TODO(), mv)
+		cm.EXPECT().ChangeInvisibleDuration(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ *v2.Endpoints, req *v2.ChangeInvisibleDurationRequest, _ time.Duration) (*v2.ChangeInvisibleDurationResponse, error) {
+				if req.GetInvisibleDuration().AsDuration() != expected {
+					t.Errorf("unexpected invisible duration of %s, got %v", id, req.GetInvisibleDuration().AsDuration())
+				}
+				return &v2.ChangeInvisibleDurationResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil
+			})
+		dpq.eraseMessage(mv, result)
+	}
+
+	mv := &MessageView{messageId: "ok", topic: "test-topic"}
+	if listener.consume(context.TODO(), mv) != SUCCESS || mv.retryAfter != 0 {
+		t.Errorf("expected delay to be ignored for success, got %v", mv.retryAfter)
+	}
+}
+
+func TestDefaultPushConsumer_Subscriptions(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{
+			"topic-a": NewFilterExpression("TagA"),
+			"topic-b": NewFilterExpressionWithType("a > 1", SQL92),
+		}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	if err = pc.Unsubscribe("topic-a"); err != nil {
+		t.Fatal(err)
+	}
+	subscriptions := pc.Subscriptions()
+	if len(subscriptions) != 1 {
+		t.Fatalf("unexpected subscriptions %v", subscriptions)
+	}
+	fe := subscriptions["topic-b"]
+	if fe.GetExpression() != "a > 1" || fe.GetExpressionType() != SQL92 {
+		t.Errorf("unexpected filter expression %v", fe)
+	}
+	delete(subscriptions, "topic-b")
+	if len(pc.Subscriptions()) != 1 {
+		t.Error("expected subscriptions to be a copy")
+	}
+}
+
+func TestDefaultPushConsumer_duplicateAckGuard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithPushDuplicateAckGuard(2, false),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	newMessageView := func(receiptHandle string) *MessageView {
+		return &MessageView{messageId: receiptHandle, topic: "test-topic", endpoints: fakeEndpoints(), ReceiptHandle: receiptHandle}
+	}
+
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil).Times(4)
+	for _, receiptHandle := range []string{"a", "b", "c"} {
+		if err = pc.Ack(context.TODO(), newMessageView(receiptHandle)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var duplicateAck *ErrDuplicateAck
+	if err = pc.Ack(context.TODO(), newMessageView("c")); !errors.As(err, &duplicateAck) || duplicateAck.MessageID != "c" {
+		t.Errorf("expected duplicate ack to be short-circuited, got %v", err)
+	}
+	// The oldest receipt handle is evicted beyond the capacity.
+	if err = pc.Ack(context.TODO(), newMessageView("a")); err != nil {
+		t.Errorf("expected ack of evicted receipt handle to be sent, got %v", err)
+	}
+
+	pc.pcOpts.duplicateAckAsSuccess = true
+	if err = pc.Ack(context.TODO(), newMessageView("a")); err != nil {
+		t.Errorf("expected duplicate ack to succeed, got %v", err)
+	}
+}
+
+func TestDefaultProcessQueue_ackCallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	results := make(map[string]error)
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithAckCallback(func(msgId string, err error) { results[msgId] = err }),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil)
+	dpq.eraseMessage(&MessageView{messageId: "acked", topic: "test-topic", endpoints: fakeEndpoints()}, SUCCESS)
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_INVALID_RECEIPT_HANDLE}}, nil)
+	dpq.eraseMessage(&MessageView{messageId: "invalid", topic: "test-topic", endpoints: fakeEndpoints()}, SUCCESS)
+	cm.EXPECT().ChangeInvisibleDuration(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.ChangeInvisibleDurationResponse{Status: &v2.Status{Code: v2.Code_OK}}, nil)
+	dpq.eraseMessage(&MessageView{messageId: "nacked", topic: "test-topic", endpoints: fakeEndpoints()}, FAILURE)
+
+	for _, msgId := range []string{"acked", "nacked"} {
+		if err, ok := results[msgId]; !ok || err != nil {
+			t.Errorf("expected successful ack of %s to be reported, got %v", msgId, err)
+		}
+	}
+	if err, ok := results["invalid"]; !ok || err == nil {
+		t.Error("expected failed ack to be reported")
+	}
+}
+
+func TestDefaultProcessQueue_ackCallbackOnRejectedAck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	results := make(chan error, 4)
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithAckCallback(func(msgId string, err error) { results <- err }),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	cm := NewMockClientManager(ctrl)
+	pc.cli.clientManager = cm
+	dpq := &defaultProcessQueue{consumer: pc}
+
+	// The rejected ack is retried once more, then given up.
+	cm.EXPECT().AckMessage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&v2.AckMessageResponse{Status: &v2.Status{Code: v2.Code_INTERNAL_SERVER_ERROR}}, nil).Times(2)
+	mv := &MessageView{messageId: "rejected", topic: "test-topic", endpoints: fakeEndpoints()}
+	dpq.ackMessage0(mv, ACK_MESSAGE_MAX_ATTEMPTS-1, pc.wrapAckCallback(mv, func(error) {}))
+	select {
+	case err := <-results:
+		var rpcErr *ErrRpcStatus
+		if !errors.As(err, &rpcErr) || rpcErr.GetCode() != int32(v2.Code_INTERNAL_SERVER_ERROR) {
+			t.Errorf("expected the rejected ack to be reported with ErrRpcStatus, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the rejected ack to be reported")
+	}
+	select {
+	case err := <-results:
+		t.Errorf("expected the ack to be reported exactly once, got another result %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDefaultPushConsumer_brokerNameFilter(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	if !pc.isBrokerConsumed(&v2.Broker{Name: "broker-b"}) {
+		t.Error("expected every broker to be consumed without filter")
+	}
+	WithBrokerNameFilter(regexp.MustCompile("^broker-a-")).apply(&pc.pcOpts)
+	for name, expected := range map[string]bool{"broker-a-0": true, "broker-a-1": true, "broker-b-0": false} {
+		if pc.isBrokerConsumed(&v2.Broker{Name: name}) != expected {
+			t.Errorf("unexpected decision of broker %s, expected consumed=%v", name, expected)
+		}
+	}
+}
+
+func TestDefaultPushConsumer_maxAssignedQueues(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithMaxAssignedQueues(3),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	newMessageQueue := func(topic string, id int32) *v2.MessageQueue {
+		return &v2.MessageQueue{
+			Topic:  &v2.Resource{Name: topic, ResourceNamespace: "test-namespace"},
+			Id:     id,
+			Broker: &v2.Broker{Name: "test-broker", Endpoints: fakeEndpoints()},
+		}
+	}
+	other := newMessageQueue("other-topic", 0)
+	pc.createProcessQueue(utils.ParseMessageQueue2Str(other), other, NewFilterExpression("*"))
+	held := newMessageQueue("test-topic", 3)
+	pc.createProcessQueue(utils.ParseMessageQueue2Str(held), held, NewFilterExpression("*"))
+
+	latest := make(map[utils.MessageQueueStr]*v2.MessageQueue)
+	for id := int32(0); id < 4; id++ {
+		mq := newMessageQueue("test-topic", id)
+		latest[utils.ParseMessageQueue2Str(mq)] = mq
+	}
+	pc.declineExcessAssignments("test-topic", latest)
+	if len(latest) != 2 {
+		t.Fatalf("expected 2 queues to be kept besides the queue of other topic, got %v", latest)
+	}
+	if _, ok := latest[utils.ParseMessageQueue2Str(held)]; !ok {
+		t.Errorf("expected the held queue to be kept, got %v", latest)
+	}
+}
+
+func TestDefaultPushConsumer_stickyAssignment(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithAssignmentStrategy(AssignmentStrategy_STICKY),
+		WithAssignmentGracePeriod(time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	ctrl := gomock.NewController(t)
+	cm := NewMockClientManager(ctrl)
+	cm.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("unavailable")).AnyTimes()
+	pc.cli.clientManager = cm
+	newAssignment := func(id int32) *v2.Assignment {
+		return &v2.Assignment{MessageQueue: &v2.MessageQueue{
+			Topic:  &v2.Resource{Name: "test-topic", ResourceNamespace: "test-namespace"},
+			Id:     id,
+			Broker: &v2.Broker{Name: "test-broker", Endpoints: fakeEndpoints()},
+		}}
+	}
+	held := newAssignment(0)
+	heldStr := utils.ParseMessageQueue2Str(held.MessageQueue)
+	pc.syncProcessQueue("test-topic", &[]*v2.Assignment{held}, NewFilterExpression("*"))
+	if churn := pc.rebalanceChurnQuantity.Load(); churn != 1 {
+		t.Errorf("expected churn of the taken queue, got %d", churn)
+	}
+
+	pc.syncProcessQueue("test-topic", &[]*v2.Assignment{newAssignment(1)}, NewFilterExpression("*"))
+	if _, ok := pc.processQueueTable.Load(heldStr); !ok {
+		t.Error("expected the held queue to be kept within the grace period")
+	}
+	pc.syncProcessQueue("test-topic", &[]*v2.Assignment{held, newAssignment(1)}, NewFilterExpression("*"))
+	if _, ok := pc.unassignedSince.Load(heldStr); ok {
+		t.Error("expected the held queue to be assigned again")
+	}
+	if churn := pc.rebalanceChurnQuantity.Load(); churn != 2 {
+		t.Errorf("expected churn of the taken queues only, got %d", churn)
+	}
+
+	pc.syncProcessQueue("test-topic", &[]*v2.Assignment{newAssignment(1)}, NewFilterExpression("*"))
+	pc.unassignedSince.Store(heldStr, time.Now().Add(-time.Minute))
+	pc.syncProcessQueue("test-topic", &[]*v2.Assignment{newAssignment(1)}, NewFilterExpression("*"))
+	if _, ok := pc.processQueueTable.Load(heldStr); ok {
+		t.Error("expected the held queue to be dropped after the grace period")
+	}
+	if churn := pc.rebalanceChurnQuantity.Load(); churn != 3 {
+		t.Errorf("expected churn of the dropped queue, got %d", churn)
+	}
+}
+
+func TestDefaultPushConsumer_prefetchCount(t *testing.T) {
+	config := &Config{Endpoint: fakeAddress, NameSpace: "test-namespace", ConsumerGroup: "test-group"}
+	pc, err := newPushConsumer(config,
+		WithPushSubscriptionExpressions(map[string]*FilterExpression{"test-topic": NewFilterExpression("*")}),
+		WithPushMessageListener(&FuncMessageListener{Consume: func(*MessageView) ConsumerResult { return SUCCESS }}),
+		WithPushConsumptionThreadCount(4),
+	)
+	if err != nil {
+		t.Fatalf("failed to create push consumer: %v", err)
+	}
+	for id := int32(0); id < 2; id++ {
+		mq := &v2.MessageQueue{Topic: &v2.Resource{Name: "test-topic"}, Id: id, Broker: &v2.Broker{Name: "test-broker"}}
+		pc.createProcessQueue(utils.ParseMessageQueue2Str(mq), mq, NewFilterExpression("*"))
+	}
+	if threshold := pc.cacheMessageCountThresholdPerQueue(); threshold != 512 {
+		t.Errorf("expected threshold by the max cache message count, got %d", threshold)
+	}
+	WithPrefetchCount(8).apply(&pc.pcOpts)
+	// 4 messages being processed plus 8 prefetched ones are shared by 2 queues.
+	if threshold := pc.cacheMessageCountThresholdPerQueue(); threshold != 6 {
+		t.Errorf("expected threshold by the prefetch count, got %d", threshold)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+)
+
+// Receipt is the receipt of a message received by simple consumer, which is enough to ack the message without the
+// MessageView, e.g. from another process, see SimpleConsumer.AckReceipt.
+type Receipt struct {
+	Topic         string
+	MessageId     string
+	ReceiptHandle string
+	// Endpoints are of the broker which the message is received from, acks are sent to it.
+	Endpoints *v2.Endpoints
+	// InvisibleUntil is when the receipt handle expires by the clock of the client, which is a bit earlier than the
+	// one of brokers. After that, brokers deliver the message again with another receipt handle, and reject acks with
+	// this one by INVALID_RECEIPT_HANDLE.
+	InvisibleUntil time.Time
+}
+
+// Expired tells whether the receipt handle has expired at now.
+func (r *Receipt) Expired(now time.Time) bool {
+	return !now.Before(r.InvisibleUntil)
+}
+
+// ReceiptStore keeps the receipts of messages received by simple consumer but not acked yet, to ack them after the
+// messages are processed durably, even after a restart or by another process. Simple consumer saves the receipt of
+// each message it receives, replaces it once the invisible duration is changed, and removes it once the message is
+// acked or its receipt handle is rejected as invalid. The default one is a MemoryReceiptStore, use
+// WithSimpleReceiptStore to inject a durable one.
+//
+// Receipt handles expire with the invisible duration, so a message processed for longer than that must be extended by
+// ChangeInvisibleDuration in time, otherwise it is delivered again and the stale receipt can no longer be acked.
+type ReceiptStore interface {
+	// Save saves receipt, replacing the one of the same message id.
+	Save(ctx context.Context, receipt *Receipt) error
+	// Remove removes the receipt of messageId, which is not an error if absent.
+	Remove(ctx context.Context, messageId string) error
+	// Load returns all the receipts saved.
+	Load(ctx context.Context) ([]*Receipt, error)
+}
+
+// MemoryReceiptStore keeps receipts in memory, which does not survive a restart. It remembers up to capacity
+// receipts, the ones expiring soonest are forgotten beyond that, expired ones first.
+type MemoryReceiptStore struct {
+	capacity int
+
+	lock     sync.Mutex
+	receipts map[string]*receiptItem
+	// expiry orders the receipts by InvisibleUntil, the soonest at the top.
+	expiry receiptHeap
+}
+
+var _ = ReceiptStore(&MemoryReceiptStore{})
+
+type receiptItem struct {
+	receipt *Receipt
+	index   int
+}
+
+type receiptHeap []*receiptItem
+
+var _ = heap.Interface(&receiptHeap{})
+
+func (h receiptHeap) Len() int { return len(h) }
+
+func (h receiptHeap) Less(i, j int) bool {
+	return h[i].receipt.InvisibleUntil.Before(h[j].receipt.InvisibleUntil)
+}
+
+func (h receiptHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *receiptHeap) Push(x interface{}) {
+	item := x.(*receiptItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *receiptHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// NewMemoryReceiptStore returns a MemoryReceiptStore remembering up to capacity receipts, 1024 if capacity is not
+// positive.
+func NewMemoryReceiptStore(capacity int) *MemoryReceiptStore {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	return &MemoryReceiptStore{
+		capacity: capacity,
+		receipts: make(map[string]*receiptItem),
+	}
+}
+
+func (mrs *MemoryReceiptStore) Save(_ context.Context, receipt *Receipt) error {
+	mrs.lock.Lock()
+	defer mrs.lock.Unlock()
+	copied := *receipt
+	if item, ok := mrs.receipts[receipt.MessageId]; ok {
+		item.receipt = &copied
+		heap.Fix(&mrs.expiry, item.index)
+		return nil
+	}
+	item := &receiptItem{receipt: &copied}
+	heap.Push(&mrs.expiry, item)
+	mrs.receipts[receipt.MessageId] = item
+	for len(mrs.receipts) > mrs.capacity {
+		soonest := heap.Pop(&mrs.expiry).(*receiptItem)
+		delete(mrs.receipts, soonest.receipt.MessageId)
+	}
+	return nil
+}
+
+func (mrs *MemoryReceiptStore) Remove(_ context.Context, messageId string) error {
+	mrs.lock.Lock()
+	defer mrs.lock.Unlock()
+	if item, ok := mrs.receipts[messageId]; ok {
+		heap.Remove(&mrs.expiry, item.index)
+		delete(mrs.receipts, messageId)
+	}
+	return nil
+}
+
+// Load returns the receipts in the order of expiry.
+func (mrs *MemoryReceiptStore) Load(_ context.Context) ([]*Receipt, error) {
+	mrs.lock.Lock()
+	defer mrs.lock.Unlock()
+	receipts := make([]*Receipt, 0, len(mrs.expiry))
+	for _, item := range mrs.expiry {
+		copied := *item.receipt
+		receipts = append(receipts, &copied)
+	}
+	sort.Slice(receipts, func(i, j int) bool {
+		return receipts[i].InvisibleUntil.Before(receipts[j].InvisibleUntil)
+	})
+	return receipts, nil
+}
+
+func toReceipt(messageView *MessageView, invisibleUntil time.Time) *Receipt {
+	return &Receipt{
+		Topic:          messageView.GetTopic(),
+		MessageId:      messageView.GetMessageId(),
+		ReceiptHandle:  messageView.GetReceiptHandle(),
+		Endpoints:      messageView.endpoints,
+		InvisibleUntil: invisibleUntil,
+	}
+}
+
+func (sc *defaultSimpleConsumer) saveReceipts(ctx context.Context, messageViews []*MessageView, invisibleUntil time.Time) {
+	for _, messageView := range messageViews {
+		if err := sc.receiptStore.Save(ctx, toReceipt(messageView, invisibleUntil)); err != nil {
+			sc.cli.log.Errorf("failed to save receipt of message, messageId=%s, err=%v", messageView.GetMessageId(), err)
+		}
+	}
+}
+
+func (sc *defaultSimpleConsumer) removeReceipt(ctx context.Context, messageId string) {
+	if err := sc.receiptStore.Remove(ctx, messageId); err != nil {
+		sc.cli.log.Errorf("failed to remove receipt of message, messageId=%s, err=%v", messageId, err)
+	}
+}
+
+// RecoverReceipts implements SimpleConsumer
+func (sc *defaultSimpleConsumer) RecoverReceipts(ctx context.Context) ([]*Receipt, error) {
+	receipts, err := sc.receiptStore.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	recovered := make([]*Receipt, 0, len(receipts))
+	for _, receipt := range receipts {
+		if receipt.Expired(now) {
+			sc.cli.log.Infof("drop expired receipt of message, messageId=%s, invisibleUntil=%v", receipt.MessageId, receipt.InvisibleUntil)
+			sc.removeReceipt(ctx, receipt.MessageId)
+			continue
+		}
+		recovered = append(recovered, receipt)
+	}
+	return recovered, nil
+}
+
+// AckReceipt implements SimpleConsumer
+func (sc *defaultSimpleConsumer) AckReceipt(ctx context.Context, receipt *Receipt) error {
+	resp, err := sc.ack0(ctx, &MessageView{
+		messageId:     receipt.MessageId,
+		topic:         receipt.Topic,
+		endpoints:     receipt.Endpoints,
+		ReceiptHandle: receipt.ReceiptHandle,
+	})
+	if err != nil {
+		return err
+	}
+	if resp != nil && resp.GetStatus().GetCode() != v2.Code_OK {
+		return &ErrRpcStatus{
+			Code:    int32(resp.GetStatus().GetCode()),
+			Message: resp.GetStatus().GetMessage(),
+		}
+	}
+	return nil
+}
@@ -46,6 +46,9 @@ type RpcClient interface {
 	ChangeInvisibleDuration(ctx context.Context, request *v2.ChangeInvisibleDurationRequest) (*v2.ChangeInvisibleDurationResponse, error)
 	ForwardMessageToDeadLetterQueue(ctx context.Context, request *v2.ForwardMessageToDeadLetterQueueRequest) (*v2.ForwardMessageToDeadLetterQueueResponse, error)
 	SyncLiteSubscription(ctx context.Context, request *v2.SyncLiteSubscriptionRequest) (*v2.SyncLiteSubscriptionResponse, error)
+	QueryOffset(ctx context.Context, request *v2.QueryOffsetRequest) (*v2.QueryOffsetResponse, error)
+	UpdateOffset(ctx context.Context, request *v2.UpdateOffsetRequest) (*v2.UpdateOffsetResponse, error)
+	GetOffset(ctx context.Context, request *v2.GetOffsetRequest) (*v2.GetOffsetResponse, error)
 	idleDuration() time.Duration
 	GetTarget() string
 }
@@ -79,12 +82,13 @@ var NewRpcClient = func(target string, opts ...RpcClientOption) (RpcClient, erro
 	}
 	conn, err := rc.opts.clientConnFunc(target, rc.opts.connOptions...)
 	if err != nil {
+		sugarBaseLogger.Errorw("create grpc conn failed", logFieldEndpoints, target, logFieldErrorCode, errorCodeOf(err), logFieldError, err)
 		return nil, fmt.Errorf("create grpc conn failed, err=%w", err)
 	}
 	rc.conn = conn
 	rc.msc = v2.NewMessagingServiceClient(conn.Conn())
 	rc.activityNanoTime = time.Now()
-	sugarBaseLogger.Infof("create rpc client success, target=%v", target)
+	sugarBaseLogger.Infow("create rpc client success", logFieldEndpoints, target)
 	return rc, nil
 }
 
@@ -113,7 +117,7 @@ func (rc *rpcClient) QueryRoute(ctx context.Context, request *v2.QueryRouteReque
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.QueryRoute(ctx, request)
+	resp, err := rc.msc.QueryRoute(ctx, request, rc.opts.callOptions[RpcType_QUERY_ROUTE]...)
 	sugarBaseLogger.Debugf("queryRoute request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
@@ -122,7 +126,7 @@ func (rc *rpcClient) QueryAssignments(ctx context.Context, request *v2.QueryAssi
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.QueryAssignment(ctx, request)
+	resp, err := rc.msc.QueryAssignment(ctx, request, rc.opts.callOptions[RpcType_QUERY_ASSIGNMENT]...)
 	sugarBaseLogger.Debugf("queryAssignment request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
@@ -131,20 +135,20 @@ func (rc *rpcClient) SendMessage(ctx context.Context, request *v2.SendMessageReq
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.SendMessage(ctx, request)
+	resp, err := rc.msc.SendMessage(ctx, request, rc.opts.callOptions[RpcType_SEND_MESSAGE]...)
 	sugarBaseLogger.Debugf("sendMessage request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
 
 func (rc *rpcClient) Telemetry(ctx context.Context) (v2.MessagingService_TelemetryClient, error) {
-	return rc.msc.Telemetry(ctx)
+	return rc.msc.Telemetry(ctx, rc.opts.callOptions[RpcType_TELEMETRY]...)
 }
 
 func (rc *rpcClient) EndTransaction(ctx context.Context, request *v2.EndTransactionRequest) (*v2.EndTransactionResponse, error) {
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.EndTransaction(ctx, request)
+	resp, err := rc.msc.EndTransaction(ctx, request, rc.opts.callOptions[RpcType_END_TRANSACTION]...)
 	sugarBaseLogger.Debugf("endTransaction request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
@@ -153,7 +157,7 @@ func (rc *rpcClient) HeartBeat(ctx context.Context, request *v2.HeartbeatRequest
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.Heartbeat(ctx, request)
+	resp, err := rc.msc.Heartbeat(ctx, request, rc.opts.callOptions[RpcType_HEARTBEAT]...)
 	sugarBaseLogger.Debugf("heartBeat request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
@@ -162,7 +166,7 @@ func (rc *rpcClient) NotifyClientTermination(ctx context.Context, request *v2.No
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.NotifyClientTermination(ctx, request)
+	resp, err := rc.msc.NotifyClientTermination(ctx, request, rc.opts.callOptions[RpcType_NOTIFY_CLIENT_TERMINATION]...)
 	sugarBaseLogger.Debugf("notifyClientTermination request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
@@ -171,7 +175,7 @@ func (rc *rpcClient) ReceiveMessage(ctx context.Context, request *v2.ReceiveMess
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.ReceiveMessage(ctx, request)
+	resp, err := rc.msc.ReceiveMessage(ctx, request, rc.opts.callOptions[RpcType_RECEIVE_MESSAGE]...)
 	sugarBaseLogger.Debugf("receiveMessage request: %v, err: %v", request, err)
 	return resp, err
 }
@@ -180,7 +184,7 @@ func (rc *rpcClient) AckMessage(ctx context.Context, request *v2.AckMessageReque
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.AckMessage(ctx, request)
+	resp, err := rc.msc.AckMessage(ctx, request, rc.opts.callOptions[RpcType_ACK_MESSAGE]...)
 	sugarBaseLogger.Debugf("ackMessage request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
@@ -189,7 +193,7 @@ func (rc *rpcClient) ChangeInvisibleDuration(ctx context.Context, request *v2.Ch
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.ChangeInvisibleDuration(ctx, request)
+	resp, err := rc.msc.ChangeInvisibleDuration(ctx, request, rc.opts.callOptions[RpcType_CHANGE_INVISIBLE_DURATION]...)
 	sugarBaseLogger.Debugf("changeInvisibleDuration request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
@@ -198,7 +202,7 @@ func (rc *rpcClient) ForwardMessageToDeadLetterQueue(ctx context.Context, reques
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.ForwardMessageToDeadLetterQueue(ctx, request)
+	resp, err := rc.msc.ForwardMessageToDeadLetterQueue(ctx, request, rc.opts.callOptions[RpcType_FORWARD_MESSAGE_TO_DEAD_LETTER_QUEUE]...)
 	sugarBaseLogger.Debugf("forwardMessageToDeadLetterQueue request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
@@ -207,7 +211,34 @@ func (rc *rpcClient) SyncLiteSubscription(ctx context.Context, request *v2.SyncL
 	rc.mux.Lock()
 	rc.activityNanoTime = time.Now()
 	rc.mux.Unlock()
-	resp, err := rc.msc.SyncLiteSubscription(ctx, request)
+	resp, err := rc.msc.SyncLiteSubscription(ctx, request, rc.opts.callOptions[RpcType_SYNC_LITE_SUBSCRIPTION]...)
 	sugarBaseLogger.Debugf("SyncLiteSubscription request: %v, response: %v, err: %v", request, resp, err)
 	return resp, err
 }
+
+func (rc *rpcClient) QueryOffset(ctx context.Context, request *v2.QueryOffsetRequest) (*v2.QueryOffsetResponse, error) {
+	rc.mux.Lock()
+	rc.activityNanoTime = time.Now()
+	rc.mux.Unlock()
+	resp, err := rc.msc.QueryOffset(ctx, request, rc.opts.callOptions[RpcType_QUERY_OFFSET]...)
+	sugarBaseLogger.Debugf("queryOffset request: %v, response: %v, err: %v", request, resp, err)
+	return resp, err
+}
+
+func (rc *rpcClient) UpdateOffset(ctx context.Context, request *v2.UpdateOffsetRequest) (*v2.UpdateOffsetResponse, error) {
+	rc.mux.Lock()
+	rc.activityNanoTime = time.Now()
+	rc.mux.Unlock()
+	resp, err := rc.msc.UpdateOffset(ctx, request, rc.opts.callOptions[RpcType_UPDATE_OFFSET]...)
+	sugarBaseLogger.Debugf("updateOffset request: %v, response: %v, err: %v", request, resp, err)
+	return resp, err
+}
+
+func (rc *rpcClient) GetOffset(ctx context.Context, request *v2.GetOffsetRequest) (*v2.GetOffsetResponse, error) {
+	rc.mux.Lock()
+	rc.activityNanoTime = time.Now()
+	rc.mux.Unlock()
+	resp, err := rc.msc.GetOffset(ctx, request, rc.opts.callOptions[RpcType_GET_OFFSET]...)
+	sugarBaseLogger.Debugf("getOffset request: %v, response: %v, err: %v", request, resp, err)
+	return resp, err
+}
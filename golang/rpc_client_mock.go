@@ -169,6 +169,36 @@ func (mr *MockRpcClientMockRecorder) QueryAssignments(ctx, request interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryAssignments", reflect.TypeOf((*MockRpcClient)(nil).QueryAssignments), ctx, request)
 }
 
+// GetOffset mocks base method.
+func (m *MockRpcClient) GetOffset(ctx context.Context, request *v2.GetOffsetRequest) (*v2.GetOffsetResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOffset", ctx, request)
+	ret0, _ := ret[0].(*v2.GetOffsetResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOffset indicates an expected call of GetOffset.
+func (mr *MockRpcClientMockRecorder) GetOffset(ctx, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOffset", reflect.TypeOf((*MockRpcClient)(nil).GetOffset), ctx, request)
+}
+
+// QueryOffset mocks base method.
+func (m *MockRpcClient) QueryOffset(ctx context.Context, request *v2.QueryOffsetRequest) (*v2.QueryOffsetResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryOffset", ctx, request)
+	ret0, _ := ret[0].(*v2.QueryOffsetResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryOffset indicates an expected call of QueryOffset.
+func (mr *MockRpcClientMockRecorder) QueryOffset(ctx, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryOffset", reflect.TypeOf((*MockRpcClient)(nil).QueryOffset), ctx, request)
+}
+
 // QueryRoute mocks base method.
 func (m *MockRpcClient) QueryRoute(ctx context.Context, request *v2.QueryRouteRequest) (*v2.QueryRouteResponse, error) {
 	m.ctrl.T.Helper()
@@ -244,6 +274,21 @@ func (mr *MockRpcClientMockRecorder) Telemetry(ctx interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Telemetry", reflect.TypeOf((*MockRpcClient)(nil).Telemetry), ctx)
 }
 
+// UpdateOffset mocks base method.
+func (m *MockRpcClient) UpdateOffset(ctx context.Context, request *v2.UpdateOffsetRequest) (*v2.UpdateOffsetResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOffset", ctx, request)
+	ret0, _ := ret[0].(*v2.UpdateOffsetResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateOffset indicates an expected call of UpdateOffset.
+func (mr *MockRpcClientMockRecorder) UpdateOffset(ctx, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOffset", reflect.TypeOf((*MockRpcClient)(nil).UpdateOffset), ctx, request)
+}
+
 // idleDuration mocks base method.
 func (m *MockRpcClient) idleDuration() time.Duration {
 	m.ctrl.T.Helper()
@@ -19,6 +19,42 @@ package golang
 
 import (
 	"time"
+
+	"google.golang.org/grpc"
+)
+
+// RpcType is the type of RPCs issued by clients to brokers, see WithRpcCallOptions.
+type RpcType int32
+
+const (
+	// RpcType_QUERY_ROUTE queries the route of topics, issued by all clients.
+	RpcType_QUERY_ROUTE RpcType = iota
+	// RpcType_HEARTBEAT keeps clients alive on brokers, issued by all clients periodically.
+	RpcType_HEARTBEAT
+	// RpcType_TELEMETRY opens the bidirectional stream syncing settings and commands, issued by all clients.
+	RpcType_TELEMETRY
+	// RpcType_NOTIFY_CLIENT_TERMINATION is issued by all clients on shutdown.
+	RpcType_NOTIFY_CLIENT_TERMINATION
+	// RpcType_SEND_MESSAGE is issued by producers.
+	RpcType_SEND_MESSAGE
+	// RpcType_END_TRANSACTION commits or rolls back transactional messages, issued by producers.
+	RpcType_END_TRANSACTION
+	// RpcType_QUERY_ASSIGNMENT queries the message queues assigned to push consumers.
+	RpcType_QUERY_ASSIGNMENT
+	// RpcType_RECEIVE_MESSAGE opens the server stream of received messages, issued by consumers.
+	RpcType_RECEIVE_MESSAGE
+	// RpcType_ACK_MESSAGE is issued by consumers.
+	RpcType_ACK_MESSAGE
+	// RpcType_CHANGE_INVISIBLE_DURATION is issued by consumers, including the nack of push consumers.
+	RpcType_CHANGE_INVISIBLE_DURATION
+	// RpcType_FORWARD_MESSAGE_TO_DEAD_LETTER_QUEUE is issued by push consumers.
+	RpcType_FORWARD_MESSAGE_TO_DEAD_LETTER_QUEUE
+	// RpcType_SYNC_LITE_SUBSCRIPTION is issued by lite push consumers.
+	RpcType_SYNC_LITE_SUBSCRIPTION
+	// RpcType_QUERY_OFFSET, RpcType_UPDATE_OFFSET and RpcType_GET_OFFSET manage the consume offsets of push consumers.
+	RpcType_QUERY_OFFSET
+	RpcType_UPDATE_OFFSET
+	RpcType_GET_OFFSET
 )
 
 type rpcClientOptions struct {
@@ -27,6 +63,7 @@ type rpcClientOptions struct {
 	timeout             time.Duration
 	clientConnFunc      ClientConnFunc
 	connOptions         []ConnOption
+	callOptions         map[RpcType][]grpc.CallOption
 }
 
 var defaultRpcClientOptions = rpcClientOptions{
@@ -95,3 +132,18 @@ func WithRpcClientTimeout(d time.Duration) RpcClientOption {
 		o.timeout = d
 	})
 }
+
+// WithRpcCallOptions returns a RpcClientOption that sets the grpc.CallOption applied to RPCs of each type, e.g.
+// grpc.WaitForReady for heartbeats or grpc.MaxCallRecvMsgSize for receives. Options of the same type set by
+// multiple calls are applied in order. Deadlines are not call options in gRPC, they are set by the request timeout
+// of clients and the long polling timeout of receives.
+func WithRpcCallOptions(opts map[RpcType][]grpc.CallOption) RpcClientOption {
+	return newFuncOption(func(o *rpcClientOptions) {
+		if o.callOptions == nil {
+			o.callOptions = make(map[RpcType][]grpc.CallOption)
+		}
+		for rpcType, callOptions := range opts {
+			o.callOptions[rpcType] = append(o.callOptions[rpcType], callOptions...)
+		}
+	})
+}
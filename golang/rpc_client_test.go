@@ -0,0 +1,62 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"testing"
+
+	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+	"google.golang.org/grpc"
+)
+
+type callOptionsRecorder struct {
+	v2.MessagingServiceClient
+	heartbeatOpts []grpc.CallOption
+	sendOpts      []grpc.CallOption
+}
+
+func (r *callOptionsRecorder) Heartbeat(_ context.Context, _ *v2.HeartbeatRequest, opts ...grpc.CallOption) (*v2.HeartbeatResponse, error) {
+	r.heartbeatOpts = opts
+	return &v2.HeartbeatResponse{}, nil
+}
+
+func (r *callOptionsRecorder) SendMessage(_ context.Context, _ *v2.SendMessageRequest, opts ...grpc.CallOption) (*v2.SendMessageResponse, error) {
+	r.sendOpts = opts
+	return &v2.SendMessageResponse{}, nil
+}
+
+func TestRpcClientCallOptions(t *testing.T) {
+	recorder := &callOptionsRecorder{}
+	rc := &rpcClient{opts: defaultRpcClientOptions, msc: recorder}
+	WithRpcCallOptions(map[RpcType][]grpc.CallOption{RpcType_HEARTBEAT: {grpc.WaitForReady(true)}}).apply(&rc.opts)
+	WithRpcCallOptions(map[RpcType][]grpc.CallOption{RpcType_HEARTBEAT: {grpc.MaxCallRecvMsgSize(1024)}}).apply(&rc.opts)
+
+	if _, err := rc.HeartBeat(context.TODO(), &v2.HeartbeatRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.heartbeatOpts) != 2 {
+		t.Errorf("expected 2 call options of heartbeat, got %d", len(recorder.heartbeatOpts))
+	}
+	if _, err := rc.SendMessage(context.TODO(), &v2.SendMessageRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.sendOpts) != 0 {
+		t.Errorf("expected no call option of send, got %d", len(recorder.sendOpts))
+	}
+}
@@ -0,0 +1,189 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RpcInfo describes a completed RPC to brokers.
+type RpcInfo struct {
+	// Method is the full gRPC method name, e.g. "/apache.rocketmq.v2.MessagingService/SendMessage".
+	Method string
+	// Target is the address of the connection.
+	Target string
+	// Duration is the latency of a unary RPC, or the lifetime of a streaming RPC until it ends.
+	Duration time.Duration
+	Code     codes.Code
+	Err      error
+}
+
+// RpcInterceptor is invoked once every RPC to brokers completes, including route, send, receive, heartbeat and
+// telemetry calls. It runs on the calling goroutine and must not block.
+type RpcInterceptor func(ctx context.Context, info *RpcInfo)
+
+func rpcInterceptorsUnaryClientInterceptor(interceptors []RpcInterceptor) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		invokeRpcInterceptors(ctx, interceptors, &RpcInfo{
+			Method:   method,
+			Target:   cc.Target(),
+			Duration: time.Since(start),
+			Code:     status.Code(err),
+			Err:      err,
+		})
+		return err
+	}
+}
+
+func rpcInterceptorsStreamClientInterceptor(interceptors []RpcInterceptor) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			invokeRpcInterceptors(ctx, interceptors, &RpcInfo{
+				Method:   method,
+				Target:   cc.Target(),
+				Duration: time.Since(start),
+				Code:     status.Code(err),
+				Err:      err,
+			})
+			return nil, err
+		}
+		return &interceptedClientStream{
+			ClientStream: cs,
+			ctx:          ctx,
+			interceptors: interceptors,
+			method:       method,
+			target:       cc.Target(),
+			start:        start,
+		}, nil
+	}
+}
+
+// interceptedClientStream invokes the interceptors once the stream ends.
+type interceptedClientStream struct {
+	grpc.ClientStream
+	ctx          context.Context
+	interceptors []RpcInterceptor
+	method       string
+	target       string
+	start        time.Time
+	once         sync.Once
+}
+
+func (ics *interceptedClientStream) RecvMsg(m interface{}) error {
+	err := ics.ClientStream.RecvMsg(m)
+	if err != nil {
+		ics.finish(err)
+	}
+	return err
+}
+
+func (ics *interceptedClientStream) finish(err error) {
+	ics.once.Do(func() {
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		invokeRpcInterceptors(ics.ctx, ics.interceptors, &RpcInfo{
+			Method:   ics.method,
+			Target:   ics.target,
+			Duration: time.Since(ics.start),
+			Code:     status.Code(err),
+			Err:      err,
+		})
+	})
+}
+
+func invokeRpcInterceptors(ctx context.Context, interceptors []RpcInterceptor, info *RpcInfo) {
+	for _, interceptor := range interceptors {
+		interceptor(ctx, info)
+	}
+}
+
+// traceUnaryClientInterceptor starts an OpenCensus span around every unary RPC to brokers, see WithRpcTracing.
+func traceUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := startRpcSpan(ctx, method, cc)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		endRpcSpan(span, err)
+		return err
+	}
+}
+
+// traceStreamClientInterceptor starts an OpenCensus span around every streaming RPC to brokers, which ends once the
+// stream ends, see WithRpcTracing.
+func traceStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startRpcSpan(ctx, method, cc)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			endRpcSpan(span, err)
+			return nil, err
+		}
+		return &tracedClientStream{ClientStream: cs, span: span}, nil
+	}
+}
+
+func startRpcSpan(ctx context.Context, method string, cc *grpc.ClientConn) (context.Context, *trace.Span) {
+	ctx, span := trace.StartSpan(ctx, method, trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(
+		trace.StringAttribute(SPAN_ATTRIBUTE_KEY_MESSAGING_SYSTEM, SPAN_ATTRIBUTE_VALUE_ROCKETMQ_MESSAGING_SYSTEM),
+		trace.StringAttribute(SPAN_ATTRIBUTE_KEY_MESSAGING_PROTOCOL, SPAN_ATTRIBUTE_VALUE_MESSAGING_PROTOCOL),
+		trace.StringAttribute(SPAN_ATTRIBUTE_KEY_MESSAGING_URL, cc.Target()),
+	)
+	return ctx, span
+}
+
+func endRpcSpan(span *trace.Span, err error) {
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	// Codes of OpenCensus are the same as gRPC.
+	if s := status.Convert(err); s.Code() != codes.OK {
+		span.SetStatus(trace.Status{Code: int32(s.Code()), Message: s.Message()})
+	}
+	span.End()
+}
+
+// tracedClientStream ends the span once the stream ends.
+type tracedClientStream struct {
+	grpc.ClientStream
+	span *trace.Span
+	once sync.Once
+}
+
+func (tcs *tracedClientStream) RecvMsg(m interface{}) error {
+	err := tcs.ClientStream.RecvMsg(m)
+	if err != nil {
+		tcs.once.Do(func() {
+			endRpcSpan(tcs.span, err)
+		})
+	}
+	return err
+}
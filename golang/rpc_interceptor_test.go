@@ -0,0 +1,134 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	errs []error
+}
+
+func (fcs *fakeClientStream) RecvMsg(m interface{}) error {
+	err := fcs.errs[0]
+	fcs.errs = fcs.errs[1:]
+	return err
+}
+
+func TestRpcInterceptor(t *testing.T) {
+	cc, err := grpc.Dial(fakeAddress, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	var infos []*RpcInfo
+	interceptors := []RpcInterceptor{func(ctx context.Context, info *RpcInfo) { infos = append(infos, info) }}
+
+	unary := rpcInterceptorsUnaryClientInterceptor(interceptors)
+	errUnavailable := status.Error(codes.Unavailable, "unavailable")
+	err = unary(context.TODO(), "/test/Unary", nil, nil, cc, func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+		return errUnavailable
+	})
+	if err != errUnavailable || len(infos) != 1 || infos[0].Method != "/test/Unary" || infos[0].Code != codes.Unavailable || infos[0].Target != fakeAddress {
+		t.Fatalf("unexpected info of unary rpc, infos=%v, err=%v", infos, err)
+	}
+
+	stream := rpcInterceptorsStreamClientInterceptor(interceptors)
+	cs, err := stream(context.TODO(), &grpc.StreamDesc{ServerStreams: true}, cc, "/test/Stream", func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{errs: []error{nil, io.EOF, io.EOF}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cs.RecvMsg(nil) == nil {
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected info of stream rpc once it ends, infos=%v", infos)
+	}
+	_ = cs.RecvMsg(nil)
+	if len(infos) != 2 || infos[1].Method != "/test/Stream" || infos[1].Code != codes.OK || infos[1].Err != nil {
+		t.Errorf("unexpected info of stream rpc, infos=%v", infos)
+	}
+
+	errRefused := errors.New("refused")
+	if _, err = stream(context.TODO(), &grpc.StreamDesc{}, cc, "/test/Stream", func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, errRefused
+	}); err != errRefused || len(infos) != 3 || infos[2].Err != errRefused {
+		t.Errorf("expected failure of opening stream to be intercepted, infos=%v, err=%v", infos, err)
+	}
+}
+
+type fakeSpanExporter struct {
+	spans []*trace.SpanData
+}
+
+func (fse *fakeSpanExporter) ExportSpan(s *trace.SpanData) {
+	fse.spans = append(fse.spans, s)
+}
+
+func TestRpcTracing(t *testing.T) {
+	cc, err := grpc.Dial(fakeAddress, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	exporter := &fakeSpanExporter{}
+	trace.RegisterExporter(exporter)
+	defer trace.UnregisterExporter(exporter)
+	// Children of a sampled span are sampled.
+	ctx, parent := trace.StartSpan(context.TODO(), "parent", trace.WithSampler(trace.AlwaysSample()))
+	defer parent.End()
+
+	unary := traceUnaryClientInterceptor()
+	err = unary(ctx, "/test/Unary", nil, nil, cc, func(ctx context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		if span := trace.FromContext(ctx); span == nil || span.SpanContext().TraceID != parent.SpanContext().TraceID {
+			t.Error("expected span of rpc in the context of invoker")
+		}
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	if len(exporter.spans) != 1 || exporter.spans[0].Name != "/test/Unary" || exporter.spans[0].Code != int32(codes.Unavailable) ||
+		exporter.spans[0].ParentSpanID != parent.SpanContext().SpanID || exporter.spans[0].Attributes[SPAN_ATTRIBUTE_KEY_MESSAGING_URL] != fakeAddress {
+		t.Fatalf("unexpected span of unary rpc, spans=%v, err=%v", exporter.spans, err)
+	}
+
+	stream := traceStreamClientInterceptor()
+	cs, err := stream(ctx, &grpc.StreamDesc{ServerStreams: true}, cc, "/test/Stream", func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{errs: []error{nil, io.EOF, io.EOF}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.RecvMsg(nil) != nil || len(exporter.spans) != 1 {
+		t.Fatalf("expected span of stream rpc to end once the stream ends, spans=%v", exporter.spans)
+	}
+	_ = cs.RecvMsg(nil)
+	_ = cs.RecvMsg(nil)
+	if len(exporter.spans) != 2 || exporter.spans[1].Name != "/test/Stream" || exporter.spans[1].Code != int32(codes.OK) {
+		t.Errorf("unexpected span of stream rpc, spans=%v", exporter.spans)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"sync"
+
+	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
+)
+
+// SendSession pins the message queue of each topic for the sends of a logical session, e.g. requests whose replies
+// are expected from the same broker, see Producer.SendWithSession. It is safe for concurrent use.
+type SendSession struct {
+	lock   sync.Mutex
+	queues map[string]*v2.MessageQueue
+}
+
+func NewSendSession() *SendSession {
+	return &SendSession{queues: make(map[string]*v2.MessageQueue)}
+}
+
+// GetMessageQueue returns the message queue pinned for topic, nil if no message of topic is sent in the session.
+func (s *SendSession) GetMessageQueue(topic string) *v2.MessageQueue {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.queues[topic]
+}
+
+func (s *SendSession) pin(topic string, mq *v2.MessageQueue) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queues[topic] = mq
+}
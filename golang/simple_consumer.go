@@ -40,10 +40,19 @@ type SimpleConsumer interface {
 
 	Subscribe(topic string, filterExpression *FilterExpression) error
 	Unsubscribe(topic string) error
+	Subscriptions() map[string]FilterExpression
 	Ack(ctx context.Context, messageView *MessageView) error
 	Receive(ctx context.Context, maxMessageNum int32, invisibleDuration time.Duration) ([]*MessageView, error)
 	ChangeInvisibleDuration(messageView *MessageView, invisibleDuration time.Duration) error
 	ChangeInvisibleDurationAsync(messageView *MessageView, invisibleDuration time.Duration)
+	Inspect() ClientState
+	CheckCompatibility(ctx context.Context) (CompatInfo, error)
+	// RecoverReceipts returns the receipts in the ReceiptStore whose receipt handles have not expired, expired ones
+	// are removed from the store.
+	RecoverReceipts(ctx context.Context) ([]*Receipt, error)
+	// AckReceipt acks the message of receipt, e.g. one returned by RecoverReceipts. It returns ErrRpcStatus if the
+	// ack is rejected, the receipt is removed from the ReceiptStore anyway if its receipt handle is invalid.
+	AckReceipt(ctx context.Context, receipt *Receipt) error
 }
 
 var _ = SimpleConsumer(&defaultSimpleConsumer{})
@@ -60,6 +69,10 @@ type defaultSimpleConsumer struct {
 	subscriptionExpressions      *map[string]*FilterExpression
 	subTopicRouteDataResultCache sync.Map
 	receiveRateLimiter           *receiveRateLimiter
+	// ackedReceiptHandles guards against duplicate acks, see WithSimpleDuplicateAckGuard.
+	ackedReceiptHandles *ackedReceiptHandles
+	// receiptStore keeps receipts of messages not acked yet, see WithSimpleReceiptStore.
+	receiptStore ReceiptStore
 }
 
 func (sc *defaultSimpleConsumer) SetRequestTimeout(timeout time.Duration) {
@@ -117,10 +130,14 @@ func (sc *defaultSimpleConsumer) changeInvisibleDuration(messageView *MessageVie
 	if messageView == nil {
 		return fmt.Errorf("changeInvisibleDuration failed, err = the message is nil")
 	}
+	invisibleUntil := time.Now().Add(invisibleDuration)
 	resp, err := sc.changeInvisibleDuration0(messageView, invisibleDuration)
 	if resp != nil {
 		messageView.ReceiptHandle = resp.ReceiptHandle
 	}
+	if err == nil {
+		sc.saveReceipts(context.Background(), []*MessageView{messageView}, invisibleUntil)
+	}
 	return err
 }
 
@@ -162,6 +179,34 @@ func (sc *defaultSimpleConsumer) Unsubscribe(topic string) error {
 	return nil
 }
 
+// Subscriptions returns a copy of the current subscriptions, including the changes made by Subscribe and Unsubscribe.
+func (sc *defaultSimpleConsumer) Subscriptions() map[string]FilterExpression {
+	sc.subscriptionExpressionsLock.RLock()
+	defer sc.subscriptionExpressionsLock.RUnlock()
+	subscriptions := make(map[string]FilterExpression, len(*sc.subscriptionExpressions))
+	for topic, filterExpression := range *sc.subscriptionExpressions {
+		subscriptions[topic] = *filterExpression
+	}
+	return subscriptions
+}
+
+// Inspect returns a snapshot of the internal state of the simple consumer.
+func (sc *defaultSimpleConsumer) Inspect() ClientState {
+	state := sc.cli.inspect()
+	state.Subscriptions = make(map[string]*FilterExpression)
+	sc.subscriptionExpressionsLock.RLock()
+	for topic, filterExpression := range *sc.subscriptionExpressions {
+		state.Subscriptions[topic] = filterExpression
+	}
+	sc.subscriptionExpressionsLock.RUnlock()
+	return state
+}
+
+// CheckCompatibility checks whether brokers implement the protocol of the simple consumer, and the features they support.
+func (sc *defaultSimpleConsumer) CheckCompatibility(ctx context.Context) (CompatInfo, error) {
+	return sc.cli.checkCompatibility(ctx)
+}
+
 func (sc *defaultSimpleConsumer) wrapReceiveMessageRequest(batchSize int, messageQueue *v2.MessageQueue, filterExpression *FilterExpression, invisibleDuration time.Duration) *v2.ReceiveMessageRequest {
 	var filterType v2.FilterType
 	switch filterExpression.expressionType {
@@ -271,8 +316,10 @@ func (sc *defaultSimpleConsumer) receiveMessage(ctx context.Context, request *v2
 		}
 		for _, message := range messageList {
 			messageView := fromProtobuf_MessageView2(message, messageQueue, deliveryTimestamp)
+			decryptMessageView(messageView, sc.scOpts.decryptor)
 			messageViewList = append(messageViewList, messageView)
 		}
+		sc.cli.observeReceiveStatus(request, status.GetCode())
 		if status.GetCode() == v2.Code_OK {
 			return messageViewList, nil
 		} else {
@@ -315,7 +362,12 @@ func (sc *defaultSimpleConsumer) Receive(ctx context.Context, maxMessageNum int3
 	if err != nil {
 		return nil, err
 	}
-	selectMessageQueue, err := subLoadBalancer.TakeMessageQueue()
+	var selectMessageQueue *v2.MessageQueue
+	if sc.scOpts.brokerRegionResolver != nil {
+		selectMessageQueue, err = subLoadBalancer.TakeMessageQueueByPreference(sc.isInPreferredBrokerRegion)
+	} else {
+		selectMessageQueue, err = subLoadBalancer.TakeMessageQueue()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -328,7 +380,13 @@ func (sc *defaultSimpleConsumer) Receive(ctx context.Context, maxMessageNum int3
 
 	request := sc.wrapReceiveMessageRequest(int(maxMessageNum), selectMessageQueue, filterExpression, invisibleDuration)
 	timeout := sc.scOpts.awaitDuration + sc.cli.opts.timeout
-	return sc.receiveMessage(ctx, request, selectMessageQueue, timeout)
+	invisibleUntil := time.Now().Add(invisibleDuration)
+	messageViews, err := sc.receiveMessage(ctx, request, selectMessageQueue, timeout)
+	if err != nil {
+		return nil, err
+	}
+	sc.saveReceipts(ctx, messageViews, invisibleUntil)
+	return messageViews, nil
 }
 
 func (sc *defaultSimpleConsumer) isClient() {
@@ -374,16 +432,18 @@ var NewSimpleConsumer = func(config *Config, opts ...SimpleConsumerOption) (Simp
 		awaitDuration:           scOpts.awaitDuration,
 		subscriptionExpressions: &scOpts.subscriptionExpressions,
 		receiveRateLimiter:      newReceiveRateLimiter(scOpts.maxReceiveConcurrency),
+		ackedReceiptHandles:     newAckedReceiptHandles(scOpts.ackedReceiptHandleCapacity),
+		receiptStore:            scOpts.receiptStore,
+	}
+	if sc.receiptStore == nil {
+		sc.receiptStore = NewMemoryReceiptStore(0)
 	}
 
 	sc.cli.initTopics = make([]string, 0)
 	for topic := range scOpts.subscriptionExpressions {
 		sc.cli.initTopics = append(sc.cli.initTopics, topic)
 	}
-	endpoints, err := utils.ParseTarget(config.Endpoint)
-	if err != nil {
-		return nil, err
-	}
+	endpoints := sc.cli.getAccessPoint()
 	sc.scSettings = &simpleConsumerSettings{
 		clientId:       sc.cli.GetClientID(),
 		endpoints:      endpoints,
@@ -418,6 +478,10 @@ func (sc *defaultSimpleConsumer) GracefulStop() error {
 	return sc.cli.GracefulStop()
 }
 
+func (sc *defaultSimpleConsumer) isInPreferredBrokerRegion(mq *v2.MessageQueue) bool {
+	return sc.scOpts.brokerRegionResolver(mq.GetBroker()) == sc.scOpts.preferredBrokerRegion
+}
+
 func (sc *defaultSimpleConsumer) getSubscriptionTopicRouteResult(ctx context.Context, topic string) (SubscriptionLoadBalancer, error) {
 	item, ok := sc.subTopicRouteDataResultCache.Load(topic)
 	if ok {
@@ -439,8 +503,21 @@ func (sc *defaultSimpleConsumer) getSubscriptionTopicRouteResult(ctx context.Con
 
 // Ack implements SimpleConsumer
 func (sc *defaultSimpleConsumer) Ack(ctx context.Context, messageView *MessageView) error {
+	_, err := sc.ack0(ctx, messageView)
+	return err
+}
+
+// ack0 returns nil response if the duplicate ack is skipped as success.
+func (sc *defaultSimpleConsumer) ack0(ctx context.Context, messageView *MessageView) (*v2.AckMessageResponse, error) {
 	if !sc.isOn() {
-		return fmt.Errorf("simple consumer is not running")
+		return nil, fmt.Errorf("simple consumer is not running")
+	}
+	if sc.ackedReceiptHandles.contains(messageView.GetReceiptHandle()) {
+		sc.cli.log.Debugf("Skip duplicate ack of message, messageId=%s", messageView.GetMessageId())
+		if sc.scOpts.duplicateAckAsSuccess {
+			return nil, nil
+		}
+		return nil, &ErrDuplicateAck{MessageID: messageView.GetMessageId()}
 	}
 	endpoints := messageView.endpoints
 	watchTime := time.Now()
@@ -453,13 +530,19 @@ func (sc *defaultSimpleConsumer) Ack(ctx context.Context, messageView *MessageVi
 	duration := time.Since(watchTime)
 	if err != nil {
 		sc.cli.doAfter(MessageHookPoints_ACK, messageCommons, duration, messageHookPointsStatus)
-		return err
+		return nil, err
 	}
 	if resp.GetStatus().GetCode() != v2.Code_OK {
 		messageHookPointsStatus = MessageHookPointsStatus_OK
+		if resp.GetStatus().GetCode() == v2.Code_INVALID_RECEIPT_HANDLE {
+			sc.removeReceipt(ctx, messageView.GetMessageId())
+		}
+	} else {
+		sc.ackedReceiptHandles.add(messageView.GetReceiptHandle())
+		sc.removeReceipt(ctx, messageView.GetMessageId())
 	}
 	sc.cli.doAfter(MessageHookPoints_ACK, messageCommons, duration, messageHookPointsStatus)
-	return nil
+	return resp, nil
 }
 
 func (sc *defaultSimpleConsumer) IsEndpointUpdated() bool {
@@ -30,6 +30,16 @@ type simpleConsumerOptions struct {
 	awaitDuration           time.Duration
 	clientFunc              NewClientFunc
 	maxReceiveConcurrency   int
+
+	preferredBrokerRegion string
+	brokerRegionResolver  func(broker *v2.Broker) string
+
+	ackedReceiptHandleCapacity int
+	duplicateAckAsSuccess      bool
+
+	decryptor Decryptor
+
+	receiptStore ReceiptStore
 }
 
 var defaultSimpleConsumerOptions = simpleConsumerOptions{
@@ -88,6 +98,42 @@ func WithSimpleReceiveRateLimit(maxConcurrency int) SimpleConsumerOption {
 	})
 }
 
+// WithPreferredBrokerRegion returns a SimpleConsumerOption that makes the consumer prefer message queues on brokers
+// of the region, which is resolved from each broker by the resolver. Message queues of other regions are received
+// from only if no queue of the region is available.
+func WithPreferredBrokerRegion(region string, resolver func(broker *v2.Broker) string) SimpleConsumerOption {
+	return newFuncSimpleConsumerOption(func(o *simpleConsumerOptions) {
+		o.preferredBrokerRegion = region
+		o.brokerRegionResolver = resolver
+	})
+}
+
+// WithSimpleDuplicateAckGuard returns a SimpleConsumerOption that sets the count of receipt handles acknowledged
+// recently which are remembered, a repeated ack of them is not sent to brokers but returns ErrDuplicateAck, or nil
+// if duplicateAckAsSuccess is true. Default is 0, which remembers nothing.
+func WithSimpleDuplicateAckGuard(capacity int, duplicateAckAsSuccess bool) SimpleConsumerOption {
+	return newFuncSimpleConsumerOption(func(o *simpleConsumerOptions) {
+		o.ackedReceiptHandleCapacity = capacity
+		o.duplicateAckAsSuccess = duplicateAckAsSuccess
+	})
+}
+
+// WithSimpleDecryptor returns a SimpleConsumerOption that sets the Decryptor of messages, see WithDecryptor.
+func WithSimpleDecryptor(decryptor Decryptor) SimpleConsumerOption {
+	return newFuncSimpleConsumerOption(func(o *simpleConsumerOptions) {
+		o.decryptor = decryptor
+	})
+}
+
+// WithSimpleReceiptStore returns a SimpleConsumerOption that sets the store of receipts of messages received but not
+// acked yet, e.g. a durable one to ack messages after a restart or from another process, see ReceiptStore. Default
+// is nil, which keeps receipts in a MemoryReceiptStore.
+func WithSimpleReceiptStore(store ReceiptStore) SimpleConsumerOption {
+	return newFuncSimpleConsumerOption(func(o *simpleConsumerOptions) {
+		o.receiptStore = store
+	})
+}
+
 var _ = ClientSettings(&simpleConsumerSettings{})
 
 type simpleConsumerSettings struct {
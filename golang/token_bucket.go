@@ -0,0 +1,92 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSendRateLimited = errors.New("rocketmq: send rate limit exceeded")
+)
+
+// tokenBucket refills rps tokens per second up to burst tokens, see WithSendRateLimit and WithConsumeRateLimit.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rps      float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	failFast bool
+}
+
+func newTokenBucket(rps, burst int, failFast bool) *tokenBucket {
+	if rps <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rps:      float64(rps),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+		failFast: failFast,
+	}
+}
+
+// acquire takes a token, it blocks until the token is available or returns ErrSendRateLimited at once in fail-fast
+// mode. throttled tells whether the caller was delayed or rejected by the limit.
+func (tb *tokenBucket) acquire(ctx context.Context) (throttled bool, err error) {
+	tb.mu.Lock()
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rps
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+	if tb.tokens >= 1 {
+		tb.tokens--
+		tb.mu.Unlock()
+		return false, nil
+	}
+	if tb.failFast {
+		tb.mu.Unlock()
+		return true, ErrSendRateLimited
+	}
+	// Reserve the token in advance, so that waiters are served in order.
+	wait := time.Duration((1 - tb.tokens) / tb.rps * float64(time.Second))
+	tb.tokens--
+	tb.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		tb.mu.Lock()
+		tb.tokens++
+		tb.mu.Unlock()
+		return true, ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package golang
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket_Burst(t *testing.T) {
+	assert.Nil(t, newTokenBucket(0, 10, false), "rate limit should be disabled")
+
+	limiter := newTokenBucket(10, 3, false)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		throttled, err := limiter.acquire(ctx)
+		assert.NoError(t, err)
+		assert.False(t, throttled, "sends within burst should not be throttled")
+	}
+	start := time.Now()
+	throttled, err := limiter.acquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, throttled, "send beyond burst should be throttled")
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond, "send beyond burst should wait for the refill")
+}
+
+func TestTokenBucket_FailFast(t *testing.T) {
+	limiter := newTokenBucket(1, 1, true)
+	ctx := context.Background()
+	_, err := limiter.acquire(ctx)
+	assert.NoError(t, err)
+	throttled, err := limiter.acquire(ctx)
+	assert.True(t, throttled)
+	assert.ErrorIs(t, err, ErrSendRateLimited)
+}
+
+func TestTokenBucket_ContextCanceled(t *testing.T) {
+	limiter := newTokenBucket(1, 1, false)
+	_, err := limiter.acquire(context.Background())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// The token reserved by the canceled send is given back.
+	assert.InDelta(t, 0, limiter.tokens, 0.1)
+}
@@ -35,6 +35,9 @@ const (
 	MAX_MESSAGE_NUM = 1
 )
 
+// TransactionChecker resolves orphaned transactions on the request of brokers. Check is called with the full
+// half message, including user properties, keys and the transaction id. Returning UNKNOWN leaves the transaction
+// unresolved, brokers would check it again later.
 type TransactionChecker struct {
 	Check func(msg *MessageView) TransactionResolution
 }
@@ -18,6 +18,8 @@
 package golang
 
 import (
+	"fmt"
+
 	"github.com/apache/rocketmq-clients/golang/v5/pkg/utils"
 	v2 "github.com/apache/rocketmq-clients/golang/v5/protocol/v2"
 )
@@ -42,3 +44,13 @@ func (ua *userAgent) toProtoBuf() *v2.UA {
 		Hostname: ua.hostName,
 	}
 }
+
+// format returns the user agent sent with every grpc connection, the application name is
+// appended after the library version if present.
+func (ua *userAgent) format(applicationName string) string {
+	s := fmt.Sprintf("rocketmq-client-go/%s (%s)", ua.version, ua.platform)
+	if len(applicationName) > 0 {
+		s += " " + applicationName
+	}
+	return s
+}